@@ -5,10 +5,14 @@ import (
 	"ctchen222/Tic-Tac-Toe/internal/api/controller"
 	apirepository "ctchen222/Tic-Tac-Toe/internal/api/repository"
 	"ctchen222/Tic-Tac-Toe/internal/api/service"
+	"ctchen222/Tic-Tac-Toe/internal/bot"
+	"ctchen222/Tic-Tac-Toe/internal/chat"
 	"ctchen222/Tic-Tac-Toe/internal/db"
 	"ctchen222/Tic-Tac-Toe/internal/hub"
 	"ctchen222/Tic-Tac-Toe/internal/logger"
+	"ctchen222/Tic-Tac-Toe/internal/player"
 	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"ctchen222/Tic-Tac-Toe/internal/room"
 	"ctchen222/Tic-Tac-Toe/internal/server"
 	"ctchen222/Tic-Tac-Toe/internal/telemetry"
 	"errors"
@@ -16,6 +20,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -57,21 +63,101 @@ func main() {
 	// Create repositories
 	gameRepo := repository.NewGameRepository(rdb)
 	playerRepo := repository.NewPlayerRepository(rdb)
-	matchmakingRepo := repository.NewMatchmakingRepository(rdb)
+	var matchmakingRepo repository.MatchmakingRepository
+	switch mode := os.Getenv("MATCHMAKING_MODE"); mode {
+	case "", repository.MatchmakingModeRated:
+		matchmakingRepo = repository.NewRatedMatchmakingRepository(rdb, repository.DefaultRatedMatchmakingConfig)
+	case repository.MatchmakingModeFIFO:
+		matchmakingRepo = repository.NewMatchmakingRepository(rdb)
+	default:
+		slog.Error("invalid MATCHMAKING_MODE", "mode", mode)
+		os.Exit(1)
+	}
+	inviteRepo := repository.NewInviteRepository(rdb)
 	userRepo := apirepository.NewUserRepository(DB)
+	ratingRepo := apirepository.NewRatingRepository(DB)
+	archiveRepo := apirepository.NewGameRepository(DB)
 
 	// Create services
-	userService := service.NewUserService(userRepo)
+	userService := service.NewUserService(userRepo, ratingRepo)
+	ratingService := service.NewRatingService(ratingRepo)
+	roomService := service.NewRoomService(inviteRepo)
+	gameService := service.NewGameService(archiveRepo)
 
 	// Create controllers
 	userController := controller.NewUserController(userService)
+	roomController := controller.NewRoomController(roomService, userService)
+	gameController := controller.NewGameController(gameService)
+
+	// Create the bot engine. BOT_SEED makes its searches reproducible.
+	botSeed := uint64(time.Now().UnixNano())
+	if raw := os.Getenv("BOT_SEED"); raw != "" {
+		botSeed, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			slog.Error("invalid BOT_SEED", "error", err)
+			os.Exit(1)
+		}
+	}
+	builtin := bot.NewMoveCalculator(bot.NewMCTS(botSeed, nil))
+
+	// External engines from BOT_ENGINES are played with difficulty=<name>.
+	engineConfigs, err := bot.ParseEngineConfigs(os.Getenv("BOT_ENGINES"))
+	if err != nil {
+		slog.Error("invalid BOT_ENGINES", "error", err)
+		os.Exit(1)
+	}
+	engines := make([]*bot.ExternalEngine, 0, len(engineConfigs))
+	for _, cfg := range engineConfigs {
+		engines = append(engines, bot.NewExternalEngine(cfg))
+	}
+	moveCalculator := bot.NewEngineCalculator(builtin, engines...)
+	defer moveCalculator.Close()
+
+	// BOT_THINK_TIMES overrides how long bots pause before moving.
+	botThinkTimes, err := bot.ParseThinkTimes(os.Getenv("BOT_THINK_TIMES"))
+	if err != nil {
+		slog.Error("invalid BOT_THINK_TIMES", "error", err)
+		os.Exit(1)
+	}
+
+	// HEARTBEAT_MISSED_LIMIT is how many pings in a row a player may miss
+	// before their connection is dropped.
+	if raw := os.Getenv("HEARTBEAT_MISSED_LIMIT"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			slog.Error("invalid HEARTBEAT_MISSED_LIMIT, must be a positive number", "value", raw)
+			os.Exit(1)
+		}
+		player.MissedHeartbeats = limit
+	}
+
+	// DRAIN_TIMEOUT is how long a stopping server waits for its games in
+	// progress before handing them off to the other servers.
+	drainTimeout := 30 * time.Second
+	if raw := os.Getenv("DRAIN_TIMEOUT"); raw != "" {
+		drainTimeout, err = time.ParseDuration(raw)
+		if err != nil || drainTimeout < 0 {
+			slog.Error("invalid DRAIN_TIMEOUT, must be a duration such as 30s", "value", raw)
+			os.Exit(1)
+		}
+	}
+
+	// CHAT_BLOCKLIST is a comma-separated list of words masked in chat messages.
+	var chatFilter chat.Filter
+	if blocklist := os.Getenv("CHAT_BLOCKLIST"); blocklist != "" {
+		chatFilter = chat.NewWordFilter(strings.Split(blocklist, ","))
+	}
+	chatService := chat.NewService(repository.NewChatRepository(rdb), chatFilter, chat.DefaultConfig)
+
+	// Finished games are rated and archived.
+	gameOverHandler := room.GameOverHandlers{ratingService, gameService}
 
 	// Create hub
-	hub := hub.NewHub(gameRepo, playerRepo, matchmakingRepo, rdb)
+	hub := hub.NewHub(gameRepo, playerRepo, matchmakingRepo, inviteRepo, repository.NewServerRepository(rdb), rdb, moveCalculator, botThinkTimes, gameOverHandler, ratingService, chatService)
 	go hub.Run()
 
 	// Create the Gin-based server
-	srv := server.NewServer(hub, userController)
+	srv := server.NewServer(hub, userController, roomController, gameController, userService, gameService)
 
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
@@ -92,11 +178,20 @@ func main() {
 
 	<-stop
 
+	// WebSocket connections aren't tracked by httpServer.Shutdown, so the hub
+	// hands its games off to the other servers first.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+	hub.Drain(drainCtx)
+	cancelDrain()
+
 	slog.Info("Shutting down server...")
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Replays have nothing to hand off; their clients start over elsewhere.
+	srv.CloseReplays(shutdownCtx)
+
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		slog.Error("Server forced to shutdown", "error", err)
 		os.Exit(1)
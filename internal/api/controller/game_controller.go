@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/response"
+	"ctchen222/Tic-Tac-Toe/internal/api/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GameController handles match history HTTP requests.
+type GameController struct {
+	gameService service.GameService
+}
+
+// NewGameController creates a new GameController.
+func NewGameController(gameService service.GameService) *GameController {
+	return &GameController{
+		gameService: gameService,
+	}
+}
+
+// ListUserGames handles the match history endpoint of a user. Games can be
+// filtered by variant, result and termination, and paged with limit and offset.
+func (gc *GameController) ListUserGames(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	var filter models.GameFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := gc.gameService.ListUserGames(c.Request.Context(), userID, filter)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(c, page)
+}
+
+// GetGame handles the endpoint returning a single game with its moves.
+func (gc *GameController) GetGame(c *gin.Context) {
+	g, err := gc.gameService.GetGame(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, service.ErrGameNotFound) {
+		response.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(c, g)
+}
+
+// GetReplay handles the endpoint returning every position of a game.
+func (gc *GameController) GetReplay(c *gin.Context) {
+	replay, err := gc.gameService.GetReplay(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, service.ErrGameNotFound) {
+		response.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(c, replay)
+}
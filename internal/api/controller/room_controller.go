@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/response"
+	"ctchen222/Tic-Tac-Toe/internal/api/service"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoomController handles private room HTTP requests.
+type RoomController struct {
+	roomService service.RoomService
+	userService service.UserService
+}
+
+// NewRoomController creates a new RoomController.
+func NewRoomController(roomService service.RoomService, userService service.UserService) *RoomController {
+	return &RoomController{
+		roomService: roomService,
+		userService: userService,
+	}
+}
+
+// Create handles the private room endpoint. The holder of the bearer token,
+// a user or a guest, becomes the host.
+func (rc *RoomController) Create(c *gin.Context) {
+	tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+	hostID, err := rc.userService.PlayerIDFromToken(c.Request.Context(), tokenString)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var req models.CreateRoomRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	room, err := rc.roomService.CreatePrivateRoom(c.Request.Context(), hostID, &req)
+	if errors.Is(err, service.ErrInvalidRoomSettings) {
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(c, room)
+}
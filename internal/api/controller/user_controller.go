@@ -4,7 +4,10 @@ import (
 	"ctchen222/Tic-Tac-Toe/internal/api/models"
 	"ctchen222/Tic-Tac-Toe/internal/api/response"
 	"ctchen222/Tic-Tac-Toe/internal/api/service"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -46,24 +49,64 @@ func (uc *UserController) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := uc.userService.Login(c.Request.Context(), &req)
+	loginResponse, err := uc.userService.Login(c.Request.Context(), &req)
 	if err != nil {
 		// Assuming service returns specific errors that can be mapped to HTTP status codes
 		response.ErrorResponse(c, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	response.SuccessResponse(c, models.LoginResponse{Token: token})
+	response.SuccessResponse(c, loginResponse)
 }
 
-// GuestLogin handles guest login, returning a generated player ID.
+// GuestLogin handles guest login, returning a generated player ID and a token for it.
 func (uc *UserController) GuestLogin(c *gin.Context) {
-	playerID, err := uc.userService.GuestLogin(c.Request.Context())
+	guest, err := uc.userService.GuestLogin(c.Request.Context())
 	if err != nil {
 		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	response.SuccessResponse(c, gin.H{"player_id": playerID})
+	response.SuccessResponse(c, guest)
 	return
 }
+
+// GetUser handles the public user profile endpoint.
+func (uc *UserController) GetUser(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	uc.respondWithProfile(c, userID)
+}
+
+// Me handles the profile endpoint of the user holding the bearer token.
+func (uc *UserController) Me(c *gin.Context) {
+	tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		response.ErrorResponse(c, http.StatusUnauthorized, "missing bearer token")
+		return
+	}
+
+	userID, err := uc.userService.Authenticate(c.Request.Context(), tokenString)
+	if err != nil {
+		response.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	uc.respondWithProfile(c, userID)
+}
+
+func (uc *UserController) respondWithProfile(c *gin.Context, userID int64) {
+	profile, err := uc.userService.GetProfile(c.Request.Context(), userID)
+	if errors.Is(err, service.ErrUserNotFound) {
+		response.ErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		response.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SuccessResponse(c, profile)
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"time"
+)
+
+// Results of a game from the point of view of one of its players.
+const (
+	ResultWin  = "win"
+	ResultLoss = "loss"
+	ResultDraw = "draw"
+)
+
+// Game is a finished game as stored in the archive.
+type Game struct {
+	ID        string `db:"id" json:"id"`
+	RoomID    string `db:"room_id" json:"room_id"`
+	Variant   string `db:"variant" json:"variant"`
+	BoardSize int    `db:"board_size" json:"board_size"`
+	WinLength int    `db:"win_length" json:"win_length"`
+	PlayerX   string `db:"player_x" json:"player_x"`
+	PlayerO   string `db:"player_o" json:"player_o"`
+	// UserX and UserO are set for players who are registered users.
+	UserX *int64 `db:"user_x" json:"user_x,omitempty"`
+	UserO *int64 `db:"user_o" json:"user_o,omitempty"`
+	// BotDifficulty is the difficulty of the bot in games against one.
+	BotDifficulty string `db:"bot_difficulty" json:"bot_difficulty,omitempty"`
+	// Winner is X, O, Draw, or empty for abandoned and aborted games.
+	Winner      string    `db:"winner" json:"winner"`
+	Termination string    `db:"termination" json:"termination"`
+	MoveCount   int       `db:"move_count" json:"move_count"`
+	StartedAt   time.Time `db:"started_at" json:"started_at"`
+	EndedAt     time.Time `db:"ended_at" json:"ended_at"`
+	// Result is the game's result for the user whose games are listed.
+	Result string `db:"-" json:"result,omitempty"`
+	// Moves are only loaded for a single game.
+	Moves []GameMove `db:"-" json:"moves,omitempty"`
+}
+
+// GameMove is a move of an archived game.
+type GameMove struct {
+	Ply    int    `db:"ply" json:"ply"`
+	Player string `db:"player" json:"player"`
+	Piece  string `db:"piece" json:"piece"`
+	Row    int    `db:"row" json:"row"`
+	Col    int    `db:"col" json:"col"`
+	// Position is the move in the form clients send it for the game's variant.
+	Position []int     `db:"-" json:"position"`
+	PlayedAt time.Time `db:"played_at" json:"played_at"`
+	Proxy    bool      `db:"proxy" json:"proxy"`
+}
+
+// GameFilter selects and pages through a user's games.
+type GameFilter struct {
+	Variant     string `form:"variant"`
+	Result      string `form:"result" binding:"omitempty,oneof=win loss draw"`
+	Termination string `form:"termination" binding:"omitempty,oneof=win draw timeout abandon resign agreement abort forfeit"`
+	Limit       int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset      int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+// GamePage is a page of a user's games, most recent first.
+type GamePage struct {
+	Games  []Game `json:"games"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// Replay is every position of an archived game, as the "update" messages a
+// client would have received while it was played.
+type Replay struct {
+	GameID      string `json:"game_id"`
+	PlayerX     string `json:"player_x"`
+	PlayerO     string `json:"player_o"`
+	Winner      string `json:"winner"`
+	Termination string `json:"termination"`
+	// Frames holds the empty board followed by the position after each move.
+	Frames []proto.ServerToClientMessage `json:"frames"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/glicko"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// userPlayerIDPrefix prefixes the player IDs of registered users; guests get bare UUIDs.
+const userPlayerIDPrefix = "user-"
+
+// PlayerIDForUser returns the player ID a registered user plays under.
+func PlayerIDForUser(userID int64) string {
+	return fmt.Sprintf("%s%d", userPlayerIDPrefix, userID)
+}
+
+// UserIDFromPlayerID returns the user ID behind a player ID, or false for guests and bots.
+func UserIDFromPlayerID(playerID string) (int64, bool) {
+	raw, ok := strings.CutPrefix(playerID, userPlayerIDPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// Rating is a user's Glicko-2 rating. Bot ratings carry the difficulty they were
+// earned against and are always provisional: they never count towards the user's
+// rating against other users.
+type Rating struct {
+	UserID      int64   `db:"user_id" json:"-"`
+	Difficulty  string  `db:"difficulty" json:"difficulty,omitempty"`
+	Rating      float64 `db:"rating" json:"rating"`
+	RD          float64 `db:"rd" json:"rd"`
+	Volatility  float64 `db:"volatility" json:"volatility"`
+	Games       int     `db:"games" json:"games"`
+	Provisional bool    `db:"-" json:"provisional"`
+}
+
+// NewRating returns the stored form of a Glicko-2 rating.
+func NewRating(userID int64, difficulty string, r glicko.Rating, games int) Rating {
+	return Rating{
+		UserID:      userID,
+		Difficulty:  difficulty,
+		Rating:      r.Rating,
+		RD:          r.RD,
+		Volatility:  r.Volatility,
+		Games:       games,
+		Provisional: difficulty != "" || r.Provisional(),
+	}
+}
+
+// Glicko returns the rating in the form used by the rating calculations.
+func (r Rating) Glicko() glicko.Rating {
+	return glicko.Rating{Rating: r.Rating, RD: r.RD, Volatility: r.Volatility}
+}
+
+// UserProfile is the public view of a user returned by the users API.
+type UserProfile struct {
+	ID         int64    `json:"id"`
+	Username   string   `json:"username"`
+	PlayerID   string   `json:"player_id"`
+	Rating     Rating   `json:"rating"`
+	BotRatings []Rating `json:"bot_ratings"`
+}
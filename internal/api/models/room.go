@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// CreateRoomRequest defines the settings a host chooses for a private room.
+// Zero values select the defaults.
+type CreateRoomRequest struct {
+	Variant   string `json:"variant"`
+	Size      int    `json:"size"`
+	WinLength int    `json:"win"`
+	// First is who moves first: "host", "guest" or "random".
+	First string `json:"first"`
+	// TimeControl is the game's time control, e.g. "60+2" or "60d2".
+	TimeControl string `json:"tc"`
+}
+
+// PrivateRoom is a private room waiting for its players, joined with its invite code.
+type PrivateRoom struct {
+	Code        string    `json:"code"`
+	Variant     string    `json:"variant"`
+	Size        int       `json:"size"`
+	WinLength   int       `json:"win"`
+	First       string    `json:"first"`
+	TimeControl string    `json:"tc"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
@@ -21,5 +21,12 @@ type LoginRequest struct {
 
 // LoginResponse defines the structure for a successful login response.
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token    string `json:"token"`
+	PlayerID string `json:"player_id"`
+}
+
+// GuestLoginResponse defines the structure for a successful guest login response.
+type GuestLoginResponse struct {
+	PlayerID string `json:"player_id"`
+	Token    string `json:"token"`
 }
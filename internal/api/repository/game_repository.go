@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GameRepository defines the interface for the archive of finished games.
+type GameRepository interface {
+	// SaveGame stores a game and its moves. Saving a game that is already
+	// archived does nothing.
+	SaveGame(ctx context.Context, g *models.Game) error
+	// GetGame returns a game with its moves, or nil if it isn't archived.
+	GetGame(ctx context.Context, id string) (*models.Game, error)
+	// ListUserGames returns a page of the user's games, most recent first, and
+	// the number of games matching the filter.
+	ListUserGames(ctx context.Context, userID int64, filter models.GameFilter) ([]models.Game, int, error)
+}
+
+type sqliteGameRepository struct {
+	db *sqlx.DB
+}
+
+// NewGameRepository creates a new SQLite-based GameRepository.
+func NewGameRepository(db *sqlx.DB) GameRepository {
+	return &sqliteGameRepository{db: db}
+}
+
+const gameColumns = `id, room_id, variant, board_size, win_length, player_x, player_o, user_x, user_o,
+	bot_difficulty, winner, termination, move_count, started_at, ended_at`
+
+// SaveGame inserts the game and its moves in one transaction.
+func (r *sqliteGameRepository) SaveGame(ctx context.Context, g *models.Game) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin game transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT OR IGNORE INTO games (` + gameColumns + `) VALUES
+		(:id, :room_id, :variant, :board_size, :win_length, :player_x, :player_o, :user_x, :user_o,
+		:bot_difficulty, :winner, :termination, :move_count, :started_at, :ended_at)`
+	result, err := tx.NamedExecContext(ctx, query, g)
+	if err != nil {
+		return fmt.Errorf("failed to save game: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save game: %w", err)
+	}
+	if inserted == 0 {
+		// The game is already archived, with its moves.
+		return nil
+	}
+
+	for _, move := range g.Moves {
+		_, err := tx.ExecContext(ctx, `INSERT INTO game_moves (game_id, ply, player, piece, row, col, played_at, proxy)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, g.ID, move.Ply, move.Player, move.Piece, move.Row, move.Col, move.PlayedAt, move.Proxy)
+		if err != nil {
+			return fmt.Errorf("failed to save game move: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetGame retrieves a game and its moves by ID.
+func (r *sqliteGameRepository) GetGame(ctx context.Context, id string) (*models.Game, error) {
+	var g models.Game
+	err := r.db.GetContext(ctx, &g, `SELECT `+gameColumns+` FROM games WHERE id = ?`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get game: %w", err)
+	}
+
+	g.Moves = []models.GameMove{}
+	query := `SELECT ply, player, piece, row, col, played_at, proxy FROM game_moves WHERE game_id = ? ORDER BY ply`
+	if err := r.db.SelectContext(ctx, &g.Moves, query, id); err != nil {
+		return nil, fmt.Errorf("failed to get game moves: %w", err)
+	}
+	return &g, nil
+}
+
+// ListUserGames retrieves a page of the games a user played.
+func (r *sqliteGameRepository) ListUserGames(ctx context.Context, userID int64, filter models.GameFilter) ([]models.Game, int, error) {
+	where, args := userGamesWhere(userID, filter)
+
+	var total int
+	if err := r.db.GetContext(ctx, &total, `SELECT COUNT(*) FROM games WHERE `+where, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count games: %w", err)
+	}
+
+	games := []models.Game{}
+	query := `SELECT ` + gameColumns + ` FROM games WHERE ` + where + ` ORDER BY ended_at DESC, id LIMIT ? OFFSET ?`
+	if err := r.db.SelectContext(ctx, &games, query, append(args, filter.Limit, filter.Offset)...); err != nil {
+		return nil, 0, fmt.Errorf("failed to list games: %w", err)
+	}
+	return games, total, nil
+}
+
+// userGamesWhere builds the condition selecting the user's games that match the filter.
+func userGamesWhere(userID int64, filter models.GameFilter) (string, []any) {
+	conds := []string{"(user_x = ? OR user_o = ?)"}
+	args := []any{userID, userID}
+
+	if filter.Variant != "" {
+		conds = append(conds, "variant = ?")
+		args = append(args, filter.Variant)
+	}
+	if filter.Termination != "" {
+		conds = append(conds, "termination = ?")
+		args = append(args, filter.Termination)
+	}
+	switch filter.Result {
+	case models.ResultWin:
+		conds = append(conds, "((user_x = ? AND winner = 'X') OR (user_o = ? AND winner = 'O'))")
+		args = append(args, userID, userID)
+	case models.ResultLoss:
+		conds = append(conds, "((user_x = ? AND winner = 'O') OR (user_o = ? AND winner = 'X'))")
+		args = append(args, userID, userID)
+	case models.ResultDraw:
+		conds = append(conds, "winner = 'Draw'")
+	}
+	return strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/glicko"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RatingRepository defines the interface for rating data operations.
+type RatingRepository interface {
+	GetRating(ctx context.Context, userID int64) (*models.Rating, error)
+	GetBotRatings(ctx context.Context, userID int64) ([]models.Rating, error)
+	// RecordGame rates a game between two users; scoreA is userA's score. Both
+	// ratings are updated in one transaction.
+	RecordGame(ctx context.Context, userA, userB int64, scoreA float64) error
+	// RecordBotGame rates a user's game against a bot of the given difficulty and rating.
+	RecordBotGame(ctx context.Context, userID int64, difficulty string, bot glicko.Rating, score float64) error
+}
+
+type sqliteRatingRepository struct {
+	db *sqlx.DB
+}
+
+// NewRatingRepository creates a new SQLite-based RatingRepository.
+func NewRatingRepository(db *sqlx.DB) RatingRepository {
+	return &sqliteRatingRepository{db: db}
+}
+
+// GetRating returns the user's rating, or the default rating if they haven't played a rated game.
+func (r *sqliteRatingRepository) GetRating(ctx context.Context, userID int64) (*models.Rating, error) {
+	rating, err := getRating(ctx, r.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &rating, nil
+}
+
+// GetBotRatings returns the user's ratings against each bot difficulty they have played.
+func (r *sqliteRatingRepository) GetBotRatings(ctx context.Context, userID int64) ([]models.Rating, error) {
+	ratings := []models.Rating{}
+	query := `SELECT user_id, difficulty, rating, rd, volatility, games FROM bot_ratings WHERE user_id = ? ORDER BY difficulty`
+	if err := sqlx.SelectContext(ctx, r.db, &ratings, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to get bot ratings: %w", err)
+	}
+	for i := range ratings {
+		ratings[i].Provisional = true
+	}
+	return ratings, nil
+}
+
+// RecordGame updates both users' ratings with the result of a game between them.
+func (r *sqliteRatingRepository) RecordGame(ctx context.Context, userA, userB int64, scoreA float64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin rating transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	a, err := getRating(ctx, tx, userA)
+	if err != nil {
+		return err
+	}
+	b, err := getRating(ctx, tx, userB)
+	if err != nil {
+		return err
+	}
+
+	newA := glicko.Update(a.Glicko(), []glicko.Result{{Opponent: b.Glicko(), Score: scoreA}})
+	newB := glicko.Update(b.Glicko(), []glicko.Result{{Opponent: a.Glicko(), Score: 1 - scoreA}})
+
+	if err := saveRating(ctx, tx, models.NewRating(userA, "", newA, a.Games+1)); err != nil {
+		return err
+	}
+	if err := saveRating(ctx, tx, models.NewRating(userB, "", newB, b.Games+1)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ratings: %w", err)
+	}
+	return nil
+}
+
+// RecordBotGame updates the user's rating against the given bot difficulty.
+func (r *sqliteRatingRepository) RecordBotGame(ctx context.Context, userID int64, difficulty string, bot glicko.Rating, score float64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin rating transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current := models.NewRating(userID, difficulty, glicko.Default(), 0)
+	query := `SELECT user_id, difficulty, rating, rd, volatility, games FROM bot_ratings WHERE user_id = ? AND difficulty = ?`
+	if err := tx.GetContext(ctx, &current, query, userID, difficulty); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get bot rating: %w", err)
+	}
+
+	updated := glicko.Update(current.Glicko(), []glicko.Result{{Opponent: bot, Score: score}})
+	next := models.NewRating(userID, difficulty, updated, current.Games+1)
+	upsert := `
+	INSERT INTO bot_ratings (user_id, difficulty, rating, rd, volatility, games, updated_at)
+	VALUES (:user_id, :difficulty, :rating, :rd, :volatility, :games, CURRENT_TIMESTAMP)
+	ON CONFLICT (user_id, difficulty) DO UPDATE SET
+		rating = excluded.rating,
+		rd = excluded.rd,
+		volatility = excluded.volatility,
+		games = excluded.games,
+		updated_at = excluded.updated_at`
+	if _, err := tx.NamedExecContext(ctx, upsert, next); err != nil {
+		return fmt.Errorf("failed to save bot rating: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit bot rating: %w", err)
+	}
+	return nil
+}
+
+// getRating reads a user's rating, falling back to the default rating.
+func getRating(ctx context.Context, q sqlx.QueryerContext, userID int64) (models.Rating, error) {
+	rating := models.NewRating(userID, "", glicko.Default(), 0)
+	query := `SELECT user_id, rating, rd, volatility, games FROM ratings WHERE user_id = ?`
+	if err := sqlx.GetContext(ctx, q, &rating, query, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rating, nil
+		}
+		return models.Rating{}, fmt.Errorf("failed to get rating: %w", err)
+	}
+	rating.Provisional = rating.Glicko().Provisional()
+	return rating, nil
+}
+
+// saveRating inserts or replaces a user's rating.
+func saveRating(ctx context.Context, tx *sqlx.Tx, rating models.Rating) error {
+	upsert := `
+	INSERT INTO ratings (user_id, rating, rd, volatility, games, updated_at)
+	VALUES (:user_id, :rating, :rd, :volatility, :games, CURRENT_TIMESTAMP)
+	ON CONFLICT (user_id) DO UPDATE SET
+		rating = excluded.rating,
+		rd = excluded.rd,
+		volatility = excluded.volatility,
+		games = excluded.games,
+		updated_at = excluded.updated_at`
+	if _, err := tx.NamedExecContext(ctx, upsert, rating); err != nil {
+		return fmt.Errorf("failed to save rating: %w", err)
+	}
+	return nil
+}
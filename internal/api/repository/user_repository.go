@@ -14,6 +14,7 @@ import (
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User, password string) error
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
 }
 
 type sqliteUserRepository struct {
@@ -54,3 +55,17 @@ func (r *sqliteUserRepository) GetUserByUsername(ctx context.Context, username s
 	}
 	return &user, nil
 }
+
+// GetUserByID retrieves a user from the database by their ID.
+func (r *sqliteUserRepository) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	var user models.User
+	query := `SELECT id, username, password_hash FROM users WHERE id = ?`
+	err := r.db.GetContext(ctx, &user, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No user found is not an application error
+		}
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	return &user, nil
+}
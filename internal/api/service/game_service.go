@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/repository"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultGamesPerPage is how many games a page of match history holds unless
+// the client asks for another number.
+const DefaultGamesPerPage = 20
+
+// ErrGameNotFound is returned for games that aren't in the archive.
+var ErrGameNotFound = errors.New("game not found")
+
+// GameService archives finished games and serves match history. It implements
+// room.GameOverHandler.
+type GameService interface {
+	HandleGameOver(ctx context.Context, over room.GameOver)
+	GetGame(ctx context.Context, id string) (*models.Game, error)
+	ListUserGames(ctx context.Context, userID int64, filter models.GameFilter) (*models.GamePage, error)
+	GetReplay(ctx context.Context, id string) (*models.Replay, error)
+}
+
+type gameService struct {
+	gameRepo repository.GameRepository
+}
+
+// NewGameService creates a new GameService.
+func NewGameService(gameRepo repository.GameRepository) GameService {
+	return &gameService{gameRepo: gameRepo}
+}
+
+// HandleGameOver writes a finished or abandoned game to the archive.
+func (s *gameService) HandleGameOver(ctx context.Context, over room.GameOver) {
+	ctx, span := tracer.Start(ctx, "GameService.HandleGameOver", trace.WithAttributes(
+		attribute.String("room.id", over.RoomID),
+		attribute.String("game.id", over.State.GameID),
+		attribute.String("game.termination", string(over.Termination)),
+	))
+	defer span.End()
+
+	g := archivedGame(over)
+	if err := s.gameRepo.SaveGame(ctx, g); err != nil {
+		slog.ErrorContext(ctx, "Failed to archive game", "room.id", over.RoomID, "game.id", g.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to archive game")
+		return
+	}
+	slog.InfoContext(ctx, "Archived game", "room.id", over.RoomID, "game.id", g.ID, "termination", g.Termination)
+}
+
+// GetGame returns a game with all its moves.
+func (s *gameService) GetGame(ctx context.Context, id string) (*models.Game, error) {
+	g, err := s.gameRepo.GetGame(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, ErrGameNotFound
+	}
+
+	// Variants that are no longer registered fall back to [row, col].
+	ruleset, rulesetErr := game.LookupRuleset(g.Variant)
+	for i := range g.Moves {
+		move := &g.Moves[i]
+		move.Position = []int{move.Row, move.Col}
+		if rulesetErr == nil {
+			move.Position = ruleset.Position(game.Move{Row: move.Row, Col: move.Col})
+		}
+	}
+	return g, nil
+}
+
+// ListUserGames returns a page of the user's games, with each game's result for the user.
+func (s *gameService) ListUserGames(ctx context.Context, userID int64, filter models.GameFilter) (*models.GamePage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultGamesPerPage
+	}
+
+	games, total, err := s.gameRepo.ListUserGames(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range games {
+		games[i].Result = resultFor(games[i], userID)
+	}
+	return &models.GamePage{Games: games, Total: total, Limit: filter.Limit, Offset: filter.Offset}, nil
+}
+
+// GetReplay rebuilds every position of an archived game.
+func (s *gameService) GetReplay(ctx context.Context, id string) (*models.Replay, error) {
+	ctx, span := tracer.Start(ctx, "GameService.GetReplay", trace.WithAttributes(
+		attribute.String("game.id", id),
+	))
+	defer span.End()
+
+	g, err := s.gameRepo.GetGame(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, ErrGameNotFound
+	}
+
+	moves := make([]game.Move, len(g.Moves))
+	for i, move := range g.Moves {
+		moves[i] = game.Move{
+			Player: game.PlayerMark(move.Player),
+			Piece:  game.PlayerMark(move.Piece),
+			Row:    move.Row,
+			Col:    move.Col,
+		}
+	}
+	cfg := game.Config{Variant: g.Variant, Size: g.BoardSize, WinLength: g.WinLength}
+	states, err := game.Replay(cfg, moves)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to replay game")
+		return nil, fmt.Errorf("failed to replay game %s: %w", id, err)
+	}
+
+	replay := &models.Replay{
+		GameID:      g.ID,
+		PlayerX:     g.PlayerX,
+		PlayerO:     g.PlayerO,
+		Winner:      g.Winner,
+		Termination: g.Termination,
+		Frames:      make([]proto.ServerToClientMessage, len(states)),
+	}
+	for i := range states {
+		frame := proto.NewUpdateMessage(&states[i])
+		frame.Replay = &proto.ReplayState{GameID: g.ID, Ply: i, Plies: len(moves)}
+		if i > 0 {
+			frame.Replay.PlayedAt = g.Moves[i-1].PlayedAt.UnixMilli()
+			frame.Replay.Proxy = g.Moves[i-1].Proxy
+		}
+		replay.Frames[i] = *frame
+	}
+	return replay, nil
+}
+
+// archivedGame returns the archive record of a game that is over.
+func archivedGame(over room.GameOver) *models.Game {
+	state := over.State
+	g := &models.Game{
+		ID:          state.GameID,
+		RoomID:      over.RoomID,
+		Variant:     state.Variant,
+		BoardSize:   state.Board.Size(),
+		WinLength:   state.Board.WinLength,
+		PlayerX:     state.PlayerXID,
+		PlayerO:     state.PlayerOID,
+		Winner:      string(state.Winner),
+		Termination: string(over.Termination),
+		MoveCount:   len(over.Moves),
+		StartedAt:   state.StartedAt,
+		EndedAt:     over.EndedAt,
+		Moves:       make([]models.GameMove, 0, len(over.Moves)),
+	}
+	// Rooms created before games had IDs still get archived.
+	if g.ID == "" {
+		g.ID = uuid.NewString()
+	}
+	if g.StartedAt.IsZero() && len(over.Moves) > 0 {
+		g.StartedAt = over.Moves[0].At
+	}
+	if g.StartedAt.IsZero() {
+		g.StartedAt = g.EndedAt
+	}
+	if id, ok := models.UserIDFromPlayerID(state.PlayerXID); ok {
+		g.UserX = &id
+	}
+	if id, ok := models.UserIDFromPlayerID(state.PlayerOID); ok {
+		g.UserO = &id
+	}
+	for _, difficulty := range over.BotDifficulties {
+		g.BotDifficulty = difficulty
+	}
+
+	for i, move := range over.Moves {
+		g.Moves = append(g.Moves, models.GameMove{
+			Ply:      i + 1,
+			Player:   string(move.Player),
+			Piece:    string(move.Piece),
+			Row:      move.Row,
+			Col:      move.Col,
+			PlayedAt: move.At,
+			Proxy:    move.Proxy,
+		})
+	}
+	return g
+}
+
+// resultFor returns the result of a game for one of its users, or an empty
+// string for games without a result.
+func resultFor(g models.Game, userID int64) string {
+	var mark game.PlayerMark
+	switch {
+	case g.UserX != nil && *g.UserX == userID:
+		mark = game.PlayerX
+	case g.UserO != nil && *g.UserO == userID:
+		mark = game.PlayerO
+	}
+
+	switch game.PlayerMark(g.Winner) {
+	case game.DRAW:
+		return models.ResultDraw
+	case game.None:
+		return ""
+	case mark:
+		return models.ResultWin
+	}
+	return models.ResultLoss
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/repository"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"errors"
+	"testing"
+	"time"
+)
+
+func finishedGame(id, playerX, playerO string, winner game.PlayerMark, termination game.Termination, endedAt time.Time) room.GameOver {
+	cfg := game.Classic.DefaultConfig()
+	return room.GameOver{
+		RoomID: "room-1",
+		State: &game.GameStateDTO{
+			GameID:    id,
+			Variant:   cfg.Variant,
+			Board:     cfg.NewBoard(),
+			PlayerXID: playerX,
+			PlayerOID: playerO,
+			Winner:    winner,
+			StartedAt: endedAt.Add(-time.Minute),
+		},
+		Termination: termination,
+		Moves: []game.MoveRecord{
+			{Move: game.Move{Player: game.PlayerX, Piece: game.PlayerX, Row: 1, Col: 1}, At: endedAt.Add(-30 * time.Second)},
+			{Move: game.Move{Player: game.PlayerO, Piece: game.PlayerO, Row: 0, Col: 2}, At: endedAt, Proxy: true},
+		},
+		EndedAt: endedAt,
+	}
+}
+
+func TestGameServiceArchivesGames(t *testing.T) {
+	ctx := context.Background()
+	conn := newTestDB(t)
+	users := repository.NewUserRepository(conn)
+	alice := createTestUser(t, users, "alice")
+	service := NewGameService(repository.NewGameRepository(conn))
+
+	endedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	over := finishedGame("game-1", models.PlayerIDForUser(alice), "bot-1234", game.PlayerO, game.TerminationTimeout, endedAt)
+	over.BotDifficulties = map[string]string{"bot-1234": "hard"}
+	service.HandleGameOver(ctx, over)
+	// A second report of the same game is ignored.
+	service.HandleGameOver(ctx, over)
+
+	g, err := service.GetGame(ctx, "game-1")
+	if err != nil {
+		t.Fatalf("GetGame() returned error: %v", err)
+	}
+	if g.PlayerX != models.PlayerIDForUser(alice) || g.UserX == nil || *g.UserX != alice || g.UserO != nil {
+		t.Errorf("got players %q/%q with users %v/%v, want alice as X against a bot", g.PlayerX, g.PlayerO, g.UserX, g.UserO)
+	}
+	if g.Winner != "O" || g.Termination != "timeout" || g.BotDifficulty != "hard" || g.MoveCount != 2 {
+		t.Errorf("got %+v, want a timeout win for the hard bot after 2 moves", g)
+	}
+	if !g.EndedAt.Equal(endedAt) || !g.StartedAt.Equal(endedAt.Add(-time.Minute)) {
+		t.Errorf("got start %v and end %v, want %v and %v", g.StartedAt, g.EndedAt, endedAt.Add(-time.Minute), endedAt)
+	}
+	if len(g.Moves) != 2 {
+		t.Fatalf("got %d moves, want 2", len(g.Moves))
+	}
+	second := g.Moves[1]
+	if second.Ply != 2 || second.Player != "O" || !second.Proxy || !second.PlayedAt.Equal(endedAt) {
+		t.Errorf("second move = %+v, want O's proxy move at ply 2", second)
+	}
+	if len(second.Position) != 2 || second.Position[0] != 0 || second.Position[1] != 2 {
+		t.Errorf("second move position = %v, want [0 2]", second.Position)
+	}
+
+	if _, err := service.GetGame(ctx, "missing"); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("GetGame() for a missing game returned %v, want ErrGameNotFound", err)
+	}
+}
+
+func TestGameServiceListsUserGames(t *testing.T) {
+	ctx := context.Background()
+	conn := newTestDB(t)
+	users := repository.NewUserRepository(conn)
+	alice := createTestUser(t, users, "alice")
+	bob := createTestUser(t, users, "bob")
+	service := NewGameService(repository.NewGameRepository(conn))
+
+	aliceID, bobID := models.PlayerIDForUser(alice), models.PlayerIDForUser(bob)
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	service.HandleGameOver(ctx, finishedGame("game-1", aliceID, bobID, game.PlayerX, game.TerminationWin, start))
+	service.HandleGameOver(ctx, finishedGame("game-2", bobID, aliceID, game.PlayerX, game.TerminationWin, start.Add(time.Hour)))
+	service.HandleGameOver(ctx, finishedGame("game-3", aliceID, "guest", game.DRAW, game.TerminationDraw, start.Add(2*time.Hour)))
+	service.HandleGameOver(ctx, finishedGame("game-4", "guest", bobID, game.None, game.TerminationAbandon, start.Add(3*time.Hour)))
+
+	page, err := service.ListUserGames(ctx, alice, models.GameFilter{})
+	if err != nil {
+		t.Fatalf("ListUserGames() returned error: %v", err)
+	}
+	if page.Total != 3 || page.Limit != DefaultGamesPerPage || len(page.Games) != 3 {
+		t.Fatalf("got %d of %d games with limit %d, want all 3 of alice's games", len(page.Games), page.Total, page.Limit)
+	}
+	wantOrder := []struct{ id, result string }{{"game-3", "draw"}, {"game-2", "loss"}, {"game-1", "win"}}
+	for i, want := range wantOrder {
+		if got := page.Games[i]; got.ID != want.id || got.Result != want.result || got.Moves != nil {
+			t.Errorf("game %d = %s (%q), want %s (%q) without moves", i, got.ID, got.Result, want.id, want.result)
+		}
+	}
+
+	page, err = service.ListUserGames(ctx, alice, models.GameFilter{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListUserGames() returned error: %v", err)
+	}
+	if page.Total != 3 || len(page.Games) != 1 || page.Games[0].ID != "game-2" {
+		t.Errorf("second page of one got %+v, want game-2 of 3", page)
+	}
+
+	filters := []struct {
+		filter models.GameFilter
+		want   string
+	}{
+		{models.GameFilter{Result: models.ResultWin}, "game-1"},
+		{models.GameFilter{Result: models.ResultLoss}, "game-2"},
+		{models.GameFilter{Result: models.ResultDraw}, "game-3"},
+		{models.GameFilter{Termination: "draw"}, "game-3"},
+	}
+	for _, tt := range filters {
+		page, err := service.ListUserGames(ctx, alice, tt.filter)
+		if err != nil {
+			t.Fatalf("ListUserGames(%+v) returned error: %v", tt.filter, err)
+		}
+		if page.Total != 1 || len(page.Games) != 1 || page.Games[0].ID != tt.want {
+			t.Errorf("ListUserGames(%+v) got %+v, want only %s", tt.filter, page.Games, tt.want)
+		}
+	}
+
+	page, err = service.ListUserGames(ctx, bob, models.GameFilter{Termination: "abandon"})
+	if err != nil {
+		t.Fatalf("ListUserGames() returned error: %v", err)
+	}
+	if len(page.Games) != 1 || page.Games[0].ID != "game-4" || page.Games[0].Result != "" {
+		t.Errorf("got %+v, want bob's abandoned game without a result", page.Games)
+	}
+
+	page, err = service.ListUserGames(ctx, alice, models.GameFilter{Variant: "gomoku"})
+	if err != nil {
+		t.Fatalf("ListUserGames() returned error: %v", err)
+	}
+	if page.Total != 0 || len(page.Games) != 0 {
+		t.Errorf("got %+v for another variant, want no games", page)
+	}
+}
+
+func TestGameServiceReplaysGames(t *testing.T) {
+	ctx := context.Background()
+	service := NewGameService(repository.NewGameRepository(newTestDB(t)))
+
+	endedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	service.HandleGameOver(ctx, finishedGame("game-1", "alice", "bob", game.None, game.TerminationAbandon, endedAt))
+
+	replay, err := service.GetReplay(ctx, "game-1")
+	if err != nil {
+		t.Fatalf("GetReplay() returned error: %v", err)
+	}
+	if len(replay.Frames) != 3 {
+		t.Fatalf("got %d frames, want the empty board and one per move", len(replay.Frames))
+	}
+	for i, frame := range replay.Frames {
+		if frame.Type != "update" || frame.Replay == nil || frame.Replay.Ply != i || frame.Replay.Plies != 2 {
+			t.Errorf("frame %d = %+v, want an update at ply %d of 2", i, frame.Replay, i)
+		}
+	}
+	if first := replay.Frames[0]; first.Next != game.PlayerX || first.LastMove != nil || first.Replay.PlayedAt != 0 {
+		t.Errorf("first frame = %+v, want the empty board with X to move", first)
+	}
+	last := replay.Frames[2]
+	if last.Board[1][1] != game.PlayerX || last.Board[0][2] != game.PlayerO || last.Next != game.PlayerX {
+		t.Errorf("last board = %v with %q to move, want both moves played and X to move", last.Board, last.Next)
+	}
+	if !last.Replay.Proxy || last.Replay.PlayedAt != endedAt.UnixMilli() {
+		t.Errorf("last frame replay state = %+v, want O's proxy move at %d", last.Replay, endedAt.UnixMilli())
+	}
+
+	if _, err := service.GetReplay(ctx, "missing"); !errors.Is(err, ErrGameNotFound) {
+		t.Errorf("GetReplay() for a missing game returned %v, want ErrGameNotFound", err)
+	}
+}
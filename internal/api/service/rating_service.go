@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/repository"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/glicko"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("service")
+
+// BotRatings are the fixed ratings bots are treated as having when they play a
+// rated game. Difficulties without an entry, such as external engines, are rated
+// like an unrated player.
+var BotRatings = map[string]glicko.Rating{
+	"easy":   {Rating: 1000, RD: 50, Volatility: glicko.DefaultVolatility},
+	"medium": {Rating: 1400, RD: 50, Volatility: glicko.DefaultVolatility},
+	"hard":   {Rating: 1900, RD: 50, Volatility: glicko.DefaultVolatility},
+}
+
+// RatingService rates finished games and looks up the ratings players are
+// matched by. It implements room.GameOverHandler and hub.RatingProvider.
+type RatingService interface {
+	HandleGameOver(ctx context.Context, over room.GameOver)
+	MatchmakingRating(ctx context.Context, playerID string) (float64, error)
+}
+
+type ratingService struct {
+	ratingRepo repository.RatingRepository
+}
+
+// NewRatingService creates a new RatingService.
+func NewRatingService(ratingRepo repository.RatingRepository) RatingService {
+	return &ratingService{ratingRepo: ratingRepo}
+}
+
+// HandleGameOver updates the ratings of the registered users who played the game.
+// Games between two users update their ratings; games against a bot update the
+// user's provisional rating for the bot's difficulty. Guests and abandoned or
+// aborted games are never rated.
+func (s *ratingService) HandleGameOver(ctx context.Context, over room.GameOver) {
+	ctx, span := tracer.Start(ctx, "RatingService.HandleGameOver", trace.WithAttributes(
+		attribute.String("room.id", over.RoomID),
+		attribute.String("game.winner", string(over.State.Winner)),
+	))
+	defer span.End()
+
+	if over.Termination == game.TerminationAbandon || over.Termination == game.TerminationAbort {
+		return
+	}
+
+	xID, oID := over.State.PlayerXID, over.State.PlayerOID
+	xUser, xRegistered := models.UserIDFromPlayerID(xID)
+	oUser, oRegistered := models.UserIDFromPlayerID(oID)
+	xScore := score(over.State.Winner, game.PlayerX)
+
+	var err error
+	switch {
+	case xRegistered && oRegistered && xUser != oUser:
+		err = s.ratingRepo.RecordGame(ctx, xUser, oUser, xScore)
+	case xRegistered && isBot(over, oID):
+		err = s.recordBotGame(ctx, xUser, over.BotDifficulties[oID], xScore)
+	case oRegistered && isBot(over, xID):
+		err = s.recordBotGame(ctx, oUser, over.BotDifficulties[xID], 1-xScore)
+	default:
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update ratings", "room.id", over.RoomID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to update ratings")
+		return
+	}
+	slog.InfoContext(ctx, "Updated ratings for finished game", "room.id", over.RoomID, "winner", over.State.Winner)
+}
+
+// MatchmakingRating returns the rating of a registered user, or the default
+// rating for guests.
+func (s *ratingService) MatchmakingRating(ctx context.Context, playerID string) (float64, error) {
+	userID, ok := models.UserIDFromPlayerID(playerID)
+	if !ok {
+		return glicko.DefaultRating, nil
+	}
+	rating, err := s.ratingRepo.GetRating(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return rating.Rating, nil
+}
+
+func (s *ratingService) recordBotGame(ctx context.Context, userID int64, difficulty string, score float64) error {
+	bot, ok := BotRatings[difficulty]
+	if !ok {
+		bot = glicko.Default()
+	}
+	return s.ratingRepo.RecordBotGame(ctx, userID, difficulty, bot, score)
+}
+
+// score returns the score of mark in a game with the given winner.
+func score(winner, mark game.PlayerMark) float64 {
+	switch winner {
+	case mark:
+		return 1
+	case game.DRAW:
+		return 0.5
+	}
+	return 0
+}
+
+func isBot(over room.GameOver, playerID string) bool {
+	_, ok := over.BotDifficulties[playerID]
+	return ok
+}
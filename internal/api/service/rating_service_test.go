@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/repository"
+	"ctchen222/Tic-Tac-Toe/internal/db"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/glicko"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestRepositories(t *testing.T) (repository.UserRepository, repository.RatingRepository) {
+	t.Helper()
+	conn := newTestDB(t)
+	return repository.NewUserRepository(conn), repository.NewRatingRepository(conn)
+}
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	conn, err := db.LocalConnect(filepath.Join(t.TempDir(), "test.db") + "?_txlock=immediate&_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("LocalConnect() returned error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.CreateSchema(conn); err != nil {
+		t.Fatalf("CreateSchema() returned error: %v", err)
+	}
+	return conn
+}
+
+func createTestUser(t *testing.T, users repository.UserRepository, username string) int64 {
+	t.Helper()
+	ctx := context.Background()
+	if err := users.CreateUser(ctx, &models.User{Username: username}, "secret"); err != nil {
+		t.Fatalf("CreateUser() returned error: %v", err)
+	}
+	user, err := users.GetUserByUsername(ctx, username)
+	if err != nil || user == nil {
+		t.Fatalf("GetUserByUsername() got %v, %v", user, err)
+	}
+	return user.ID
+}
+
+func TestRatingServiceRatesGamesBetweenUsers(t *testing.T) {
+	ctx := context.Background()
+	users, ratings := newTestRepositories(t)
+	alice := createTestUser(t, users, "alice")
+	bob := createTestUser(t, users, "bob")
+	service := NewRatingService(ratings)
+
+	service.HandleGameOver(ctx, room.GameOver{
+		RoomID: "room-1",
+		State: &game.GameStateDTO{
+			PlayerXID: models.PlayerIDForUser(alice),
+			PlayerOID: models.PlayerIDForUser(bob),
+			Winner:    game.PlayerX,
+		},
+	})
+
+	winner, err := ratings.GetRating(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetRating() returned error: %v", err)
+	}
+	loser, err := ratings.GetRating(ctx, bob)
+	if err != nil {
+		t.Fatalf("GetRating() returned error: %v", err)
+	}
+	if winner.Rating <= glicko.DefaultRating || loser.Rating >= glicko.DefaultRating {
+		t.Errorf("ratings got %.1f/%.1f, want the winner above and the loser below %v", winner.Rating, loser.Rating, glicko.DefaultRating)
+	}
+	if winner.Games != 1 || loser.Games != 1 || !winner.Provisional {
+		t.Errorf("got winner %+v and loser %+v, want one provisional game each", winner, loser)
+	}
+
+	// A draw between them moves the ratings back towards each other.
+	service.HandleGameOver(ctx, room.GameOver{
+		RoomID: "room-1",
+		State: &game.GameStateDTO{
+			PlayerXID: models.PlayerIDForUser(bob),
+			PlayerOID: models.PlayerIDForUser(alice),
+			Winner:    game.DRAW,
+		},
+	})
+	after, _ := ratings.GetRating(ctx, alice)
+	if after.Rating >= winner.Rating || after.Games != 2 {
+		t.Errorf("after a draw got %+v, want a lower rating than %.1f after 2 games", after, winner.Rating)
+	}
+}
+
+func TestRatingServiceKeepsBotRatingsSeparate(t *testing.T) {
+	ctx := context.Background()
+	users, ratings := newTestRepositories(t)
+	alice := createTestUser(t, users, "alice")
+	service := NewRatingService(ratings)
+
+	service.HandleGameOver(ctx, room.GameOver{
+		RoomID: "room-1",
+		State: &game.GameStateDTO{
+			PlayerXID: "bot-1234",
+			PlayerOID: models.PlayerIDForUser(alice),
+			Winner:    game.PlayerO,
+		},
+		BotDifficulties: map[string]string{"bot-1234": "hard"},
+	})
+	// Games with guests are not rated.
+	service.HandleGameOver(ctx, room.GameOver{
+		RoomID: "room-2",
+		State: &game.GameStateDTO{
+			PlayerXID: models.PlayerIDForUser(alice),
+			PlayerOID: "6f1c7a52-guest",
+			Winner:    game.PlayerX,
+		},
+	})
+	// Nor are abandoned games.
+	service.HandleGameOver(ctx, room.GameOver{
+		RoomID: "room-3",
+		State: &game.GameStateDTO{
+			PlayerXID: models.PlayerIDForUser(alice),
+			PlayerOID: "bot-1234",
+		},
+		BotDifficulties: map[string]string{"bot-1234": "hard"},
+		Termination:     game.TerminationAbandon,
+	})
+	// Or aborted ones.
+	service.HandleGameOver(ctx, room.GameOver{
+		RoomID: "room-4",
+		State: &game.GameStateDTO{
+			PlayerXID: models.PlayerIDForUser(alice),
+			PlayerOID: "bot-1234",
+		},
+		BotDifficulties: map[string]string{"bot-1234": "hard"},
+		Termination:     game.TerminationAbort,
+	})
+
+	rating, err := ratings.GetRating(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetRating() returned error: %v", err)
+	}
+	if rating.Games != 0 || rating.Rating != glicko.DefaultRating {
+		t.Errorf("GetRating() got %+v, want the default rating", rating)
+	}
+
+	botRatings, err := ratings.GetBotRatings(ctx, alice)
+	if err != nil {
+		t.Fatalf("GetBotRatings() returned error: %v", err)
+	}
+	if len(botRatings) != 1 || botRatings[0].Difficulty != "hard" || botRatings[0].Games != 1 ||
+		botRatings[0].Rating <= glicko.DefaultRating || !botRatings[0].Provisional {
+		t.Errorf("GetBotRatings() got %+v, want one provisional win against hard", botRatings)
+	}
+}
+
+func TestUserIDFromPlayerID(t *testing.T) {
+	if id, ok := models.UserIDFromPlayerID(models.PlayerIDForUser(42)); !ok || id != 42 {
+		t.Errorf("round trip got %d, %v", id, ok)
+	}
+	for _, playerID := range []string{"", "bot-1234", "user-", "user-abc", "user--1", "2b9f5b1e-guest"} {
+		if _, ok := models.UserIDFromPlayerID(playerID); ok {
+			t.Errorf("UserIDFromPlayerID(%q) should not be a user", playerID)
+		}
+	}
+}
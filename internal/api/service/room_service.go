@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InviteTTL is how long an invite code can be used.
+const InviteTTL = 10 * time.Minute
+
+// ErrInvalidRoomSettings is returned for private room settings that can't be played.
+var ErrInvalidRoomSettings = errors.New("invalid room settings")
+
+// RoomService creates private rooms.
+type RoomService interface {
+	CreatePrivateRoom(ctx context.Context, hostID string, req *models.CreateRoomRequest) (*models.PrivateRoom, error)
+}
+
+type roomService struct {
+	inviteRepo repository.InviteRepository
+}
+
+// NewRoomService creates a new RoomService.
+func NewRoomService(inviteRepo repository.InviteRepository) RoomService {
+	return &roomService{inviteRepo: inviteRepo}
+}
+
+// CreatePrivateRoom validates the host's settings and creates an invite code for them.
+func (s *roomService) CreatePrivateRoom(ctx context.Context, hostID string, req *models.CreateRoomRequest) (*models.PrivateRoom, error) {
+	ctx, span := tracer.Start(ctx, "RoomService.CreatePrivateRoom", trace.WithAttributes(
+		attribute.String("player.id", hostID),
+	))
+	defer span.End()
+
+	cfg, err := game.ResolveConfig(req.Variant, req.Size, req.WinLength)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRoomSettings, err)
+	}
+
+	first := req.First
+	switch first {
+	case "":
+		first = repository.FirstMoveRandom
+	case repository.FirstMoveRandom, repository.FirstMoveHost, repository.FirstMoveGuest:
+	default:
+		return nil, fmt.Errorf("%w: first must be %q, %q or %q", ErrInvalidRoomSettings,
+			repository.FirstMoveHost, repository.FirstMoveGuest, repository.FirstMoveRandom)
+	}
+
+	cfg.TimeControl = game.DefaultTimeControl
+	if req.TimeControl != "" {
+		if cfg.TimeControl, err = game.ParseTimeControl(req.TimeControl); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRoomSettings, err)
+		}
+	}
+
+	invite, err := s.inviteRepo.Create(ctx, &repository.Invite{
+		HostID:    hostID,
+		Config:    cfg,
+		FirstMove: first,
+	}, InviteTTL)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to create invite")
+		return nil, err
+	}
+
+	return &models.PrivateRoom{
+		Code:        invite.Code,
+		Variant:     cfg.Variant,
+		Size:        cfg.Size,
+		WinLength:   cfg.WinLength,
+		First:       first,
+		TimeControl: cfg.TimeControl.String(),
+		ExpiresAt:   invite.ExpiresAt,
+	}, nil
+}
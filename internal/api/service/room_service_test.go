@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingInviteRepository keeps the last created invite.
+type recordingInviteRepository struct {
+	created *repository.Invite
+}
+
+func (r *recordingInviteRepository) Create(ctx context.Context, invite *repository.Invite, ttl time.Duration) (*repository.Invite, error) {
+	created := *invite
+	created.Code = "ABC234"
+	created.ExpiresAt = time.Now().Add(ttl)
+	r.created = &created
+	return &created, nil
+}
+
+func (r *recordingInviteRepository) Join(ctx context.Context, code, playerID string) (*repository.Invite, error) {
+	return nil, repository.ErrInviteNotFound
+}
+
+func TestCreatePrivateRoom(t *testing.T) {
+	invites := &recordingInviteRepository{}
+	service := NewRoomService(invites)
+
+	room, err := service.CreatePrivateRoom(context.Background(), "alice", &models.CreateRoomRequest{
+		Variant:     "misere",
+		Size:        4,
+		First:       "guest",
+		TimeControl: "30d3",
+	})
+	if err != nil {
+		t.Fatalf("CreatePrivateRoom() returned error: %v", err)
+	}
+	if room.Code != "ABC234" || room.Size != 4 || room.WinLength != 4 || room.First != "guest" || room.TimeControl != "30d3" {
+		t.Errorf("CreatePrivateRoom() = %+v", room)
+	}
+
+	want := repository.Invite{
+		Code:   "ABC234",
+		HostID: "alice",
+		Config: game.Config{Variant: "misere", Size: 4, WinLength: 4,
+			TimeControl: game.TimeControl{Base: 30 * time.Second, Delay: 3 * time.Second}},
+		FirstMove: repository.FirstMoveGuest,
+		ExpiresAt: invites.created.ExpiresAt,
+	}
+	if *invites.created != want {
+		t.Errorf("stored invite = %+v, want %+v", *invites.created, want)
+	}
+	if until := time.Until(room.ExpiresAt); until <= 0 || until > InviteTTL {
+		t.Errorf("invite expires in %v, want within %v", until, InviteTTL)
+	}
+}
+
+func TestCreatePrivateRoomRejectsInvalidSettings(t *testing.T) {
+	service := NewRoomService(&recordingInviteRepository{})
+
+	tests := map[string]models.CreateRoomRequest{
+		"unknown variant":        {Variant: "chess"},
+		"invalid board":          {Size: 30},
+		"unknown first move":     {First: "me"},
+		"malformed time control": {TimeControl: "5 minutes"},
+		"base time too short":    {TimeControl: "1+0"},
+		"increment too long":     {TimeControl: "60+600"},
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := service.CreatePrivateRoom(context.Background(), "alice", &req); !errors.Is(err, ErrInvalidRoomSettings) {
+				t.Errorf("CreatePrivateRoom() error = %v, want ErrInvalidRoomSettings", err)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"ctchen222/Tic-Tac-Toe/internal/api/models"
 	"ctchen222/Tic-Tac-Toe/internal/api/repository"
 	"errors"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,23 +14,43 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Note: In a real application, this should be loaded from a secure configuration.
-var jwtSecret = []byte("my_super_secret_key")
+// jwtSecret signs the tokens of users and guests. All servers of a deployment
+// must share it, so it is read from JWT_SECRET; the fallback is for development only.
+var jwtSecret = loadJWTSecret()
+
+const (
+	userTokenLifetime  = 72 * time.Hour
+	guestTokenLifetime = 24 * time.Hour
+)
+
+func loadJWTSecret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte("my_super_secret_key")
+}
 
 // UserService defines the interface for user-related business logic.
 type UserService interface {
 	Register(ctx context.Context, req *models.RegisterRequest) error
-	Login(ctx context.Context, req *models.LoginRequest) (string, error)
-	GuestLogin(ctx context.Context) (string, error)
+	Login(ctx context.Context, req *models.LoginRequest) (*models.LoginResponse, error)
+	GuestLogin(ctx context.Context) (*models.GuestLoginResponse, error)
+	GetProfile(ctx context.Context, userID int64) (*models.UserProfile, error)
+	Authenticate(ctx context.Context, tokenString string) (int64, error)
+	PlayerIDFromToken(ctx context.Context, tokenString string) (string, error)
 }
 
+// ErrUserNotFound is returned when a user does not exist.
+var ErrUserNotFound = errors.New("user not found")
+
 type userService struct {
-	userRepo repository.UserRepository
+	userRepo   repository.UserRepository
+	ratingRepo repository.RatingRepository
 }
 
 // NewUserService creates a new UserService.
-func NewUserService(userRepo repository.UserRepository) UserService {
-	return &userService{userRepo: userRepo}
+func NewUserService(userRepo repository.UserRepository, ratingRepo repository.RatingRepository) UserService {
+	return &userService{userRepo: userRepo, ratingRepo: ratingRepo}
 }
 
 // Register handles user registration.
@@ -49,38 +71,132 @@ func (s *userService) Register(ctx context.Context, req *models.RegisterRequest)
 	return s.userRepo.CreateUser(ctx, user, req.Password)
 }
 
-// Login handles user login and returns a JWT on success.
-func (s *userService) Login(ctx context.Context, req *models.LoginRequest) (string, error) {
+// Login handles user login and returns a JWT on success, along with the player
+// ID the user plays under.
+func (s *userService) Login(ctx context.Context, req *models.LoginRequest) (*models.LoginResponse, error) {
 	user, err := s.userRepo.GetUserByUsername(ctx, req.Username)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if user == nil {
-		return "", errors.New("invalid username or password")
+		return nil, errors.New("invalid username or password")
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
-		return "", errors.New("invalid username or password")
+		return nil, errors.New("invalid username or password")
 	}
 
 	// Create JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": user.ID,
 		"un":  user.Username,
-		"exp": time.Now().Add(time.Hour * 72).Unix(),
+		"exp": time.Now().Add(userTokenLifetime).Unix(),
 	})
 
 	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tokenString, nil
+	return &models.LoginResponse{Token: tokenString, PlayerID: models.PlayerIDForUser(user.ID)}, nil
 }
 
-// GuestLogin generates a UUID for a guest player.
-func (s *userService) GuestLogin(ctx context.Context) (string, error) {
+// GuestLogin generates a UUID for a guest player and a signed token carrying it.
+func (s *userService) GuestLogin(ctx context.Context) (*models.GuestLoginResponse, error) {
 	playerID := uuid.New().String()
-	return playerID, nil
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"gst": playerID,
+		"exp": time.Now().Add(guestTokenLifetime).Unix(),
+	})
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.GuestLoginResponse{PlayerID: playerID, Token: tokenString}, nil
+}
+
+// GetProfile returns a user with their ratings.
+func (s *userService) GetProfile(ctx context.Context, userID int64) (*models.UserProfile, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	rating, err := s.ratingRepo.GetRating(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	botRatings, err := s.ratingRepo.GetBotRatings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserProfile{
+		ID:         user.ID,
+		Username:   user.Username,
+		PlayerID:   models.PlayerIDForUser(user.ID),
+		Rating:     *rating,
+		BotRatings: botRatings,
+	}, nil
+}
+
+// Authenticate validates a JWT issued by Login and returns the user ID it was issued for.
+func (s *userService) Authenticate(ctx context.Context, tokenString string) (int64, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	userID, ok := userIDClaim(claims)
+	if !ok {
+		return 0, errors.New("token does not belong to a registered user")
+	}
+	return userID, nil
+}
+
+// PlayerIDFromToken validates a JWT issued by Login or GuestLogin and returns the
+// player ID it identifies: models.PlayerIDForUser for users, the guest's UUID for guests.
+func (s *userService) PlayerIDFromToken(ctx context.Context, tokenString string) (string, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	if userID, ok := userIDClaim(claims); ok {
+		return models.PlayerIDForUser(userID), nil
+	}
+	if guestID, ok := claims["gst"].(string); ok && guestID != "" {
+		return guestID, nil
+	}
+	return "", errors.New("token does not identify a player")
+}
+
+// parseToken verifies the signature and expiry of a token and returns its claims.
+func parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// userIDClaim returns the user ID in the subject of a user token.
+func userIDClaim(claims jwt.MapClaims) (int64, bool) {
+	// Numeric claims are decoded from JSON as float64.
+	sub, ok := claims["sub"].(float64)
+	if !ok || sub <= 0 {
+		return 0, false
+	}
+	return int64(sub), true
 }
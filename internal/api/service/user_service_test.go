@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPlayerIDFromToken(t *testing.T) {
+	ctx := context.Background()
+	users, ratings := newTestRepositories(t)
+	alice := createTestUser(t, users, "alice")
+	service := NewUserService(users, ratings)
+
+	login, err := service.Login(ctx, &models.LoginRequest{Username: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+	playerID, err := service.PlayerIDFromToken(ctx, login.Token)
+	if err != nil || playerID != models.PlayerIDForUser(alice) {
+		t.Errorf("PlayerIDFromToken(user token) = %q, %v; want %q", playerID, err, models.PlayerIDForUser(alice))
+	}
+
+	guest, err := service.GuestLogin(ctx)
+	if err != nil {
+		t.Fatalf("GuestLogin() returned error: %v", err)
+	}
+	playerID, err = service.PlayerIDFromToken(ctx, guest.Token)
+	if err != nil || playerID != guest.PlayerID {
+		t.Errorf("PlayerIDFromToken(guest token) = %q, %v; want %q", playerID, err, guest.PlayerID)
+	}
+	if _, err := service.Authenticate(ctx, guest.Token); err == nil {
+		t.Error("Authenticate(guest token) succeeded, want an error")
+	}
+}
+
+func TestPlayerIDFromTokenRejectsBadTokens(t *testing.T) {
+	ctx := context.Background()
+	users, ratings := newTestRepositories(t)
+	service := NewUserService(users, ratings)
+
+	sign := func(secret []byte, method jwt.SigningMethod, claims jwt.MapClaims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(method, claims).SignedString(secret)
+		if err != nil {
+			t.Fatalf("SignedString() returned error: %v", err)
+		}
+		return token
+	}
+	valid := time.Now().Add(time.Hour).Unix()
+
+	tests := map[string]string{
+		"empty":          "",
+		"garbage":        "not-a-token",
+		"wrong secret":   sign([]byte("another_secret"), jwt.SigningMethodHS256, jwt.MapClaims{"gst": "guest", "exp": valid}),
+		"expired":        sign(jwtSecret, jwt.SigningMethodHS256, jwt.MapClaims{"gst": "guest", "exp": time.Now().Add(-time.Hour).Unix()}),
+		"no expiry":      sign(jwtSecret, jwt.SigningMethodHS256, jwt.MapClaims{"gst": "guest"}),
+		"wrong method":   sign(jwtSecret, jwt.SigningMethodHS512, jwt.MapClaims{"gst": "guest", "exp": valid}),
+		"no identity":    sign(jwtSecret, jwt.SigningMethodHS256, jwt.MapClaims{"exp": valid}),
+		"invalid userID": sign(jwtSecret, jwt.SigningMethodHS256, jwt.MapClaims{"sub": -1, "exp": valid}),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if playerID, err := service.PlayerIDFromToken(ctx, token); err == nil {
+				t.Errorf("PlayerIDFromToken() = %q, want an error", playerID)
+			}
+		})
+	}
+}
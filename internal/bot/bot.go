@@ -1,33 +1,165 @@
 package bot
 
 import (
+	"context"
 	"ctchen222/Tic-Tac-Toe/internal/game"
 	"ctchen222/Tic-Tac-Toe/internal/hub/types"
 	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/room"
 	"ctchen222/Tic-Tac-Toe/pkg/proto"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// botSendTimeout is how long a bot waits for room in a full incomingMoves
+	// channel before dropping an answer to a request. Moves are never dropped:
+	// a bot that doesn't move runs out of time on its clock and loses.
+	botSendTimeout = 5 * time.Second
+)
+
+// ThinkTime is the distribution of the pause a bot takes before moving: a
+// uniformly random duration between Min and Max. Time spent calculating the
+// move counts towards the pause.
+type ThinkTime struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// DefaultThinkTimes maps each difficulty to the think time of its bots.
+// Difficulties without an entry, such as external engines, use the medium one.
+var DefaultThinkTimes = map[string]ThinkTime{
+	"easy":   {Min: 1500 * time.Millisecond, Max: 3 * time.Second},
+	"medium": {Min: 800 * time.Millisecond, Max: 2 * time.Second},
+	"hard":   {Min: 300 * time.Millisecond, Max: time.Second},
+}
+
+// TakebackAcceptance maps each difficulty to the chance its bots accept a
+// takeback request. Difficulties without an entry, such as external engines,
+// always decline.
+var TakebackAcceptance = map[string]float64{
+	"easy":   1,
+	"medium": 0.5,
+	"hard":   0,
+}
+
+// ThinkTimeFor returns the think time for difficulty from thinkTimes, falling
+// back to DefaultThinkTimes.
+func ThinkTimeFor(thinkTimes map[string]ThinkTime, difficulty string) ThinkTime {
+	if t, ok := thinkTimes[difficulty]; ok {
+		return t
+	}
+	if t, ok := DefaultThinkTimes[difficulty]; ok {
+		return t
+	}
+	return DefaultThinkTimes["medium"]
+}
+
+// ParseThinkTimes parses think times in the form "difficulty=min-max;...", for
+// example "easy=2s-4s;hard=200ms-800ms". An empty spec yields no think times.
+func ParseThinkTimes(spec string) (map[string]ThinkTime, error) {
+	thinkTimes := make(map[string]ThinkTime)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		difficulty, bounds, ok := strings.Cut(entry, "=")
+		low, high, okRange := strings.Cut(bounds, "-")
+		if !ok || !okRange || strings.TrimSpace(difficulty) == "" {
+			return nil, fmt.Errorf("think time %q must look like difficulty=min-max", entry)
+		}
+		minimum, err := time.ParseDuration(strings.TrimSpace(low))
+		if err != nil {
+			return nil, fmt.Errorf("think time %q: %w", entry, err)
+		}
+		maximum, err := time.ParseDuration(strings.TrimSpace(high))
+		if err != nil {
+			return nil, fmt.Errorf("think time %q: %w", entry, err)
+		}
+		if minimum < 0 || maximum < minimum {
+			return nil, fmt.Errorf("think time %q: need 0 <= min <= max", entry)
+		}
+		thinkTimes[strings.TrimSpace(difficulty)] = ThinkTime{Min: minimum, Max: maximum}
+	}
+	return thinkTimes, nil
+}
+
+// sample draws a pause from the distribution.
+func (t ThinkTime) sample() time.Duration {
+	if t.Max <= t.Min {
+		return t.Min
+	}
+	return t.Min + rand.N(t.Max-t.Min)
+}
+
+// botTurn is a position the bot has been asked to move in. ctx is cancelled
+// once the position is superseded or the bot is closed.
+type botTurn struct {
+	ctx     context.Context
+	ruleset game.Ruleset
+	state   game.State
+}
+
 // BotConnection simulates a websocket connection for a bot player.
 // It implements the player.Connection interface.
+//
+// WriteMessage never blocks the room: positions where it is the bot's turn are
+// queued for the bot's own goroutine, started with Run, which thinks and then
+// injects the move into the room. A newer message, such as the update after a
+// rematch, cancels the pending turn.
 type BotConnection struct {
 	playerID      string
 	player        *player.Player
 	incomingMoves chan<- *types.PlayerMove
 	mark          game.PlayerMark
 	difficulty    string
+	calculator    room.MoveCalculator
+	thinkTime     ThinkTime
+
+	mu         sync.Mutex
+	cancelTurn context.CancelFunc
+	// position is the position of the turn cancelTurn belongs to.
+	position game.State
+	turns    chan botTurn
+	ctx      context.Context
+	cancel   context.CancelFunc
 }
 
-// NewBotConnection creates a new connection for a bot.
-func NewBotConnection(playerID string, difficulty string, p *player.Player, incomingMoves chan<- *types.PlayerMove) *BotConnection {
+// NewBotConnection creates a new connection for a bot that picks its moves with
+// calculator and pauses for thinkTime before each move. Run must be started for
+// the bot to play.
+func NewBotConnection(playerID string, difficulty string, p *player.Player, incomingMoves chan<- *types.PlayerMove, calculator room.MoveCalculator, thinkTime ThinkTime) *BotConnection {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &BotConnection{
 		playerID:      playerID,
 		player:        p,
 		incomingMoves: incomingMoves,
 		difficulty:    difficulty,
+		calculator:    calculator,
+		thinkTime:     thinkTime,
+		turns:         make(chan botTurn, 1),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Run plays the queued turns until the bot is closed.
+func (bc *BotConnection) Run() {
+	for {
+		select {
+		case <-bc.ctx.Done():
+			return
+		case turn := <-bc.turns:
+			bc.play(turn)
+		}
 	}
 }
 
@@ -44,12 +176,17 @@ func (bc *BotConnection) WriteMessage(messageType int, data []byte) error {
 		return nil // Not a valid message for the bot
 	}
 
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
 	switch msgType {
 	case "assignment":
 		var msg proto.PlayerAssignmentMessage
 		if err := json.Unmarshal(data, &msg); err != nil {
 			return err
 		}
+		// A new assignment starts a new game, so any pending turn is stale.
+		bc.supersedeTurn()
 		bc.mark = msg.Mark
 		slog.Info("Bot has been assigned mark", "bot.id", bc.playerID, "mark", bc.mark)
 
@@ -59,37 +196,144 @@ func (bc *BotConnection) WriteMessage(messageType int, data []byte) error {
 			return err
 		}
 
-		// The bot only acts if it has a mark, it's its turn, and there is no winner
-		if bc.mark != "" && msg.Next == bc.mark && msg.Winner == "" {
-			slog.Info("Bot is thinking...", "bot.id", bc.playerID, "mark", bc.mark)
-			time.Sleep(1 * time.Second) // Simulate thinking time
-
-			row, col := CalculateNextMove(msg.Board, bc.mark, bc.difficulty)
-
-			if row != -1 {
-				slog.Info("Bot calculated move. Injecting into room.", "bot.id", bc.playerID, "row", row, "col", col)
-				move := proto.ClientToServerMessage{
-					Type:     "move",
-					Position: []int{row, col},
-				}
-				moveBytes, _ := json.Marshal(move)
-
-				// Directly inject the move into the room's incoming channel
-				moveToSend := &types.PlayerMove{
-					Player:  bc.player,
-					Message: moveBytes,
-				}
-				bc.incomingMoves <- moveToSend
-
-			} else {
-				slog.Warn("Bot calculated no valid move.", "bot.id", bc.playerID)
+		// The bot only acts if it has a mark, it's its turn, and the game isn't over
+		toMove := bc.mark != "" && msg.Next == bc.mark && msg.Winner == "" && msg.Termination == ""
+		position := game.State{Board: boardFromMessage(&msg), Turn: msg.Next, LastMove: msg.LastMove}
+		// Updates that leave the position alone, such as a new spectator
+		// count, don't interrupt the bot's turn.
+		if toMove && bc.cancelTurn != nil && samePosition(bc.position, position) {
+			return nil
+		}
+		bc.supersedeTurn()
+
+		if toMove {
+			ruleset, err := game.LookupRuleset(msg.Variant)
+			if err != nil {
+				slog.Warn("Bot cannot play unknown variant.", "bot.id", bc.playerID, "variant", msg.Variant)
+				return nil
+			}
+
+			ctx, cancel := context.WithCancel(bc.ctx)
+			bc.cancelTurn = cancel
+			bc.position = position
+			turn := botTurn{
+				ctx:     ctx,
+				ruleset: ruleset,
+				state:   position,
 			}
+			// Replace a turn the bot hasn't picked up yet; only the latest position matters.
+			select {
+			case <-bc.turns:
+			default:
+			}
+			bc.turns <- turn
+			slog.Info("Bot is thinking...", "bot.id", bc.playerID, "mark", bc.mark)
+		}
+
+	case "takeback_request":
+		var msg proto.ServerToClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		if msg.From != bc.playerID {
+			accept := rand.Float64() < TakebackAcceptance[bc.difficulty]
+			go bc.answer(proto.ClientToServerMessage{Type: "takeback_response", Accept: accept})
+		}
+
+	case "draw_offer":
+		var msg proto.ServerToClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		// Bots play on to the end.
+		if msg.From != bc.playerID {
+			go bc.answer(proto.ClientToServerMessage{Type: "decline_draw"})
+		}
+
+	case "opponent_abandoned":
+		var msg proto.ServerToClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		if msg.From != bc.playerID {
+			go bc.answer(proto.ClientToServerMessage{Type: "claim_win"})
 		}
 	}
 
 	return nil
 }
 
+// supersedeTurn cancels the turn the bot is queued for or thinking about.
+// bc.mu must be held.
+func (bc *BotConnection) supersedeTurn() {
+	if bc.cancelTurn != nil {
+		bc.cancelTurn()
+		bc.cancelTurn = nil
+	}
+}
+
+// play calculates a move for turn, waits out the rest of the think time and
+// injects the move into the room, unless the turn is cancelled first.
+func (bc *BotConnection) play(turn botTurn) {
+	thinkTimer := time.NewTimer(bc.thinkTime.sample())
+	defer thinkTimer.Stop()
+
+	nextMove, ok := bc.calculator.CalculateNextMove(turn.ctx, turn.ruleset, turn.state, bc.difficulty)
+	if turn.ctx.Err() != nil {
+		slog.Info("Bot turn cancelled.", "bot.id", bc.playerID)
+		return
+	}
+	if !ok {
+		slog.Warn("Bot calculated no valid move.", "bot.id", bc.playerID)
+		return
+	}
+
+	select {
+	case <-turn.ctx.Done():
+		slog.Info("Bot turn cancelled.", "bot.id", bc.playerID)
+		return
+	case <-thinkTimer.C:
+	}
+	if turn.ctx.Err() != nil {
+		return
+	}
+
+	slog.Info("Bot calculated move. Injecting into room.", "bot.id", bc.playerID, "row", nextMove.Row, "col", nextMove.Col, "piece", nextMove.Piece)
+	move := proto.ClientToServerMessage{
+		Type:     "move",
+		Position: turn.ruleset.Position(nextMove),
+		Piece:    nextMove.Piece,
+	}
+	moveBytes, _ := json.Marshal(move)
+	moveToSend := &types.PlayerMove{
+		Player:  bc.player,
+		Message: moveBytes,
+	}
+
+	// The room may be busy; wait for space until the turn is superseded or the
+	// bot is closed, since its clock keeps running.
+	select {
+	case bc.incomingMoves <- moveToSend:
+	case <-turn.ctx.Done():
+		slog.Info("Bot turn cancelled.", "bot.id", bc.playerID)
+	}
+}
+
+// answer injects the bot's answer to an opponent's request into the room.
+func (bc *BotConnection) answer(msg proto.ClientToServerMessage) {
+	slog.Info("Bot answers request.", "bot.id", bc.playerID, "type", msg.Type, "accept", msg.Accept)
+	data, _ := json.Marshal(msg)
+
+	sendTimer := time.NewTimer(botSendTimeout)
+	defer sendTimer.Stop()
+	select {
+	case bc.incomingMoves <- &types.PlayerMove{Player: bc.player, Message: data}:
+	case <-bc.ctx.Done():
+	case <-sendTimer.C:
+		slog.Warn("Room is not accepting messages. Bot answer dropped.", "bot.id", bc.playerID, "type", msg.Type)
+	}
+}
+
 // ReadMessage is called by the ReadPump. For a bot, we don't read from a real
 // connection. We return an EOF error immediately to signal the ReadPump to exit,
 // preventing it from blocking forever.
@@ -98,7 +342,32 @@ func (bc *BotConnection) ReadMessage() (int, []byte, error) {
 	return 0, nil, io.EOF
 }
 
-// Close is a no-op for the bot.
+// Close stops the bot, cancelling any turn it is thinking about.
 func (bc *BotConnection) Close() error {
+	bc.cancel()
 	return nil
-}
\ No newline at end of file
+}
+
+// samePosition reports whether two positions have the same board, last move
+// and player to move.
+func samePosition(a, b game.State) bool {
+	if a.Turn != b.Turn || a.Board.WinLength != b.Board.WinLength {
+		return false
+	}
+	if (a.LastMove == nil) != (b.LastMove == nil) || (a.LastMove != nil && *a.LastMove != *b.LastMove) {
+		return false
+	}
+	return slices.EqualFunc(a.Board.Cells, b.Board.Cells, func(x, y []game.PlayerMark) bool {
+		return slices.Equal(x, y)
+	})
+}
+
+// boardFromMessage rebuilds the game board from an update message. Messages that
+// don't carry a win length fall back to the usual one for the board size.
+func boardFromMessage(msg *proto.ServerToClientMessage) game.Board {
+	winLength := msg.WinLength
+	if winLength == 0 {
+		winLength = game.DefaultWinLength(len(msg.Board))
+	}
+	return game.Board{Cells: msg.Board, WinLength: winLength}
+}
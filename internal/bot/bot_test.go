@@ -17,7 +17,9 @@ func TestNewBotConnection(t *testing.T) {
 	p := &player.Player{ID: playerID}
 	incomingMoves := make(chan *types.PlayerMove, 1) // Buffered channel for testing
 
-	bc := NewBotConnection(playerID, difficulty, p, incomingMoves)
+	calculator := &BotMoveCalculator{}
+
+	bc := NewBotConnection(playerID, difficulty, p, incomingMoves, calculator, ThinkTime{})
 
 	if bc.playerID != playerID {
 		t.Errorf("Expected playerID %s, got %s", playerID, bc.playerID)
@@ -31,13 +33,16 @@ func TestNewBotConnection(t *testing.T) {
 	if bc.incomingMoves != incomingMoves {
 		t.Error("Expected incomingMoves channel to be set correctly")
 	}
+	if bc.calculator != calculator {
+		t.Error("Expected calculator to be set correctly")
+	}
 	if bc.mark != "" {
 		t.Errorf("Expected initial mark to be empty, got %s", bc.mark)
 	}
 }
 
 func TestBotConnection_WriteMessage_Assignment(t *testing.T) {
-	bc := NewBotConnection("testBot", "easy", &player.Player{}, make(chan *types.PlayerMove, 1))
+	bc := NewBotConnection("testBot", "easy", &player.Player{}, make(chan *types.PlayerMove, 1), &BotMoveCalculator{}, ThinkTime{})
 	assignmentMsg := proto.PlayerAssignmentMessage{
 		Type: "assignment",
 		Mark: game.PlayerX,
@@ -57,7 +62,9 @@ func TestBotConnection_WriteMessage_Assignment(t *testing.T) {
 func TestBotConnection_WriteMessage_Update_BotTurn_MakesMove(t *testing.T) {
 	p := &player.Player{ID: "testBot"}
 	incomingMoves := make(chan *types.PlayerMove, 1)
-	bc := NewBotConnection(p.ID, "easy", p, incomingMoves)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	go bc.Run()
+	defer bc.Close()
 	bc.mark = game.PlayerX // Assign mark first
 
 	updateMsg := proto.ServerToClientMessage{
@@ -94,10 +101,55 @@ func TestBotConnection_WriteMessage_Update_BotTurn_MakesMove(t *testing.T) {
 	}
 }
 
+func TestBotConnection_WriteMessage_Update_Ultimate_PlaysForcedBoard(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove, 1)
+	bc := NewBotConnection(p.ID, "medium", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	go bc.Run()
+	defer bc.Close()
+	bc.mark = game.PlayerO
+
+	// X played the bottom-left cell of the center board, sending O to the bottom-left board.
+	board := game.Ultimate.DefaultConfig().NewBoard()
+	board.Cells[5][3] = game.PlayerX
+	updateMsg := proto.ServerToClientMessage{
+		Type:        "update",
+		Variant:     game.UltimateVariant,
+		Board:       board.Cells,
+		Size:        9,
+		WinLength:   3,
+		Next:        game.PlayerO,
+		LastMove:    &game.Move{Player: game.PlayerX, Piece: game.PlayerX, Row: 5, Col: 3},
+		ForcedBoard: []int{2, 0},
+	}
+	data, _ := json.Marshal(updateMsg)
+
+	go func() {
+		if err := bc.WriteMessage(1, data); err != nil {
+			t.Errorf("WriteMessage failed: %v", err)
+		}
+	}()
+
+	select {
+	case moveToSend := <-incomingMoves:
+		var move proto.ClientToServerMessage
+		if err := json.Unmarshal(moveToSend.Message, &move); err != nil {
+			t.Fatalf("Failed to unmarshal bot's move: %v", err)
+		}
+		if len(move.Position) != 4 || move.Position[0] != 2 || move.Position[1] != 0 {
+			t.Errorf("Expected a move in small board [2, 0], got %+v", move)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Bot did not make a move within the expected time")
+	}
+}
+
 func TestBotConnection_WriteMessage_Update_NotBotTurn_NoMove(t *testing.T) {
 	p := &player.Player{ID: "testBot"}
 	incomingMoves := make(chan *types.PlayerMove, 1)
-	bc := NewBotConnection(p.ID, "easy", p, incomingMoves)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	go bc.Run()
+	defer bc.Close()
 	bc.mark = game.PlayerX
 
 	updateMsg := proto.ServerToClientMessage{
@@ -126,7 +178,9 @@ func TestBotConnection_WriteMessage_Update_NotBotTurn_NoMove(t *testing.T) {
 func TestBotConnection_WriteMessage_Update_GameEnded_NoMove(t *testing.T) {
 	p := &player.Player{ID: "testBot"}
 	incomingMoves := make(chan *types.PlayerMove, 1)
-	bc := NewBotConnection(p.ID, "easy", p, incomingMoves)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	go bc.Run()
+	defer bc.Close()
 	bc.mark = game.PlayerX
 
 	updateMsg := proto.ServerToClientMessage{
@@ -152,8 +206,264 @@ func TestBotConnection_WriteMessage_Update_GameEnded_NoMove(t *testing.T) {
 	}
 }
 
+func TestBotConnection_WriteMessage_DoesNotBlockWhileThinking(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove, 1)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{Min: time.Hour, Max: time.Hour})
+	go bc.Run()
+	defer bc.Close()
+	bc.mark = game.PlayerX
+
+	data, _ := json.Marshal(proto.ServerToClientMessage{
+		Type:  "update",
+		Board: [][]game.PlayerMark{{"", "", ""}, {"", "", ""}, {"", "", ""}},
+		Next:  game.PlayerX,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			if err := bc.WriteMessage(1, data); err != nil {
+				t.Errorf("WriteMessage failed: %v", err)
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("WriteMessage blocked while the bot was thinking")
+	}
+}
+
+func TestBotConnection_Rematch_CancelsPendingTurn(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove, 1)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{Min: 200 * time.Millisecond, Max: 200 * time.Millisecond})
+	go bc.Run()
+	defer bc.Close()
+
+	assignment, _ := json.Marshal(proto.PlayerAssignmentMessage{Type: "assignment", Mark: game.PlayerX})
+	update, _ := json.Marshal(proto.ServerToClientMessage{
+		Type:  "update",
+		Board: [][]game.PlayerMark{{"", "", ""}, {"", "", ""}, {"", "", ""}},
+		Next:  game.PlayerX,
+	})
+	if err := bc.WriteMessage(1, assignment); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+	if err := bc.WriteMessage(1, update); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	// A rematch swaps the marks before the bot has finished thinking.
+	assignment, _ = json.Marshal(proto.PlayerAssignmentMessage{Type: "assignment", Mark: game.PlayerO})
+	if err := bc.WriteMessage(1, assignment); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	select {
+	case <-incomingMoves:
+		t.Error("Bot played a move for a game that was replaced by a rematch")
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestBotConnection_SpectatorUpdates_DoNotRestartTurn(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove, 1)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{Min: 200 * time.Millisecond, Max: 200 * time.Millisecond})
+	go bc.Run()
+	defer bc.Close()
+
+	assignment, _ := json.Marshal(proto.PlayerAssignmentMessage{Type: "assignment", Mark: game.PlayerX})
+	if err := bc.WriteMessage(1, assignment); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	// Spectators keep joining while the bot thinks; only their count changes.
+	deadline := time.After(time.Second)
+	for spectators := 0; ; spectators++ {
+		update, _ := json.Marshal(proto.ServerToClientMessage{
+			Type:       "update",
+			Board:      [][]game.PlayerMark{{"", "", ""}, {"", "", ""}, {"", "", ""}},
+			Next:       game.PlayerX,
+			Spectators: spectators,
+		})
+		if err := bc.WriteMessage(1, update); err != nil {
+			t.Fatalf("WriteMessage failed: %v", err)
+		}
+
+		select {
+		case <-incomingMoves:
+			return
+		case <-deadline:
+			t.Fatal("Bot never moved while spectators came and went")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestBotConnection_Close_StopsBlockedSend(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove) // Nobody reads: the room is busy.
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	stopped := make(chan struct{})
+	go func() {
+		bc.Run()
+		close(stopped)
+	}()
+	bc.mark = game.PlayerX
+
+	data, _ := json.Marshal(proto.ServerToClientMessage{
+		Type:  "update",
+		Board: [][]game.PlayerMark{{"", "", ""}, {"", "", ""}, {"", "", ""}},
+		Next:  game.PlayerX,
+	})
+	if err := bc.WriteMessage(1, data); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	bc.Close()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Bot did not stop after Close while waiting to send its move")
+	}
+}
+
+func TestBotConnection_AnswersTakebackRequests(t *testing.T) {
+	tests := []struct {
+		difficulty string
+		want       bool
+	}{
+		{"easy", true},
+		{"hard", false},
+		{"engine:stockfish", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.difficulty, func(t *testing.T) {
+			p := &player.Player{ID: "testBot"}
+			incomingMoves := make(chan *types.PlayerMove, 1)
+			bc := NewBotConnection(p.ID, tt.difficulty, p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+			defer bc.Close()
+
+			data, _ := json.Marshal(proto.ServerToClientMessage{Type: "takeback_request", From: "human"})
+			if err := bc.WriteMessage(1, data); err != nil {
+				t.Fatalf("WriteMessage failed: %v", err)
+			}
+
+			select {
+			case answer := <-incomingMoves:
+				var msg proto.ClientToServerMessage
+				if err := json.Unmarshal(answer.Message, &msg); err != nil {
+					t.Fatalf("Could not unmarshal answer: %v", err)
+				}
+				if answer.Player != p || msg.Type != "takeback_response" || msg.Accept != tt.want {
+					t.Errorf("got %+v, want a takeback_response with accept %v", msg, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Bot did not answer the takeback request")
+			}
+		})
+	}
+}
+
+func TestBotConnection_DeclinesDrawOffers(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove, 1)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	defer bc.Close()
+
+	data, _ := json.Marshal(proto.ServerToClientMessage{Type: "draw_offer", From: "human"})
+	if err := bc.WriteMessage(1, data); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	select {
+	case answer := <-incomingMoves:
+		var msg proto.ClientToServerMessage
+		if err := json.Unmarshal(answer.Message, &msg); err != nil {
+			t.Fatalf("Could not unmarshal answer: %v", err)
+		}
+		if msg.Type != "decline_draw" {
+			t.Errorf("got %+v, want decline_draw", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Bot did not answer the draw offer")
+	}
+}
+
+func TestBotConnection_ClaimsWinWhenOpponentAbandons(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove, 1)
+	bc := NewBotConnection(p.ID, "hard", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	defer bc.Close()
+
+	data, _ := json.Marshal(proto.ServerToClientMessage{Type: "opponent_abandoned", From: "human"})
+	if err := bc.WriteMessage(1, data); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	select {
+	case answer := <-incomingMoves:
+		var msg proto.ClientToServerMessage
+		if err := json.Unmarshal(answer.Message, &msg); err != nil {
+			t.Fatalf("Could not unmarshal answer: %v", err)
+		}
+		if msg.Type != "claim_win" {
+			t.Errorf("got %+v, want claim_win", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Bot did not claim the win")
+	}
+}
+
+func TestBotConnection_IgnoresOwnTakebackRequest(t *testing.T) {
+	p := &player.Player{ID: "testBot"}
+	incomingMoves := make(chan *types.PlayerMove, 1)
+	bc := NewBotConnection(p.ID, "easy", p, incomingMoves, &BotMoveCalculator{}, ThinkTime{})
+	defer bc.Close()
+
+	data, _ := json.Marshal(proto.ServerToClientMessage{Type: "takeback_request", From: p.ID})
+	if err := bc.WriteMessage(1, data); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	select {
+	case answer := <-incomingMoves:
+		t.Errorf("Bot answered its own request: %s", answer.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestParseThinkTimes(t *testing.T) {
+	thinkTimes, err := ParseThinkTimes("easy=2s-4s; hard = 200ms-800ms")
+	if err != nil {
+		t.Fatalf("ParseThinkTimes() returned error: %v", err)
+	}
+	if thinkTimes["easy"] != (ThinkTime{Min: 2 * time.Second, Max: 4 * time.Second}) ||
+		thinkTimes["hard"] != (ThinkTime{Min: 200 * time.Millisecond, Max: 800 * time.Millisecond}) {
+		t.Errorf("ParseThinkTimes() got %+v", thinkTimes)
+	}
+	if got := ThinkTimeFor(thinkTimes, "medium"); got != DefaultThinkTimes["medium"] {
+		t.Errorf("ThinkTimeFor(medium) got %+v, want the default", got)
+	}
+	if got := ThinkTimeFor(thinkTimes, "some-engine"); got != DefaultThinkTimes["medium"] {
+		t.Errorf("ThinkTimeFor(some-engine) got %+v, want the medium default", got)
+	}
+
+	for _, spec := range []string{"easy", "easy=1s", "easy=2s-1s", "easy=x-1s"} {
+		if _, err := ParseThinkTimes(spec); err == nil {
+			t.Errorf("ParseThinkTimes(%q) expected an error", spec)
+		}
+	}
+}
+
 func TestBotConnection_ReadMessage(t *testing.T) {
-	bc := NewBotConnection("testBot", "easy", &player.Player{}, make(chan *types.PlayerMove, 1))
+	bc := NewBotConnection("testBot", "easy", &player.Player{}, make(chan *types.PlayerMove, 1), &BotMoveCalculator{}, ThinkTime{})
 	_, _, err := bc.ReadMessage()
 	if err != io.EOF {
 		t.Errorf("Expected ReadMessage to return io.EOF, got %v", err)
@@ -161,7 +471,7 @@ func TestBotConnection_ReadMessage(t *testing.T) {
 }
 
 func TestBotConnection_Close(t *testing.T) {
-	bc := NewBotConnection("testBot", "easy", &player.Player{}, make(chan *types.PlayerMove, 1))
+	bc := NewBotConnection("testBot", "easy", &player.Player{}, make(chan *types.PlayerMove, 1), &BotMoveCalculator{}, ThinkTime{})
 	err := bc.Close()
 	if err != nil {
 		t.Errorf("Expected Close to return nil, got %v", err)
@@ -0,0 +1,435 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// External engines are separate programs that talk to the server over stdin and
+// stdout, one command or reply per line, much like UCI for chess engines.
+//
+// Server to engine:
+//
+//	tttp                                    start of session; answer with tttpok
+//	newgame <variant> <size> <winLength>    the following positions belong to a new game
+//	position <rows> turn <X|O> [lastmove <row> <col> <player> <piece>]
+//	                                        rows are the board rows joined by "/", with
+//	                                        "X", "O" and "." for an empty cell
+//	time <milliseconds>                     time left to answer the next go
+//	go                                      search the position; answer with bestmove
+//	stop                                    stop searching; answer with bestmove at once
+//	quit                                    end of session; the engine should exit
+//
+// Engine to server:
+//
+//	tttpok                                  ready for commands
+//	bestmove <row> <col> [<piece>]          the chosen move, in board coordinates
+//
+// Any other line from the engine, such as "info ..." or "id name ...", is ignored.
+const (
+	engineHandshakeTimeout = 5 * time.Second
+	// engineGracePeriod is added to the move time before an engine is considered stuck.
+	engineGracePeriod = 500 * time.Millisecond
+	// Restarts after a crash are delayed by a backoff that doubles up to engineMaxBackoff.
+	engineMinBackoff = time.Second
+	engineMaxBackoff = time.Minute
+)
+
+var (
+	ErrEngineUnavailable = errors.New("engine is not available")
+	ErrEngineTimeout     = errors.New("engine did not answer in time")
+)
+
+// EngineConfig describes an external engine and how it is run.
+type EngineConfig struct {
+	// Name is the difficulty value that selects the engine.
+	Name    string
+	Command string
+	Args    []string
+	// MoveTime is the time the engine gets for each move.
+	MoveTime time.Duration
+	// Fallback is the built-in difficulty used when the engine cannot answer.
+	Fallback string
+}
+
+// ParseEngineConfigs parses engine definitions of the form
+// "name=command arg...;name=command arg...", as used by the BOT_ENGINES variable.
+func ParseEngineConfigs(spec string) ([]EngineConfig, error) {
+	var configs []EngineConfig
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, command, ok := strings.Cut(entry, "=")
+		fields := strings.Fields(command)
+		if !ok || strings.TrimSpace(name) == "" || len(fields) == 0 {
+			return nil, fmt.Errorf("invalid engine definition %q", entry)
+		}
+		configs = append(configs, EngineConfig{Name: strings.TrimSpace(name), Command: fields[0], Args: fields[1:]})
+	}
+	return configs, nil
+}
+
+// ExternalEngine runs an engine subprocess and asks it for moves. The process is
+// started on first use and restarted, after a backoff, when it crashes or stops
+// answering. Requests are serialised; an engine process thinks about one position
+// at a time.
+type ExternalEngine struct {
+	cfg EngineConfig
+
+	mu         sync.Mutex
+	proc       *engineProcess
+	minBackoff time.Duration
+	backoff    time.Duration
+	nextStart  time.Time
+	lastGame   string
+	lastMoves  int
+}
+
+// NewExternalEngine creates a supervisor for the engine described by cfg.
+func NewExternalEngine(cfg EngineConfig) *ExternalEngine {
+	if cfg.MoveTime <= 0 {
+		cfg.MoveTime = 2 * time.Second
+	}
+	if cfg.Fallback == "" {
+		cfg.Fallback = "medium"
+	}
+	return &ExternalEngine{cfg: cfg, minBackoff: engineMinBackoff}
+}
+
+// Name returns the difficulty value that selects the engine.
+func (e *ExternalEngine) Name() string {
+	return e.cfg.Name
+}
+
+// BestMove asks the engine for a move in the given position. The move is checked
+// against the ruleset before it is returned. Once ctx is done the engine is told
+// to stop searching and ctx's error is returned.
+func (e *ExternalEngine) BestMove(ctx context.Context, ruleset game.Ruleset, state game.State) (game.Move, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return game.Move{}, err
+	}
+	if err := e.ensureStarted(); err != nil {
+		return game.Move{}, err
+	}
+
+	move, err := e.request(ctx, ruleset, state)
+	if err != nil {
+		switch {
+		case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+			e.stopSearch()
+		case errors.Is(err, ErrEngineTimeout), errors.Is(err, io.EOF), errors.Is(err, io.ErrClosedPipe):
+			e.crashed(err)
+		}
+		return game.Move{}, err
+	}
+	return move, nil
+}
+
+// stopSearch ends the search of a position nobody waits for anymore and
+// discards its bestmove, so the engine is ready for the next one. Engines that
+// don't stop in time are restarted.
+func (e *ExternalEngine) stopSearch() {
+	err := e.proc.send("stop")
+	if err == nil {
+		_, err = e.proc.expect(context.Background(), "bestmove", engineGracePeriod)
+	}
+	if err != nil {
+		e.crashed(fmt.Errorf("engine did not stop searching: %w", err))
+	}
+}
+
+// Close stops the engine process.
+func (e *ExternalEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.proc == nil {
+		return nil
+	}
+	err := e.proc.stop()
+	e.proc = nil
+	return err
+}
+
+func (e *ExternalEngine) ensureStarted() error {
+	if e.proc != nil && !e.proc.exited() {
+		return nil
+	}
+	if e.proc != nil {
+		e.crashed(errors.New("engine process exited"))
+	}
+	if time.Now().Before(e.nextStart) {
+		return ErrEngineUnavailable
+	}
+
+	proc, err := startEngineProcess(e.cfg)
+	if err != nil {
+		e.crashed(err)
+		return fmt.Errorf("%w: %v", ErrEngineUnavailable, err)
+	}
+	slog.Info("External engine started", "engine", e.cfg.Name, "pid", proc.cmd.Process.Pid)
+	e.proc = proc
+	e.backoff = 0
+	e.lastGame = ""
+	return nil
+}
+
+// crashed tears down the process and schedules the next start.
+func (e *ExternalEngine) crashed(reason error) {
+	if e.proc != nil {
+		_ = e.proc.stop()
+		e.proc = nil
+	}
+	if e.backoff == 0 {
+		e.backoff = e.minBackoff
+	} else {
+		e.backoff = min(2*e.backoff, engineMaxBackoff)
+	}
+	e.nextStart = time.Now().Add(e.backoff)
+	slog.Warn("External engine stopped, restarting after backoff", "engine", e.cfg.Name, "backoff", e.backoff, "error", reason)
+}
+
+func (e *ExternalEngine) request(ctx context.Context, ruleset game.Ruleset, state game.State) (game.Move, error) {
+	cfg := game.Config{Variant: ruleset.Name(), Size: state.Board.Size(), WinLength: state.Board.WinLength}
+	moves := state.Board.Size()*state.Board.Size() - countEmpty(state.Board)
+	if cfg.Key() != e.lastGame || moves <= e.lastMoves {
+		if err := e.proc.send(fmt.Sprintf("newgame %s %d %d", cfg.Variant, cfg.Size, cfg.WinLength)); err != nil {
+			return game.Move{}, err
+		}
+	}
+	e.lastGame, e.lastMoves = cfg.Key(), moves
+
+	commands := []string{
+		formatPosition(state),
+		fmt.Sprintf("time %d", e.cfg.MoveTime.Milliseconds()),
+		"go",
+	}
+	for _, command := range commands {
+		if err := e.proc.send(command); err != nil {
+			return game.Move{}, err
+		}
+	}
+
+	line, err := e.proc.expect(ctx, "bestmove", e.cfg.MoveTime+engineGracePeriod)
+	if err != nil {
+		return game.Move{}, err
+	}
+	move, err := parseBestMove(line, state)
+	if err != nil {
+		return game.Move{}, err
+	}
+	if _, err := ruleset.Apply(state, move); err != nil {
+		return game.Move{}, fmt.Errorf("engine played an illegal move %q: %w", line, err)
+	}
+	return move, nil
+}
+
+// formatPosition encodes a position as a "position" command.
+func formatPosition(state game.State) string {
+	rows := make([]string, len(state.Board.Cells))
+	for r, rowData := range state.Board.Cells {
+		var b strings.Builder
+		for _, cell := range rowData {
+			if cell == game.None {
+				b.WriteByte('.')
+			} else {
+				b.WriteString(string(cell))
+			}
+		}
+		rows[r] = b.String()
+	}
+
+	command := fmt.Sprintf("position %s turn %s", strings.Join(rows, "/"), state.Turn)
+	if last := state.LastMove; last != nil {
+		command += fmt.Sprintf(" lastmove %d %d %s %s", last.Row, last.Col, last.Player, last.Piece)
+	}
+	return command
+}
+
+// parseBestMove parses a "bestmove <row> <col> [<piece>]" reply. Without a piece
+// the player places their own mark.
+func parseBestMove(line string, state game.State) (game.Move, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields) > 4 || fields[0] != "bestmove" {
+		return game.Move{}, fmt.Errorf("malformed bestmove %q", line)
+	}
+	row, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return game.Move{}, fmt.Errorf("malformed bestmove %q: %w", line, err)
+	}
+	col, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return game.Move{}, fmt.Errorf("malformed bestmove %q: %w", line, err)
+	}
+	piece := state.Turn
+	if len(fields) == 4 {
+		piece = game.PlayerMark(fields[3])
+	}
+	return game.Move{Player: state.Turn, Piece: piece, Row: row, Col: col}, nil
+}
+
+// engineProcess is a running engine and the lines it has written.
+type engineProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string
+	done  chan struct{}
+	// stopping is closed once the engine is told to quit, after which its
+	// output is discarded.
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+func startEngineProcess(cfg EngineConfig) (*engineProcess, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &engineProcess{cmd: cmd, stdin: stdin, lines: make(chan string, 16), done: make(chan struct{}), stopping: make(chan struct{})}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			// Every line is kept for expect, which skips the chatter, so a
+			// burst of output can't push out a reply.
+			select {
+			case p.lines <- scanner.Text():
+			case <-p.stopping:
+			}
+		}
+		close(p.lines)
+		_ = cmd.Wait()
+		close(p.done)
+	}()
+
+	if err := p.send("tttp"); err != nil {
+		_ = p.stop()
+		return nil, err
+	}
+	if _, err := p.expect(context.Background(), "tttpok", engineHandshakeTimeout); err != nil {
+		_ = p.stop()
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+	return p, nil
+}
+
+func (p *engineProcess) send(command string) error {
+	_, err := io.WriteString(p.stdin, command+"\n")
+	if err != nil {
+		return fmt.Errorf("%w: %v", io.ErrClosedPipe, err)
+	}
+	return nil
+}
+
+// expect waits for a line starting with keyword, skipping any other output,
+// until timeout or until ctx is done.
+func (p *engineProcess) expect(ctx context.Context, keyword string, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return "", io.EOF
+			}
+			if line == keyword || strings.HasPrefix(line, keyword+" ") {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", ErrEngineTimeout
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func (p *engineProcess) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop asks the engine to quit and kills it if it doesn't.
+func (p *engineProcess) stop() error {
+	p.stopOnce.Do(func() { close(p.stopping) })
+	_ = p.send("quit")
+	_ = p.stdin.Close()
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(engineGracePeriod):
+		return p.cmd.Process.Kill()
+	}
+}
+
+// EngineCalculator implements room.MoveCalculator with external engines. A
+// difficulty naming a registered engine asks that engine; any other difficulty,
+// and any move the engine fails to deliver, goes to the built-in fallback.
+type EngineCalculator struct {
+	engines  map[string]*ExternalEngine
+	fallback room.MoveCalculator
+}
+
+// NewEngineCalculator creates a calculator that selects engines by name and
+// otherwise uses fallback.
+func NewEngineCalculator(fallback room.MoveCalculator, engines ...*ExternalEngine) *EngineCalculator {
+	byName := make(map[string]*ExternalEngine, len(engines))
+	for _, engine := range engines {
+		byName[engine.Name()] = engine
+	}
+	return &EngineCalculator{engines: byName, fallback: fallback}
+}
+
+// CalculateNextMove asks the engine registered under difficulty, if any.
+func (c *EngineCalculator) CalculateNextMove(ctx context.Context, ruleset game.Ruleset, state game.State, difficulty string) (game.Move, bool) {
+	engine, ok := c.engines[difficulty]
+	if !ok {
+		return c.fallback.CalculateNextMove(ctx, ruleset, state, difficulty)
+	}
+
+	move, err := engine.BestMove(ctx, ruleset, state)
+	if ctx.Err() != nil {
+		return game.Move{}, false
+	}
+	if err != nil {
+		slog.Warn("External engine failed, using built-in bot", "engine", engine.Name(), "fallback", engine.cfg.Fallback, "error", err)
+		return c.fallback.CalculateNextMove(ctx, ruleset, state, engine.cfg.Fallback)
+	}
+	return move, true
+}
+
+// Close stops every engine process.
+func (c *EngineCalculator) Close() error {
+	var errs []error
+	for _, engine := range c.engines {
+		errs = append(errs, engine.Close())
+	}
+	return errors.Join(errs...)
+}
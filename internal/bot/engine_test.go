@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const engineHelperEnv = "TTT_ENGINE_HELPER"
+
+// TestEngineHelperProcess is not a real test: it is run as a fake external engine
+// by the tests below, with its behaviour chosen by TTT_ENGINE_HELPER.
+func TestEngineHelperProcess(t *testing.T) {
+	mode := os.Getenv(engineHelperEnv)
+	if mode == "" {
+		return
+	}
+
+	var position string
+	searching := false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "tttp":
+			fmt.Println("id name helper")
+			fmt.Println("tttpok")
+		case "position":
+			position = fields[1]
+		case "go":
+			switch mode {
+			case "slow":
+				continue
+			case "stoppable":
+				searching = true
+				continue
+			case "crash":
+				os.Exit(3)
+			case "illegal":
+				fmt.Println("bestmove 9 9")
+				continue
+			}
+			if mode == "chatty" {
+				for i := 0; i < 100; i++ {
+					fmt.Printf("info depth %d\n", i)
+				}
+			}
+			// Play the first empty cell.
+			for r, row := range strings.Split(position, "/") {
+				if c := strings.IndexByte(row, '.'); c >= 0 {
+					fmt.Println("info thinking")
+					fmt.Printf("bestmove %d %d\n", r, c)
+					break
+				}
+			}
+		case "stop":
+			if searching {
+				searching = false
+				fmt.Println("bestmove 0 1")
+			}
+		case "quit":
+			os.Exit(0)
+		}
+	}
+	os.Exit(0)
+}
+
+func newHelperEngine(t *testing.T, mode string) *ExternalEngine {
+	t.Setenv(engineHelperEnv, mode)
+	engine := NewExternalEngine(EngineConfig{
+		Name:     "helper",
+		Command:  os.Args[0],
+		Args:     []string{"-test.run=^TestEngineHelperProcess$"},
+		MoveTime: 200 * time.Millisecond,
+		Fallback: "hard",
+	})
+	engine.minBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+func classicState() game.State {
+	board := game.NewBoard(3, 3)
+	board.Cells[0][0] = game.PlayerX
+	return game.State{Board: board, Turn: game.PlayerO, LastMove: &game.Move{Player: game.PlayerX, Piece: game.PlayerX}}
+}
+
+func TestExternalEngineBestMove(t *testing.T) {
+	engine := newHelperEngine(t, "first")
+
+	move, err := engine.BestMove(context.Background(), game.Classic, classicState())
+	if err != nil {
+		t.Fatalf("BestMove() returned error: %v", err)
+	}
+	if move != (game.Move{Player: game.PlayerO, Piece: game.PlayerO, Row: 0, Col: 1}) {
+		t.Errorf("BestMove() got %+v, want O at (0, 1)", move)
+	}
+
+	// The same process answers the next request.
+	pid := engine.proc.cmd.Process.Pid
+	if _, err := engine.BestMove(context.Background(), game.Classic, classicState()); err != nil {
+		t.Fatalf("second BestMove() returned error: %v", err)
+	}
+	if engine.proc.cmd.Process.Pid != pid {
+		t.Error("engine was restarted between requests")
+	}
+}
+
+func TestExternalEngineKeepsBestMoveAfterChatter(t *testing.T) {
+	engine := newHelperEngine(t, "chatty")
+	for i := 0; i < 5; i++ {
+		if _, err := engine.BestMove(context.Background(), game.Classic, classicState()); err != nil {
+			t.Fatalf("BestMove() %d returned error: %v", i, err)
+		}
+	}
+}
+
+func TestExternalEngineFailures(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr error
+	}{
+		{mode: "slow", wantErr: ErrEngineTimeout},
+		{mode: "illegal", wantErr: game.ErrInvalidMove},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			engine := newHelperEngine(t, tt.mode)
+			if _, err := engine.BestMove(context.Background(), game.Classic, classicState()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("BestMove() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExternalEngineStopsCancelledSearch(t *testing.T) {
+	engine := newHelperEngine(t, "stoppable")
+
+	// A cancelled search is stopped rather than waited out, and the engine is
+	// kept for the next position.
+	var pid int
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		_, err := engine.BestMove(ctx, game.Classic, classicState())
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("BestMove() error = %v, want context.DeadlineExceeded", err)
+		}
+		if elapsed := time.Since(start); elapsed >= engine.cfg.MoveTime {
+			t.Errorf("cancelled BestMove() took %v, want less than the move time", elapsed)
+		}
+		if engine.proc == nil || (pid != 0 && engine.proc.cmd.Process.Pid != pid) {
+			t.Fatal("engine was restarted after a cancelled search")
+		}
+		pid = engine.proc.cmd.Process.Pid
+	}
+}
+
+func TestExternalEngineRestartsAfterCrash(t *testing.T) {
+	engine := newHelperEngine(t, "crash")
+	if _, err := engine.BestMove(context.Background(), game.Classic, classicState()); err == nil {
+		t.Fatal("BestMove() on a crashing engine returned no error")
+	}
+	if engine.proc != nil {
+		t.Fatal("crashed engine process was not cleared")
+	}
+
+	// Within the backoff the engine is not started again.
+	if _, err := engine.BestMove(context.Background(), game.Classic, classicState()); !errors.Is(err, ErrEngineUnavailable) {
+		t.Fatalf("BestMove() during backoff error = %v, want ErrEngineUnavailable", err)
+	}
+
+	t.Setenv(engineHelperEnv, "first")
+	time.Sleep(2 * engine.backoff)
+	if _, err := engine.BestMove(context.Background(), game.Classic, classicState()); err != nil {
+		t.Fatalf("BestMove() after restart returned error: %v", err)
+	}
+}
+
+func TestEngineCalculatorFallsBack(t *testing.T) {
+	calculator := NewEngineCalculator(&BotMoveCalculator{}, newHelperEngine(t, "slow"))
+
+	// O must block X's row; the built-in hard bot does, the stuck engine can't.
+	board := classicBoard([][]game.PlayerMark{
+		{game.PlayerX, game.PlayerX, ""},
+		{game.PlayerO, "", ""},
+		{"", "", ""},
+	})
+	move, ok := calculator.CalculateNextMove(context.Background(), game.Classic, game.State{Board: board, Turn: game.PlayerO}, "helper")
+	if !ok || move.Row != 0 || move.Col != 2 {
+		t.Errorf("CalculateNextMove() got %+v, %v; want the fallback to block at (0, 2)", move, ok)
+	}
+
+	// Other difficulties never reach the engine.
+	if _, ok := calculator.CalculateNextMove(context.Background(), game.Classic, game.State{Board: board, Turn: game.PlayerO}, "easy"); !ok {
+		t.Error("CalculateNextMove() with a built-in difficulty found no move")
+	}
+}
+
+func TestParseEngineConfigs(t *testing.T) {
+	configs, err := ParseEngineConfigs("alpha=/usr/bin/alpha --fast; beta = ./beta")
+	if err != nil {
+		t.Fatalf("ParseEngineConfigs() returned error: %v", err)
+	}
+	if len(configs) != 2 || configs[0].Name != "alpha" || configs[0].Command != "/usr/bin/alpha" ||
+		len(configs[0].Args) != 1 || configs[1].Name != "beta" || configs[1].Command != "./beta" {
+		t.Errorf("ParseEngineConfigs() got %+v", configs)
+	}
+
+	for _, spec := range []string{"alpha", "=cmd", "alpha="} {
+		if _, err := ParseEngineConfigs(spec); err == nil {
+			t.Errorf("ParseEngineConfigs(%q) expected an error", spec)
+		}
+	}
+}
+
+func TestFormatPosition(t *testing.T) {
+	state := classicState()
+	want := "position X../.../... turn O lastmove 0 0 X X"
+	if got := formatPosition(state); got != want {
+		t.Errorf("formatPosition() got %q, want %q", got, want)
+	}
+}
@@ -1,23 +1,54 @@
 package bot
 
 import (
+	"context"
 	"ctchen222/Tic-Tac-Toe/internal/game"
 	"math/rand/v2"
 )
 
-// BotMoveCalculator implements the room.MoveCalculator interface.
-type BotMoveCalculator struct{}
+// BotMoveCalculator implements the room.MoveCalculator interface. Games on the
+// classic 3x3 board use ChooseMove; larger boards are searched by the MCTS engine
+// with the difficulty's budget. Without an engine every game uses ChooseMove.
+type BotMoveCalculator struct {
+	engine *MCTS
+}
+
+// NewMoveCalculator creates a calculator that plays large boards with engine.
+func NewMoveCalculator(engine *MCTS) *BotMoveCalculator {
+	return &BotMoveCalculator{engine: engine}
+}
+
+// CalculateNextMove picks the bot's move for the player whose turn it is.
+// Only engine searches stop early when ctx is done; the heuristics are quick.
+func (c *BotMoveCalculator) CalculateNextMove(ctx context.Context, ruleset game.Ruleset, state game.State, difficulty string) (game.Move, bool) {
+	if c.engine != nil && state.Board.Size() > game.DefaultBoardSize {
+		return c.engine.CalculateNextMove(ctx, ruleset, state, difficulty)
+	}
+	return ChooseMove(ruleset, state, difficulty)
+}
 
-// CalculateNextMove calls the package-level function to satisfy the interface.
-func (c *BotMoveCalculator) CalculateNextMove(board [][]game.PlayerMark, mark game.PlayerMark, difficulty string) (row, col int) {
-	return CalculateNextMove(board, mark, difficulty)
+// ChooseMove picks a move for the player whose turn it is. Classic games use the
+// heuristics below; other variants are played through their ruleset.
+func ChooseMove(ruleset game.Ruleset, state game.State, difficulty string) (game.Move, bool) {
+	if meta, ok := ruleset.(game.MetaRuleset); ok {
+		return ultimateMove(meta, state, difficulty)
+	}
+	if ruleset.Name() != game.Classic.Name() {
+		return rulesetMove(ruleset, state, difficulty)
+	}
+
+	row, col := CalculateNextMove(state.Board, state.Turn, difficulty)
+	if row == -1 || col == -1 {
+		return game.Move{}, false
+	}
+	return game.Move{Player: state.Turn, Piece: state.Turn, Row: row, Col: col}, true
 }
 
-// CalculateNextMove determines the bot's next move based on the specified difficulty.
-func CalculateNextMove(board [][]game.PlayerMark, botMark game.PlayerMark, difficulty string) (row, col int) {
+// CalculateNextMove determines the bot's next move in a classic game based on the specified difficulty.
+func CalculateNextMove(board game.Board, botMark game.PlayerMark, difficulty string) (row, col int) {
 	switch difficulty {
 	case "easy":
-		return easyMove(board)
+		return easyMove(board.Cells)
 	case "medium":
 		return mediumMove(board, botMark)
 	case "hard":
@@ -47,7 +78,7 @@ func easyMove(board [][]game.PlayerMark) (row, col int) {
 }
 
 // mediumMove will win if it can, block if it must, otherwise move randomly.
-func mediumMove(board [][]game.PlayerMark, botMark game.PlayerMark) (row, col int) {
+func mediumMove(board game.Board, botMark game.PlayerMark) (row, col int) {
 	opponentMark := game.PlayerX
 	if botMark == game.PlayerX {
 		opponentMark = game.PlayerO
@@ -66,16 +97,19 @@ func mediumMove(board [][]game.PlayerMark, botMark game.PlayerMark) (row, col in
 	}
 
 	// 3. Random: Otherwise, make a random move
-	return easyMove(board)
+	return easyMove(board.Cells)
 }
 
-// hardMove implements the optimal strategy.
-func hardMove(board [][]game.PlayerMark, botMark game.PlayerMark) (row, col int) {
-	opponentMark := game.PlayerX
-	if botMark == game.PlayerX {
-		opponentMark = game.PlayerO
+// hardMove plays perfectly whenever the position is small enough to search to the
+// end, which always includes the classic board. Larger positions win if they can,
+// block if they must, and otherwise use a positional heuristic.
+func hardMove(board game.Board, botMark game.PlayerMark) (row, col int) {
+	if row, col, ok := perfectMove(board, botMark); ok {
+		return row, col
 	}
 
+	opponentMark := game.Opponent(botMark)
+
 	// 1. Win: Check if the bot can win in the next move
 	nextRow, nextCol, canWin := findWinningMove(board, botMark)
 	if canWin {
@@ -88,91 +122,92 @@ func hardMove(board [][]game.PlayerMark, botMark game.PlayerMark) (row, col int)
 		return nextRow, nextCol
 	}
 
-	// 3. Center: Take the center if it's available
-	if board[1][1] == "" {
-		return 1, 1
-	}
-
-	// 4. Corners: Take an available corner randomly
-	availableCorners := [][2]int{}
-	corners := [][2]int{{0, 0}, {0, 2}, {2, 0}, {2, 2}}
-	for _, corner := range corners {
-		if board[corner[0]][corner[1]] == "" {
-			availableCorners = append(availableCorners, corner)
-		}
-	}
-	if len(availableCorners) > 0 {
-		randomCorner := availableCorners[rand.IntN(len(availableCorners))]
-		return randomCorner[0], randomCorner[1]
-	}
+	// 3. Position: Otherwise pick the most promising cell
+	return positionalMove(board, botMark, opponentMark)
+}
 
-	// 5. Sides: Take any available side randomly
-	availableSides := [][2]int{}
-	sides := [][2]int{{0, 1}, {1, 0}, {1, 2}, {2, 1}}
-	for _, side := range sides {
-		if board[side[0]][side[1]] == "" {
-			availableSides = append(availableSides, side)
+// findWinningMove checks if a player has a potential winning move, i.e. an empty
+// cell that completes a line of the board's win length.
+func findWinningMove(board game.Board, mark game.PlayerMark) (row, col int, found bool) {
+	for r, rowData := range board.Cells {
+		for c, cell := range rowData {
+			if cell == "" && board.IsWinningMove(r, c, mark) {
+				return r, c, true
+			}
 		}
 	}
-	if len(availableSides) > 0 {
-		randomSide := availableSides[rand.IntN(len(availableSides))]
-		return randomSide[0], randomSide[1]
-	}
 
-	// Should not happen in a normal game, but as a fallback
-	return -1, -1
+	return -1, -1, false
 }
 
-// findWinningMove checks if a player has a potential winning move (two in a row with an empty third).
-func findWinningMove(board [][]game.PlayerMark, mark game.PlayerMark) (row, col int, found bool) {
-	// Check rows
-	for r := range [3]int{} {
-		if board[r][0] == mark && board[r][1] == mark && board[r][2] == "" {
-			return r, 2, true
-		}
-		if board[r][0] == mark && board[r][2] == mark && board[r][1] == "" {
-			return r, 1, true
-		}
-		if board[r][1] == mark && board[r][2] == mark && board[r][0] == "" {
-			return r, 0, true
+// positionalMove scores every empty cell by the lines of win length passing through it.
+// Lines the bot can still complete count towards attack, lines only the opponent can
+// complete count towards defence, and longer partial lines weigh more. Cells closer to the
+// centre win otherwise equal scores, and remaining ties are broken randomly.
+func positionalMove(board game.Board, botMark, opponentMark game.PlayerMark) (row, col int) {
+	size := board.Size()
+	center := (size - 1) / 2
+	bestScore := -1
+	var bestMoves [][2]int
+	for r, rowData := range board.Cells {
+		for c, cell := range rowData {
+			if cell != "" {
+				continue
+			}
+			distance := abs(r-center) + abs(c-center)
+			score := cellScore(board, r, c, botMark, opponentMark)*(2*size+1) + 2*size - distance
+			if score > bestScore {
+				bestScore = score
+				bestMoves = bestMoves[:0]
+			}
+			if score == bestScore {
+				bestMoves = append(bestMoves, [2]int{r, c})
+			}
 		}
 	}
 
-	// Check columns
-	for c := range [3]int{} {
-		if board[0][c] == mark && board[1][c] == mark && board[2][c] == "" {
-			return 2, c, true
-		}
-		if board[0][c] == mark && board[2][c] == mark && board[1][c] == "" {
-			return 1, c, true
-		}
-		if board[1][c] == mark && board[2][c] == mark && board[0][c] == "" {
-			return 0, c, true
-		}
+	if len(bestMoves) == 0 {
+		return -1, -1
 	}
+	move := bestMoves[rand.IntN(len(bestMoves))]
+	return move[0], move[1]
+}
 
-	// Check diagonals
-	// Top-left to bottom-right
-	if board[0][0] == mark && board[1][1] == mark && board[2][2] == "" {
-		return 2, 2, true
-	}
-	if board[0][0] == mark && board[2][2] == mark && board[1][1] == "" {
-		return 1, 1, true
-	}
-	if board[1][1] == mark && board[2][2] == mark && board[0][0] == "" {
-		return 0, 0, true
+// cellScore sums the value of every line segment of win length that contains (row, col).
+func cellScore(board game.Board, row, col int, botMark, opponentMark game.PlayerMark) int {
+	k := board.WinLength
+	score := 0
+	for _, d := range [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+		// Slide a window of length k over every position that covers (row, col).
+		for offset := 0; offset < k; offset++ {
+			startRow, startCol := row-d[0]*offset, col-d[1]*offset
+			endRow, endCol := startRow+d[0]*(k-1), startCol+d[1]*(k-1)
+			if !board.InBounds(startRow, startCol) || !board.InBounds(endRow, endCol) {
+				continue
+			}
+			own, opp := 0, 0
+			for i := 0; i < k; i++ {
+				switch board.Cells[startRow+d[0]*i][startCol+d[1]*i] {
+				case botMark:
+					own++
+				case opponentMark:
+					opp++
+				}
+			}
+			switch {
+			case opp == 0:
+				score += 1 + own*own*2
+			case own == 0:
+				score += 1 + opp*opp
+			}
+		}
 	}
+	return score
+}
 
-	// Top-right to bottom-left
-	if board[0][2] == mark && board[1][1] == mark && board[2][0] == "" {
-		return 2, 0, true
-	}
-	if board[0][2] == mark && board[2][0] == mark && board[1][1] == "" {
-		return 1, 1, true
-	}
-	if board[1][1] == mark && board[2][0] == mark && board[0][2] == "" {
-		return 0, 2, true
+func abs(n int) int {
+	if n < 0 {
+		return -n
 	}
-
-	return -1, -1, false
+	return n
 }
@@ -2,6 +2,7 @@ package bot
 
 import (
 	"ctchen222/Tic-Tac-Toe/internal/game"
+	"fmt"
 	"testing"
 )
 
@@ -15,6 +16,11 @@ func moveIn(move [2]int, list [][2]int) bool {
 	return false
 }
 
+// classicBoard wraps 3x3 cells in a three-in-a-row board.
+func classicBoard(cells [][]game.PlayerMark) game.Board {
+	return game.Board{Cells: cells, WinLength: 3}
+}
+
 func TestFindWinningMove(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -93,7 +99,7 @@ func TestFindWinningMove(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			row, col, found := findWinningMove(tt.board, tt.mark)
+			row, col, found := findWinningMove(classicBoard(tt.board), tt.mark)
 			if found != tt.wantFound || row != tt.wantRow || col != tt.wantCol {
 				t.Errorf("findWinningMove() for %s got (%d, %d, %v), want (%d, %d, %v)", tt.name, row, col, found, tt.wantRow, tt.wantCol, tt.wantFound)
 			}
@@ -206,7 +212,7 @@ func TestMediumMove(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			row, col := mediumMove(tt.board, tt.botMark)
+			row, col := mediumMove(classicBoard(tt.board), tt.botMark)
 			if tt.wantRow == -1 && tt.wantCol == -1 { // Expecting random or full board
 				if row != -1 || col != -1 { // If not full, check if it's an empty spot
 					if tt.board[row][col] != "" {
@@ -257,6 +263,16 @@ func TestHardMove(t *testing.T) {
 			botMark: game.PlayerX,
 			wantRow: 1, wantCol: 1,
 		},
+		{
+			name: "Opposite corners - answer on a side",
+			board: [][]game.PlayerMark{
+				{game.PlayerX, "", ""},
+				{"", game.PlayerO, ""},
+				{"", "", game.PlayerX},
+			},
+			botMark: game.PlayerO,
+			wantRow: -1, wantCol: -1, // Expect a side; a corner loses to a fork
+		},
 		{
 			name: "Take corner (random)",
 			board: [][]game.PlayerMark{
@@ -291,7 +307,7 @@ func TestHardMove(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			row, col := hardMove(tt.board, tt.botMark)
+			row, col := hardMove(classicBoard(tt.board), tt.botMark)
 			if tt.wantRow == -1 && tt.wantCol == -1 { // Expecting random corner/side or full board
 				if row != -1 || col != -1 { // If not full, check if it's an empty spot
 					if tt.board[row][col] != "" {
@@ -304,7 +320,7 @@ func TestHardMove(t *testing.T) {
 							t.Errorf("hardMove expected a corner, got (%d, %d)", row, col)
 						}
 					}
-					if tt.name == "Take side (random)" {
+					if tt.name == "Take side (random)" || tt.name == "Opposite corners - answer on a side" {
 						sides := [][2]int{{0, 1}, {1, 0}, {1, 2}, {2, 1}}
 						if !moveIn([2]int{row, col}, sides) {
 							t.Errorf("hardMove expected a side, got (%d, %d)", row, col)
@@ -396,7 +412,7 @@ func TestCalculateNextMove(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			row, col := CalculateNextMove(tt.board, tt.botMark, tt.difficulty)
+			row, col := CalculateNextMove(classicBoard(tt.board), tt.botMark, tt.difficulty)
 			if tt.wantRow == -1 && tt.wantCol == -1 { // Expecting random or full board
 				if row != -1 || col != -1 { // If not full, check if it's an empty spot
 					if tt.board[row][col] != "" {
@@ -409,3 +425,324 @@ func TestCalculateNextMove(t *testing.T) {
 		})
 	}
 }
+
+func TestLargeBoardMoves(t *testing.T) {
+	t.Run("Gomoku - completes five in a row", func(t *testing.T) {
+		board := game.NewBoard(15, 5)
+		for c := 3; c < 7; c++ {
+			board.Cells[7][c] = game.PlayerX
+		}
+		board.Cells[7][7] = game.PlayerO
+		row, col := hardMove(board, game.PlayerX)
+		if row != 7 || col != 2 {
+			t.Errorf("hardMove should complete the line at (7, 2), got (%d, %d)", row, col)
+		}
+	})
+
+	t.Run("Gomoku - blocks an open four", func(t *testing.T) {
+		board := game.NewBoard(15, 5)
+		for r := 2; r < 6; r++ {
+			board.Cells[r][r] = game.PlayerO
+		}
+		board.Cells[0][14] = game.PlayerX
+		row, col, found := findWinningMove(board, game.PlayerO)
+		if !found {
+			t.Fatal("findWinningMove should find O's winning cell")
+		}
+		gotRow, gotCol := mediumMove(board, game.PlayerX)
+		if gotRow != row || gotCol != col {
+			t.Errorf("mediumMove should block at (%d, %d), got (%d, %d)", row, col, gotRow, gotCol)
+		}
+	})
+
+	t.Run("Gomoku - opens in the centre", func(t *testing.T) {
+		row, col := hardMove(game.NewBoard(15, 5), game.PlayerX)
+		if row != 7 || col != 7 {
+			t.Errorf("hardMove should open at the centre (7, 7), got (%d, %d)", row, col)
+		}
+	})
+
+	t.Run("4x4 - returns an empty cell", func(t *testing.T) {
+		board := game.NewBoard(4, 4)
+		board.Cells[0][0] = game.PlayerX
+		board.Cells[1][1] = game.PlayerO
+		row, col := hardMove(board, game.PlayerX)
+		if !board.InBounds(row, col) || board.Cells[row][col] != "" {
+			t.Errorf("hardMove returned an invalid move (%d, %d)", row, col)
+		}
+	})
+
+	t.Run("Full board", func(t *testing.T) {
+		board := game.NewBoard(4, 4)
+		for r := range board.Cells {
+			for c := range board.Cells[r] {
+				board.Cells[r][c] = game.PlayerO
+			}
+		}
+		row, col := hardMove(board, game.PlayerX)
+		if row != -1 || col != -1 {
+			t.Errorf("hardMove on a full board should return (-1, -1), got (%d, %d)", row, col)
+		}
+	})
+}
+
+func TestVariantMoves(t *testing.T) {
+	X, O, E := game.PlayerX, game.PlayerO, game.None
+
+	t.Run("Wild - completes a line of the opponent's mark", func(t *testing.T) {
+		state := game.State{Board: classicBoard([][]game.PlayerMark{
+			{O, O, E},
+			{E, X, E},
+			{E, E, E},
+		}), Turn: X}
+		move, ok := ChooseMove(game.Wild, state, "medium")
+		if !ok || move.Row != 0 || move.Col != 2 || move.Piece != O {
+			t.Errorf("ChooseMove() got %+v, %v; want O at (0, 2)", move, ok)
+		}
+	})
+
+	t.Run("Misere - never completes its own line", func(t *testing.T) {
+		state := game.State{Board: classicBoard([][]game.PlayerMark{
+			{X, X, E},
+			{O, E, E},
+			{E, E, E},
+		}), Turn: X}
+		for i := 0; i < 20; i++ {
+			move, ok := ChooseMove(game.Misere, state, "medium")
+			if !ok {
+				t.Fatal("ChooseMove() found no move")
+			}
+			if move.Row == 0 && move.Col == 2 {
+				t.Fatalf("ChooseMove() completed its own line: %+v", move)
+			}
+		}
+	})
+
+	t.Run("Order and chaos - Chaos blocks an open four", func(t *testing.T) {
+		board := game.OrderAndChaos.DefaultConfig().NewBoard()
+		for col := 1; col <= 4; col++ {
+			board.Cells[2][col] = X
+		}
+		board.Cells[2][0] = O
+		state := game.State{Board: board, Turn: O}
+		move, ok := ChooseMove(game.OrderAndChaos, state, "medium")
+		if !ok || move.Row != 2 || move.Col != 5 || move.Piece != O {
+			t.Errorf("ChooseMove() got %+v, %v; want O at (2, 5)", move, ok)
+		}
+	})
+}
+
+func TestUltimateMoves(t *testing.T) {
+	newBoard := func() game.Board { return game.Ultimate.DefaultConfig().NewBoard() }
+
+	t.Run("Wins the game when it can", func(t *testing.T) {
+		// X owns the top-left and top-middle boards and has two in a row in the top-right board.
+		board := newBoard()
+		for c := 0; c < 6; c++ {
+			board.Cells[0][c] = game.PlayerX
+		}
+		board.Cells[1][6], board.Cells[1][7] = game.PlayerX, game.PlayerX
+		board.Cells[3][5] = game.PlayerO
+		state := game.State{Board: board, Turn: game.PlayerX, LastMove: &game.Move{Player: game.PlayerO, Piece: game.PlayerO, Row: 3, Col: 5}}
+
+		move, ok := ChooseMove(game.Ultimate, state, "medium")
+		if !ok || move.Row != 1 || move.Col != 8 {
+			t.Errorf("ChooseMove() got %+v, %v; want row 1, col 8", move, ok)
+		}
+	})
+
+	t.Run("Wins a small board", func(t *testing.T) {
+		board := newBoard()
+		board.Cells[3][3], board.Cells[4][4] = game.PlayerO, game.PlayerO
+		board.Cells[1][4] = game.PlayerX
+		state := game.State{Board: board, Turn: game.PlayerO, LastMove: &game.Move{Player: game.PlayerX, Piece: game.PlayerX, Row: 1, Col: 4}}
+
+		for _, difficulty := range []string{"medium", "hard"} {
+			move, ok := ChooseMove(game.Ultimate, state, difficulty)
+			if !ok || move.Row != 5 || move.Col != 5 {
+				t.Errorf("%s: ChooseMove() got %+v, %v; want row 5, col 5", difficulty, move, ok)
+			}
+		}
+	})
+
+	t.Run("Only plays legal moves", func(t *testing.T) {
+		state := game.State{Board: newBoard(), Turn: game.PlayerX}
+		for i := 0; i < 30; i++ {
+			move, ok := ChooseMove(game.Ultimate, state, "hard")
+			if !ok {
+				break
+			}
+			next, err := game.Ultimate.Apply(state, move)
+			if err != nil {
+				t.Fatalf("ChooseMove() returned illegal move %+v: %v", move, err)
+			}
+			state = next
+		}
+	})
+}
+
+// positionKey identifies a position and the player to move for memoization in tests.
+func positionKey(board game.Board, mover game.PlayerMark) string {
+	return fmt.Sprint(board.Cells, mover)
+}
+
+// referenceScore is a plain minimax with the solver's scoring, used to check it:
+// a win scores the number of empty cells when it is played, a draw zero.
+func referenceScore(board game.Board, mover game.PlayerMark, memo map[string]int) int {
+	key := positionKey(board, mover)
+	if score, ok := memo[key]; ok {
+		return score
+	}
+
+	empty := countEmpty(board)
+	best := 0
+	first := true
+	for r, rowData := range board.Cells {
+		for c, cell := range rowData {
+			if cell != game.None {
+				continue
+			}
+			score := referenceMoveScore(board, mover, r, c, empty, memo)
+			if first || score > best {
+				best, first = score, false
+			}
+		}
+	}
+	memo[key] = best
+	return best
+}
+
+func referenceMoveScore(board game.Board, mover game.PlayerMark, r, c, empty int, memo map[string]int) int {
+	if board.IsWinningMove(r, c, mover) {
+		return empty
+	}
+	if empty == 1 {
+		return 0
+	}
+	board.Cells[r][c] = mover
+	defer func() { board.Cells[r][c] = game.None }()
+	return -referenceScore(board, game.Opponent(mover), memo)
+}
+
+// forEachReachable calls visit for every position reachable in a classic game,
+// with either player moving first, where the game is still in progress.
+func forEachReachable(visit func(board game.Board, mover game.PlayerMark)) {
+	seen := make(map[string]bool)
+	var walk func(board game.Board, mover game.PlayerMark)
+	walk = func(board game.Board, mover game.PlayerMark) {
+		key := positionKey(board, mover)
+		if seen[key] || game.CheckWinner(board) != game.None {
+			return
+		}
+		seen[key] = true
+		visit(board, mover)
+
+		for r, rowData := range board.Cells {
+			for c, cell := range rowData {
+				if cell == game.None {
+					board.Cells[r][c] = mover
+					walk(board, game.Opponent(mover))
+					board.Cells[r][c] = game.None
+				}
+			}
+		}
+	}
+	walk(game.NewBoard(3, 3), game.PlayerX)
+	walk(game.NewBoard(3, 3), game.PlayerO)
+}
+
+func TestPerfectMoveIsOptimalEverywhere(t *testing.T) {
+	memo := make(map[string]int)
+	positions := 0
+	forEachReachable(func(board game.Board, mover game.PlayerMark) {
+		positions++
+		empty := countEmpty(board)
+		best := referenceScore(board, mover, memo)
+
+		var want [][2]int
+		for r, rowData := range board.Cells {
+			for c, cell := range rowData {
+				if cell == game.None && referenceMoveScore(board, mover, r, c, empty, memo) == best {
+					want = append(want, [2]int{r, c})
+				}
+			}
+		}
+
+		got := solverFor(3, 3).bestMoves(board, mover)
+		if len(got) != len(want) {
+			t.Fatalf("bestMoves(%v, %s) got %v, want %v", board.Cells, mover, got, want)
+		}
+		for _, move := range got {
+			if !moveIn(move, want) {
+				t.Fatalf("bestMoves(%v, %s) got %v, want %v", board.Cells, mover, got, want)
+			}
+		}
+
+		row, col := hardMove(board, mover)
+		if !moveIn([2]int{row, col}, want) {
+			t.Fatalf("hardMove(%v, %s) got (%d, %d), want one of %v", board.Cells, mover, row, col, want)
+		}
+	})
+
+	if positions == 0 {
+		t.Fatal("no positions visited")
+	}
+}
+
+func TestHardMoveNeverLoses(t *testing.T) {
+	memo := make(map[string]int)
+	for _, bot := range []game.PlayerMark{game.PlayerX, game.PlayerO} {
+		checked := make(map[string]bool)
+
+		// survives plays every opponent reply and every optimal bot move from the
+		// position and reports whether the bot avoids losing in all of them.
+		var survives func(board game.Board, mover game.PlayerMark) bool
+		survives = func(board game.Board, mover game.PlayerMark) bool {
+			switch game.CheckWinner(board) {
+			case bot, game.DRAW:
+				return true
+			case game.Opponent(bot):
+				return false
+			}
+			key := positionKey(board, mover)
+			if checked[key] {
+				return true
+			}
+
+			moves := solverFor(3, 3).bestMoves(board, mover)
+			if mover != bot {
+				moves = moves[:0]
+				for r, rowData := range board.Cells {
+					for c, cell := range rowData {
+						if cell == game.None {
+							moves = append(moves, [2]int{r, c})
+						}
+					}
+				}
+			}
+			for _, move := range moves {
+				board.Cells[move[0]][move[1]] = mover
+				ok := survives(board, game.Opponent(mover))
+				board.Cells[move[0]][move[1]] = game.None
+				if !ok {
+					return false
+				}
+			}
+			checked[key] = true
+			return true
+		}
+
+		forEachReachable(func(board game.Board, mover game.PlayerMark) {
+			// Positions the bot has already lost against best play are not its fault.
+			if mover == bot && referenceScore(board, mover, memo) < 0 {
+				return
+			}
+			if mover != bot && referenceScore(board, mover, memo) > 0 {
+				return
+			}
+			if !survives(board, mover) {
+				t.Fatalf("bot %s lost from position %v with %s to move", bot, board.Cells, mover)
+			}
+		})
+	}
+}
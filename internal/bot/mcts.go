@@ -0,0 +1,259 @@
+package bot
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	// explorationConstant is the UCT exploration weight, sqrt(2).
+	explorationConstant = math.Sqrt2
+	// neighbourhoodMinSize is the board size from which moves are only considered
+	// near cells that are already taken.
+	neighbourhoodMinSize = 8
+	// neighbourhoodRadius is how far from a taken cell a candidate move may be.
+	neighbourhoodRadius = 2
+	// maxPlayoutMoves cuts off random playouts on large boards; a playout that
+	// reaches it counts as a draw.
+	maxPlayoutMoves = 40
+)
+
+// Budget limits a single MCTS search. The search stops when either limit is
+// reached; a zero field means no limit on that dimension. A search always runs
+// at least one iteration.
+type Budget struct {
+	Iterations int
+	Duration   time.Duration
+}
+
+// DefaultBudgets maps each difficulty to the budget of its searches.
+var DefaultBudgets = map[string]Budget{
+	"easy":   {Iterations: 50},
+	"medium": {Iterations: 1000, Duration: 300 * time.Millisecond},
+	"hard":   {Iterations: 20000, Duration: 1500 * time.Millisecond},
+}
+
+// MCTS is a Monte Carlo Tree Search (UCT) engine that plays any ruleset. It
+// implements room.MoveCalculator, with difficulty selecting the search budget.
+//
+// Searches are seeded from a generator created with the engine's seed, so an
+// engine with iteration-only budgets plays the same moves for the same seed and
+// sequence of positions.
+type MCTS struct {
+	budgets map[string]Budget
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewMCTS creates an engine seeded with seed. Difficulties missing from budgets
+// fall back to DefaultBudgets.
+func NewMCTS(seed uint64, budgets map[string]Budget) *MCTS {
+	merged := make(map[string]Budget, len(DefaultBudgets))
+	for difficulty, budget := range DefaultBudgets {
+		merged[difficulty] = budget
+	}
+	for difficulty, budget := range budgets {
+		merged[difficulty] = budget
+	}
+	return &MCTS{
+		budgets: merged,
+		rng:     rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// CalculateNextMove searches with the budget of the given difficulty. Unknown
+// difficulties use the hard budget.
+func (m *MCTS) CalculateNextMove(ctx context.Context, ruleset game.Ruleset, state game.State, difficulty string) (game.Move, bool) {
+	budget, ok := m.budgets[difficulty]
+	if !ok {
+		budget = m.budgets["hard"]
+	}
+	return m.Search(ctx, ruleset, state, budget)
+}
+
+// Search returns the most visited move after searching state within budget. A
+// search abandoned because ctx is done returns false.
+func (m *MCTS) Search(ctx context.Context, ruleset game.Ruleset, state game.State, budget Budget) (game.Move, bool) {
+	m.mu.Lock()
+	seed := m.rng.Uint64()
+	m.mu.Unlock()
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	moves := candidateMoves(ruleset, state)
+	if len(moves) == 0 {
+		return game.Move{}, false
+	}
+	if len(moves) == 1 {
+		return moves[0], true
+	}
+	// Take a win on the spot rather than leaving it to the statistics.
+	for _, move := range moves {
+		if next, err := ruleset.Apply(state, move); err == nil && ruleset.Outcome(next) == state.Turn {
+			return move, true
+		}
+	}
+
+	root := &mctsNode{untried: moves}
+	var deadline time.Time
+	if budget.Duration > 0 {
+		deadline = time.Now().Add(budget.Duration)
+	}
+	for i := 0; i == 0 || budget.Iterations <= 0 || i < budget.Iterations; i++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		if ctx.Err() != nil {
+			return game.Move{}, false
+		}
+		root.iterate(ruleset, state, rng)
+	}
+
+	best := root.children[0]
+	for _, child := range root.children[1:] {
+		if child.visits > best.visits {
+			best = child
+		}
+	}
+	return best.move, true
+}
+
+// mctsNode is a node of the search tree. Its statistics are kept from the point
+// of view of mover, the player who made move to reach it.
+type mctsNode struct {
+	move     game.Move
+	mover    game.PlayerMark
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []game.Move
+	visits   int
+	reward   float64
+}
+
+// iterate runs one selection, expansion, playout and backpropagation pass.
+func (n *mctsNode) iterate(ruleset game.Ruleset, state game.State, rng *rand.Rand) {
+	node := n
+	for len(node.untried) == 0 && len(node.children) > 0 {
+		node = node.selectChild()
+		state = mustApply(ruleset, state, node.move)
+	}
+
+	if len(node.untried) > 0 {
+		i := rng.IntN(len(node.untried))
+		move := node.untried[i]
+		node.untried[i] = node.untried[len(node.untried)-1]
+		node.untried = node.untried[:len(node.untried)-1]
+
+		state = mustApply(ruleset, state, move)
+		child := &mctsNode{move: move, mover: move.Player, parent: node}
+		if ruleset.Outcome(state) == game.None {
+			child.untried = candidateMoves(ruleset, state)
+		}
+		node.children = append(node.children, child)
+		node = child
+	}
+
+	result := playout(ruleset, state, rng)
+	for ; node != nil; node = node.parent {
+		node.visits++
+		switch result {
+		case node.mover:
+			node.reward++
+		case game.DRAW, game.None:
+			node.reward += 0.5
+		}
+	}
+}
+
+// selectChild picks the child with the highest UCT value.
+func (n *mctsNode) selectChild() *mctsNode {
+	logVisits := math.Log(float64(n.visits))
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	for _, child := range n.children {
+		value := child.reward/float64(child.visits) + explorationConstant*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+	return best
+}
+
+// playout plays random moves until the game ends, or maxPlayoutMoves have been
+// played, and returns the outcome.
+func playout(ruleset game.Ruleset, state game.State, rng *rand.Rand) game.PlayerMark {
+	for i := 0; ; i++ {
+		if outcome := ruleset.Outcome(state); outcome != game.None {
+			return outcome
+		}
+		if i == maxPlayoutMoves {
+			return game.DRAW
+		}
+		moves := candidateMoves(ruleset, state)
+		if len(moves) == 0 {
+			return game.DRAW
+		}
+		state = mustApply(ruleset, state, moves[rng.IntN(len(moves))])
+	}
+}
+
+// mustApply applies a move taken from the ruleset's own legal moves.
+func mustApply(ruleset game.Ruleset, state game.State, move game.Move) game.State {
+	next, err := ruleset.Apply(state, move)
+	if err != nil {
+		panic("bot: ruleset rejected one of its legal moves: " + err.Error())
+	}
+	return next
+}
+
+// candidateMoves returns the legal moves worth searching. On large boards only
+// cells near taken ones are considered, which keeps the branching factor of
+// gomoku-sized games manageable.
+func candidateMoves(ruleset game.Ruleset, state game.State) []game.Move {
+	moves := ruleset.LegalMoves(state)
+	if _, meta := ruleset.(game.MetaRuleset); meta || state.Board.Size() < neighbourhoodMinSize {
+		return moves
+	}
+
+	size := state.Board.Size()
+	empty := true
+	near := make([]bool, size*size)
+	for r, rowData := range state.Board.Cells {
+		for c, cell := range rowData {
+			if cell == game.None {
+				continue
+			}
+			empty = false
+			for dr := -neighbourhoodRadius; dr <= neighbourhoodRadius; dr++ {
+				for dc := -neighbourhoodRadius; dc <= neighbourhoodRadius; dc++ {
+					if state.Board.InBounds(r+dr, c+dc) {
+						near[(r+dr)*size+c+dc] = true
+					}
+				}
+			}
+		}
+	}
+	if empty {
+		center := size / 2
+		for dr := -1; dr <= 1; dr++ {
+			for dc := -1; dc <= 1; dc++ {
+				near[(center+dr)*size+center+dc] = true
+			}
+		}
+	}
+
+	filtered := make([]game.Move, 0, len(moves))
+	for _, move := range moves {
+		if near[move.Row*size+move.Col] {
+			filtered = append(filtered, move)
+		}
+	}
+	if len(filtered) == 0 {
+		return moves
+	}
+	return filtered
+}
@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"testing"
+	"time"
+)
+
+var (
+	_ room.MoveCalculator = (*MCTS)(nil)
+	_ room.MoveCalculator = (*BotMoveCalculator)(nil)
+)
+
+func TestMCTSIsDeterministicForASeed(t *testing.T) {
+	budgets := map[string]Budget{"medium": {Iterations: 100}}
+	states := []struct {
+		name    string
+		ruleset game.Ruleset
+		state   game.State
+	}{
+		{"Gomoku", game.Classic, game.State{Board: game.NewBoard(15, 5), Turn: game.PlayerX}},
+		{"Order and chaos", game.OrderAndChaos, game.State{Board: game.OrderAndChaos.DefaultConfig().NewBoard(), Turn: game.PlayerX}},
+		{"Ultimate", game.Ultimate, game.State{Board: game.Ultimate.DefaultConfig().NewBoard(), Turn: game.PlayerO}},
+	}
+
+	for _, tt := range states {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := NewMCTS(42, budgets), NewMCTS(42, budgets)
+			state := tt.state
+			for i := 0; i < 4; i++ {
+				a, okA := first.CalculateNextMove(context.Background(), tt.ruleset, state, "medium")
+				b, okB := second.CalculateNextMove(context.Background(), tt.ruleset, state, "medium")
+				if !okA || !okB || a != b {
+					t.Fatalf("move %d: engines with the same seed disagree: %+v, %+v", i, a, b)
+				}
+				next, err := tt.ruleset.Apply(state, a)
+				if err != nil {
+					t.Fatalf("move %d: engine returned illegal move %+v: %v", i, a, err)
+				}
+				state = next
+			}
+		})
+	}
+}
+
+func TestMCTSTakesWinAndBlocks(t *testing.T) {
+	engine := NewMCTS(7, map[string]Budget{"hard": {Iterations: 3000}})
+
+	t.Run("Gomoku - completes five in a row", func(t *testing.T) {
+		board := game.NewBoard(15, 5)
+		for c := 3; c < 7; c++ {
+			board.Cells[7][c] = game.PlayerX
+		}
+		board.Cells[8][3], board.Cells[8][4], board.Cells[8][5] = game.PlayerO, game.PlayerO, game.PlayerO
+		move, ok := engine.CalculateNextMove(context.Background(), game.Classic, game.State{Board: board, Turn: game.PlayerX}, "hard")
+		if !ok || move.Row != 7 || (move.Col != 2 && move.Col != 7) {
+			t.Errorf("CalculateNextMove() got %+v, %v; want a win on row 7", move, ok)
+		}
+	})
+
+	t.Run("Classic - blocks the opponent", func(t *testing.T) {
+		board := classicBoard([][]game.PlayerMark{
+			{game.PlayerO, game.PlayerO, ""},
+			{game.PlayerX, "", ""},
+			{game.PlayerX, "", ""},
+		})
+		for i := 0; i < 5; i++ {
+			move, ok := engine.CalculateNextMove(context.Background(), game.Classic, game.State{Board: board, Turn: game.PlayerX}, "hard")
+			if !ok || move.Row != 0 || move.Col != 2 {
+				t.Fatalf("CalculateNextMove() got %+v, %v; want (0, 2)", move, ok)
+			}
+		}
+	})
+}
+
+func TestMCTSRespectsTimeBudget(t *testing.T) {
+	engine := NewMCTS(1, map[string]Budget{"hard": {Duration: 50 * time.Millisecond}})
+	state := game.State{Board: game.NewBoard(15, 5), Turn: game.PlayerX}
+	state.Board.Cells[7][7] = game.PlayerO
+
+	start := time.Now()
+	if _, ok := engine.CalculateNextMove(context.Background(), game.Classic, state, "hard"); !ok {
+		t.Fatal("CalculateNextMove() found no move")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search took %v with a 50ms budget", elapsed)
+	}
+}
+
+func TestMCTSStopsWhenCancelled(t *testing.T) {
+	engine := NewMCTS(1, map[string]Budget{"hard": {Duration: time.Minute}})
+	state := game.State{Board: game.NewBoard(15, 5), Turn: game.PlayerX}
+	state.Board.Cells[7][7] = game.PlayerO
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, ok := engine.CalculateNextMove(ctx, game.Classic, state, "hard"); ok {
+		t.Error("cancelled CalculateNextMove() returned a move")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search took %v after being cancelled at 50ms", elapsed)
+	}
+}
+
+func TestBotMoveCalculatorUsesEngineOnLargeBoards(t *testing.T) {
+	calculator := NewMoveCalculator(NewMCTS(3, map[string]Budget{"easy": {Iterations: 20}}))
+
+	state := game.State{Board: game.NewBoard(9, 5), Turn: game.PlayerO}
+	move, ok := calculator.CalculateNextMove(context.Background(), game.Classic, state, "easy")
+	if !ok {
+		t.Fatal("CalculateNextMove() found no move")
+	}
+	// The engine only considers the centre of an empty large board.
+	if move.Row < 3 || move.Row > 5 || move.Col < 3 || move.Col > 5 {
+		t.Errorf("CalculateNextMove() got %+v, want a move near the centre", move)
+	}
+
+	if _, ok := calculator.CalculateNextMove(context.Background(), game.Classic, game.State{Board: game.NewBoard(3, 3), Turn: game.PlayerX}, "hard"); !ok {
+		t.Error("CalculateNextMove() on the classic board found no move")
+	}
+}
@@ -0,0 +1,264 @@
+package bot
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"math/rand/v2"
+	"sync"
+)
+
+const (
+	// maxSolverEmpty is the largest number of empty cells the solver searches from;
+	// positions with more empty cells fall back to the heuristics. It always covers
+	// the classic 3x3 board.
+	maxSolverEmpty = 10
+	// maxSolverCells bounds the board size so a position still fits a base-3 uint64 hash.
+	maxSolverCells = 25
+	// maxTableEntries caps each transposition table; once full, new positions are
+	// searched but no longer stored.
+	maxTableEntries = 1 << 20
+)
+
+// Transposition table bounds.
+const (
+	boundExact = iota
+	boundLower
+	boundUpper
+)
+
+type ttEntry struct {
+	score int8
+	bound int8
+}
+
+// solver finds optimal moves of a k-in-a-row game with negamax and alpha-beta
+// pruning. Scores are from the point of view of the player to move: a win scores
+// the number of empty cells left when it is played, so faster wins score higher
+// and slower losses score closer to zero; a draw scores zero.
+//
+// Searched positions are memoized in a transposition table shared by all games on
+// the same board. Positions are hashed with the player to move as "own" and the
+// other player as "opponent", and reduced over the eight symmetries of the square,
+// so mirrored, rotated and colour-swapped positions share one entry.
+type solver struct {
+	size  int
+	perms [8][]int
+
+	mu    sync.RWMutex
+	table map[uint64]ttEntry
+}
+
+var (
+	solversMu sync.Mutex
+	solvers   = make(map[[2]int]*solver)
+)
+
+// solverFor returns the shared solver for boards of the given size and win length.
+func solverFor(size, winLength int) *solver {
+	solversMu.Lock()
+	defer solversMu.Unlock()
+
+	key := [2]int{size, winLength}
+	s, ok := solvers[key]
+	if !ok {
+		s = newSolver(size)
+		solvers[key] = s
+	}
+	return s
+}
+
+func newSolver(size int) *solver {
+	s := &solver{size: size, table: make(map[uint64]ttEntry)}
+	n := size - 1
+	transforms := [8]func(r, c int) (int, int){
+		func(r, c int) (int, int) { return r, c },
+		func(r, c int) (int, int) { return c, n - r },
+		func(r, c int) (int, int) { return n - r, n - c },
+		func(r, c int) (int, int) { return n - c, r },
+		func(r, c int) (int, int) { return r, n - c },
+		func(r, c int) (int, int) { return n - r, c },
+		func(r, c int) (int, int) { return c, r },
+		func(r, c int) (int, int) { return n - c, n - r },
+	}
+	for i, transform := range transforms {
+		perm := make([]int, size*size)
+		for r := 0; r < size; r++ {
+			for c := 0; c < size; c++ {
+				tr, tc := transform(r, c)
+				perm[r*size+c] = tr*size + tc
+			}
+		}
+		s.perms[i] = perm
+	}
+	return s
+}
+
+// perfectMove returns an optimal move for botMark in a classic game, chosen at
+// random among equally good ones. ok is false when the position is too large to search.
+func perfectMove(board game.Board, botMark game.PlayerMark) (row, col int, ok bool) {
+	size := board.Size()
+	if size*size > maxSolverCells || countEmpty(board) > maxSolverEmpty {
+		return -1, -1, false
+	}
+
+	moves := solverFor(size, board.WinLength).bestMoves(board, botMark)
+	if len(moves) == 0 {
+		return -1, -1, true
+	}
+	move := moves[rand.IntN(len(moves))]
+	return move[0], move[1], true
+}
+
+// bestMoves returns every move that achieves the best score for mover.
+func (s *solver) bestMoves(board game.Board, mover game.PlayerMark) [][2]int {
+	board = board.Clone()
+	empty := countEmpty(board)
+	opponent := game.Opponent(mover)
+
+	best := 0
+	var moves [][2]int
+	for r, rowData := range board.Cells {
+		for c, cell := range rowData {
+			if cell != game.None {
+				continue
+			}
+
+			var score int
+			switch {
+			case board.IsWinningMove(r, c, mover):
+				score = empty
+			case empty == 1:
+				score = 0
+			default:
+				board.Cells[r][c] = mover
+				score = -s.negamax(board, opponent, empty-1, -maxSolverCells-1, maxSolverCells+1)
+				board.Cells[r][c] = game.None
+			}
+
+			if len(moves) == 0 || score > best {
+				best = score
+				moves = moves[:0]
+			}
+			if score == best {
+				moves = append(moves, [2]int{r, c})
+			}
+		}
+	}
+	return moves
+}
+
+// negamax returns the score of the position for mover, who has empty cells left to
+// play in. The board is modified during the search and restored before returning.
+func (s *solver) negamax(board game.Board, mover game.PlayerMark, empty, alpha, beta int) int {
+	key := s.key(board, mover)
+	if entry, ok := s.lookup(key); ok {
+		score := int(entry.score)
+		switch entry.bound {
+		case boundExact:
+			return score
+		case boundLower:
+			alpha = max(alpha, score)
+		case boundUpper:
+			beta = min(beta, score)
+		}
+		if alpha >= beta {
+			return score
+		}
+	}
+
+	// An immediate win is the best any move can do, so look for one first.
+	for r, rowData := range board.Cells {
+		for c, cell := range rowData {
+			if cell == game.None && board.IsWinningMove(r, c, mover) {
+				s.store(key, empty, boundExact)
+				return empty
+			}
+		}
+	}
+	if empty == 1 {
+		s.store(key, 0, boundExact)
+		return 0
+	}
+
+	alphaOrig := alpha
+	opponent := game.Opponent(mover)
+	best := -maxSolverCells - 1
+search:
+	for r, rowData := range board.Cells {
+		for c, cell := range rowData {
+			if cell != game.None {
+				continue
+			}
+			board.Cells[r][c] = mover
+			score := -s.negamax(board, opponent, empty-1, -beta, -alpha)
+			board.Cells[r][c] = game.None
+
+			best = max(best, score)
+			alpha = max(alpha, best)
+			if alpha >= beta {
+				break search
+			}
+		}
+	}
+
+	bound := boundExact
+	switch {
+	case best <= alphaOrig:
+		bound = boundUpper
+	case best >= beta:
+		bound = boundLower
+	}
+	s.store(key, best, bound)
+	return best
+}
+
+// key returns the canonical hash of the position for mover: the smallest base-3
+// encoding over all symmetries, with mover's cells as 1 and the opponent's as 2.
+func (s *solver) key(board game.Board, mover game.PlayerMark) uint64 {
+	var canonical uint64
+	for i, perm := range s.perms {
+		var h uint64
+		for _, cell := range perm {
+			h *= 3
+			switch board.Cells[cell/s.size][cell%s.size] {
+			case game.None:
+			case mover:
+				h += 1
+			default:
+				h += 2
+			}
+		}
+		if i == 0 || h < canonical {
+			canonical = h
+		}
+	}
+	return canonical
+}
+
+func (s *solver) lookup(key uint64) (ttEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.table[key]
+	return entry, ok
+}
+
+func (s *solver) store(key uint64, score, bound int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.table) >= maxTableEntries {
+		return
+	}
+	s.table[key] = ttEntry{score: int8(score), bound: int8(bound)}
+}
+
+// countEmpty returns the number of empty cells on the board.
+func countEmpty(board game.Board) int {
+	count := 0
+	for _, rowData := range board.Cells {
+		for _, cell := range rowData {
+			if cell == game.None {
+				count++
+			}
+		}
+	}
+	return count
+}
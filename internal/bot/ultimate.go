@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"math/rand/v2"
+)
+
+// Scores used to rank ultimate tic-tac-toe moves.
+const (
+	scoreLosesGame        = -1000
+	scoreWinsSmallBoard   = 100
+	scoreBlocksSmallWin   = 50
+	scoreSendsToLostBoard = -60
+	scoreGivesFreeChoice  = -40
+)
+
+// ultimateMove plays ultimate tic-tac-toe. Easy plays randomly. Medium wins the game
+// when it can, avoids moves that let the opponent win at once, and otherwise wins or
+// blocks small boards. Hard also looks at which small board the move sends the
+// opponent to and prefers central boards and cells.
+func ultimateMove(ruleset game.MetaRuleset, state game.State, difficulty string) (game.Move, bool) {
+	moves := ruleset.LegalMoves(state)
+	if len(moves) == 0 {
+		return game.Move{}, false
+	}
+	if difficulty == "easy" {
+		return moves[rand.IntN(len(moves))], true
+	}
+
+	me := state.Turn
+	opponent := game.Opponent(me)
+	macro := ruleset.MacroBoard(state)
+
+	best := 0
+	var bestMoves []game.Move
+	for i, move := range moves {
+		next, err := ruleset.Apply(state, move)
+		if err != nil {
+			continue
+		}
+		if ruleset.Outcome(next) == me {
+			return move, true
+		}
+
+		bigRow, bigCol := move.Row/game.SubBoardSize, move.Col/game.SubBoardSize
+		row, col := move.Row%game.SubBoardSize, move.Col%game.SubBoardSize
+		small := game.SubBoard(state.Board, bigRow, bigCol)
+
+		score := 0
+		if canWinNow(ruleset, next) {
+			score += scoreLosesGame
+		}
+		if macro[bigRow][bigCol] == game.None && small.IsWinningMove(row, col, me) {
+			score += scoreWinsSmallBoard
+		}
+		if small.IsWinningMove(row, col, opponent) {
+			score += scoreBlocksSmallWin
+		}
+
+		if difficulty == "hard" {
+			forced := ruleset.ForcedBoard(next)
+			switch {
+			case forced == nil:
+				score += scoreGivesFreeChoice
+			case canWinSmallBoard(game.SubBoard(next.Board, forced[0], forced[1]), opponent):
+				score += scoreSendsToLostBoard
+			}
+			score += placementScore(bigRow, bigCol) + placementScore(row, col)
+		}
+
+		if i == 0 || score > best {
+			best = score
+			bestMoves = bestMoves[:0]
+		}
+		if score == best {
+			bestMoves = append(bestMoves, move)
+		}
+	}
+
+	if len(bestMoves) == 0 {
+		return moves[rand.IntN(len(moves))], true
+	}
+	return bestMoves[rand.IntN(len(bestMoves))], true
+}
+
+// canWinSmallBoard reports whether mark can complete a line on the small board with one move.
+func canWinSmallBoard(small game.Board, mark game.PlayerMark) bool {
+	if game.CheckWinner(small) != game.None {
+		return false
+	}
+	for row, rowData := range small.Cells {
+		for col, cell := range rowData {
+			if cell == game.None && small.IsWinningMove(row, col, mark) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// placementScore favours the center of a 3x3 grid, then its corners.
+func placementScore(row, col int) int {
+	switch {
+	case row == 1 && col == 1:
+		return 3
+	case row != 1 && col != 1:
+		return 2
+	default:
+		return 0
+	}
+}
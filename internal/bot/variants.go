@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"math/rand/v2"
+)
+
+// maxLookaheadMoves bounds the number of legal moves for which the hard level
+// looks two moves ahead; beyond it, hard plays like medium.
+const maxLookaheadMoves = 64
+
+// rulesetMove plays any variant by asking its ruleset what each move leads to.
+// Easy plays randomly. Medium takes an immediate win and otherwise avoids moves that
+// lose at once or hand the opponent an immediate win. Hard additionally prefers the
+// safe move that leaves the opponent the fewest safe replies.
+func rulesetMove(ruleset game.Ruleset, state game.State, difficulty string) (game.Move, bool) {
+	moves := ruleset.LegalMoves(state)
+	if len(moves) == 0 {
+		return game.Move{}, false
+	}
+	if difficulty == "easy" {
+		return moves[rand.IntN(len(moves))], true
+	}
+
+	me := state.Turn
+	var safe []game.Move
+	var safeStates []game.State
+	for _, move := range moves {
+		next, err := ruleset.Apply(state, move)
+		if err != nil {
+			continue
+		}
+		switch ruleset.Outcome(next) {
+		case me:
+			return move, true
+		case game.DRAW:
+			safe = append(safe, move)
+			safeStates = append(safeStates, next)
+		case game.None:
+			if !canWinNow(ruleset, next) {
+				safe = append(safe, move)
+				safeStates = append(safeStates, next)
+			}
+		}
+	}
+
+	if len(safe) == 0 {
+		// Every move loses; pick any of them.
+		return moves[rand.IntN(len(moves))], true
+	}
+	if difficulty != "hard" || len(moves) > maxLookaheadMoves {
+		return safe[rand.IntN(len(safe))], true
+	}
+
+	best := -1
+	var bestMoves []game.Move
+	for i, next := range safeStates {
+		replies := countSafeReplies(ruleset, next)
+		if best == -1 || replies < best {
+			best = replies
+			bestMoves = bestMoves[:0]
+		}
+		if replies == best {
+			bestMoves = append(bestMoves, safe[i])
+		}
+	}
+	return bestMoves[rand.IntN(len(bestMoves))], true
+}
+
+// canWinNow reports whether the player to move has a move that wins immediately.
+func canWinNow(ruleset game.Ruleset, state game.State) bool {
+	for _, move := range ruleset.LegalMoves(state) {
+		next, err := ruleset.Apply(state, move)
+		if err == nil && ruleset.Outcome(next) == state.Turn {
+			return true
+		}
+	}
+	return false
+}
+
+// countSafeReplies counts the moves of the player to move that neither lose at once
+// nor allow an immediate win in reply.
+func countSafeReplies(ruleset game.Ruleset, state game.State) int {
+	count := 0
+	for _, move := range ruleset.LegalMoves(state) {
+		next, err := ruleset.Apply(state, move)
+		if err != nil {
+			continue
+		}
+		switch ruleset.Outcome(next) {
+		case state.Turn, game.DRAW:
+			count++
+		case game.None:
+			if !canWinNow(ruleset, next) {
+				count++
+			}
+		}
+	}
+	return count
+}
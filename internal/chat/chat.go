@@ -0,0 +1,187 @@
+// Package chat checks, filters and records the chat messages and emotes players
+// send to their rooms.
+package chat
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("chat")
+
+// Message types handled by the chat service.
+const (
+	TypeChat  = "chat"
+	TypeEmote = "emote"
+)
+
+var (
+	ErrRateLimited  = errors.New("sending messages too fast")
+	ErrEmptyMessage = errors.New("message is empty")
+	ErrTooLong      = errors.New("message is too long")
+	ErrBlocked      = errors.New("message was blocked by the content filter")
+	ErrUnknownEmote = errors.New("unknown emote")
+)
+
+// Emotes are the emotes players can send.
+var Emotes = []string{"gg", "wave", "thinking", "wow", "oops", "thanks"}
+
+// Config tunes the chat service.
+type Config struct {
+	// MaxLength is the longest chat message accepted, in characters.
+	MaxLength int
+	// HistorySize is how many messages of each room are kept for replay.
+	HistorySize int
+	// RatePerSecond is how many messages a player may send per second in the long run.
+	RatePerSecond float64
+	// Burst is how many messages a player may send at once.
+	Burst int
+}
+
+// DefaultConfig is used by NewService for zero fields.
+var DefaultConfig = Config{
+	MaxLength:     200,
+	HistorySize:   50,
+	RatePerSecond: 0.5,
+	Burst:         5,
+}
+
+// Service validates and records the chat of all rooms on a server. Rate limits
+// are kept per player, on the server the player is connected to.
+type Service struct {
+	repo    repository.ChatRepository
+	filter  Filter
+	cfg     Config
+	limiter *Limiter
+	now     func() time.Time
+}
+
+// NewService creates a chat service. A nil filter lets every message through.
+func NewService(repo repository.ChatRepository, filter Filter, cfg Config) *Service {
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = DefaultConfig.MaxLength
+	}
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = DefaultConfig.HistorySize
+	}
+	if cfg.RatePerSecond <= 0 {
+		cfg.RatePerSecond = DefaultConfig.RatePerSecond
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = DefaultConfig.Burst
+	}
+	if filter == nil {
+		filter = NopFilter{}
+	}
+	return &Service{
+		repo:    repo,
+		filter:  filter,
+		cfg:     cfg,
+		limiter: NewLimiter(cfg.RatePerSecond, cfg.Burst),
+		now:     time.Now,
+	}
+}
+
+// Post checks a "chat" or "emote" message from a player and adds it to the
+// room's history. It returns the entry to deliver to the room.
+func (s *Service) Post(ctx context.Context, roomID, playerID string, msg *proto.ClientToServerMessage) (*proto.ChatEntry, error) {
+	ctx, span := tracer.Start(ctx, "chat.Post", trace.WithAttributes(
+		attribute.String("room.id", roomID),
+		attribute.String("player.id", playerID),
+		attribute.String("message.type", msg.Type),
+	))
+	defer span.End()
+
+	entry, err := s.newEntry(playerID, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected chat message")
+		return nil, err
+	}
+
+	if err := s.repo.Append(ctx, roomID, *entry, s.cfg.HistorySize); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to record chat message")
+		return nil, err
+	}
+	return entry, nil
+}
+
+// newEntry builds the entry of a message, or returns why it can't be sent.
+func (s *Service) newEntry(playerID string, msg *proto.ClientToServerMessage) (*proto.ChatEntry, error) {
+	if !s.limiter.Allow(playerID) {
+		return nil, ErrRateLimited
+	}
+
+	entry := &proto.ChatEntry{Type: msg.Type, From: playerID, SentAt: s.now().UnixMilli()}
+	switch msg.Type {
+	case TypeChat:
+		text := strings.TrimSpace(msg.Text)
+		if text == "" {
+			return nil, ErrEmptyMessage
+		}
+		if utf8.RuneCountInString(text) > s.cfg.MaxLength {
+			return nil, ErrTooLong
+		}
+		text, ok := s.filter.Filter(text)
+		if !ok {
+			return nil, ErrBlocked
+		}
+		entry.Text = text
+	case TypeEmote:
+		if !slices.Contains(Emotes, msg.Emote) {
+			return nil, ErrUnknownEmote
+		}
+		entry.Emote = msg.Emote
+	default:
+		return nil, fmt.Errorf("not a chat message: %q", msg.Type)
+	}
+	return entry, nil
+}
+
+// History returns the messages of a room that recipientID may see, oldest first.
+func (s *Service) History(ctx context.Context, roomID, recipientID string) ([]proto.ChatEntry, error) {
+	entries, err := s.repo.History(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	muting, err := s.repo.Muting(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	visible := entries[:0]
+	for _, entry := range entries {
+		if Visible(entry, recipientID, muting) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, nil
+}
+
+// SetMuted mutes or unmutes the opponent of a player.
+func (s *Service) SetMuted(ctx context.Context, roomID, playerID string, muted bool) error {
+	return s.repo.SetMuted(ctx, roomID, playerID, muted)
+}
+
+// Muting returns the players of a room who muted their opponent.
+func (s *Service) Muting(ctx context.Context, roomID string) (map[string]bool, error) {
+	return s.repo.Muting(ctx, roomID)
+}
+
+// Visible reports whether recipientID may see entry, given the players of the
+// room who muted their opponent. Players always see their own messages.
+func Visible(entry proto.ChatEntry, recipientID string, muting map[string]bool) bool {
+	return entry.From == recipientID || !muting[recipientID]
+}
@@ -0,0 +1,182 @@
+package chat
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryRepository is an in-memory repository.ChatRepository.
+type memoryRepository struct {
+	history map[string][]proto.ChatEntry
+	muting  map[string]map[string]bool
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{history: make(map[string][]proto.ChatEntry), muting: make(map[string]map[string]bool)}
+}
+
+func (m *memoryRepository) Append(ctx context.Context, roomID string, entry proto.ChatEntry, max int) error {
+	m.history[roomID] = append(m.history[roomID], entry)
+	if n := len(m.history[roomID]); n > max {
+		m.history[roomID] = m.history[roomID][n-max:]
+	}
+	return nil
+}
+
+func (m *memoryRepository) History(ctx context.Context, roomID string) ([]proto.ChatEntry, error) {
+	return append([]proto.ChatEntry(nil), m.history[roomID]...), nil
+}
+
+func (m *memoryRepository) SetMuted(ctx context.Context, roomID, playerID string, muted bool) error {
+	if m.muting[roomID] == nil {
+		m.muting[roomID] = make(map[string]bool)
+	}
+	m.muting[roomID][playerID] = muted
+	return nil
+}
+
+func (m *memoryRepository) Muting(ctx context.Context, roomID string) (map[string]bool, error) {
+	return m.muting[roomID], nil
+}
+
+func TestServicePost(t *testing.T) {
+	service := NewService(newMemoryRepository(), NewWordFilter([]string{"darn"}), Config{MaxLength: 10, Burst: 100})
+
+	tests := []struct {
+		name    string
+		msg     proto.ClientToServerMessage
+		want    proto.ChatEntry
+		wantErr error
+	}{
+		{
+			name: "chat",
+			msg:  proto.ClientToServerMessage{Type: TypeChat, Text: "  hi there "},
+			want: proto.ChatEntry{Type: TypeChat, From: "alice", Text: "hi there"},
+		},
+		{
+			name: "filtered chat",
+			msg:  proto.ClientToServerMessage{Type: TypeChat, Text: "Darn it"},
+			want: proto.ChatEntry{Type: TypeChat, From: "alice", Text: "**** it"},
+		},
+		{
+			name: "emote",
+			msg:  proto.ClientToServerMessage{Type: TypeEmote, Emote: "gg"},
+			want: proto.ChatEntry{Type: TypeEmote, From: "alice", Emote: "gg"},
+		},
+		{
+			name:    "empty chat",
+			msg:     proto.ClientToServerMessage{Type: TypeChat, Text: "   "},
+			wantErr: ErrEmptyMessage,
+		},
+		{
+			name:    "too long",
+			msg:     proto.ClientToServerMessage{Type: TypeChat, Text: strings.Repeat("é", 11)},
+			wantErr: ErrTooLong,
+		},
+		{
+			name:    "unknown emote",
+			msg:     proto.ClientToServerMessage{Type: TypeEmote, Emote: "rage"},
+			wantErr: ErrUnknownEmote,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := service.Post(context.Background(), "room-1", "alice", &tt.msg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Post() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			tt.want.SentAt = entry.SentAt
+			if *entry != tt.want {
+				t.Errorf("Post() = %+v, want %+v", *entry, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceHistory(t *testing.T) {
+	ctx := context.Background()
+	service := NewService(newMemoryRepository(), nil, Config{HistorySize: 3, Burst: 100})
+
+	for _, msg := range []struct{ from, text string }{
+		{"alice", "one"}, {"bob", "two"}, {"alice", "three"}, {"bob", "four"},
+	} {
+		if _, err := service.Post(ctx, "room-1", msg.from, &proto.ClientToServerMessage{Type: TypeChat, Text: msg.text}); err != nil {
+			t.Fatalf("Post() returned error: %v", err)
+		}
+	}
+
+	texts := func(entries []proto.ChatEntry) string {
+		var out []string
+		for _, entry := range entries {
+			out = append(out, entry.Text)
+		}
+		return strings.Join(out, ",")
+	}
+
+	history, err := service.History(ctx, "room-1", "alice")
+	if err != nil {
+		t.Fatalf("History() returned error: %v", err)
+	}
+	if got := texts(history); got != "two,three,four" {
+		t.Errorf("History() = %s, want the last 3 messages", got)
+	}
+
+	if err := service.SetMuted(ctx, "room-1", "alice", true); err != nil {
+		t.Fatalf("SetMuted() returned error: %v", err)
+	}
+	history, _ = service.History(ctx, "room-1", "alice")
+	if got := texts(history); got != "three" {
+		t.Errorf("History() for a player who muted their opponent = %s, want only their own messages", got)
+	}
+	history, _ = service.History(ctx, "room-1", "bob")
+	if got := texts(history); got != "two,three,four" {
+		t.Errorf("History() for the muted player = %s, want all messages", got)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(0.5, 2)
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.Allow("alice") || !limiter.Allow("alice") {
+		t.Fatal("Allow() rejected a burst within the limit")
+	}
+	if limiter.Allow("alice") {
+		t.Error("Allow() accepted a message beyond the burst")
+	}
+	if !limiter.Allow("bob") {
+		t.Error("Allow() limited a player by another player's messages")
+	}
+
+	now = now.Add(2 * time.Second)
+	if !limiter.Allow("alice") {
+		t.Error("Allow() rejected a message after a token was refilled")
+	}
+	if limiter.Allow("alice") {
+		t.Error("Allow() accepted a second message after only one token was refilled")
+	}
+}
+
+func TestWordFilter(t *testing.T) {
+	filter := NewWordFilter([]string{"heck", " Darn ", ""})
+
+	tests := map[string]string{
+		"what the heck":   "what the ****",
+		"HECK, DARN!":     "****, ****!",
+		"checkmate heckz": "checkmate heckz",
+		"":                "",
+	}
+	for text, want := range tests {
+		if got, ok := filter.Filter(text); !ok || got != want {
+			t.Errorf("Filter(%q) = %q, %v; want %q", text, got, ok, want)
+		}
+	}
+}
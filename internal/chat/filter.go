@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Filter is a content filter for chat messages.
+type Filter interface {
+	// Filter returns the text to send in place of text, or false if the message
+	// must not be sent at all.
+	Filter(text string) (string, bool)
+}
+
+// NopFilter lets every message through unchanged.
+type NopFilter struct{}
+
+func (NopFilter) Filter(text string) (string, bool) {
+	return text, true
+}
+
+// WordFilter masks blocked words with asterisks. Words are compared as a whole
+// and case-insensitively.
+type WordFilter struct {
+	blocked map[string]bool
+}
+
+// NewWordFilter creates a filter blocking the given words. Empty words are ignored.
+func NewWordFilter(words []string) *WordFilter {
+	blocked := make(map[string]bool, len(words))
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			blocked[word] = true
+		}
+	}
+	return &WordFilter{blocked: blocked}
+}
+
+func (f *WordFilter) Filter(text string) (string, bool) {
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if f.blocked[strings.ToLower(word)] {
+			word = strings.Repeat("*", j-i)
+		}
+		out.WriteString(word)
+		i = j
+	}
+	return out.String(), true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
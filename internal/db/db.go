@@ -28,7 +28,9 @@ func LocalConnect(dbPath string) (*sqlx.DB, error) {
 
 func DBConnect() (*sqlx.DB, error) {
 	Once.Do(func() {
-		pool, err := sqlx.Open("sqlite", "./master.db")
+		// Transactions take the write lock up front, and wait for it rather than
+		// failing, so concurrent rating updates don't deadlock on lock upgrades.
+		pool, err := sqlx.Open("sqlite", "./master.db?_txlock=immediate&_pragma=busy_timeout(5000)")
 		if err != nil {
 			log.Fatalf("Failed to open master database connection: %v", err)
 		}
@@ -44,6 +46,17 @@ func InitializeDB() error {
 		return fmt.Errorf("failed to connect to master database: %w", err)
 	}
 
+	if err := CreateSchema(DB); err != nil {
+		return err
+	}
+
+	log.Println("DB connection initialized and schema verified.")
+
+	return nil
+}
+
+// CreateSchema creates the tables the application needs if they don't exist.
+func CreateSchema(DB *sqlx.DB) error {
 	if _, err := DB.Exec("PRAGMA foreign_keys = ON"); err != nil {
 		return fmt.Errorf("failed to enable foreign keys: %w", err)
 	}
@@ -60,7 +73,69 @@ func InitializeDB() error {
 		return fmt.Errorf("failed to create users table: %w", err)
 	}
 
-	log.Println("DB connection initialized and schema verified.")
+	// Glicko-2 ratings from games against other users, and separate provisional
+	// ratings from games against each bot difficulty.
+	ratingSchema := `
+	CREATE TABLE IF NOT EXISTS ratings (
+		user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		rating REAL NOT NULL,
+		rd REAL NOT NULL,
+		volatility REAL NOT NULL,
+		games INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS bot_ratings (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		difficulty TEXT NOT NULL,
+		rating REAL NOT NULL,
+		rd REAL NOT NULL,
+		volatility REAL NOT NULL,
+		games INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, difficulty)
+	);`
+
+	if _, err := DB.Exec(ratingSchema); err != nil {
+		return fmt.Errorf("failed to create rating tables: %w", err)
+	}
+
+	// Finished games and their moves. user_x and user_o are set for players who
+	// are registered users, so a user's games can be looked up by user ID.
+	gameSchema := `
+	CREATE TABLE IF NOT EXISTS games (
+		id TEXT PRIMARY KEY,
+		room_id TEXT NOT NULL,
+		variant TEXT NOT NULL,
+		board_size INTEGER NOT NULL,
+		win_length INTEGER NOT NULL,
+		player_x TEXT NOT NULL,
+		player_o TEXT NOT NULL,
+		user_x INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		user_o INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		bot_difficulty TEXT NOT NULL DEFAULT '',
+		winner TEXT NOT NULL,
+		termination TEXT NOT NULL,
+		move_count INTEGER NOT NULL,
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS games_user_x ON games (user_x, ended_at);
+	CREATE INDEX IF NOT EXISTS games_user_o ON games (user_o, ended_at);
+	CREATE TABLE IF NOT EXISTS game_moves (
+		game_id TEXT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+		ply INTEGER NOT NULL,
+		player TEXT NOT NULL,
+		piece TEXT NOT NULL,
+		row INTEGER NOT NULL,
+		col INTEGER NOT NULL,
+		played_at DATETIME NOT NULL,
+		proxy BOOLEAN NOT NULL DEFAULT 0,
+		PRIMARY KEY (game_id, ply)
+	);`
+
+	if _, err := DB.Exec(gameSchema); err != nil {
+		return fmt.Errorf("failed to create game tables: %w", err)
+	}
 
 	return nil
 }
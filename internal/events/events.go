@@ -1,12 +1,42 @@
 package events
 
-import "encoding/json"
+import (
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"fmt"
+)
 
 // Pub/Sub channel constants
 const (
 	EventsChannel = "channel:events"
 )
 
+// RoomChannel returns the Pub/Sub channel of a room, which carries RoomEvents
+// to every server hosting one of the room's players or spectators.
+func RoomChannel(roomID string) string {
+	return fmt.Sprintf("channel:room:%s", roomID)
+}
+
+// Room event types
+const (
+	RoomEventUpdate = "update"
+	RoomEventChat   = "chat"
+	RoomEventNotice = "notice"
+	// RoomEventGameOver is published when a game ends because a player left.
+	// Every server delivers its notice and then closes the room.
+	RoomEventGameOver = "game_over"
+)
+
+// RoomEvent is a message published on a room's channel.
+type RoomEvent struct {
+	Type string `json:"type"`
+	// Chat is the chat message or emote of a "chat" event.
+	Chat *proto.ChatEntry `json:"chat,omitempty"`
+	// Notice is the message a "notice" event delivers as is to the room's
+	// players and spectators.
+	Notice *proto.ServerToClientMessage `json:"notice,omitempty"`
+}
+
 // Event represents a global message published via Pub/Sub.
 type Event struct {
 	Type    string          `json:"event"`
@@ -29,6 +59,8 @@ type PlayerDisconnectedPayload struct {
 type PlayerReconnectedPayload struct {
 	RoomID   string `json:"room_id"`
 	PlayerID string `json:"player_id"`
+	// ServerID is the server the player resumed their game on.
+	ServerID string `json:"server_id,omitempty"`
 }
 
 // RematchRequestedPayload is the payload for the "rematch_requested" event.
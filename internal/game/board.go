@@ -0,0 +1,212 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Board dimensions
+	DefaultBoardSize = 3
+	MinBoardSize     = 3
+	MaxBoardSize     = 19
+	MinWinLength     = 3
+)
+
+// directions are the four line directions checked for a win: horizontal,
+// vertical, diagonal and anti-diagonal.
+var directions = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// Board is a square grid of marks. Its size and the number of marks in a row
+// needed to win are set per game.
+type Board struct {
+	Cells     [][]PlayerMark
+	WinLength int
+}
+
+// NewBoard creates an empty board with the given size and win length.
+func NewBoard(size, winLength int) Board {
+	cells := make([][]PlayerMark, size)
+	for i := range cells {
+		cells[i] = make([]PlayerMark, size)
+	}
+	return Board{Cells: cells, WinLength: winLength}
+}
+
+// Size returns the number of rows (and columns) of the board.
+func (b Board) Size() int {
+	return len(b.Cells)
+}
+
+// InBounds reports whether the given cell lies on the board.
+func (b Board) InBounds(row, col int) bool {
+	return row >= 0 && row < len(b.Cells) && col >= 0 && col < len(b.Cells[row])
+}
+
+// Clone returns a deep copy of the board.
+func (b Board) Clone() Board {
+	cells := make([][]PlayerMark, len(b.Cells))
+	for i, rowData := range b.Cells {
+		cells[i] = make([]PlayerMark, len(rowData))
+		copy(cells[i], rowData)
+	}
+	return Board{Cells: cells, WinLength: b.WinLength}
+}
+
+// IsWinningMove reports whether placing mark at (row, col) completes a line of
+// WinLength marks. The current content of the cell is ignored.
+func (b Board) IsWinningMove(row, col int, mark PlayerMark) bool {
+	if !b.InBounds(row, col) || mark == None {
+		return false
+	}
+	for _, d := range directions {
+		count := 1 + b.countFrom(row+d[0], col+d[1], d[0], d[1], mark) + b.countFrom(row-d[0], col-d[1], -d[0], -d[1], mark)
+		if count >= b.WinLength {
+			return true
+		}
+	}
+	return false
+}
+
+// countFrom counts consecutive cells holding mark, starting at (row, col) and
+// stepping by (dr, dc).
+func (b Board) countFrom(row, col, dr, dc int, mark PlayerMark) int {
+	count := 0
+	for b.InBounds(row, col) && b.Cells[row][col] == mark {
+		count++
+		row += dr
+		col += dc
+	}
+	return count
+}
+
+// Config describes the variant and board a game is played with.
+type Config struct {
+	Variant   string
+	Size      int
+	WinLength int
+	// TimeControl is zero until one is chosen; games are then played with
+	// DefaultTimeControl.
+	TimeControl TimeControl
+}
+
+// DefaultConfig is the classic 3x3, three-in-a-row game.
+var DefaultConfig = Config{Variant: DefaultVariant, Size: DefaultBoardSize, WinLength: DefaultWinLength(DefaultBoardSize)}
+
+// NewConfig validates and returns a game configuration. An empty variant selects the default one.
+func NewConfig(variant string, size, winLength int) (Config, error) {
+	ruleset, err := LookupRuleset(variant)
+	if err != nil {
+		return Config{}, err
+	}
+	if size < MinBoardSize || size > MaxBoardSize {
+		return Config{}, fmt.Errorf("board size must be between %d and %d", MinBoardSize, MaxBoardSize)
+	}
+	if winLength < MinWinLength || winLength > size {
+		return Config{}, fmt.Errorf("win length must be between %d and the board size", MinWinLength)
+	}
+
+	cfg := Config{Variant: ruleset.Name(), Size: size, WinLength: winLength}
+	if err := ruleset.ValidateConfig(cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// ResolveConfig fills in the defaults of a partly chosen configuration and
+// validates it. A zero size selects the board the variant is usually played on,
+// and a zero win length the usual one for the board size.
+func ResolveConfig(variant string, size, winLength int) (Config, error) {
+	ruleset, err := LookupRuleset(variant)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := ruleset.DefaultConfig()
+	if size != 0 {
+		cfg.Size = size
+		cfg.WinLength = DefaultWinLength(size)
+	}
+	if winLength != 0 {
+		cfg.WinLength = winLength
+	}
+	return NewConfig(cfg.Variant, cfg.Size, cfg.WinLength)
+}
+
+// DefaultWinLength returns the usual win length for a board of the given size:
+// the full row on small boards, four on 5x5 and five (gomoku) on anything larger.
+func DefaultWinLength(size int) int {
+	switch {
+	case size <= 4:
+		return size
+	case size == 5:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// NewBoard creates an empty board for the configuration.
+func (c Config) NewBoard() Board {
+	return NewBoard(c.Size, c.WinLength)
+}
+
+// Ruleset returns the ruleset of the configured variant.
+func (c Config) Ruleset() (Ruleset, error) {
+	return LookupRuleset(c.Variant)
+}
+
+// Key returns a compact string form of the configuration, e.g. "classic/15x15k5"
+// or "classic/3x3k3@60+2" once a time control is chosen.
+func (c Config) Key() string {
+	variant := c.Variant
+	if variant == "" {
+		variant = DefaultVariant
+	}
+	key := fmt.Sprintf("%s/%dx%dk%d", variant, c.Size, c.Size, c.WinLength)
+	if !c.TimeControl.IsZero() {
+		key += "@" + c.TimeControl.String()
+	}
+	return key
+}
+
+// ParseConfigKey parses a key produced by Config.Key. Keys without a variant
+// prefix use the default variant.
+func ParseConfigKey(key string) (Config, error) {
+	key, rawTC, hasTC := strings.Cut(key, "@")
+	var tc TimeControl
+	if hasTC {
+		var err error
+		if tc, err = ParseTimeControl(rawTC); err != nil {
+			return Config{}, err
+		}
+	}
+
+	variant, board, ok := strings.Cut(key, "/")
+	if !ok {
+		variant, board = DefaultVariant, key
+	}
+	dims, win, ok := strings.Cut(board, "k")
+	if !ok {
+		return Config{}, errors.New("invalid board config key")
+	}
+	rows, cols, ok := strings.Cut(dims, "x")
+	if !ok || rows != cols {
+		return Config{}, errors.New("invalid board config key")
+	}
+	size, err := strconv.Atoi(rows)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid board size: %w", err)
+	}
+	winLength, err := strconv.Atoi(win)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid win length: %w", err)
+	}
+	cfg, err := NewConfig(variant, size, winLength)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.TimeControl = tc
+	return cfg, nil
+}
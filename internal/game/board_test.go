@@ -0,0 +1,204 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+// boardWith returns an empty board of the given size and win length with the listed cells set to mark.
+func boardWith(size, winLength int, mark PlayerMark, cells ...[2]int) Board {
+	board := NewBoard(size, winLength)
+	for _, cell := range cells {
+		board.Cells[cell[0]][cell[1]] = mark
+	}
+	return board
+}
+
+func TestCheckWinnerLargeBoards(t *testing.T) {
+	tests := []struct {
+		name  string
+		board Board
+		want  PlayerMark
+	}{
+		{
+			name:  "4x4 - X wins with four in a row",
+			board: boardWith(4, 4, PlayerX, [2]int{2, 0}, [2]int{2, 1}, [2]int{2, 2}, [2]int{2, 3}),
+			want:  PlayerX,
+		},
+		{
+			name:  "4x4 - three in a row is not enough",
+			board: boardWith(4, 4, PlayerX, [2]int{2, 0}, [2]int{2, 1}, [2]int{2, 2}),
+			want:  None,
+		},
+		{
+			name:  "5x5 win 4 - O wins on an off-centre anti-diagonal",
+			board: boardWith(5, 4, PlayerO, [2]int{1, 4}, [2]int{2, 3}, [2]int{3, 2}, [2]int{4, 1}),
+			want:  PlayerO,
+		},
+		{
+			name:  "15x15 gomoku - X wins on a diagonal",
+			board: boardWith(15, 5, PlayerX, [2]int{7, 7}, [2]int{8, 8}, [2]int{9, 9}, [2]int{10, 10}, [2]int{11, 11}),
+			want:  PlayerX,
+		},
+		{
+			name:  "15x15 gomoku - O wins on the last column",
+			board: boardWith(15, 5, PlayerO, [2]int{10, 14}, [2]int{11, 14}, [2]int{12, 14}, [2]int{13, 14}, [2]int{14, 14}),
+			want:  PlayerO,
+		},
+		{
+			name:  "15x15 gomoku - broken line does not win",
+			board: boardWith(15, 5, PlayerX, [2]int{0, 0}, [2]int{0, 1}, [2]int{0, 2}, [2]int{0, 4}, [2]int{0, 5}),
+			want:  None,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckWinner(tt.board); got != tt.want {
+				t.Errorf("CheckWinner() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWinningMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		board    Board
+		row, col int
+		mark     PlayerMark
+		want     bool
+	}{
+		{
+			name:  "3x3 - completes a row",
+			board: boardWith(3, 3, PlayerX, [2]int{0, 0}, [2]int{0, 1}),
+			row:   0, col: 2, mark: PlayerX,
+			want: true,
+		},
+		{
+			name:  "3x3 - wrong mark",
+			board: boardWith(3, 3, PlayerX, [2]int{0, 0}, [2]int{0, 1}),
+			row:   0, col: 2, mark: PlayerO,
+			want: false,
+		},
+		{
+			name:  "15x15 - fills the gap in a broken line",
+			board: boardWith(15, 5, PlayerO, [2]int{3, 3}, [2]int{4, 4}, [2]int{6, 6}, [2]int{7, 7}),
+			row:   5, col: 5, mark: PlayerO,
+			want: true,
+		},
+		{
+			name:  "15x15 - four is not five",
+			board: boardWith(15, 5, PlayerO, [2]int{3, 3}, [2]int{4, 4}, [2]int{6, 6}),
+			row:   5, col: 5, mark: PlayerO,
+			want: false,
+		},
+		{
+			name:  "Out of bounds",
+			board: NewBoard(4, 4),
+			row:   4, col: 0, mark: PlayerX,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.board.IsWinningMove(tt.row, tt.col, tt.mark); got != tt.want {
+				t.Errorf("IsWinningMove() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		variant         string
+		size, winLength int
+		wantErr         bool
+	}{
+		{name: "Classic", variant: "classic", size: 3, winLength: 3},
+		{name: "Default variant", size: 3, winLength: 3},
+		{name: "Gomoku", variant: "classic", size: 15, winLength: 5},
+		{name: "Misere 4x4", variant: "misere", size: 4, winLength: 4},
+		{name: "Order and chaos", variant: "orderchaos", size: 6, winLength: 5},
+		{name: "Order and chaos on 3x3", variant: "orderchaos", size: 3, winLength: 3, wantErr: true},
+		{name: "Unknown variant", variant: "chess", size: 3, winLength: 3, wantErr: true},
+		{name: "Board too small", size: 2, winLength: 2, wantErr: true},
+		{name: "Board too large", size: MaxBoardSize + 1, winLength: 5, wantErr: true},
+		{name: "Win length longer than board", size: 4, winLength: 5, wantErr: true},
+		{name: "Win length too short", size: 5, winLength: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := NewConfig(tt.variant, tt.size, tt.winLength)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (cfg.Variant == "" || cfg.Size != tt.size || cfg.WinLength != tt.winLength) {
+				t.Errorf("NewConfig() got = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestResolveConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		variant         string
+		size, winLength int
+		want            Config
+		wantErr         bool
+	}{
+		{name: "Defaults", want: DefaultConfig},
+		{name: "Variant board", variant: "orderchaos", want: Config{Variant: "orderchaos", Size: 6, WinLength: 5}},
+		{name: "Size picks win length", size: 15, want: Config{Variant: "classic", Size: 15, WinLength: 5}},
+		{name: "Explicit win length", size: 7, winLength: 4, want: Config{Variant: "classic", Size: 7, WinLength: 4}},
+		{name: "Invalid size", size: 1, wantErr: true},
+		{name: "Unknown variant", variant: "chess", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ResolveConfig(tt.variant, tt.size, tt.winLength)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg != tt.want {
+				t.Errorf("ResolveConfig() got = %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigKeyRoundTrip(t *testing.T) {
+	configs := []Config{
+		DefaultConfig,
+		{Variant: "classic", Size: 4, WinLength: 4},
+		{Variant: "wild", Size: 5, WinLength: 4},
+		{Variant: "classic", Size: 15, WinLength: 5},
+		OrderAndChaos.DefaultConfig(),
+		{Variant: "classic", Size: 3, WinLength: 3, TimeControl: TimeControl{Base: time.Minute, Increment: 2 * time.Second}},
+		{Variant: "classic", Size: 3, WinLength: 3, TimeControl: TimeControl{Base: 5 * time.Minute, Delay: 3 * time.Second}},
+	}
+	for _, cfg := range configs {
+		got, err := ParseConfigKey(cfg.Key())
+		if err != nil {
+			t.Fatalf("ParseConfigKey(%q) returned error: %v", cfg.Key(), err)
+		}
+		if got != cfg {
+			t.Errorf("ParseConfigKey(%q) got = %+v, want %+v", cfg.Key(), got, cfg)
+		}
+	}
+
+	if cfg, err := ParseConfigKey("4x4k4"); err != nil || cfg.Variant != DefaultVariant {
+		t.Errorf("ParseConfigKey without a variant should use the default variant, got %+v, %v", cfg, err)
+	}
+
+	for _, key := range []string{"", "3x3", "3x4k3", "axak3", "3x3k9", "chess/3x3k3", "orderchaos/3x3k3", "3x3k3@60", "3x3k3@1+0"} {
+		if _, err := ParseConfigKey(key); err == nil {
+			t.Errorf("ParseConfigKey(%q) expected an error", key)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds of the time controls players may choose.
+const (
+	MinClockBase  = 10 * time.Second
+	MaxClockBase  = time.Hour
+	MaxClockBonus = time.Minute
+)
+
+// TimeControl is how much time each player has for a game: a bank of Base time
+// and either a Fischer Increment, added to the bank after each move, or a
+// Bronstein Delay, up to which the time spent on a move is given back.
+type TimeControl struct {
+	Base      time.Duration
+	Increment time.Duration
+	Delay     time.Duration
+}
+
+// DefaultTimeControl is used for games whose time control wasn't chosen.
+var DefaultTimeControl = TimeControl{Base: time.Minute, Increment: 2 * time.Second}
+
+// ParseTimeControl parses a time control written in seconds as "<base>+<increment>",
+// e.g. "60+2", or "<base>d<delay>" for a Bronstein delay, e.g. "60d2".
+func ParseTimeControl(s string) (TimeControl, error) {
+	sep := "+"
+	if strings.Contains(s, "d") {
+		sep = "d"
+	}
+	rawBase, rawBonus, ok := strings.Cut(s, sep)
+	if !ok {
+		return TimeControl{}, errors.New("time control must look like 60+2 or 60d2")
+	}
+	base, err := strconv.Atoi(rawBase)
+	if err != nil {
+		return TimeControl{}, fmt.Errorf("invalid base time: %w", err)
+	}
+	bonus, err := strconv.Atoi(rawBonus)
+	if err != nil {
+		return TimeControl{}, fmt.Errorf("invalid time bonus: %w", err)
+	}
+
+	tc := TimeControl{Base: time.Duration(base) * time.Second}
+	if sep == "d" {
+		tc.Delay = time.Duration(bonus) * time.Second
+	} else {
+		tc.Increment = time.Duration(bonus) * time.Second
+	}
+	if tc.Base < MinClockBase || tc.Base > MaxClockBase {
+		return TimeControl{}, fmt.Errorf("base time must be between %v and %v", MinClockBase, MaxClockBase)
+	}
+	if bonus < 0 || tc.Increment > MaxClockBonus || tc.Delay > MaxClockBonus {
+		return TimeControl{}, fmt.Errorf("increment and delay must be between 0 and %v", MaxClockBonus)
+	}
+	return tc, nil
+}
+
+// String returns the time control in the form read by ParseTimeControl.
+func (tc TimeControl) String() string {
+	if tc.Delay > 0 {
+		return fmt.Sprintf("%dd%d", int(tc.Base.Seconds()), int(tc.Delay.Seconds()))
+	}
+	return fmt.Sprintf("%d+%d", int(tc.Base.Seconds()), int(tc.Increment.Seconds()))
+}
+
+// IsZero reports whether no time control was chosen.
+func (tc TimeControl) IsZero() bool {
+	return tc == TimeControl{}
+}
+
+// Remaining returns what is left of a bank of time after thinking for elapsed
+// on a move, never less than zero.
+func (tc TimeControl) Remaining(left, elapsed time.Duration) time.Duration {
+	used := max(elapsed-tc.Delay, 0)
+	return max(left-used, 0)
+}
+
+// Charge returns a player's bank once they moved after thinking for elapsed,
+// including the increment. It reports false if their time ran out first.
+func (tc TimeControl) Charge(left, elapsed time.Duration) (time.Duration, bool) {
+	left = tc.Remaining(left, elapsed)
+	if left == 0 {
+		return 0, false
+	}
+	return left + tc.Increment, true
+}
+
+// Clock holds both players' banks of time. The bank of the player to move is
+// what they had when their turn started.
+type Clock struct {
+	X, O          time.Duration
+	TurnStartedAt time.Time
+}
+
+// NewClock returns the clock of a game starting at now.
+func NewClock(tc TimeControl, now time.Time) Clock {
+	return Clock{X: tc.Base, O: tc.Base, TurnStartedAt: now}
+}
+
+// Bank returns the bank of the player with mark.
+func (c Clock) Bank(mark PlayerMark) time.Duration {
+	if mark == PlayerO {
+		return c.O
+	}
+	return c.X
+}
+
+// SetBank sets the bank of the player with mark.
+func (c *Clock) SetBank(mark PlayerMark, left time.Duration) {
+	if mark == PlayerO {
+		c.O = left
+	} else {
+		c.X = left
+	}
+}
@@ -0,0 +1,85 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	tests := map[string]TimeControl{
+		"60+2":  {Base: time.Minute, Increment: 2 * time.Second},
+		"180+0": {Base: 3 * time.Minute},
+		"300d5": {Base: 5 * time.Minute, Delay: 5 * time.Second},
+	}
+	for raw, want := range tests {
+		got, err := ParseTimeControl(raw)
+		if err != nil {
+			t.Fatalf("ParseTimeControl(%q) returned error: %v", raw, err)
+		}
+		if got != want {
+			t.Errorf("ParseTimeControl(%q) = %+v, want %+v", raw, got, want)
+		}
+		if got.String() != raw {
+			t.Errorf("String() = %q, want %q", got.String(), raw)
+		}
+	}
+
+	for _, raw := range []string{"", "60", "60+", "a+2", "5+2", "7200+0", "60+120", "60+-1", "60d2d"} {
+		if _, err := ParseTimeControl(raw); err == nil {
+			t.Errorf("ParseTimeControl(%q) expected an error", raw)
+		}
+	}
+}
+
+func TestTimeControl_Charge(t *testing.T) {
+	fischer := TimeControl{Base: time.Minute, Increment: 2 * time.Second}
+	bronstein := TimeControl{Base: time.Minute, Delay: 2 * time.Second}
+
+	tests := []struct {
+		name     string
+		tc       TimeControl
+		left     time.Duration
+		elapsed  time.Duration
+		want     time.Duration
+		wantLeft bool
+	}{
+		{"increment added after the move", fischer, 10 * time.Second, 3 * time.Second, 9 * time.Second, true},
+		{"delay gives back quick moves", bronstein, 10 * time.Second, time.Second, 10 * time.Second, true},
+		{"delay only gives back its own length", bronstein, 10 * time.Second, 5 * time.Second, 7 * time.Second, true},
+		{"flag falls before the increment", fischer, 3 * time.Second, 3 * time.Second, 0, false},
+		{"flag falls after the delay", bronstein, 3 * time.Second, 6 * time.Second, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.tc.Charge(tt.left, tt.elapsed)
+			if got != tt.want || ok != tt.wantLeft {
+				t.Errorf("Charge() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestGameStateDTO_TimeLeft(t *testing.T) {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	state := &GameStateDTO{
+		CurrentTurn: PlayerX,
+		TimeControl: DefaultTimeControl,
+		Clock:       Clock{X: 30 * time.Second, O: 20 * time.Second, TurnStartedAt: start},
+	}
+	now := start.Add(10 * time.Second)
+
+	if got := state.TimeLeft(PlayerX, now); got != 20*time.Second {
+		t.Errorf("TimeLeft(X) = %v, want the running clock at 20s", got)
+	}
+	if got := state.TimeLeft(PlayerO, now); got != 20*time.Second {
+		t.Errorf("TimeLeft(O) = %v, want the stopped clock at 20s", got)
+	}
+	if got := state.TimeLeft(PlayerX, start.Add(time.Minute)); got != 0 {
+		t.Errorf("TimeLeft(X) after the flag fell = %v, want 0", got)
+	}
+
+	state.Winner = PlayerO
+	if got := state.TimeLeft(PlayerX, now); got != 30*time.Second {
+		t.Errorf("TimeLeft(X) of a finished game = %v, want the bank of 30s", got)
+	}
+}
@@ -2,6 +2,7 @@ package game
 
 import (
 	"math/rand/v2"
+	"time"
 )
 
 // PlayerMark represents the mark of a player (X, O) or an empty cell.
@@ -18,28 +19,116 @@ const (
 	// Game results
 	Draw GameResult = "Draw"
 
-	// Board boundaries
-	BorderMin = 0
-	BorderMax = 2
-
 	// Redis hash fields
-	FieldBoard    = "board"
-	FieldPlayerX  = "player_x"
-	FieldPlayerO  = "player_o"
-	FieldNextTurn = "next_turn"
-	FieldWinner   = "winner"
-	FieldStatus   = "status"
+	FieldVariant     = "variant"
+	FieldBoard       = "board"
+	FieldBoardSize   = "board_size"
+	FieldWinLength   = "win_length"
+	FieldPlayerX     = "player_x"
+	FieldPlayerO     = "player_o"
+	FieldNextTurn    = "next_turn"
+	FieldLastMove    = "last_move"
+	FieldWinner      = "winner"
+	FieldStatus      = "status"
+	FieldSpectators  = "spectators"
+	FieldTimeControl = "time_control"
+	FieldClockX      = "clock_x_ms"
+	FieldClockO      = "clock_o_ms"
+	FieldTurnStarted = "turn_started_at"
+	FieldGameID      = "game_id"
+	FieldStartedAt   = "started_at"
+	FieldTakeback    = "takeback_request"
+	FieldTermination = "termination"
+	FieldDrawOffer   = "draw_offer"
+	FieldAbandonedBy = "abandoned_by"
+	FieldBots        = "bots"
+
+	// Redis hash fields of the room:<id>:meta hash kept for MetaRuleset games
+	FieldMacroBoard  = "macro_board"
+	FieldForcedBoard = "forced_board"
 )
 
 // GameStateDTO is a Data Transfer Object for game state.
 // It's used to pass game state information around without holding state in memory.
 type GameStateDTO struct {
-	Board       [3][3]PlayerMark
+	Variant     string
+	Board       Board
 	CurrentTurn PlayerMark
+	LastMove    *Move
 	Winner      PlayerMark
 	IsDraw      bool
 	PlayerXID   string
 	PlayerOID   string
+	// Spectators is the number of spectators watching the game on all servers.
+	Spectators int
+	// TimeControl is zero for games started before clocks, which are untimed.
+	TimeControl TimeControl
+	Clock       Clock
+	// GameID identifies this game of the room; every rematch gets a new one.
+	GameID    string
+	StartedAt time.Time
+	// Termination is how the game ended, once it is over.
+	Termination Termination
+	// BotDifficulties maps the player ID of each bot in the game to its difficulty.
+	BotDifficulties map[string]string
+
+	// MacroBoard and ForcedBoard are only set for games played with a MetaRuleset.
+	MacroBoard  [][]PlayerMark
+	ForcedBoard []int
+}
+
+// Over reports whether the game has ended, including games that were aborted
+// without a winner.
+func (s *GameStateDTO) Over() bool {
+	return s.Winner != None || s.IsDraw || s.Termination != ""
+}
+
+// Config returns the variant, board and time control the game is played with.
+func (s *GameStateDTO) Config() Config {
+	return Config{Variant: s.Variant, Size: s.Board.Size(), WinLength: s.Board.WinLength, TimeControl: s.TimeControl}
+}
+
+// TimeLeft returns the time the player with mark has left at now. The clock of
+// the player to move runs until the game is over.
+func (s *GameStateDTO) TimeLeft(mark PlayerMark, now time.Time) time.Duration {
+	left := s.Clock.Bank(mark)
+	if mark != s.CurrentTurn || s.Over() {
+		return left
+	}
+	return s.TimeControl.Remaining(left, now.Sub(s.Clock.TurnStartedAt))
+}
+
+// Ruleset returns the ruleset of the game's variant.
+func (s *GameStateDTO) Ruleset() (Ruleset, error) {
+	return LookupRuleset(s.Variant)
+}
+
+// State returns the part of the game state a ruleset works on.
+func (s *GameStateDTO) State() State {
+	return State{Board: s.Board, Turn: s.CurrentTurn, LastMove: s.LastMove}
+}
+
+// MarkOf returns the mark of the given player, or None if they are not part of the game.
+func (s *GameStateDTO) MarkOf(playerID string) PlayerMark {
+	switch playerID {
+	case s.PlayerXID:
+		return PlayerX
+	case s.PlayerOID:
+		return PlayerO
+	}
+	return None
+}
+
+// OpponentOf returns the ID of the player's opponent, or an empty string for
+// anybody who doesn't play in the game.
+func (s *GameStateDTO) OpponentOf(playerID string) string {
+	switch playerID {
+	case s.PlayerXID:
+		return s.PlayerOID
+	case s.PlayerOID:
+		return s.PlayerXID
+	}
+	return ""
 }
 
 // RandomlyChooseFirstPlayer randomly selects who goes first.
@@ -50,40 +139,27 @@ func RandomlyChooseFirstPlayer() PlayerMark {
 	return PlayerO
 }
 
-// BoardArrayToSlice converts a 3x3 array to a slice of slices.
-func BoardArrayToSlice(board [3][3]PlayerMark) [][]PlayerMark {
-	slice := make([][]PlayerMark, 3)
-	for i := 0; i < 3; i++ {
-		slice[i] = make([]PlayerMark, 3)
-		copy(slice[i], board[i][:])
-	}
-	return slice
+// BoardArrayToSlice returns a copy of the board's cells as a slice of slices.
+func BoardArrayToSlice(board Board) [][]PlayerMark {
+	return board.Clone().Cells
 }
 
 // CheckWinner checks if there is a winner on the board. Returns the winner's mark or None.
-func CheckWinner(board [3][3]PlayerMark) PlayerMark {
-	// Check rows
-	for i := range [3]int{} {
-		if board[i][0] != None && board[i][0] == board[i][1] && board[i][1] == board[i][2] {
-			return board[i][0]
-		}
-	}
-
-	// Check columns
-	for i := range [3]int{} {
-		if board[0][i] != None && board[0][i] == board[1][i] && board[1][i] == board[2][i] {
-			return board[0][i]
+// A player wins by placing WinLength marks in a row horizontally, vertically or diagonally.
+func CheckWinner(board Board) PlayerMark {
+	for r, rowData := range board.Cells {
+		for c, mark := range rowData {
+			if mark == None {
+				continue
+			}
+			for _, d := range directions {
+				if board.countFrom(r, c, d[0], d[1], mark) >= board.WinLength {
+					return mark
+				}
+			}
 		}
 	}
 
-	// Check diagonals
-	if board[0][0] != None && board[0][0] == board[1][1] && board[1][1] == board[2][2] {
-		return board[0][0]
-	}
-	if board[0][2] != None && board[0][2] == board[1][1] && board[1][1] == board[2][0] {
-		return board[0][2]
-	}
-
 	isBoardFull := IsBoardFull(board)
 	if isBoardFull {
 		return DRAW
@@ -93,14 +169,13 @@ func CheckWinner(board [3][3]PlayerMark) PlayerMark {
 }
 
 // IsBoardFull checks if the board has any empty cells left.
-func IsBoardFull(board [3][3]PlayerMark) bool {
-	for r := range [3]int{} {
-		for c := range [3]int{} {
-			if board[r][c] == None {
+func IsBoardFull(board Board) bool {
+	for _, rowData := range board.Cells {
+		for _, mark := range rowData {
+			if mark == None {
 				return false
 			}
 		}
 	}
 	return true
 }
-
@@ -7,17 +7,17 @@ import (
 func TestCheckWinner(t *testing.T) {
 	tests := []struct {
 		name  string
-		board [3][3]PlayerMark
+		board [][]PlayerMark
 		want  PlayerMark
 	}{
 		{
 			name:  "No winner - empty board",
-			board: [3][3]PlayerMark{},
+			board: NewBoard(3, 3).Cells,
 			want:  None,
 		},
 		{
 			name: "No winner - partial board",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, None, None},
 				{None, PlayerO, None},
 				{None, None, None},
@@ -26,7 +26,7 @@ func TestCheckWinner(t *testing.T) {
 		},
 		{
 			name: "X wins - first row",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, PlayerX, PlayerX},
 				{None, PlayerO, None},
 				{None, None, PlayerO},
@@ -35,7 +35,7 @@ func TestCheckWinner(t *testing.T) {
 		},
 		{
 			name: "O wins - second column",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, PlayerO, None},
 				{PlayerX, PlayerO, None},
 				{None, PlayerO, None},
@@ -44,7 +44,7 @@ func TestCheckWinner(t *testing.T) {
 		},
 		{
 			name: "X wins - main diagonal",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, None, None},
 				{None, PlayerX, None},
 				{None, None, PlayerX},
@@ -53,7 +53,7 @@ func TestCheckWinner(t *testing.T) {
 		},
 		{
 			name: "O wins - anti-diagonal",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{None, None, PlayerO},
 				{None, PlayerO, None},
 				{PlayerO, None, None},
@@ -62,7 +62,7 @@ func TestCheckWinner(t *testing.T) {
 		},
 		{
 			name: "No winner - full board (draw)",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, PlayerO, PlayerX},
 				{PlayerX, PlayerO, PlayerO},
 				{PlayerO, PlayerX, PlayerX},
@@ -73,7 +73,7 @@ func TestCheckWinner(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := CheckWinner(tt.board); got != tt.want {
+			if got := CheckWinner(Board{Cells: tt.board, WinLength: 3}); got != tt.want {
 				t.Errorf("CheckWinner() got = %v, want %v", got, tt.want)
 			}
 		})
@@ -83,17 +83,17 @@ func TestCheckWinner(t *testing.T) {
 func TestIsBoardFull(t *testing.T) {
 	tests := []struct {
 		name  string
-		board [3][3]PlayerMark
+		board [][]PlayerMark
 		want  bool
 	}{
 		{
 			name:  "Empty board is not full",
-			board: [3][3]PlayerMark{},
+			board: NewBoard(3, 3).Cells,
 			want:  false,
 		},
 		{
 			name: "Partial board is not full",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, None, None},
 				{None, PlayerO, None},
 				{None, None, None},
@@ -102,7 +102,7 @@ func TestIsBoardFull(t *testing.T) {
 		},
 		{
 			name: "Full board is full",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, PlayerO, PlayerX},
 				{PlayerX, PlayerO, PlayerO},
 				{PlayerO, PlayerX, PlayerX},
@@ -111,7 +111,7 @@ func TestIsBoardFull(t *testing.T) {
 		},
 		{
 			name: "Full board with winner is full",
-			board: [3][3]PlayerMark{
+			board: [][]PlayerMark{
 				{PlayerX, PlayerX, PlayerX},
 				{PlayerO, PlayerO, PlayerX},
 				{PlayerO, PlayerX, PlayerO},
@@ -122,7 +122,7 @@ func TestIsBoardFull(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := IsBoardFull(tt.board); got != tt.want {
+			if got := IsBoardFull(Board{Cells: tt.board, WinLength: 3}); got != tt.want {
 				t.Errorf("IsBoardFull() got = %v, want %v", got, tt.want)
 			}
 		})
@@ -151,3 +151,14 @@ func TestRandomlyChooseFirstPlayer(t *testing.T) {
 		t.Errorf("RandomlyChooseFirstPlayer() did not return both PlayerX and PlayerO over 100 runs. Seen X: %v, Seen O: %v", seenX, seenO)
 	}
 }
+
+func TestOpponentOf(t *testing.T) {
+	state := &GameStateDTO{PlayerXID: "alice", PlayerOID: "bob"}
+
+	tests := map[string]string{"alice": "bob", "bob": "alice", "carol": ""}
+	for playerID, want := range tests {
+		if got := state.OpponentOf(playerID); got != want {
+			t.Errorf("OpponentOf(%q) = %q, want %q", playerID, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package game
+
+import "time"
+
+// Termination is how a game ended.
+type Termination string
+
+const (
+	// TerminationWin is a game won by completing a line.
+	TerminationWin Termination = "win"
+	// TerminationDraw is a game that ended without a winner.
+	TerminationDraw Termination = "draw"
+	// TerminationTimeout is a game lost on time. Games archived before clocks
+	// also use it when the server played the deciding move for a player who
+	// timed out.
+	TerminationTimeout Termination = "timeout"
+	// TerminationAbandon is a game left unfinished because both players left
+	// and didn't reconnect in time.
+	TerminationAbandon Termination = "abandon"
+	// TerminationResign is a game won because the opponent resigned.
+	TerminationResign Termination = "resign"
+	// TerminationAgreement is a game drawn by accepting a draw offer.
+	TerminationAgreement Termination = "agreement"
+	// TerminationAbort is a game called off before both players had moved.
+	TerminationAbort Termination = "abort"
+	// TerminationForfeit is a game won because the opponent left and didn't
+	// reconnect in time.
+	TerminationForfeit Termination = "forfeit"
+)
+
+// MoveRecord is a move as it was played in a game.
+type MoveRecord struct {
+	Move
+	At time.Time `json:"at"`
+	// Proxy is set for moves the server played for a player who timed out,
+	// which only games played before clocks have.
+	Proxy bool `json:"proxy,omitempty"`
+}
+
+// TerminationOf returns how a finished game with the given winner and moves ended.
+func TerminationOf(winner PlayerMark, moves []MoveRecord) Termination {
+	switch {
+	case winner == DRAW:
+		return TerminationDraw
+	case len(moves) > 0 && moves[len(moves)-1].Proxy:
+		return TerminationTimeout
+	}
+	return TerminationWin
+}
+
+// Abortable reports whether a game with the given moves may still be aborted,
+// which is until both players have moved.
+func Abortable(moves []MoveRecord) bool {
+	var movedX, movedO bool
+	for _, move := range moves {
+		switch move.Player {
+		case PlayerX:
+			movedX = true
+		case PlayerO:
+			movedO = true
+		}
+	}
+	return !movedX || !movedO
+}
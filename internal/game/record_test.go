@@ -0,0 +1,51 @@
+package game
+
+import "testing"
+
+func TestTerminationOf(t *testing.T) {
+	played := MoveRecord{Move: Move{Player: PlayerX, Piece: PlayerX}}
+	proxy := MoveRecord{Move: Move{Player: PlayerX, Piece: PlayerX}, Proxy: true}
+
+	tests := []struct {
+		name   string
+		winner PlayerMark
+		moves  []MoveRecord
+		want   Termination
+	}{
+		{name: "Win by a played move", winner: PlayerX, moves: []MoveRecord{proxy, played}, want: TerminationWin},
+		{name: "Win by a proxy move", winner: PlayerX, moves: []MoveRecord{played, proxy}, want: TerminationTimeout},
+		{name: "Draw by a proxy move", winner: DRAW, moves: []MoveRecord{played, proxy}, want: TerminationDraw},
+		{name: "Win without recorded moves", winner: PlayerO, want: TerminationWin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TerminationOf(tt.winner, tt.moves); got != tt.want {
+				t.Errorf("TerminationOf() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbortable(t *testing.T) {
+	x := MoveRecord{Move: Move{Player: PlayerX, Piece: PlayerX}}
+	o := MoveRecord{Move: Move{Player: PlayerO, Piece: PlayerO}}
+
+	tests := []struct {
+		name  string
+		moves []MoveRecord
+		want  bool
+	}{
+		{name: "No moves", want: true},
+		{name: "Only the first player moved", moves: []MoveRecord{o}, want: true},
+		{name: "Both players moved", moves: []MoveRecord{x, o}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Abortable(tt.moves); got != tt.want {
+				t.Errorf("Abortable() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package game
+
+import "fmt"
+
+// Replay plays moves from the empty board of cfg and returns the state of the
+// game before the first move and after each move. The first move decides who
+// started.
+func Replay(cfg Config, moves []Move) ([]GameStateDTO, error) {
+	ruleset, err := cfg.Ruleset()
+	if err != nil {
+		return nil, err
+	}
+
+	state := State{Board: cfg.NewBoard()}
+	if len(moves) > 0 {
+		state.Turn = moves[0].Player
+	}
+	states := make([]GameStateDTO, 0, len(moves)+1)
+	states = append(states, replayState(cfg.Variant, ruleset, state))
+	for i, move := range moves {
+		state, err = ruleset.Apply(state, move)
+		if err != nil {
+			return nil, fmt.Errorf("move %d: %w", i+1, err)
+		}
+		states = append(states, replayState(cfg.Variant, ruleset, state))
+	}
+	return states, nil
+}
+
+// replayState returns the game state of a replayed position.
+func replayState(variant string, ruleset Ruleset, s State) GameStateDTO {
+	dto := GameStateDTO{
+		Variant:     variant,
+		Board:       s.Board,
+		CurrentTurn: s.Turn,
+		LastMove:    s.LastMove,
+		Winner:      ruleset.Outcome(s),
+	}
+	if meta, ok := ruleset.(MetaRuleset); ok {
+		dto.MacroBoard = meta.MacroBoard(s)
+		dto.ForcedBoard = meta.ForcedBoard(s)
+	}
+	return dto
+}
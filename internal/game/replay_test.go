@@ -0,0 +1,68 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	cfg := Classic.DefaultConfig()
+	moves := []Move{
+		{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 0},
+		{Player: PlayerX, Piece: PlayerX, Row: 1, Col: 1},
+		{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 1},
+		{Player: PlayerX, Piece: PlayerX, Row: 2, Col: 2},
+		{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 2},
+	}
+
+	states, err := Replay(cfg, moves)
+	if err != nil {
+		t.Fatalf("Replay() returned error: %v", err)
+	}
+	if len(states) != len(moves)+1 {
+		t.Fatalf("Replay() returned %d states, want %d", len(states), len(moves)+1)
+	}
+
+	first := states[0]
+	if first.CurrentTurn != PlayerO || first.LastMove != nil || first.Board.Size() != 3 {
+		t.Errorf("first state = %+v, want a 3x3 board with O to move", first)
+	}
+	for _, rowData := range first.Board.Cells {
+		for _, cell := range rowData {
+			if cell != None {
+				t.Fatalf("first board = %v, want it empty", first.Board.Cells)
+			}
+		}
+	}
+	if states[2].Board.Cells[0][0] != PlayerO || states[2].Board.Cells[1][1] != PlayerX || states[2].Board.Cells[0][1] != None {
+		t.Errorf("board after two moves = %v", states[2].Board.Cells)
+	}
+	if states[4].Winner != None || states[4].CurrentTurn != PlayerO {
+		t.Errorf("state before the last move = %+v, want O to move without a winner", states[4])
+	}
+	last := states[len(states)-1]
+	if last.Winner != PlayerO || last.LastMove == nil || *last.LastMove != moves[4] {
+		t.Errorf("last state = %+v, want O's winning move", last)
+	}
+	// Earlier states are not changed by later moves.
+	if states[1].Board.Cells[0][1] != None {
+		t.Error("replaying later moves changed an earlier board")
+	}
+
+	illegal := append([]Move{}, moves[:2]...)
+	illegal = append(illegal, Move{Player: PlayerO, Piece: PlayerO, Row: 1, Col: 1})
+	if _, err := Replay(cfg, illegal); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Replay() with an illegal move returned %v, want ErrInvalidMove", err)
+	}
+}
+
+func TestReplayUltimate(t *testing.T) {
+	states, err := Replay(Ultimate.DefaultConfig(), []Move{{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 4}})
+	if err != nil {
+		t.Fatalf("Replay() returned error: %v", err)
+	}
+	last := states[1]
+	if len(last.MacroBoard) != SubBoardSize || len(last.ForcedBoard) != 2 || last.ForcedBoard[0] != 0 || last.ForcedBoard[1] != 1 {
+		t.Errorf("got macro board %v and forced board %v, want O sent to small board [0, 1]", last.MacroBoard, last.ForcedBoard)
+	}
+}
@@ -0,0 +1,112 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultVariant is the ruleset used when a game doesn't name one.
+const DefaultVariant = "classic"
+
+var (
+	ErrGameOver       = errors.New("game is already over")
+	ErrNotYourTurn    = errors.New("not player's turn")
+	ErrInvalidMove    = errors.New("invalid move")
+	ErrUnknownRuleset = errors.New("unknown game variant")
+)
+
+// Move is a single placement on the board. Player is the mark of the player making
+// the move and Piece the mark placed on the board; they differ in variants such as
+// Wild, where either player may place either mark.
+type Move struct {
+	Player PlayerMark `json:"player"`
+	Piece  PlayerMark `json:"piece"`
+	Row    int        `json:"row"`
+	Col    int        `json:"col"`
+}
+
+// State is the part of a game a ruleset needs to decide legality and outcome.
+type State struct {
+	Board    Board
+	Turn     PlayerMark
+	LastMove *Move
+}
+
+// Ruleset decides how a game variant is played. Rulesets are stateless and are
+// looked up by name, so a variant can be added by registering a new implementation.
+type Ruleset interface {
+	// Name is the identifier used to select the variant.
+	Name() string
+	// DefaultConfig returns the board the variant is played on unless told otherwise.
+	DefaultConfig() Config
+	// ValidateConfig reports whether the variant can be played with the given board.
+	ValidateConfig(cfg Config) error
+	// ParseMove builds a move from a client position and optional piece.
+	ParseMove(s State, player PlayerMark, position []int, piece PlayerMark) (Move, error)
+	// Position returns the client position of a move, the inverse of ParseMove.
+	Position(move Move) []int
+	// LegalMoves lists the moves available to the player whose turn it is.
+	LegalMoves(s State) []Move
+	// Apply validates a move and returns the state after it is played.
+	Apply(s State, move Move) (State, error)
+	// Outcome reports the result after the last move: None while the game is in
+	// progress, DRAW, or the mark of the winning player.
+	Outcome(s State) PlayerMark
+	// NextPlayer returns who moves after mover.
+	NextPlayer(s State, mover PlayerMark) PlayerMark
+}
+
+var (
+	rulesetsMu sync.RWMutex
+	rulesets   = make(map[string]Ruleset)
+)
+
+// RegisterRuleset makes a ruleset available by name. Registering the same name twice panics.
+func RegisterRuleset(r Ruleset) {
+	rulesetsMu.Lock()
+	defer rulesetsMu.Unlock()
+
+	if _, exists := rulesets[r.Name()]; exists {
+		panic(fmt.Sprintf("game: ruleset %q registered twice", r.Name()))
+	}
+	rulesets[r.Name()] = r
+}
+
+// LookupRuleset returns the ruleset registered under name. An empty name selects the default variant.
+func LookupRuleset(name string) (Ruleset, error) {
+	if name == "" {
+		name = DefaultVariant
+	}
+
+	rulesetsMu.RLock()
+	defer rulesetsMu.RUnlock()
+
+	r, ok := rulesets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownRuleset, name)
+	}
+	return r, nil
+}
+
+// Variants returns the names of all registered rulesets in alphabetical order.
+func Variants() []string {
+	rulesetsMu.RLock()
+	defer rulesetsMu.RUnlock()
+
+	names := make([]string, 0, len(rulesets))
+	for name := range rulesets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Opponent returns the other player's mark.
+func Opponent(mark PlayerMark) PlayerMark {
+	if mark == PlayerX {
+		return PlayerO
+	}
+	return PlayerX
+}
@@ -0,0 +1,35 @@
+package game
+
+import "fmt"
+
+// TakebackPlies returns how many of the last moves are taken back when the
+// player with mark takes back their last move: that move and every move played
+// since, so it is their turn again. It returns 0 if the player hasn't moved.
+func TakebackPlies(moves []MoveRecord, mark PlayerMark) int {
+	for i := len(moves) - 1; i >= 0; i-- {
+		if moves[i].Player == mark {
+			return len(moves) - i
+		}
+	}
+	return 0
+}
+
+// Rewind returns the state of the game played on an empty board of cfg once
+// the last plies of moves are taken back. The player who made the first move
+// is to move on an empty board.
+func Rewind(cfg Config, moves []Move, plies int) (GameStateDTO, error) {
+	if plies < 0 || plies > len(moves) {
+		return GameStateDTO{}, fmt.Errorf("cannot take back %d of %d moves", plies, len(moves))
+	}
+
+	kept := moves[:len(moves)-plies]
+	states, err := Replay(cfg, kept)
+	if err != nil {
+		return GameStateDTO{}, err
+	}
+	state := states[len(states)-1]
+	if len(kept) == 0 && len(moves) > 0 {
+		state.CurrentTurn = moves[0].Player
+	}
+	return state, nil
+}
@@ -0,0 +1,67 @@
+package game
+
+import "testing"
+
+func TestTakebackPlies(t *testing.T) {
+	moves := []MoveRecord{
+		{Move: Move{Player: PlayerX, Piece: PlayerX, Row: 1, Col: 1}},
+		{Move: Move{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 0}},
+		{Move: Move{Player: PlayerX, Piece: PlayerX, Row: 2, Col: 2}},
+	}
+
+	tests := []struct {
+		name  string
+		moves []MoveRecord
+		mark  PlayerMark
+		want  int
+	}{
+		{"own move was the last", moves, PlayerX, 1},
+		{"opponent replied since", moves, PlayerO, 2},
+		{"player has not moved", moves[:1], PlayerO, 0},
+		{"no moves", nil, PlayerX, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TakebackPlies(tt.moves, tt.mark); got != tt.want {
+				t.Errorf("TakebackPlies() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewind(t *testing.T) {
+	cfg := Classic.DefaultConfig()
+	moves := []Move{
+		{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 0},
+		{Player: PlayerX, Piece: PlayerX, Row: 1, Col: 1},
+		{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 1},
+		{Player: PlayerX, Piece: PlayerX, Row: 2, Col: 2},
+		{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 2},
+	}
+
+	state, err := Rewind(cfg, moves, 2)
+	if err != nil {
+		t.Fatalf("Rewind() returned error: %v", err)
+	}
+	if state.CurrentTurn != PlayerX || state.Winner != None {
+		t.Errorf("got %q to move with winner %q, want X to move without a winner", state.CurrentTurn, state.Winner)
+	}
+	if state.LastMove == nil || *state.LastMove != moves[2] {
+		t.Errorf("last move = %v, want %v", state.LastMove, moves[2])
+	}
+	if state.Board.Cells[2][2] != None || state.Board.Cells[0][2] != None || state.Board.Cells[0][1] != PlayerO {
+		t.Errorf("board = %v, want the last two moves taken back", state.Board.Cells)
+	}
+
+	state, err = Rewind(cfg, moves, len(moves))
+	if err != nil {
+		t.Fatalf("Rewind() of every move returned error: %v", err)
+	}
+	if state.CurrentTurn != PlayerO || state.LastMove != nil {
+		t.Errorf("empty board has %q to move after %v, want O to move first", state.CurrentTurn, state.LastMove)
+	}
+
+	if _, err := Rewind(cfg, moves, len(moves)+1); err == nil {
+		t.Error("Rewind() of more moves than were played returned no error")
+	}
+}
@@ -0,0 +1,242 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// UltimateVariant is the name of the ultimate tic-tac-toe ruleset.
+	UltimateVariant = "ultimate"
+	// SubBoardSize is the size of each small board, and of the big board holding them.
+	SubBoardSize = 3
+)
+
+func init() {
+	RegisterRuleset(Ultimate)
+}
+
+// MetaRuleset is implemented by rulesets played on a big board made of smaller
+// boards. Besides the cells, these games have a macro board of small-board results
+// and may restrict which small board the next move goes to.
+type MetaRuleset interface {
+	Ruleset
+	// MacroBoard returns the result of each small board: None while it is open,
+	// the mark of the player who won it, or DRAW when it filled up without a line.
+	MacroBoard(s State) [][]PlayerMark
+	// ForcedBoard returns the [bigRow, bigCol] of the small board the next move
+	// must be played in, or nil when any open small board may be used.
+	ForcedBoard(s State) []int
+}
+
+// Ultimate is ultimate tic-tac-toe: nine 3x3 boards inside a 3x3 big board. The
+// cell a player picks decides the small board the opponent must play in next;
+// when that board is already decided the opponent may play in any open board.
+// Winning a small board claims it on the big board, and three claimed boards in
+// a row win the game.
+var Ultimate MetaRuleset = ultimateRuleset{}
+
+type ultimateRuleset struct{}
+
+func (ultimateRuleset) Name() string {
+	return UltimateVariant
+}
+
+func (ultimateRuleset) DefaultConfig() Config {
+	return Config{Variant: UltimateVariant, Size: SubBoardSize * SubBoardSize, WinLength: SubBoardSize}
+}
+
+func (u ultimateRuleset) ValidateConfig(cfg Config) error {
+	if cfg.Size != SubBoardSize*SubBoardSize || cfg.WinLength != SubBoardSize {
+		return errors.New("ultimate tic-tac-toe is played on nine 3x3 boards")
+	}
+	return nil
+}
+
+// ParseMove expects a [bigRow, bigCol, row, col] position and maps it onto the
+// 9x9 grid of cells.
+func (ultimateRuleset) ParseMove(s State, player PlayerMark, position []int, piece PlayerMark) (Move, error) {
+	if len(position) != 4 {
+		return Move{}, fmt.Errorf("%w: position must be [bigRow, bigCol, row, col]", ErrInvalidMove)
+	}
+	for _, v := range position {
+		if v < 0 || v >= SubBoardSize {
+			return Move{}, fmt.Errorf("%w: position out of range", ErrInvalidMove)
+		}
+	}
+	if piece != None && piece != player {
+		return Move{}, fmt.Errorf("%w: piece %q not allowed", ErrInvalidMove, piece)
+	}
+
+	return Move{
+		Player: player,
+		Piece:  player,
+		Row:    position[0]*SubBoardSize + position[2],
+		Col:    position[1]*SubBoardSize + position[3],
+	}, nil
+}
+
+func (ultimateRuleset) Position(move Move) []int {
+	return []int{move.Row / SubBoardSize, move.Col / SubBoardSize, move.Row % SubBoardSize, move.Col % SubBoardSize}
+}
+
+func (u ultimateRuleset) LegalMoves(s State) []Move {
+	macro := u.MacroBoard(s)
+	if s.LastMove != nil && macroOutcome(macro) != None {
+		return nil
+	}
+	forced := forcedBoard(s, macro)
+
+	moves := make([]Move, 0, SubBoardSize*SubBoardSize)
+	for row, rowData := range s.Board.Cells {
+		for col, cell := range rowData {
+			if cell != None || macro[row/SubBoardSize][col/SubBoardSize] != None {
+				continue
+			}
+			if forced != nil && (row/SubBoardSize != forced[0] || col/SubBoardSize != forced[1]) {
+				continue
+			}
+			moves = append(moves, Move{Player: s.Turn, Piece: s.Turn, Row: row, Col: col})
+		}
+	}
+	return moves
+}
+
+func (u ultimateRuleset) Apply(s State, move Move) (State, error) {
+	macro := u.MacroBoard(s)
+	if s.LastMove != nil && macroOutcome(macro) != None {
+		return State{}, ErrGameOver
+	}
+	if move.Player != s.Turn {
+		return State{}, ErrNotYourTurn
+	}
+	if move.Piece != move.Player {
+		return State{}, fmt.Errorf("%w: piece %q not allowed", ErrInvalidMove, move.Piece)
+	}
+	if !s.Board.InBounds(move.Row, move.Col) || s.Board.Cells[move.Row][move.Col] != None {
+		return State{}, ErrInvalidMove
+	}
+
+	bigRow, bigCol := move.Row/SubBoardSize, move.Col/SubBoardSize
+	if macro[bigRow][bigCol] != None {
+		return State{}, fmt.Errorf("%w: small board is already decided", ErrInvalidMove)
+	}
+	if forced := forcedBoard(s, macro); forced != nil && (bigRow != forced[0] || bigCol != forced[1]) {
+		return State{}, fmt.Errorf("%w: must play in small board [%d, %d]", ErrInvalidMove, forced[0], forced[1])
+	}
+
+	next := State{Board: s.Board.Clone(), LastMove: &move}
+	next.Board.Cells[move.Row][move.Col] = move.Piece
+	next.Turn = u.NextPlayer(next, move.Player)
+	return next, nil
+}
+
+func (u ultimateRuleset) Outcome(s State) PlayerMark {
+	if s.LastMove == nil {
+		return None
+	}
+	return macroOutcome(u.MacroBoard(s))
+}
+
+func (ultimateRuleset) NextPlayer(s State, mover PlayerMark) PlayerMark {
+	return Opponent(mover)
+}
+
+func (ultimateRuleset) MacroBoard(s State) [][]PlayerMark {
+	macro := make([][]PlayerMark, SubBoardSize)
+	for bigRow := range macro {
+		macro[bigRow] = make([]PlayerMark, SubBoardSize)
+		for bigCol := range macro[bigRow] {
+			macro[bigRow][bigCol] = smallBoardResult(s.Board, bigRow, bigCol)
+		}
+	}
+	return macro
+}
+
+func (u ultimateRuleset) ForcedBoard(s State) []int {
+	if s.LastMove == nil {
+		return nil
+	}
+	return forcedBoard(s, u.MacroBoard(s))
+}
+
+// forcedBoard returns the small board the last move sends the next player to, or
+// nil when that board is decided or there is no last move.
+func forcedBoard(s State, macro [][]PlayerMark) []int {
+	if s.LastMove == nil {
+		return nil
+	}
+	bigRow, bigCol := s.LastMove.Row%SubBoardSize, s.LastMove.Col%SubBoardSize
+	if macro[bigRow][bigCol] != None {
+		return nil
+	}
+	return []int{bigRow, bigCol}
+}
+
+// macroOutcome returns the result of the game given the results of the small boards.
+func macroOutcome(macro [][]PlayerMark) PlayerMark {
+	winner := CheckWinner(Board{Cells: withoutDraws(macro), WinLength: SubBoardSize})
+	if winner == PlayerX || winner == PlayerO {
+		return winner
+	}
+	if IsBoardFull(Board{Cells: macro}) {
+		return DRAW
+	}
+	return None
+}
+
+// smallBoardResult returns the result of the small board at the given big-board
+// position: the mark with three in a row, DRAW when it is full, or None.
+func smallBoardResult(board Board, bigRow, bigCol int) PlayerMark {
+	row0, col0 := bigRow*SubBoardSize, bigCol*SubBoardSize
+	cell := func(r, c int) PlayerMark { return board.Cells[row0+r][col0+c] }
+
+	lines := [8][3][2]int{
+		{{0, 0}, {0, 1}, {0, 2}}, {{1, 0}, {1, 1}, {1, 2}}, {{2, 0}, {2, 1}, {2, 2}},
+		{{0, 0}, {1, 0}, {2, 0}}, {{0, 1}, {1, 1}, {2, 1}}, {{0, 2}, {1, 2}, {2, 2}},
+		{{0, 0}, {1, 1}, {2, 2}}, {{0, 2}, {1, 1}, {2, 0}},
+	}
+	for _, line := range lines {
+		mark := cell(line[0][0], line[0][1])
+		if mark != None && mark == cell(line[1][0], line[1][1]) && mark == cell(line[2][0], line[2][1]) {
+			return mark
+		}
+	}
+
+	for r := 0; r < SubBoardSize; r++ {
+		for c := 0; c < SubBoardSize; c++ {
+			if cell(r, c) == None {
+				return None
+			}
+		}
+	}
+	return DRAW
+}
+
+// SubBoard copies out the small board at the given big-board position.
+func SubBoard(board Board, bigRow, bigCol int) Board {
+	small := NewBoard(SubBoardSize, SubBoardSize)
+	for r := 0; r < SubBoardSize; r++ {
+		for c := 0; c < SubBoardSize; c++ {
+			row, col := bigRow*SubBoardSize+r, bigCol*SubBoardSize+c
+			if board.InBounds(row, col) {
+				small.Cells[r][c] = board.Cells[row][col]
+			}
+		}
+	}
+	return small
+}
+
+// withoutDraws blanks out drawn small boards so they don't count towards a line.
+func withoutDraws(macro [][]PlayerMark) [][]PlayerMark {
+	cells := make([][]PlayerMark, len(macro))
+	for i, rowData := range macro {
+		cells[i] = make([]PlayerMark, len(rowData))
+		for j, mark := range rowData {
+			if mark != DRAW {
+				cells[i][j] = mark
+			}
+		}
+	}
+	return cells
+}
@@ -0,0 +1,117 @@
+package game
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// ultimateMove builds a move from a [bigRow, bigCol, row, col] position.
+func ultimateMove(t *testing.T, s State, player PlayerMark, position ...int) Move {
+	t.Helper()
+	move, err := Ultimate.ParseMove(s, player, position, None)
+	if err != nil {
+		t.Fatalf("ParseMove(%v) returned error: %v", position, err)
+	}
+	return move
+}
+
+func newUltimateState(first PlayerMark) State {
+	return State{Board: Ultimate.DefaultConfig().NewBoard(), Turn: first}
+}
+
+func TestUltimateParseMoveAndPosition(t *testing.T) {
+	s := newUltimateState(PlayerX)
+
+	move := ultimateMove(t, s, PlayerX, 1, 2, 0, 1)
+	if move.Row != 3 || move.Col != 7 || move.Piece != PlayerX {
+		t.Errorf("ParseMove() got %+v, want row 3, col 7", move)
+	}
+	if got := Ultimate.Position(move); !reflect.DeepEqual(got, []int{1, 2, 0, 1}) {
+		t.Errorf("Position() got %v, want [1 2 0 1]", got)
+	}
+
+	for _, position := range [][]int{{1, 1}, {0, 0, 0, 3}, {-1, 0, 0, 0}} {
+		if _, err := Ultimate.ParseMove(s, PlayerX, position, None); !errors.Is(err, ErrInvalidMove) {
+			t.Errorf("ParseMove(%v) error = %v, want ErrInvalidMove", position, err)
+		}
+	}
+}
+
+func TestUltimateForcedBoard(t *testing.T) {
+	s := newUltimateState(PlayerX)
+	if forced := Ultimate.ForcedBoard(s); forced != nil {
+		t.Fatalf("ForcedBoard() before the first move got %v, want nil", forced)
+	}
+	if got := len(Ultimate.LegalMoves(s)); got != 81 {
+		t.Fatalf("LegalMoves() before the first move got %d, want 81", got)
+	}
+
+	// X plays the top-right cell of the center board, sending O to the top-right board.
+	s = play(t, Ultimate, s, ultimateMove(t, s, PlayerX, 1, 1, 0, 2))
+	if forced := Ultimate.ForcedBoard(s); !reflect.DeepEqual(forced, []int{0, 2}) {
+		t.Fatalf("ForcedBoard() got %v, want [0 2]", forced)
+	}
+	for _, move := range Ultimate.LegalMoves(s) {
+		if move.Row/SubBoardSize != 0 || move.Col/SubBoardSize != 2 {
+			t.Fatalf("LegalMoves() includes %+v outside the forced board", move)
+		}
+	}
+
+	wrongBoard := ultimateMove(t, s, PlayerO, 0, 0, 0, 0)
+	if _, err := Ultimate.Apply(s, wrongBoard); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Apply() outside the forced board error = %v, want ErrInvalidMove", err)
+	}
+}
+
+func TestUltimateDecidedBoardGivesFreeChoice(t *testing.T) {
+	// X has two of the top-left board's diagonal and O's last move sent X there.
+	board := Ultimate.DefaultConfig().NewBoard()
+	board.Cells[0][0], board.Cells[1][1], board.Cells[3][3] = PlayerX, PlayerX, PlayerO
+	s := State{Board: board, Turn: PlayerX, LastMove: &Move{Player: PlayerO, Piece: PlayerO, Row: 3, Col: 3}}
+
+	s = play(t, Ultimate, s, ultimateMove(t, s, PlayerX, 0, 0, 2, 2))
+
+	if got := Ultimate.MacroBoard(s)[0][0]; got != PlayerX {
+		t.Fatalf("MacroBoard()[0][0] got %v, want X", got)
+	}
+	// X's move sent O to the bottom-right board, which is open.
+	if forced := Ultimate.ForcedBoard(s); !reflect.DeepEqual(forced, []int{2, 2}) {
+		t.Fatalf("ForcedBoard() got %v, want [2 2]", forced)
+	}
+
+	// O sends X to the decided top-left board, so X may play anywhere else.
+	s = play(t, Ultimate, s, ultimateMove(t, s, PlayerO, 2, 2, 0, 0))
+	if forced := Ultimate.ForcedBoard(s); forced != nil {
+		t.Fatalf("ForcedBoard() after being sent to a decided board got %v, want nil", forced)
+	}
+	for _, move := range Ultimate.LegalMoves(s) {
+		if move.Row < SubBoardSize && move.Col < SubBoardSize {
+			t.Fatalf("LegalMoves() includes %+v in a decided board", move)
+		}
+	}
+}
+
+func TestUltimateOutcome(t *testing.T) {
+	// X holds the top row of the big board except the top-right cell of the third board.
+	board := Ultimate.DefaultConfig().NewBoard()
+	for _, big := range [][2]int{{0, 0}, {0, 1}} {
+		for c := 0; c < SubBoardSize; c++ {
+			board.Cells[big[0]*SubBoardSize][big[1]*SubBoardSize+c] = PlayerX
+		}
+	}
+	board.Cells[0][6], board.Cells[0][7] = PlayerX, PlayerX
+	s := State{Board: board, Turn: PlayerX}
+
+	if got := Ultimate.Outcome(s); got != None {
+		t.Fatalf("Outcome() before any move got %v, want None", got)
+	}
+
+	s = play(t, Ultimate, s, ultimateMove(t, s, PlayerX, 0, 2, 0, 2))
+	if got := Ultimate.Outcome(s); got != PlayerX {
+		t.Errorf("Outcome() after completing the big row got %v, want X", got)
+	}
+	if moves := Ultimate.LegalMoves(s); len(moves) != 0 {
+		t.Errorf("LegalMoves() after the game ended got %d moves, want 0", len(moves))
+	}
+}
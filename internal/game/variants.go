@@ -0,0 +1,193 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+)
+
+func init() {
+	RegisterRuleset(Classic)
+	RegisterRuleset(Misere)
+	RegisterRuleset(Wild)
+	RegisterRuleset(Notakto)
+	RegisterRuleset(OrderAndChaos)
+}
+
+// Built-in rulesets. They all place one piece per turn on an empty cell and only
+// differ in which pieces a player may place and who a completed line counts for.
+var (
+	// Classic is standard tic-tac-toe: completing a line of your mark wins.
+	Classic Ruleset = &lineRuleset{
+		name:       "classic",
+		pieces:     ownPiece,
+		lineWinner: mover,
+		fullBoard:  DRAW,
+	}
+
+	// Misere inverts the goal: completing a line of your mark loses.
+	Misere Ruleset = &lineRuleset{
+		name:       "misere",
+		pieces:     ownPiece,
+		lineWinner: Opponent,
+		fullBoard:  DRAW,
+	}
+
+	// Wild lets either player place X or O; whoever completes a line of either mark wins.
+	Wild Ruleset = &lineRuleset{
+		name:       "wild",
+		pieces:     anyPiece,
+		lineWinner: mover,
+		fullBoard:  DRAW,
+	}
+
+	// Notakto has both players place X; whoever completes a line loses.
+	Notakto Ruleset = &lineRuleset{
+		name:       "notakto",
+		pieces:     func(PlayerMark) []PlayerMark { return []PlayerMark{PlayerX} },
+		lineWinner: Opponent,
+		fullBoard:  DRAW,
+	}
+
+	// OrderAndChaos is played on 6x6. X plays Order and wins with five in a row of
+	// either mark; O plays Chaos and wins if the board fills up first. Both players
+	// may place either mark.
+	OrderAndChaos Ruleset = &lineRuleset{
+		name:          "orderchaos",
+		defaultConfig: Config{Size: 6, WinLength: 5},
+		validate: func(cfg Config) error {
+			if cfg.Size != 6 || cfg.WinLength != 5 {
+				return errors.New("order and chaos is played on a 6x6 board with five in a row")
+			}
+			return nil
+		},
+		pieces:     anyPiece,
+		lineWinner: func(PlayerMark) PlayerMark { return PlayerX },
+		fullBoard:  PlayerO,
+	}
+)
+
+func ownPiece(player PlayerMark) []PlayerMark { return []PlayerMark{player} }
+
+func anyPiece(PlayerMark) []PlayerMark { return []PlayerMark{PlayerX, PlayerO} }
+
+func mover(player PlayerMark) PlayerMark { return player }
+
+// lineRuleset is a k-in-a-row game on a square board.
+type lineRuleset struct {
+	name          string
+	defaultConfig Config
+	validate      func(cfg Config) error
+	// pieces lists the marks a player may place.
+	pieces func(player PlayerMark) []PlayerMark
+	// lineWinner returns who wins when the given player completes a line.
+	lineWinner func(player PlayerMark) PlayerMark
+	// fullBoard is the result when the board fills up without a line.
+	fullBoard PlayerMark
+}
+
+func (r *lineRuleset) Name() string {
+	return r.name
+}
+
+func (r *lineRuleset) DefaultConfig() Config {
+	cfg := r.defaultConfig
+	if cfg.Size == 0 {
+		cfg = Config{Size: DefaultBoardSize, WinLength: DefaultWinLength(DefaultBoardSize)}
+	}
+	cfg.Variant = r.name
+	return cfg
+}
+
+func (r *lineRuleset) ValidateConfig(cfg Config) error {
+	if r.validate == nil {
+		return nil
+	}
+	return r.validate(cfg)
+}
+
+func (r *lineRuleset) ParseMove(s State, player PlayerMark, position []int, piece PlayerMark) (Move, error) {
+	if len(position) != 2 {
+		return Move{}, fmt.Errorf("%w: position must be [row, col]", ErrInvalidMove)
+	}
+
+	allowed := r.pieces(player)
+	if piece == None {
+		if len(allowed) != 1 {
+			return Move{}, fmt.Errorf("%w: choose a piece to place", ErrInvalidMove)
+		}
+		piece = allowed[0]
+	}
+
+	return Move{Player: player, Piece: piece, Row: position[0], Col: position[1]}, nil
+}
+
+func (r *lineRuleset) Position(move Move) []int {
+	return []int{move.Row, move.Col}
+}
+
+func (r *lineRuleset) LegalMoves(s State) []Move {
+	if r.Outcome(s) != None {
+		return nil
+	}
+
+	pieces := r.pieces(s.Turn)
+	moves := make([]Move, 0, len(pieces)*s.Board.Size()*s.Board.Size())
+	for row, rowData := range s.Board.Cells {
+		for col, cell := range rowData {
+			if cell != None {
+				continue
+			}
+			for _, piece := range pieces {
+				moves = append(moves, Move{Player: s.Turn, Piece: piece, Row: row, Col: col})
+			}
+		}
+	}
+	return moves
+}
+
+func (r *lineRuleset) Apply(s State, move Move) (State, error) {
+	if r.Outcome(s) != None {
+		return State{}, ErrGameOver
+	}
+	if move.Player != s.Turn {
+		return State{}, ErrNotYourTurn
+	}
+	if !s.Board.InBounds(move.Row, move.Col) || s.Board.Cells[move.Row][move.Col] != None {
+		return State{}, ErrInvalidMove
+	}
+	if !containsMark(r.pieces(move.Player), move.Piece) {
+		return State{}, fmt.Errorf("%w: piece %q not allowed", ErrInvalidMove, move.Piece)
+	}
+
+	next := State{Board: s.Board.Clone(), LastMove: &move}
+	next.Board.Cells[move.Row][move.Col] = move.Piece
+	next.Turn = r.NextPlayer(next, move.Player)
+	return next, nil
+}
+
+func (r *lineRuleset) Outcome(s State) PlayerMark {
+	last := s.LastMove
+	if last == nil {
+		return None
+	}
+	if s.Board.IsWinningMove(last.Row, last.Col, last.Piece) {
+		return r.lineWinner(last.Player)
+	}
+	if IsBoardFull(s.Board) {
+		return r.fullBoard
+	}
+	return None
+}
+
+func (r *lineRuleset) NextPlayer(s State, mover PlayerMark) PlayerMark {
+	return Opponent(mover)
+}
+
+func containsMark(marks []PlayerMark, mark PlayerMark) bool {
+	for _, m := range marks {
+		if m == mark {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+// play applies moves in order, failing the test on the first illegal one.
+func play(t *testing.T, r Ruleset, s State, moves ...Move) State {
+	t.Helper()
+	for _, m := range moves {
+		next, err := r.Apply(s, m)
+		if err != nil {
+			t.Fatalf("%s: Apply(%+v) returned error: %v", r.Name(), m, err)
+		}
+		s = next
+	}
+	return s
+}
+
+func TestLookupRuleset(t *testing.T) {
+	for _, name := range []string{"classic", "misere", "wild", "notakto", "orderchaos"} {
+		r, err := LookupRuleset(name)
+		if err != nil {
+			t.Fatalf("LookupRuleset(%q) returned error: %v", name, err)
+		}
+		if r.Name() != name {
+			t.Errorf("LookupRuleset(%q) returned ruleset %q", name, r.Name())
+		}
+	}
+
+	if r, err := LookupRuleset(""); err != nil || r != Classic {
+		t.Errorf("LookupRuleset(\"\") should return the classic ruleset, got %v, %v", r, err)
+	}
+	if _, err := LookupRuleset("chess"); !errors.Is(err, ErrUnknownRuleset) {
+		t.Errorf("LookupRuleset(\"chess\") error = %v, want ErrUnknownRuleset", err)
+	}
+}
+
+func TestRulesetOutcomes(t *testing.T) {
+	x := func(row, col int) Move { return Move{Player: PlayerX, Piece: PlayerX, Row: row, Col: col} }
+	o := func(row, col int) Move { return Move{Player: PlayerO, Piece: PlayerO, Row: row, Col: col} }
+
+	tests := []struct {
+		name    string
+		ruleset Ruleset
+		config  Config
+		first   PlayerMark
+		moves   []Move
+		want    PlayerMark
+	}{
+		{
+			name:    "Classic - completing a row wins",
+			ruleset: Classic,
+			first:   PlayerX,
+			moves:   []Move{x(0, 0), o(1, 0), x(0, 1), o(1, 1), x(0, 2)},
+			want:    PlayerX,
+		},
+		{
+			name:    "Classic - game in progress",
+			ruleset: Classic,
+			first:   PlayerX,
+			moves:   []Move{x(0, 0), o(1, 1)},
+			want:    None,
+		},
+		{
+			name:    "Classic - full board is a draw",
+			ruleset: Classic,
+			first:   PlayerX,
+			moves:   []Move{x(0, 0), o(0, 1), x(0, 2), o(1, 1), x(1, 0), o(1, 2), x(2, 1), o(2, 0), x(2, 2)},
+			want:    DRAW,
+		},
+		{
+			name:    "Misere - completing a row loses",
+			ruleset: Misere,
+			first:   PlayerX,
+			moves:   []Move{x(0, 0), o(1, 0), x(0, 1), o(1, 1), x(0, 2)},
+			want:    PlayerO,
+		},
+		{
+			name:    "Wild - O completes a line of X and wins",
+			ruleset: Wild,
+			first:   PlayerX,
+			moves: []Move{
+				{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 0},
+				{Player: PlayerO, Piece: PlayerO, Row: 2, Col: 2},
+				{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 1},
+				{Player: PlayerO, Piece: PlayerX, Row: 0, Col: 2},
+			},
+			want: PlayerO,
+		},
+		{
+			name:    "Notakto - completing a line of X loses",
+			ruleset: Notakto,
+			first:   PlayerO,
+			moves: []Move{
+				{Player: PlayerO, Piece: PlayerX, Row: 0, Col: 0},
+				{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 1},
+				{Player: PlayerO, Piece: PlayerX, Row: 2, Col: 2},
+				{Player: PlayerX, Piece: PlayerX, Row: 2, Col: 1},
+				{Player: PlayerO, Piece: PlayerX, Row: 1, Col: 1},
+			},
+			want: PlayerX,
+		},
+		{
+			name:    "Order and chaos - five of O wins for Order even when Chaos completes it",
+			ruleset: OrderAndChaos,
+			config:  OrderAndChaos.DefaultConfig(),
+			first:   PlayerX,
+			moves: []Move{
+				{Player: PlayerX, Piece: PlayerO, Row: 0, Col: 0},
+				{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 1},
+				{Player: PlayerX, Piece: PlayerO, Row: 0, Col: 2},
+				{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 3},
+				{Player: PlayerX, Piece: PlayerX, Row: 5, Col: 5},
+				{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 4},
+			},
+			want: PlayerX,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.config
+			if cfg.Size == 0 {
+				cfg = DefaultConfig
+			}
+			s := play(t, tt.ruleset, State{Board: cfg.NewBoard(), Turn: tt.first}, tt.moves...)
+			if got := tt.ruleset.Outcome(s); got != tt.want {
+				t.Errorf("Outcome() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderAndChaosFullBoardWinsForChaos(t *testing.T) {
+	// Fill a 6x6 board in a pattern with no five in a row of either mark.
+	pattern := [6]string{"XXOOXX", "OOXXOO", "XXOOXX", "OOXXOO", "XXOOXX", "OOXXOO"}
+	s := State{Board: OrderAndChaos.DefaultConfig().NewBoard(), Turn: PlayerX}
+	for r, line := range pattern {
+		for c, ch := range line {
+			piece := PlayerMark(string(ch))
+			s = play(t, OrderAndChaos, s, Move{Player: s.Turn, Piece: piece, Row: r, Col: c})
+		}
+	}
+	if got := OrderAndChaos.Outcome(s); got != PlayerO {
+		t.Errorf("Outcome() on a full board got = %v, want %v", got, PlayerO)
+	}
+}
+
+func TestRulesetApplyRejectsIllegalMoves(t *testing.T) {
+	s := State{Board: DefaultConfig.NewBoard(), Turn: PlayerX}
+	s = play(t, Classic, s, Move{Player: PlayerX, Piece: PlayerX, Row: 1, Col: 1})
+
+	tests := []struct {
+		name    string
+		ruleset Ruleset
+		move    Move
+		wantErr error
+	}{
+		{name: "Wrong player", ruleset: Classic, move: Move{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 0}, wantErr: ErrNotYourTurn},
+		{name: "Occupied cell", ruleset: Classic, move: Move{Player: PlayerO, Piece: PlayerO, Row: 1, Col: 1}, wantErr: ErrInvalidMove},
+		{name: "Off the board", ruleset: Classic, move: Move{Player: PlayerO, Piece: PlayerO, Row: 3, Col: 0}, wantErr: ErrInvalidMove},
+		{name: "Opponent's piece in classic", ruleset: Classic, move: Move{Player: PlayerO, Piece: PlayerX, Row: 0, Col: 0}, wantErr: ErrInvalidMove},
+		{name: "O in notakto", ruleset: Notakto, move: Move{Player: PlayerO, Piece: PlayerO, Row: 0, Col: 0}, wantErr: ErrInvalidMove},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.ruleset.Apply(s, tt.move); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	won := play(t, Classic, State{Board: DefaultConfig.NewBoard(), Turn: PlayerX},
+		Move{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 0}, Move{Player: PlayerO, Piece: PlayerO, Row: 1, Col: 0},
+		Move{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 1}, Move{Player: PlayerO, Piece: PlayerO, Row: 1, Col: 1},
+		Move{Player: PlayerX, Piece: PlayerX, Row: 0, Col: 2})
+	if _, err := Classic.Apply(won, Move{Player: PlayerO, Piece: PlayerO, Row: 2, Col: 2}); !errors.Is(err, ErrGameOver) {
+		t.Errorf("Apply() after the game ended error = %v, want ErrGameOver", err)
+	}
+	if moves := Classic.LegalMoves(won); len(moves) != 0 {
+		t.Errorf("LegalMoves() after the game ended got %d moves, want 0", len(moves))
+	}
+}
+
+func TestRulesetParseMoveAndLegalMoves(t *testing.T) {
+	s := State{Board: DefaultConfig.NewBoard(), Turn: PlayerO}
+
+	move, err := Classic.ParseMove(s, PlayerO, []int{2, 1}, None)
+	if err != nil || move != (Move{Player: PlayerO, Piece: PlayerO, Row: 2, Col: 1}) {
+		t.Errorf("Classic.ParseMove() got %+v, %v", move, err)
+	}
+	if move, err := Notakto.ParseMove(s, PlayerO, []int{0, 0}, None); err != nil || move.Piece != PlayerX {
+		t.Errorf("Notakto.ParseMove() should default to X, got %+v, %v", move, err)
+	}
+	if _, err := Wild.ParseMove(s, PlayerO, []int{0, 0}, None); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Wild.ParseMove() without a piece error = %v, want ErrInvalidMove", err)
+	}
+	if _, err := Classic.ParseMove(s, PlayerO, []int{0}, None); !errors.Is(err, ErrInvalidMove) {
+		t.Errorf("Classic.ParseMove() with a short position error = %v, want ErrInvalidMove", err)
+	}
+
+	if got := len(Classic.LegalMoves(s)); got != 9 {
+		t.Errorf("Classic.LegalMoves() on an empty board got %d moves, want 9", got)
+	}
+	if got := len(Wild.LegalMoves(s)); got != 18 {
+		t.Errorf("Wild.LegalMoves() on an empty board got %d moves, want 18", got)
+	}
+}
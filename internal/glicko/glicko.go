@@ -0,0 +1,118 @@
+// Package glicko implements the Glicko-2 rating system described by Mark
+// Glickman in "Example of the Glicko-2 system" (2012).
+package glicko
+
+import "math"
+
+const (
+	// DefaultRating, DefaultRD and DefaultVolatility describe an unrated player.
+	DefaultRating     = 1500.0
+	DefaultRD         = 350.0
+	DefaultVolatility = 0.06
+
+	// ProvisionalRD is the rating deviation above which a rating is still provisional.
+	ProvisionalRD = 110.0
+
+	// tau constrains how much the volatility may change in one rating period.
+	tau = 0.5
+	// scale converts between the Glicko and Glicko-2 scales.
+	scale = 173.7178
+	// epsilon is the convergence tolerance of the volatility iteration.
+	epsilon = 0.000001
+)
+
+// Rating is a player's Glicko-2 rating on the familiar Glicko scale.
+type Rating struct {
+	Rating     float64
+	RD         float64
+	Volatility float64
+}
+
+// Default returns the rating of a player who hasn't played yet.
+func Default() Rating {
+	return Rating{Rating: DefaultRating, RD: DefaultRD, Volatility: DefaultVolatility}
+}
+
+// Provisional reports whether the rating is still too uncertain to be trusted.
+func (r Rating) Provisional() bool {
+	return r.RD > ProvisionalRD
+}
+
+// Result is the outcome of one game against an opponent: Score is 1 for a win,
+// 0.5 for a draw and 0 for a loss.
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+// Update returns the rating after a rating period with the given results. With
+// no results only the rating deviation grows.
+func Update(r Rating, results []Result) Rating {
+	mu := (r.Rating - DefaultRating) / scale
+	phi := r.RD / scale
+
+	if len(results) == 0 {
+		return Rating{Rating: r.Rating, RD: math.Sqrt(phi*phi+r.Volatility*r.Volatility) * scale, Volatility: r.Volatility}
+	}
+
+	var vInv, deltaSum float64
+	for _, result := range results {
+		muJ := (result.Opponent.Rating - DefaultRating) / scale
+		gJ := g(result.Opponent.RD / scale)
+		e := expected(mu, muJ, gJ)
+		vInv += gJ * gJ * e * (1 - e)
+		deltaSum += gJ * (result.Score - e)
+	}
+	v := 1 / vInv
+	delta := v * deltaSum
+
+	sigma := newVolatility(phi, v, delta, r.Volatility)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*deltaSum
+
+	return Rating{Rating: newMu*scale + DefaultRating, RD: newPhi * scale, Volatility: sigma}
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muJ, gJ float64) float64 {
+	return 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+}
+
+// newVolatility finds the new volatility with the Illinois variant of regula falsi.
+func newVolatility(phi, v, delta, sigma float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
@@ -0,0 +1,55 @@
+package glicko
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUpdateMatchesGlickmanExample(t *testing.T) {
+	player := Rating{Rating: 1500, RD: 200, Volatility: 0.06}
+	results := []Result{
+		{Opponent: Rating{Rating: 1400, RD: 30}, Score: 1},
+		{Opponent: Rating{Rating: 1550, RD: 100}, Score: 0},
+		{Opponent: Rating{Rating: 1700, RD: 300}, Score: 0},
+	}
+
+	got := Update(player, results)
+	if math.Abs(got.Rating-1464.06) > 0.01 {
+		t.Errorf("Rating got %.2f, want 1464.06", got.Rating)
+	}
+	if math.Abs(got.RD-151.52) > 0.01 {
+		t.Errorf("RD got %.2f, want 151.52", got.RD)
+	}
+	if math.Abs(got.Volatility-0.05999) > 0.00001 {
+		t.Errorf("Volatility got %.5f, want 0.05999", got.Volatility)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	opponent := Default()
+
+	win := Update(Default(), []Result{{Opponent: opponent, Score: 1}})
+	loss := Update(Default(), []Result{{Opponent: opponent, Score: 0}})
+	draw := Update(Default(), []Result{{Opponent: opponent, Score: 0.5}})
+
+	if win.Rating <= DefaultRating || loss.Rating >= DefaultRating {
+		t.Errorf("win/loss ratings got %.2f/%.2f, want above/below %v", win.Rating, loss.Rating, DefaultRating)
+	}
+	if math.Abs(win.Rating-DefaultRating-(DefaultRating-loss.Rating)) > 1e-6 {
+		t.Errorf("win and loss against an equal opponent should move the rating by the same amount")
+	}
+	if math.Abs(draw.Rating-DefaultRating) > 1e-6 {
+		t.Errorf("draw against an equal opponent got %.2f, want %v", draw.Rating, DefaultRating)
+	}
+	if win.RD >= DefaultRD {
+		t.Errorf("RD got %.2f, want it to shrink after a game", win.RD)
+	}
+	if !Default().Provisional() || (Rating{RD: 50}).Provisional() {
+		t.Error("Provisional() should depend on the rating deviation")
+	}
+
+	idle := Update(Rating{Rating: 1600, RD: 100, Volatility: 0.06}, nil)
+	if idle.Rating != 1600 || idle.RD <= 100 {
+		t.Errorf("an idle period got %+v, want the same rating with a larger RD", idle)
+	}
+}
@@ -4,16 +4,17 @@ import (
 	"context"
 	"ctchen222/Tic-Tac-Toe/internal/events"
 	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
 	"ctchen222/Tic-Tac-Toe/internal/room"
 	"ctchen222/Tic-Tac-Toe/pkg/proto"
 	"encoding/json"
-	"fmt"
 	"log/slog"
 	"time" // Added for time.Sleep
 
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -23,10 +24,14 @@ func (h *Hub) runRoomUpdateSubscriber(ctx context.Context, room *room.Room) {
 	))
 	defer span.End()
 
-	roomChannel := fmt.Sprintf("channel:room:%s", room.ID)
+	roomChannel := events.RoomChannel(room.ID)
 	slog.InfoContext(ctx, "Starting room subscriber", "room.id", room.ID, "channel", roomChannel)
 	pubsub := h.rdb.Subscribe(ctx, roomChannel)
 	defer pubsub.Close()
+	go func() {
+		<-room.Done
+		pubsub.Close()
+	}()
 
 	ch := pubsub.Channel()
 	for msg := range ch {
@@ -34,25 +39,56 @@ func (h *Hub) runRoomUpdateSubscriber(ctx context.Context, room *room.Room) {
 			attribute.String("room.id", room.ID),
 			attribute.String("redis.payload", msg.Payload),
 		))
-		defer updateSpan.End()
+		h.handleRoomEvent(updateCtx, updateSpan, room, msg.Payload)
+		updateSpan.End()
+	}
+	slog.InfoContext(ctx, "Stopping room subscriber", "room.id", room.ID)
+}
 
-		slog.InfoContext(updateCtx, "Received room update", "room.id", room.ID, "payload", msg.Payload)
-		gameState, err := h.gameRepo.FindByID(updateCtx, room.ID)
+// handleRoomEvent delivers an event published on a room's channel to the
+// room's players and spectators on this server.
+func (h *Hub) handleRoomEvent(ctx context.Context, span trace.Span, r *room.Room, payload string) {
+	slog.InfoContext(ctx, "Received room update", "room.id", r.ID, "payload", payload)
+
+	// Servers running older versions publish the bare string "update".
+	event := events.RoomEvent{Type: events.RoomEventUpdate}
+	if payload != events.RoomEventUpdate {
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			slog.ErrorContext(ctx, "Could not unmarshal room event", "room.id", r.ID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Could not unmarshal room event")
+			return
+		}
+	}
+
+	switch event.Type {
+	case events.RoomEventUpdate:
+		gameState, err := h.gameRepo.FindByID(ctx, r.ID)
 		if err != nil {
-			slog.ErrorContext(updateCtx, "Room subscriber could not get game state", "room.id", room.ID, "error", err)
-			updateSpan.RecordError(err)
-			updateSpan.SetStatus(codes.Error, "Could not get game state")
-			continue
+			slog.ErrorContext(ctx, "Room subscriber could not get game state", "room.id", r.ID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Could not get game state")
+			return
+		}
+		r.Broadcast(proto.NewUpdateMessage(gameState))
+	case events.RoomEventChat:
+		if event.Chat != nil {
+			r.DeliverChat(ctx, event.Chat)
 		}
-		updateMsg := &proto.ServerToClientMessage{
-			Type:   "update",
-			Board:  game.BoardArrayToSlice(gameState.Board),
-			Next:   gameState.CurrentTurn,
-			Winner: gameState.Winner,
+	case events.RoomEventNotice:
+		if event.Notice != nil {
+			r.Broadcast(event.Notice)
+		}
+	case events.RoomEventGameOver:
+		if event.Notice != nil {
+			r.Broadcast(event.Notice)
+		}
+		// Nobody is left to play a rematch against.
+		select {
+		case h.closeRooms <- room.CloseRequest{RoomID: r.ID, Reason: "game over"}:
+		case <-r.Done:
 		}
-		room.Broadcast(updateMsg)
 	}
-	slog.InfoContext(ctx, "Stopping room subscriber", "room.id", room.ID)
 }
 
 func (h *Hub) runMatcher(ctx context.Context) {
@@ -61,7 +97,13 @@ func (h *Hub) runMatcher(ctx context.Context) {
 		//TODO: refactor span error handling
 		matchCtx, matchSpan := tracer.Start(ctx, "hub.runMatcher.matchAttempt")
 
-		player1ID, player2ID, err := h.matchmakingRepo.GetPlayersFromQueue(matchCtx)
+		match, err := h.matchmakingRepo.GetPlayersFromQueue(matchCtx)
+		if err != nil && ctx.Err() != nil {
+			// The server is draining.
+			matchSpan.End()
+			slog.InfoContext(ctx, "Redis-based matcher stopped")
+			return
+		}
 		if err != nil {
 			slog.ErrorContext(matchCtx, "Error getting players from queue", "error", err)
 			matchSpan.RecordError(err)
@@ -70,22 +112,31 @@ func (h *Hub) runMatcher(ctx context.Context) {
 			time.Sleep(1 * time.Second)
 			continue
 		}
-		matchSpan.SetAttributes(attribute.String("player1.id", player1ID), attribute.String("player2.id", player2ID))
+		player1ID, player2ID, pool := match.Player1ID, match.Player2ID, match.Pool
+		matchSpan.SetAttributes(attribute.String("player1.id", player1ID), attribute.String("player2.id", player2ID), attribute.String("matchmaking.pool", pool))
+		matchmakingWaitHistogram.Record(matchCtx, match.Waited.Seconds(), metric.WithAttributes(attribute.String("pool", pool)))
+
+		cfg, err := game.ParseConfigKey(pool)
+		if err != nil {
+			slog.ErrorContext(matchCtx, "Matched players from an invalid pool, falling back to default board", "pool", pool, "error", err)
+			matchSpan.RecordError(err)
+			cfg = game.DefaultConfig
+		}
 
 		roomID := uuid.New().String()
 		matchSpan.SetAttributes(attribute.String("room.id", roomID))
 
-		if err := h.gameRepo.Create(matchCtx, roomID, player1ID, player2ID); err != nil {
+		if err := h.gameRepo.Create(matchCtx, roomID, player1ID, player2ID, cfg, repository.RoomSettings{}); err != nil {
 			slog.ErrorContext(matchCtx, "Failed to create new game in Redis", "room.id", roomID, "error", err)
 			slog.InfoContext(matchCtx, "Re-queuing players")
 			matchSpan.RecordError(err)
 			matchSpan.SetStatus(codes.Error, "Failed to create game in Redis")
-			if err := h.matchmakingRepo.AddToQueue(matchCtx, player1ID); err != nil {
+			if err := h.addToQueue(matchCtx, player1ID, pool); err != nil {
 				slog.ErrorContext(matchCtx, "FATAL: Failed to re-queue player", "player.id", player1ID, "error", err)
 				matchSpan.RecordError(err)
 				matchSpan.SetStatus(codes.Error, "FATAL: Failed to re-queue player1")
 			}
-			if err := h.matchmakingRepo.AddToQueue(matchCtx, player2ID); err != nil {
+			if err := h.addToQueue(matchCtx, player2ID, pool); err != nil {
 				slog.ErrorContext(matchCtx, "FATAL: Failed to re-queue player", "player.id", player2ID, "error", err)
 				matchSpan.RecordError(err)
 				matchSpan.SetStatus(codes.Error, "FATAL: Failed to re-queue player2")
@@ -105,24 +156,7 @@ func (h *Hub) runMatcher(ctx context.Context) {
 			matchSpan.SetStatus(codes.Error, "Failed to update player2 for match")
 		}
 
-		payload, err := json.Marshal(events.MatchMadePayload{RoomID: roomID, PlayerIDs: []string{player1ID, player2ID}})
-		if err != nil {
-			slog.ErrorContext(matchCtx, "Failed to marshal match_made payload", "error", err)
-			matchSpan.RecordError(err)
-			matchSpan.SetStatus(codes.Error, "Failed to marshal match_made payload")
-			matchSpan.End()
-			continue
-		}
-		event, err := json.Marshal(events.Event{Type: "match_made", Payload: payload})
-		if err != nil {
-			slog.ErrorContext(matchCtx, "Failed to marshal event", "error", err)
-			matchSpan.RecordError(err)
-			matchSpan.SetStatus(codes.Error, "Failed to marshal event")
-			matchSpan.End()
-			continue
-		}
-
-		if err := h.rdb.Publish(matchCtx, events.EventsChannel, event).Err(); err != nil {
+		if err := h.publishMatchMade(matchCtx, roomID, player1ID, player2ID); err != nil {
 			slog.ErrorContext(matchCtx, "Failed to publish match_made event", "error", err)
 			matchSpan.RecordError(err)
 			matchSpan.SetStatus(codes.Error, "Failed to publish match_made event")
@@ -134,3 +168,22 @@ func (h *Hub) runMatcher(ctx context.Context) {
 		matchSpan.End()
 	}
 }
+
+// publishMatchMade tells every server that a game has been created, so the
+// servers of its players set up their rooms.
+func (h *Hub) publishMatchMade(ctx context.Context, roomID string, playerIDs ...string) error {
+	return h.publishEvent(ctx, "match_made", events.MatchMadePayload{RoomID: roomID, PlayerIDs: playerIDs})
+}
+
+// publishEvent publishes an event to every server.
+func (h *Hub) publishEvent(ctx context.Context, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	event, err := json.Marshal(events.Event{Type: eventType, Payload: data})
+	if err != nil {
+		return err
+	}
+	return h.rdb.Publish(ctx, events.EventsChannel, event).Err()
+}
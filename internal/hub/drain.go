@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// drainPollInterval is how often a draining server checks whether its
+	// games are over.
+	drainPollInterval = time.Second
+	// maxReconnectJitter spreads out the reconnections of a draining server's
+	// clients, so they don't all reach the other servers at once.
+	maxReconnectJitter = 2 * time.Second
+	// drainReason is the close reason of a draining server's connections.
+	drainReason = "server draining"
+)
+
+// drainStep is a step of draining the server, taken by the Run loop.
+type drainStep int
+
+const (
+	// drainAnnounce tells the clients that the server is draining and lets
+	// the players who aren't in a game go.
+	drainAnnounce drainStep = iota
+	// drainCount counts the games still in progress.
+	drainCount
+	// drainHandOff closes the remaining rooms, leaving their games in Redis
+	// for the players to resume on another server.
+	drainHandOff
+)
+
+type drainRequest struct {
+	step drainStep
+	// reply receives the number of rooms with a game in progress, or the
+	// number of rooms handed off.
+	reply chan int
+}
+
+// Draining reports whether the server is draining and turns new connections away.
+func (h *Hub) Draining() bool {
+	return h.draining.Load()
+}
+
+// Drain prepares the server to shut down. It stops taking registrations and
+// matching players, tells the clients to reconnect elsewhere, and lets the
+// players who aren't in a game go at once. Once the games in progress are over,
+// or ctx is done, the remaining rooms are handed off: their players are
+// disconnected and the server leaves the registry, so the janitor adopts the
+// rooms and the players resume on another server.
+func (h *Hub) Drain(ctx context.Context) {
+	slog.InfoContext(ctx, "Draining server", "server.id", h.serverID)
+	h.draining.Store(true)
+	h.stopMatcher()
+
+	inProgress := h.drainStep(drainAnnounce)
+	slog.InfoContext(ctx, "Waiting for games in progress", "rooms.count", inProgress)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+wait:
+	for inProgress > 0 {
+		select {
+		case <-ctx.Done():
+			slog.WarnContext(ctx, "Drain deadline reached with games in progress", "rooms.count", inProgress)
+			break wait
+		case <-ticker.C:
+			inProgress = h.drainStep(drainCount)
+		}
+	}
+
+	// The registry must stop renewing this server before it leaves.
+	h.stopRegistry()
+	<-h.registryDone
+	handedOff := h.drainStep(drainHandOff)
+	if err := h.servers.Deregister(context.Background(), h.serverID); err != nil {
+		slog.ErrorContext(ctx, "Failed to leave server registry", "server.id", h.serverID, "error", err)
+	}
+	slog.InfoContext(ctx, "Server drained", "server.id", h.serverID, "rooms.handed_off", handedOff)
+}
+
+// drainStep has the Run loop take a step of draining the server.
+func (h *Hub) drainStep(step drainStep) int {
+	reply := make(chan int)
+	h.drain <- drainRequest{step: step, reply: reply}
+	return <-reply
+}
+
+// handleDrain takes a step of draining the server.
+func (h *Hub) handleDrain(ctx context.Context, step drainStep) int {
+	ctx, span := tracer.Start(ctx, "hub.handleDrain", trace.WithAttributes(
+		attribute.Int("drain.step", int(step)),
+	))
+	defer span.End()
+
+	switch step {
+	case drainAnnounce:
+		h.announceDrain(ctx)
+	case drainHandOff:
+		return h.handOffRooms(ctx)
+	}
+
+	inProgress := 0
+	for _, r := range h.localRooms {
+		if gameInProgress(r) {
+			inProgress++
+		}
+	}
+	return inProgress
+}
+
+// gameInProgress reports whether a room's game is under way with a player
+// connected to this server.
+func gameInProgress(r *room.Room) bool {
+	if state := r.State(); state != room.StateWaiting && state != room.StatePlaying {
+		return false
+	}
+	for _, p := range r.Players() {
+		if !p.IsBot && p.Status() == player.StatusConnected {
+			return true
+		}
+	}
+	return false
+}
+
+// announceDrain tells every client that the server is draining. Players who
+// aren't in a room leave the matchmaking queue and are disconnected, so they
+// reconnect to another server right away.
+func (h *Hub) announceDrain(ctx context.Context) {
+	inRoom := make(map[*player.Player]bool)
+	for _, r := range h.localRooms {
+		for _, p := range r.Players() {
+			inRoom[p] = true
+		}
+		r.Broadcast(drainingMessage())
+	}
+
+	for _, p := range h.localPlayers {
+		if inRoom[p] {
+			continue
+		}
+		h.sendDraining(ctx, p)
+		closeConnection(p, websocket.CloseServiceRestart, drainReason)
+		h.unregisterPlayer(ctx, p)
+	}
+}
+
+// handOffRooms closes the local rooms without ending their games. Their players
+// are marked disconnected, so they resume their games wherever they reconnect.
+func (h *Hub) handOffRooms(ctx context.Context) int {
+	handedOff := len(h.localRooms)
+	for _, r := range h.localRooms {
+		slog.InfoContext(ctx, "Handing off room", "room.id", r.ID, "state", r.State())
+		r.Close()
+		delete(h.localRooms, r.ID)
+		activeRoomsCounter.Add(ctx, -1)
+
+		for _, p := range r.Players() {
+			if p.IsBot || h.localPlayers[p.ID] != p {
+				continue
+			}
+			if err := h.playerRepo.UpdateConnectionStatus(ctx, p.ID, player.StatusDisconnected); err != nil {
+				slog.ErrorContext(ctx, "Failed to set player status to disconnected", "player.id", p.ID, "error", err)
+			}
+			closeConnection(p, websocket.CloseServiceRestart, drainReason)
+			delete(h.localPlayers, p.ID)
+		}
+	}
+	return handedOff
+}
+
+// rejectDraining turns away a registration that arrived while draining.
+func (h *Hub) rejectDraining(ctx context.Context, p *player.Player) {
+	slog.InfoContext(ctx, "Rejected registration while draining", "player.id", p.ID)
+	h.sendDraining(ctx, p)
+	closeConnection(p, websocket.CloseServiceRestart, drainReason)
+}
+
+func (h *Hub) sendDraining(ctx context.Context, p *player.Player) {
+	data, _ := json.Marshal(drainingMessage())
+	if err := p.Send(data); err != nil {
+		slog.ErrorContext(ctx, "Error sending server_draining to player", "player.id", p.ID, "error", err)
+	}
+}
+
+// drainingMessage tells a client that the server is draining, with a jittered
+// reconnection delay.
+func drainingMessage() *proto.ServerToClientMessage {
+	return &proto.ServerToClientMessage{
+		Type:           "server_draining",
+		Reason:         drainReason,
+		ReconnectAfter: rand.Int64N(maxReconnectJitter.Milliseconds()),
+	}
+}
@@ -2,7 +2,6 @@ package hub
 
 import (
 	"context"
-	"ctchen222/Tic-Tac-Toe/internal/bot"
 	"ctchen222/Tic-Tac-Toe/internal/events"
 	"ctchen222/Tic-Tac-Toe/internal/player"
 	"ctchen222/Tic-Tac-Toe/internal/room"
@@ -15,90 +14,95 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// runEventSubscriber passes the events published to every server on to the
+// hub's Run loop, which owns the state they act on.
 func (h *Hub) runEventSubscriber(ctx context.Context) {
 	slog.InfoContext(ctx, "Event subscriber started", "channel", events.EventsChannel)
 	pubsub := h.rdb.Subscribe(ctx, events.EventsChannel)
 	defer pubsub.Close()
 
-	ch := pubsub.Channel()
-
-	for msg := range ch {
-		eventCtx, eventSpan := tracer.Start(ctx, "hub.handleEvent", trace.WithAttributes(
-			attribute.String("event.channel", events.EventsChannel),
-			attribute.String("event.payload", msg.Payload),
-		))
-		defer eventSpan.End()
-
-		var event events.Event
-		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
-			var oldFormat map[string]string
-			if errOld := json.Unmarshal([]byte(msg.Payload), &oldFormat); errOld == nil {
-				if oldFormat["event"] == "player_disconnected" {
-					h.handlePlayerDisconnected(eventCtx, &events.PlayerDisconnectedPayload{
-						RoomID:   oldFormat["room_id"],
-						PlayerID: oldFormat["player_id"],
-					})
-				}
-			} else {
-				slog.ErrorContext(eventCtx, "Could not unmarshal global event", "error", err)
-				eventSpan.RecordError(err)
-				eventSpan.SetStatus(codes.Error, "Could not unmarshal global event")
+	for msg := range pubsub.Channel() {
+		h.events <- msg.Payload
+	}
+}
+
+// handleEvent handles an event published to every server.
+func (h *Hub) handleEvent(ctx context.Context, payload string) {
+	eventCtx, eventSpan := tracer.Start(ctx, "hub.handleEvent", trace.WithAttributes(
+		attribute.String("event.channel", events.EventsChannel),
+		attribute.String("event.payload", payload),
+	))
+	defer eventSpan.End()
+
+	var event events.Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		var oldFormat map[string]string
+		if errOld := json.Unmarshal([]byte(payload), &oldFormat); errOld == nil {
+			if oldFormat["event"] == "player_disconnected" {
+				h.handlePlayerDisconnected(eventCtx, &events.PlayerDisconnectedPayload{
+					RoomID:   oldFormat["room_id"],
+					PlayerID: oldFormat["player_id"],
+				})
 			}
-			continue
+		} else {
+			slog.ErrorContext(eventCtx, "Could not unmarshal global event", "error", err)
+			eventSpan.RecordError(err)
+			eventSpan.SetStatus(codes.Error, "Could not unmarshal global event")
 		}
-		eventSpan.SetAttributes(attribute.String("event.type", event.Type))
-
-		switch event.Type {
-		case "match_made":
-			var payload events.MatchMadePayload
-			if err := json.Unmarshal(event.Payload, &payload); err != nil {
-				slog.ErrorContext(eventCtx, "Could not unmarshal match_made payload", "error", err)
-				eventSpan.RecordError(err)
-				eventSpan.SetStatus(codes.Error, "Could not unmarshal match_made payload")
-				continue
-			}
-			h.handleMatchMade(eventCtx, &payload)
-
-		case "player_disconnected":
-			var payload events.PlayerDisconnectedPayload
-			if err := json.Unmarshal(event.Payload, &payload); err != nil {
-				slog.ErrorContext(eventCtx, "Could not unmarshal player_disconnected payload", "error", err)
-				eventSpan.RecordError(err)
-				eventSpan.SetStatus(codes.Error, "Could not unmarshal player_disconnected payload")
-				continue
-			}
-			h.handlePlayerDisconnected(eventCtx, &payload)
-
-		case "player_reconnected":
-			var payload events.PlayerReconnectedPayload
-			if err := json.Unmarshal(event.Payload, &payload); err != nil {
-				slog.ErrorContext(eventCtx, "Could not unmarshal player_reconnected payload", "error", err)
-				eventSpan.RecordError(err)
-				eventSpan.SetStatus(codes.Error, "Could not unmarshal player_reconnected payload")
-				continue
-			}
-			h.handlePlayerReconnected(eventCtx, &payload)
-
-		case "rematch_requested":
-			var payload events.RematchRequestedPayload
-			if err := json.Unmarshal(event.Payload, &payload); err != nil {
-				slog.ErrorContext(eventCtx, "Could not unmarshal rematch_requested payload", "error", err)
-				eventSpan.RecordError(err)
-				eventSpan.SetStatus(codes.Error, "Could not unmarshal rematch_requested payload")
-				continue
-			}
-			h.handleRematchRequested(eventCtx, &payload)
-
-		case "rematch_successful":
-			var payload events.RematchSuccessfulPayload
-			if err := json.Unmarshal(event.Payload, &payload); err != nil {
-				slog.ErrorContext(eventCtx, "Could not unmarshal rematch_successful payload", "error", err)
-				eventSpan.RecordError(err)
-				eventSpan.SetStatus(codes.Error, "Could not unmarshal rematch_successful payload")
-				continue
-			}
-			h.handleRematchSuccessful(eventCtx, &payload)
+		return
+	}
+	eventSpan.SetAttributes(attribute.String("event.type", event.Type))
+
+	switch event.Type {
+	case "match_made":
+		var payload events.MatchMadePayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			slog.ErrorContext(eventCtx, "Could not unmarshal match_made payload", "error", err)
+			eventSpan.RecordError(err)
+			eventSpan.SetStatus(codes.Error, "Could not unmarshal match_made payload")
+			return
+		}
+		h.handleMatchMade(eventCtx, &payload)
+
+	case "player_disconnected":
+		var payload events.PlayerDisconnectedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			slog.ErrorContext(eventCtx, "Could not unmarshal player_disconnected payload", "error", err)
+			eventSpan.RecordError(err)
+			eventSpan.SetStatus(codes.Error, "Could not unmarshal player_disconnected payload")
+			return
+		}
+		h.handlePlayerDisconnected(eventCtx, &payload)
+
+	case "player_reconnected":
+		var payload events.PlayerReconnectedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			slog.ErrorContext(eventCtx, "Could not unmarshal player_reconnected payload", "error", err)
+			eventSpan.RecordError(err)
+			eventSpan.SetStatus(codes.Error, "Could not unmarshal player_reconnected payload")
+			return
+		}
+		h.handlePlayerReconnected(eventCtx, &payload)
+
+	case "rematch_requested":
+		var payload events.RematchRequestedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			slog.ErrorContext(eventCtx, "Could not unmarshal rematch_requested payload", "error", err)
+			eventSpan.RecordError(err)
+			eventSpan.SetStatus(codes.Error, "Could not unmarshal rematch_requested payload")
+			return
+		}
+		h.handleRematchRequested(eventCtx, &payload)
+
+	case "rematch_successful":
+		var payload events.RematchSuccessfulPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			slog.ErrorContext(eventCtx, "Could not unmarshal rematch_successful payload", "error", err)
+			eventSpan.RecordError(err)
+			eventSpan.SetStatus(codes.Error, "Could not unmarshal rematch_successful payload")
+			return
 		}
+		h.handleRematchSuccessful(eventCtx, &payload)
 	}
 }
 
@@ -147,9 +151,23 @@ func (h *Hub) handlePlayerReconnected(ctx context.Context, payload *events.Playe
 
 	slog.InfoContext(ctx, "Received player_reconnected event", "player.id", payload.PlayerID, "room.id", payload.RoomID)
 
-	if room, ok := h.localRooms[payload.RoomID]; ok {
-		room.HandleOpponentReconnected()
+	r, ok := h.localRooms[payload.RoomID]
+	if !ok {
+		return
+	}
+	// The player's stale copy here, and the bots playing them, give way to
+	// the server that resumed the game.
+	if left := r.RemoveAbsentPlayer(payload.PlayerID); left != nil && h.localPlayers[left.ID] == left {
+		delete(h.localPlayers, left.ID)
+	}
+	if payload.ServerID != "" && payload.ServerID != h.serverID && r.RemoveBots() {
+		slog.InfoContext(ctx, "Bots follow their player to another server", "player.id", payload.PlayerID, "room.id", payload.RoomID, "server.id", payload.ServerID)
 	}
+	if r.Empty() {
+		h.closeRoom(ctx, r, "game resumed elsewhere")
+		return
+	}
+	r.HandleOpponentReconnected(payload.PlayerID)
 }
 
 func (h *Hub) handleRematchSuccessful(ctx context.Context, payload *events.RematchSuccessfulPayload) {
@@ -162,7 +180,7 @@ func (h *Hub) handleRematchSuccessful(ctx context.Context, payload *events.Remat
 
 	if room, ok := h.localRooms[payload.RoomID]; ok {
 		// Resend assignments and initial state to all players in the room
-		h.sendInitialRoomState(ctx, room, room.Players)
+		h.sendInitialRoomState(ctx, room, room.Players())
 	}
 }
 
@@ -176,12 +194,12 @@ func (h *Hub) handleRematchRequested(ctx context.Context, payload *events.Rematc
 	slog.InfoContext(ctx, "Received rematch_requested event", "player.id", payload.PlayerID, "room.id", payload.RoomID)
 
 	if room, ok := h.localRooms[payload.RoomID]; ok {
-		for _, p := range room.Players {
+		for _, p := range room.Players() {
 			if p.ID != payload.PlayerID {
 				msg := &proto.ServerToClientMessage{Type: "rematch_requested"}
 				data, _ := json.Marshal(msg)
 				if p.Conn != nil {
-					if err := p.Conn.WriteMessage(1, data); err != nil {
+					if err := p.Send(data); err != nil {
 						slog.ErrorContext(ctx, "Error sending rematch_requested to player", "player.id", p.ID, "error", err)
 						span.RecordError(err)
 						span.SetStatus(codes.Error, "Error sending rematch_requested")
@@ -200,14 +218,10 @@ func (h *Hub) createAndStartRoom(ctx context.Context, roomID string, localPlayer
 	))
 	defer span.End()
 
-	moveCalculator := &bot.BotMoveCalculator{}
-	newRoom := room.NewRoom(roomID, h.rdb, h.gameRepo, h.playerRepo, moveCalculator, moveTimeout)
+	newRoom := room.NewRoom(roomID, h.rdb, h.gameRepo, h.playerRepo, h.gameOverHandler, h.chat)
 	for _, p := range localPlayers {
 		newRoom.AddPlayer(p)
 	}
-	h.localRooms[roomID] = newRoom
-
-	go newRoom.Start(h.unregister)
-	go h.runRoomUpdateSubscriber(ctx, newRoom)
+	h.startRoom(ctx, newRoom)
 	h.sendInitialRoomState(ctx, newRoom, localPlayers)
 }
@@ -2,26 +2,29 @@ package hub
 
 import (
 	"context"
+	"ctchen222/Tic-Tac-Toe/internal/bot"
+	"ctchen222/Tic-Tac-Toe/internal/chat"
 	"ctchen222/Tic-Tac-Toe/internal/hub/types"
 	"ctchen222/Tic-Tac-Toe/internal/player"
 	"ctchen222/Tic-Tac-Toe/internal/repository"
 	"ctchen222/Tic-Tac-Toe/internal/room"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
-const moveTimeout = 15 * time.Second
-
 var (
-	activeRoomsCounter metric.Int64UpDownCounter
-	gamesPlayedCounter metric.Int64Counter
+	activeRoomsCounter       metric.Int64UpDownCounter
+	gamesPlayedCounter       metric.Int64Counter
+	matchmakingWaitHistogram metric.Float64Histogram
 
 	tracer = otel.Tracer("hub")
 	meter  = otel.Meter("hub")
@@ -38,33 +41,93 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+
+	matchmakingWaitHistogram, err = meter.Float64Histogram("matchmaking_wait_seconds", metric.WithDescription("How long matched players waited in the queue."), metric.WithUnit("s"))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RatingProvider looks up the rating players are matched by.
+type RatingProvider interface {
+	MatchmakingRating(ctx context.Context, playerID string) (float64, error)
 }
 
+// Hub keeps track of the players and rooms of this server. Its maps are only
+// touched by the Run loop: registrations, unregistrations, closing rooms and
+// the events other servers publish all reach it through channels.
 type Hub struct {
 	rdb             *redis.Client
 	gameRepo        repository.GameRepository
 	playerRepo      repository.PlayerRepository
 	matchmakingRepo repository.MatchmakingRepository
+	inviteRepo      repository.InviteRepository
+	servers         repository.ServerRepository
 	serverID        string
 	localPlayers    map[string]*player.Player
 	localRooms      map[string]*room.Room
+	moveCalculator  room.MoveCalculator
+	botThinkTimes   map[string]bot.ThinkTime
+	gameOverHandler room.GameOverHandler
+	ratings         RatingProvider
+	chat            *chat.Service
 
-	register   chan *types.RegistrationRequest
-	unregister chan *player.Player
+	register      chan *types.RegistrationRequest
+	unregister    chan *player.Player
+	spectatorLeft chan string
+	// closeRooms receives the rooms that should be closed, because they timed
+	// out or their game ended with a player leaving.
+	closeRooms chan room.CloseRequest
+	// events receives the payloads of the events published to every server.
+	events chan string
+	// orphans receives the rooms of dead servers this server adopts.
+	orphans chan orphanedRoom
+	// drain receives the steps of draining the server.
+	drain    chan drainRequest
+	draining atomic.Bool
+
+	matcherCtx   context.Context
+	stopMatcher  context.CancelFunc
+	registryCtx  context.Context
+	stopRegistry context.CancelFunc
+	// registryDone is closed once the registry stopped renewing the server.
+	registryDone chan struct{}
 }
 
+// closedRoomTTL is how long the keys of a closed room's finished game stay in Redis.
+const closedRoomTTL = 10 * time.Minute
+
 // NewHub creates a new hub.
-func NewHub(gameRepo repository.GameRepository, playerRepo repository.PlayerRepository, matchmakingRepo repository.MatchmakingRepository, rdb *redis.Client) *Hub {
+func NewHub(gameRepo repository.GameRepository, playerRepo repository.PlayerRepository, matchmakingRepo repository.MatchmakingRepository, inviteRepo repository.InviteRepository, servers repository.ServerRepository, rdb *redis.Client, moveCalculator room.MoveCalculator, botThinkTimes map[string]bot.ThinkTime, gameOverHandler room.GameOverHandler, ratings RatingProvider, chatService *chat.Service) *Hub {
+	matcherCtx, stopMatcher := context.WithCancel(context.Background())
+	registryCtx, stopRegistry := context.WithCancel(context.Background())
 	return &Hub{
 		rdb:             rdb,
 		gameRepo:        gameRepo,
 		playerRepo:      playerRepo,
 		matchmakingRepo: matchmakingRepo,
+		inviteRepo:      inviteRepo,
+		servers:         servers,
 		serverID:        uuid.New().String(),
 		localPlayers:    make(map[string]*player.Player),
 		localRooms:      make(map[string]*room.Room),
+		moveCalculator:  moveCalculator,
+		botThinkTimes:   botThinkTimes,
+		gameOverHandler: gameOverHandler,
+		ratings:         ratings,
+		chat:            chatService,
 		register:        make(chan *types.RegistrationRequest),
 		unregister:      make(chan *player.Player),
+		spectatorLeft:   make(chan string),
+		closeRooms:      make(chan room.CloseRequest),
+		events:          make(chan string),
+		orphans:         make(chan orphanedRoom),
+		drain:           make(chan drainRequest),
+		matcherCtx:      matcherCtx,
+		stopMatcher:     stopMatcher,
+		registryCtx:     registryCtx,
+		stopRegistry:    stopRegistry,
+		registryDone:    make(chan struct{}),
 	}
 }
 
@@ -72,8 +135,13 @@ func NewHub(gameRepo repository.GameRepository, playerRepo repository.PlayerRepo
 func (h *Hub) Run() {
 	slog.Info("Hub starting", "server.id", h.serverID)
 
-	go h.runMatcher(context.Background())
+	if err := h.registerQueueMetrics(); err != nil {
+		slog.Error("Failed to register matchmaking queue metrics", "error", err)
+	}
+
+	go h.runMatcher(h.matcherCtx)
 	go h.runEventSubscriber(context.Background())
+	go h.runRegistry(h.registryCtx)
 
 	for {
 		select {
@@ -86,6 +154,20 @@ func (h *Hub) Run() {
 			hubCtx := context.Background()
 			slog.InfoContext(traceCtx, "Received registration request", "player.id", req.Player.ID)
 
+			if h.Draining() {
+				h.rejectDraining(hubCtx, req.Player)
+				span.End()
+				continue
+			}
+
+			// Spectators don't become local players, so watching a game leaves the
+			// spectator's own games and queue entries alone.
+			if req.SpectateRoomID != "" {
+				h.registerSpectator(hubCtx, req)
+				span.End()
+				continue
+			}
+
 			h.localPlayers[req.Player.ID] = req.Player
 
 			roomID, status, err := h.playerRepo.FindForReconnection(hubCtx, req.Player.ID)
@@ -106,7 +188,9 @@ func (h *Hub) Run() {
 					continue
 				}
 
-				if req.Mode == "bot" {
+				if req.JoinCode != "" {
+					h.joinPrivateRoom(hubCtx, req)
+				} else if req.Mode == "bot" {
 					h.registerBotGame(hubCtx, req)
 				} else {
 					h.queuePlayerForMatchmaking(hubCtx, req)
@@ -116,22 +200,126 @@ func (h *Hub) Run() {
 			_ = traceCtx
 
 		case p := <-h.unregister:
-			hubCtx := context.Background()
-			slog.InfoContext(hubCtx, "Player unregistered", "player.id", p.ID)
+			// Players who registered again since, and absent players, are
+			// not ours to forget.
+			if h.localPlayers[p.ID] == p {
+				h.unregisterPlayer(context.Background(), p)
+			}
 
-			delete(h.localPlayers, p.ID)
+		case payload := <-h.events:
+			h.handleEvent(context.Background(), payload)
 
-			if err := h.matchmakingRepo.RemoveFromQueue(hubCtx, p.ID); err != nil {
-				slog.WarnContext(hubCtx, "Failed to remove player from matchmaking queue", "player.id", p.ID, "error", err)
+		case o := <-h.orphans:
+			h.adoptRoom(context.Background(), o)
+
+		case req := <-h.drain:
+			req.reply <- h.handleDrain(context.Background(), req.step)
+
+		case req := <-h.closeRooms:
+			if r, ok := h.localRooms[req.RoomID]; ok {
+				h.closeRoom(context.Background(), r, req.Reason)
 			}
 
-			if err := h.playerRepo.SetOffline(hubCtx, p.ID); err != nil {
-				slog.ErrorContext(hubCtx, "Failed to set player status to offline", "player.id", p.ID, "error", err)
+		case roomID := <-h.spectatorLeft:
+			// Rooms opened only for spectators close with their last spectator.
+			if r, ok := h.localRooms[roomID]; ok && r.Empty() {
+				h.closeRoom(context.Background(), r, "no spectators left")
 			}
 		}
 	}
 }
 
+// unregisterPlayer forgets a local player who left for good.
+func (h *Hub) unregisterPlayer(ctx context.Context, p *player.Player) {
+	slog.InfoContext(ctx, "Player unregistered", "player.id", p.ID)
+
+	delete(h.localPlayers, p.ID)
+
+	if err := h.matchmakingRepo.RemoveFromQueue(ctx, p.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to remove player from matchmaking queue", "player.id", p.ID, "error", err)
+	}
+
+	if err := h.playerRepo.SetOffline(ctx, p.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to set player status to offline", "player.id", p.ID, "error", err)
+	}
+
+	// Nobody is left to play against the bots of this player's rooms.
+	for _, r := range h.localRooms {
+		if r.OnlyBotsBesides(p.ID) {
+			h.closeRoom(ctx, r, "bot game left")
+		}
+	}
+}
+
+// startRoom adds a room to the local rooms and starts its goroutines.
+func (h *Hub) startRoom(ctx context.Context, r *room.Room) {
+	h.localRooms[r.ID] = r
+	activeRoomsCounter.Add(ctx, 1)
+	go r.Start(h.unregister, h.closeRooms)
+	go h.runRoomUpdateSubscriber(ctx, r)
+}
+
+// closeRoom tears down a local room: its run loop, bots and subscription stop,
+// and its local players are taken out of the room, disconnected with reason and
+// unregistered. The keys of a finished game are left to expire soon after.
+func (h *Hub) closeRoom(ctx context.Context, r *room.Room, reason string) {
+	if _, ok := h.localRooms[r.ID]; !ok {
+		return
+	}
+	slog.InfoContext(ctx, "Closing room", "room.id", r.ID, "state", r.State(), "reason", reason)
+	finished := r.State() == room.StateFinished
+	r.Close()
+	delete(h.localRooms, r.ID)
+	activeRoomsCounter.Add(ctx, -1)
+
+	if finished {
+		if err := h.gameRepo.Expire(ctx, r.ID, closedRoomTTL); err != nil {
+			slog.WarnContext(ctx, "Failed to expire closed room", "room.id", r.ID, "error", err)
+		}
+	}
+
+	for _, p := range r.Players() {
+		// Skip bots, and players who since registered again elsewhere.
+		if p.IsBot || h.localPlayers[p.ID] != p {
+			continue
+		}
+		if err := h.playerRepo.LeaveRoom(ctx, p.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to take player out of room", "player.id", p.ID, "room.id", r.ID, "error", err)
+		}
+		if p.Status() == player.StatusConnected {
+			closeConnection(p, websocket.CloseNormalClosure, reason)
+		}
+		h.unregisterPlayer(ctx, p)
+	}
+}
+
+// registerQueueMetrics reports the size of each matchmaking pool and how long
+// its longest-waiting player has been queued.
+func (h *Hub) registerQueueMetrics() error {
+	queueSize, err := meter.Int64ObservableGauge("matchmaking_queue_size", metric.WithDescription("The number of players waiting in each matchmaking pool."))
+	if err != nil {
+		return err
+	}
+	oldestWait, err := meter.Float64ObservableGauge("matchmaking_oldest_wait_seconds", metric.WithDescription("How long the longest-waiting player of each pool has been queued."), metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats, err := h.matchmakingRepo.QueueStats(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range stats {
+			attrs := metric.WithAttributes(attribute.String("pool", s.Pool))
+			o.ObserveInt64(queueSize, int64(s.Waiting), attrs)
+			o.ObserveFloat64(oldestWait, s.OldestWait.Seconds(), attrs)
+		}
+		return nil
+	}, queueSize, oldestWait)
+	return err
+}
+
 // Register returns the register channel.
 func (h *Hub) Register() chan<- *types.RegistrationRequest {
 	return h.register
@@ -0,0 +1,676 @@
+package hub
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/chat"
+	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/hub/types"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// These tests drive a hub whose repositories are in memory and whose Redis is
+// unreachable, so events are handed to the hub the way its subscriber does.
+// Run them with -race to check that the hub's state has a single owner.
+
+type fakeGameRepo struct {
+	repository.GameRepository
+	mu    sync.Mutex
+	games map[string]*game.GameStateDTO
+	moves []game.Move
+}
+
+func (r *fakeGameRepo) add(roomID, playerXID, playerOID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.games[roomID] = &game.GameStateDTO{
+		Variant:     game.DefaultVariant,
+		Board:       game.NewBoard(3, 3),
+		PlayerXID:   playerXID,
+		PlayerOID:   playerOID,
+		CurrentTurn: game.PlayerX,
+	}
+}
+
+func (r *fakeGameRepo) FindByID(ctx context.Context, id string) (*game.GameStateDTO, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.games[id]
+	if !ok {
+		return nil, repository.ErrGameNotFound
+	}
+	copied := *state
+	return &copied, nil
+}
+
+func (r *fakeGameRepo) Update(ctx context.Context, id string, move game.Move) (*game.GameStateDTO, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.moves = append(r.moves, move)
+	copied := *r.games[id]
+	return &copied, nil
+}
+
+func (r *fakeGameRepo) played() []game.Move {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]game.Move(nil), r.moves...)
+}
+
+func (r *fakeGameRepo) AddSpectator(ctx context.Context, roomID string, max int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.games[roomID]
+	if !ok {
+		return 0, repository.ErrGameNotFound
+	}
+	if state.Spectators >= max {
+		return 0, repository.ErrRoomFull
+	}
+	state.Spectators++
+	return state.Spectators, nil
+}
+
+func (r *fakeGameRepo) RemoveSpectator(ctx context.Context, roomID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state, ok := r.games[roomID]; ok && state.Spectators > 0 {
+		state.Spectators--
+	}
+	return nil
+}
+
+func (r *fakeGameRepo) ClearAbandoned(ctx context.Context, roomID, playerID string) error {
+	return repository.ErrNotAbandoned
+}
+
+func (r *fakeGameRepo) Expire(ctx context.Context, roomID string, ttl time.Duration) error {
+	return nil
+}
+
+type fakePlayerRepo struct {
+	mu    sync.Mutex
+	rooms map[string]string
+	// lost are the players of each dead server.
+	lost     map[string][]repository.LostPlayer
+	statuses map[string]player.PlayerStatus
+}
+
+func (r *fakePlayerRepo) FindForReconnection(ctx context.Context, id string) (string, player.PlayerStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if roomID, ok := r.rooms[id]; ok {
+		return roomID, player.StatusDisconnected, nil
+	}
+	return "", "", nil
+}
+
+func (r *fakePlayerRepo) UpdateConnectionStatus(ctx context.Context, id string, status player.PlayerStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses[id] = status
+	return nil
+}
+
+func (r *fakePlayerRepo) status(id string) player.PlayerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statuses[id]
+}
+func (r *fakePlayerRepo) SetInitialState(ctx context.Context, id, serverID string) error { return nil }
+func (r *fakePlayerRepo) UpdateForMatch(ctx context.Context, id, roomID string) error    { return nil }
+func (r *fakePlayerRepo) SetOffline(ctx context.Context, id string) error                { return nil }
+func (r *fakePlayerRepo) LeaveRoom(ctx context.Context, id string) error                 { return nil }
+func (r *fakePlayerRepo) SetServer(ctx context.Context, id, serverID string) error       { return nil }
+
+func (r *fakePlayerRepo) DisconnectServer(ctx context.Context, serverID string) ([]repository.LostPlayer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lost[serverID], nil
+}
+
+// fakeServerRepo is a registry in which this server never becomes the janitor.
+type fakeServerRepo struct {
+	deregistered atomic.Bool
+}
+
+func (*fakeServerRepo) Heartbeat(ctx context.Context, serverID string) error { return nil }
+func (*fakeServerRepo) AcquireJanitor(ctx context.Context, serverID string) (bool, error) {
+	return false, nil
+}
+func (*fakeServerRepo) Expired(ctx context.Context) ([]string, error)     { return nil, nil }
+func (*fakeServerRepo) Forget(ctx context.Context, serverID string) error { return nil }
+
+func (r *fakeServerRepo) Deregister(ctx context.Context, serverID string) error {
+	r.deregistered.Store(true)
+	return nil
+}
+
+type fakeMatchmakingRepo struct{}
+
+func (fakeMatchmakingRepo) AddToQueue(ctx context.Context, playerID, pool string, rating float64) error {
+	return nil
+}
+
+// GetPlayersFromQueue never matches anybody: matches are made by the tests.
+func (fakeMatchmakingRepo) GetPlayersFromQueue(ctx context.Context) (*repository.Match, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (fakeMatchmakingRepo) RemoveFromQueue(ctx context.Context, playerID string) error { return nil }
+func (fakeMatchmakingRepo) QueueStats(ctx context.Context) ([]repository.QueueStats, error) {
+	return nil, nil
+}
+
+type fakeChatRepo struct{}
+
+func (fakeChatRepo) Append(ctx context.Context, roomID string, entry proto.ChatEntry, max int) error {
+	return nil
+}
+func (fakeChatRepo) History(ctx context.Context, roomID string) ([]proto.ChatEntry, error) {
+	return nil, nil
+}
+func (fakeChatRepo) SetMuted(ctx context.Context, roomID, playerID string, muted bool) error {
+	return nil
+}
+func (fakeChatRepo) Muting(ctx context.Context, roomID string) (map[string]bool, error) {
+	return nil, nil
+}
+
+type fixedRatings struct{}
+
+func (fixedRatings) MatchmakingRating(ctx context.Context, playerID string) (float64, error) {
+	return 1500, nil
+}
+
+// fakeConn records what is written to it. Reads return what the test sends on
+// incoming, and block until it is closed otherwise.
+type fakeConn struct {
+	mu        sync.Mutex
+	messages  []string
+	closeCode int
+	incoming  chan []byte
+	closed    chan struct{}
+	once      sync.Once
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{incoming: make(chan []byte), closed: make(chan struct{})}
+}
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if messageType == websocket.CloseMessage {
+		c.closeCode = int(binary.BigEndian.Uint16(data))
+		return nil
+	}
+	c.messages = append(c.messages, string(data))
+	return nil
+}
+
+func (c *fakeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.incoming:
+		return websocket.TextMessage, data, nil
+	case <-c.closed:
+		return 0, nil, errors.New("connection closed")
+	}
+}
+
+func (c *fakeConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// received reports whether a message of the given type was written.
+func (c *fakeConn) received(messageType string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range c.messages {
+		if strings.Contains(m, `"type":"`+messageType+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// closedWith returns the code of the close frame written, or zero.
+func (c *fakeConn) closedWith() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeCode
+}
+
+// updates returns the "update" messages written.
+func (c *fakeConn) updates() []proto.ServerToClientMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var updates []proto.ServerToClientMessage
+	for _, m := range c.messages {
+		var message proto.ServerToClientMessage
+		if err := json.Unmarshal([]byte(m), &message); err == nil && message.Type == "update" {
+			updates = append(updates, message)
+		}
+	}
+	return updates
+}
+
+func newTestHub(t *testing.T) (*Hub, *fakeGameRepo, *fakePlayerRepo) {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 10 * time.Millisecond})
+	t.Cleanup(func() { rdb.Close() })
+
+	games := &fakeGameRepo{games: make(map[string]*game.GameStateDTO)}
+	players := &fakePlayerRepo{rooms: make(map[string]string), lost: make(map[string][]repository.LostPlayer), statuses: make(map[string]player.PlayerStatus)}
+	chatService := chat.NewService(fakeChatRepo{}, nil, chat.DefaultConfig)
+	h := NewHub(games, players, fakeMatchmakingRepo{}, nil, &fakeServerRepo{}, rdb, nil, nil, nil, fixedRatings{}, chatService)
+	return h, games, players
+}
+
+func register(h *Hub, id string, conn *fakeConn) *player.Player {
+	p := player.NewPlayer(id, conn)
+	h.Register() <- &types.RegistrationRequest{Player: p, PlayerID: id, Mode: "human", Ctx: context.Background()}
+	return p
+}
+
+// publish hands an event to the hub as its subscriber would.
+func publish(t *testing.T, h *Hub, eventType string, payload any) {
+	t.Helper()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := json.Marshal(events.Event{Type: eventType, Payload: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.events <- string(event)
+}
+
+// waitFor polls until cond holds or two seconds have passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConcurrentRegistrationsDisconnectsAndMatches(t *testing.T) {
+	h, games, _ := newTestHub(t)
+	go h.Run()
+
+	const rooms = 10
+	conns := make([][2]*fakeConn, rooms)
+	var wg sync.WaitGroup
+	for i := range rooms {
+		conns[i] = [2]*fakeConn{newFakeConn(), newFakeConn()}
+		roomID := fmt.Sprintf("room-%d", i)
+		xID, oID := fmt.Sprintf("x-%d", i), fmt.Sprintf("o-%d", i)
+		games.add(roomID, xID, oID)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			register(h, xID, conns[i][0])
+			o := register(h, oID, conns[i][1])
+			publish(t, h, "match_made", events.MatchMadePayload{RoomID: roomID, PlayerIDs: []string{xID, oID}})
+
+			// O drops their connection while other rooms are being set up,
+			// and every server hears about it.
+			conns[i][1].Close()
+			publish(t, h, "player_disconnected", events.PlayerDisconnectedPayload{RoomID: roomID, PlayerID: oID})
+			publish(t, h, "rematch_requested", events.RematchRequestedPayload{RoomID: roomID, PlayerID: oID})
+			if i%2 == 0 {
+				h.Unregister() <- o
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range rooms {
+		waitFor(t, fmt.Sprintf("room %d to start", i), func() bool {
+			return conns[i][0].received("assignment") && conns[i][0].received("update")
+		})
+		waitFor(t, fmt.Sprintf("X of room %d to hear about the disconnect", i), func() bool {
+			return conns[i][0].received("opponent_disconnected") && conns[i][0].received("rematch_requested")
+		})
+	}
+}
+
+func TestConcurrentReconnections(t *testing.T) {
+	h, games, players := newTestHub(t)
+	go h.Run()
+
+	const rooms = 5
+	var wg sync.WaitGroup
+	reconnected := make([]*fakeConn, rooms)
+	for i := range rooms {
+		roomID := fmt.Sprintf("room-%d", i)
+		xID, oID := fmt.Sprintf("x-%d", i), fmt.Sprintf("o-%d", i)
+		games.add(roomID, xID, oID)
+		reconnected[i] = newFakeConn()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first := newFakeConn()
+			register(h, xID, first)
+			register(h, oID, newFakeConn())
+			publish(t, h, "match_made", events.MatchMadePayload{RoomID: roomID, PlayerIDs: []string{xID, oID}})
+
+			// X loses their connection and comes back on a new one.
+			first.Close()
+			players.mu.Lock()
+			players.rooms[xID] = roomID
+			players.mu.Unlock()
+			register(h, xID, reconnected[i])
+			publish(t, h, "player_reconnected", events.PlayerReconnectedPayload{RoomID: roomID, PlayerID: xID})
+		}()
+	}
+	wg.Wait()
+
+	for i := range rooms {
+		waitFor(t, fmt.Sprintf("X of room %d to get the game back", i), func() bool {
+			return reconnected[i].received("assignment") && reconnected[i].received("update")
+		})
+	}
+}
+
+func TestReapServerAdoptsItsRooms(t *testing.T) {
+	// The hub isn't running, so the test plays its Run loop.
+	h, games, players := newTestHub(t)
+	games.add("room-1", "x-1", "o-1")
+	games.add("room-2", "x-2", "o-2")
+
+	local := player.NewPlayer("x-1", newFakeConn())
+	h.localPlayers[local.ID] = local
+	h.createAndStartRoom(context.Background(), "room-1", []*player.Player{local})
+
+	players.lost["dead"] = []repository.LostPlayer{
+		{PlayerID: "o-1", RoomID: "room-1"},
+		{PlayerID: "x-2", RoomID: "room-2"},
+		{PlayerID: "o-2", RoomID: "room-2"},
+		{PlayerID: "queued"},
+	}
+	reaped := make(chan error)
+	go func() { reaped <- h.reapServer(context.Background(), "dead") }()
+	for range 2 {
+		h.adoptRoom(context.Background(), <-h.orphans)
+	}
+	if err := <-reaped; err != nil {
+		t.Fatalf("reapServer() returned error: %v", err)
+	}
+
+	want := map[string][]string{"room-1": {"x-1", "o-1"}, "room-2": {"x-2", "o-2"}}
+	for roomID, playerIDs := range want {
+		r, ok := h.localRooms[roomID]
+		if !ok {
+			t.Fatalf("%s was not adopted", roomID)
+		}
+		got := r.Players()
+		if len(got) != len(playerIDs) {
+			t.Fatalf("%s has %d players, want %d", roomID, len(got), len(playerIDs))
+		}
+		for i, p := range got {
+			if p.ID != playerIDs[i] {
+				t.Errorf("%s player %d = %s, want %s", roomID, i, p.ID, playerIDs[i])
+			}
+		}
+	}
+	if p := h.localRooms["room-1"].Players()[0]; p != local || p.Status() != player.StatusConnected {
+		t.Error("adopting room-1 replaced its connected local player")
+	}
+	if p := h.localRooms["room-2"].Players()[0]; p.Status() != player.StatusDisconnected {
+		t.Errorf("absent player status = %s, want disconnected", p.Status())
+	}
+	if _, ok := h.localPlayers["o-1"]; ok {
+		t.Error("absent player became a local player")
+	}
+}
+
+func TestDrainHandsOffGamesInProgress(t *testing.T) {
+	h, games, players := newTestHub(t)
+	go h.Run()
+
+	games.add("room-1", "x-1", "o-1")
+	x, o, queued := newFakeConn(), newFakeConn(), newFakeConn()
+	register(h, "x-1", x)
+	register(h, "o-1", o)
+	register(h, "queued", queued)
+	publish(t, h, "match_made", events.MatchMadePayload{RoomID: "room-1", PlayerIDs: []string{"x-1", "o-1"}})
+	waitFor(t, "the game to start", func() bool { return x.received("assignment") && o.received("assignment") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	h.Drain(ctx)
+	if ctx.Err() == nil {
+		t.Error("Drain() returned before its deadline with a game in progress")
+	}
+
+	if !queued.received("server_draining") || !queued.isClosed() {
+		t.Error("queued player was not told to reconnect elsewhere")
+	}
+	for id, conn := range map[string]*fakeConn{"x-1": x, "o-1": o} {
+		waitFor(t, id+" to be disconnected", conn.isClosed)
+		if !conn.received("server_draining") {
+			t.Errorf("%s was not told the server is draining", id)
+		}
+		if got := players.status(id); got != player.StatusDisconnected {
+			t.Errorf("%s status = %q, want disconnected so they resume elsewhere", id, got)
+		}
+	}
+	if !h.servers.(*fakeServerRepo).deregistered.Load() {
+		t.Error("drained server is still in the registry")
+	}
+
+	late := newFakeConn()
+	register(h, "late", late)
+	waitFor(t, "a late registration to be turned away", func() bool {
+		return late.isClosed() && late.received("server_draining")
+	})
+}
+
+func TestBotGameResumesWhereItsPlayerReconnects(t *testing.T) {
+	// The hub isn't running, so the test plays its Run loop.
+	h, games, _ := newTestHub(t)
+	games.add("room-1", "alice", "bot-1")
+	games.games["room-1"].BotDifficulties = map[string]string{"bot-1": "easy"}
+
+	alice := player.NewPlayer("alice", newFakeConn())
+	h.localPlayers[alice.ID] = alice
+	h.handleReconnectionRegistration(context.Background(), alice, "room-1")
+
+	r, ok := h.localRooms["room-1"]
+	if !ok {
+		t.Fatal("room of the resumed bot game was not started")
+	}
+	players := r.Players()
+	if len(players) != 2 || players[0] != alice || !players[1].IsBot || players[1].ID != "bot-1" || players[1].Difficulty != "easy" {
+		t.Fatalf("Players() = %v, want alice and her easy bot", players)
+	}
+	waitFor(t, "alice to get her mark", func() bool { return alice.Conn.(*fakeConn).received("assignment") })
+
+	// This server's own event leaves the bot alone.
+	h.handlePlayerReconnected(context.Background(), &events.PlayerReconnectedPayload{RoomID: "room-1", PlayerID: "alice", ServerID: h.serverID})
+	if len(r.Players()) != 2 {
+		t.Fatal("bot left the server its player resumed the game on")
+	}
+
+	// Once alice resumes on another server, the bot goes with her.
+	alice.SetStatus(player.StatusDisconnected)
+	h.handlePlayerReconnected(context.Background(), &events.PlayerReconnectedPayload{RoomID: "room-1", PlayerID: "alice", ServerID: "other"})
+	if _, ok := h.localRooms["room-1"]; ok {
+		t.Error("room stayed open after its player and bot moved to another server")
+	}
+	if _, ok := h.localPlayers["alice"]; ok {
+		t.Error("stale copy of alice is still a local player")
+	}
+}
+
+func TestReapServerSeatsTheBotsOfAdoptedRooms(t *testing.T) {
+	h, games, players := newTestHub(t)
+	games.add("room-1", "alice", "bot-1")
+	games.games["room-1"].BotDifficulties = map[string]string{"bot-1": "hard"}
+	players.lost["dead"] = []repository.LostPlayer{{PlayerID: "alice", RoomID: "room-1"}}
+
+	reaped := make(chan error)
+	go func() { reaped <- h.reapServer(context.Background(), "dead") }()
+	h.adoptRoom(context.Background(), <-h.orphans)
+	if err := <-reaped; err != nil {
+		t.Fatalf("reapServer() returned error: %v", err)
+	}
+
+	r, ok := h.localRooms["room-1"]
+	if !ok {
+		t.Fatal("bot room was not adopted")
+	}
+	got := r.Players()
+	if len(got) != 2 || got[0].ID != "alice" || got[0].Status() != player.StatusDisconnected {
+		t.Fatalf("Players() = %v, want absent alice and her bot", got)
+	}
+	if bot := got[1]; !bot.IsBot || bot.ID != "bot-1" || bot.Difficulty != "hard" || bot.Conn == nil {
+		t.Errorf("second player = %+v, want a running hard bot-1", bot)
+	}
+}
+
+// spectate has a new connection watch a room, as the Run loop would.
+func spectate(h *Hub, id, roomID string) *fakeConn {
+	conn := newFakeConn()
+	s := player.NewPlayer(id, conn)
+	h.registerSpectator(context.Background(), &types.RegistrationRequest{Player: s, PlayerID: id, SpectateRoomID: roomID, Ctx: context.Background()})
+	return conn
+}
+
+// roomUpdate hands the hub an update published for the room, as its room
+// subscriber would.
+func roomUpdate(h *Hub, roomID string) {
+	ctx := context.Background()
+	h.handleRoomEvent(ctx, trace.SpanFromContext(ctx), h.localRooms[roomID], events.RoomEventUpdate)
+}
+
+func TestSpectatorMovesAreNeverPlayed(t *testing.T) {
+	// The hub isn't running, so the test plays its Run loop.
+	h, games, _ := newTestHub(t)
+	games.add("room-1", "alice", "bob")
+
+	// Even with the ID of the player to move, a spectator only watches.
+	conn := spectate(h, "alice", "room-1")
+	waitFor(t, "the spectator to be told they are spectating", func() bool { return conn.received("spectating") })
+	for range 2 {
+		select {
+		case conn.incoming <- []byte(`{"type":"move","position":[1,1]}`):
+		case <-time.After(time.Second):
+			t.Fatal("spectator's messages are not being read")
+		}
+	}
+
+	if moves := games.played(); len(moves) != 0 {
+		t.Errorf("spectator played %v", moves)
+	}
+	if conn.isClosed() {
+		t.Error("spectator was disconnected for sending a move")
+	}
+}
+
+func TestSpectatorsBeyondMaxSpectatorsAreTurnedAway(t *testing.T) {
+	defer func(max int) { room.MaxSpectators = max }(room.MaxSpectators)
+	room.MaxSpectators = 1
+
+	h, games, _ := newTestHub(t)
+	games.add("room-1", "alice", "bob")
+
+	first := spectate(h, "carol", "room-1")
+	second := spectate(h, "dave", "room-1")
+
+	waitFor(t, "the second spectator to be turned away", func() bool { return second.isClosed() })
+	if code := second.closedWith(); code != proto.CloseRoomFull {
+		t.Errorf("second spectator closed with %d, want %d", code, proto.CloseRoomFull)
+	}
+	if second.received("spectating") {
+		t.Error("second spectator was told they are spectating")
+	}
+	if first.isClosed() || !first.received("spectating") {
+		t.Error("first spectator is not watching the room")
+	}
+	if state, _ := games.FindByID(context.Background(), "room-1"); state.Spectators != 1 {
+		t.Errorf("Spectators = %d, want 1", state.Spectators)
+	}
+}
+
+func TestSpectatorCountIsSentInUpdates(t *testing.T) {
+	h, games, _ := newTestHub(t)
+	games.add("room-1", "alice", "bob")
+
+	alice := player.NewPlayer("alice", newFakeConn())
+	h.localPlayers[alice.ID] = alice
+	h.createAndStartRoom(context.Background(), "room-1", []*player.Player{alice})
+
+	carol := spectate(h, "carol", "room-1")
+	dave := spectate(h, "dave", "room-1")
+	roomUpdate(h, "room-1")
+
+	for name, conn := range map[string]*fakeConn{"alice": alice.Conn.(*fakeConn), "carol": carol, "dave": dave} {
+		waitFor(t, name+" to see both spectators", func() bool {
+			updates := conn.updates()
+			return len(updates) > 0 && updates[len(updates)-1].Spectators == 2
+		})
+	}
+}
+
+func TestSpectatorKeepsWatchingAfterRematch(t *testing.T) {
+	h, games, _ := newTestHub(t)
+	games.add("room-1", "alice", "bob")
+
+	conn := spectate(h, "carol", "room-1")
+	roomUpdate(h, "room-1")
+	waitFor(t, "the spectator's first update", func() bool { return len(conn.updates()) > 0 })
+
+	// The rematch swaps the players' marks and starts a new board.
+	games.add("room-1", "bob", "alice")
+	h.handleRematchSuccessful(context.Background(), &events.RematchSuccessfulPayload{RoomID: "room-1"})
+	waitFor(t, "the spectator to get the rematch", func() bool { return len(conn.updates()) > 1 })
+
+	games.mu.Lock()
+	games.games["room-1"].CurrentTurn = game.PlayerO
+	games.mu.Unlock()
+	roomUpdate(h, "room-1")
+	waitFor(t, "the spectator to follow the rematch", func() bool {
+		updates := conn.updates()
+		return updates[len(updates)-1].Next == game.PlayerO
+	})
+
+	if conn.isClosed() || conn.received("assignment") {
+		t.Error("rematch treated the spectator as a player")
+	}
+}
@@ -43,7 +43,7 @@ func (h *Hub) sendInitialRoomState(ctx context.Context, room *room.Room, localPl
 		assignmentMessage := &proto.PlayerAssignmentMessage{Type: "assignment", Mark: mark}
 		data, _ := json.Marshal(assignmentMessage)
 		if p.Conn != nil {
-			if err := p.Conn.WriteMessage(1, data); err != nil {
+			if err := p.Send(data); err != nil {
 				slog.ErrorContext(ctx, "Error sending assignment to player", "player.id", p.ID, "error", err)
 				span.RecordError(err)
 				span.SetStatus(codes.Error, "Error sending assignment to player")
@@ -51,11 +51,11 @@ func (h *Hub) sendInitialRoomState(ctx context.Context, room *room.Room, localPl
 		}
 	}
 
-	initialUpdate := &proto.ServerToClientMessage{
-		Type:   "update",
-		Board:  game.BoardArrayToSlice(initialGameState.Board),
-		Next:   initialGameState.CurrentTurn,
-		Winner: initialGameState.Winner,
-	}
-	room.Broadcast(initialUpdate)
+	room.Broadcast(proto.NewUpdateMessage(initialGameState))
+}
+
+// closeConnection closes a player's connection with a close code once the
+// messages already queued for them are written.
+func closeConnection(p *player.Player, code int, reason string) {
+	p.Disconnect(code, reason)
 }
@@ -3,13 +3,20 @@ package hub
 import (
 	"context"
 	"ctchen222/Tic-Tac-Toe/internal/bot"
+	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/game"
 	"ctchen222/Tic-Tac-Toe/internal/hub/types"
 	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
 	"ctchen222/Tic-Tac-Toe/internal/room"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -22,21 +29,38 @@ func (h *Hub) handleReconnectionRegistration(ctx context.Context, p *player.Play
 	))
 	defer span.End()
 
-	if existingRoom, ok := h.localRooms[roomID]; ok {
-		existingRoom.AddPlayer(p)
-		go existingRoom.ReadPump(p)
+	// A player back within the forfeit window takes their game up again.
+	if err := h.gameRepo.ClearAbandoned(ctx, roomID, p.ID); err != nil && !errors.Is(err, repository.ErrNotAbandoned) {
+		slog.WarnContext(ctx, "Failed to clear abandonment of reconnected player", "player.id", p.ID, "room.id", roomID, "error", err)
+	}
+
+	r, ok := h.localRooms[roomID]
+	if ok {
+		r.AddPlayer(p)
+		go r.ReadPump(p)
 		slog.InfoContext(ctx, "Reconnected player added back to existing local room", "player.id", p.ID, "room.id", roomID)
 	} else {
 		slog.InfoContext(ctx, "Creating new local room handler for reconnected player", "player.id", p.ID, "room.id", roomID)
-		moveCalculator := &bot.BotMoveCalculator{}
-		newRoom := room.NewRoom(roomID, h.rdb, h.gameRepo, h.playerRepo, moveCalculator, moveTimeout)
-		newRoom.AddPlayer(p)
-		h.localRooms[roomID] = newRoom
-		go newRoom.Start(h.unregister)
-		go h.runRoomUpdateSubscriber(ctx, newRoom)
+		r = room.NewRoom(roomID, h.rdb, h.gameRepo, h.playerRepo, h.gameOverHandler, h.chat)
+		r.AddPlayer(p)
+		h.startRoom(ctx, r)
 	}
 
-	h.sendInitialRoomState(ctx, h.localRooms[roomID], []*player.Player{p})
+	// A bot game resumed on this server brings its bot along.
+	bots := h.addBots(ctx, r)
+	h.sendInitialRoomState(ctx, r, append([]*player.Player{p}, bots...))
+	r.SendChatHistory(ctx, p)
+
+	if err := h.playerRepo.SetServer(ctx, p.ID, h.serverID); err != nil {
+		slog.ErrorContext(ctx, "Failed to record server of reconnected player", "player.id", p.ID, "error", err)
+	}
+	// Servers hosting the opponent let them know, and drop the player if
+	// they hold them as absent.
+	if err := h.publishEvent(ctx, "player_reconnected", events.PlayerReconnectedPayload{RoomID: roomID, PlayerID: p.ID, ServerID: h.serverID}); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish player_reconnected event", "player.id", p.ID, "room.id", roomID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to publish player_reconnected event")
+	}
 }
 
 func (h *Hub) registerBotGame(ctx context.Context, req *types.RegistrationRequest) {
@@ -46,30 +70,21 @@ func (h *Hub) registerBotGame(ctx context.Context, req *types.RegistrationReques
 	))
 	defer span.End()
 
-	slog.InfoContext(ctx, "Creating bot match", "player.id", req.Player.ID, "difficulty", req.Difficulty)
-
-	var botGameTimeout time.Duration
-	switch req.Difficulty {
-	case "hard":
-		botGameTimeout = 5 * time.Second
-	case "easy":
-		botGameTimeout = 15 * time.Second
-	default:
-		botGameTimeout = 10 * time.Second
+	cfg := req.Config
+	if cfg.TimeControl.IsZero() {
+		cfg.TimeControl = botTimeControl(req.Difficulty)
 	}
+	slog.InfoContext(ctx, "Creating bot match", "player.id", req.Player.ID, "difficulty", req.Difficulty, "board", cfg.Key())
 
 	roomID := uuid.New().String()
-	moveCalculator := &bot.BotMoveCalculator{}
-	newRoom := room.NewRoom(roomID, h.rdb, h.gameRepo, h.playerRepo, moveCalculator, botGameTimeout)
+	newRoom := room.NewRoom(roomID, h.rdb, h.gameRepo, h.playerRepo, h.gameOverHandler, h.chat)
 
 	player1 := req.Player
-	botPlayerID := "bot-" + uuid.New().String()[:8]
-	player2 := player.NewPlayer(botPlayerID, nil)
-	player2.IsBot = true
-	botConn := bot.NewBotConnection(botPlayerID, req.Difficulty, player2, newRoom.IncomingMoves())
-	player2.Conn = botConn
+	player2, botConn := h.newBot(newRoom, "bot-"+uuid.New().String()[:8], req.Difficulty)
 
-	if err := h.gameRepo.Create(ctx, roomID, player1.ID, player2.ID); err != nil {
+	if err := h.gameRepo.Create(ctx, roomID, player1.ID, player2.ID, cfg, repository.RoomSettings{
+		Bots: map[string]string{player2.ID: player2.Difficulty},
+	}); err != nil {
 		slog.ErrorContext(ctx, "Failed to create new bot game in Redis", "room.id", roomID, "error", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to create bot game in Redis")
@@ -77,14 +92,73 @@ func (h *Hub) registerBotGame(ctx context.Context, req *types.RegistrationReques
 	}
 	slog.InfoContext(ctx, "Bot game state created in Redis", "room.id", roomID)
 
+	// The room ID lets the game resume wherever the player reconnects.
+	if err := h.playerRepo.UpdateForMatch(ctx, player1.ID, roomID); err != nil {
+		slog.ErrorContext(ctx, "Failed to update player state for bot match", "player.id", player1.ID, "error", err)
+	}
+
 	newRoom.AddPlayer(player1)
 	newRoom.AddPlayer(player2)
-	h.localRooms[roomID] = newRoom
-	go newRoom.Start(h.unregister)
-	go h.runRoomUpdateSubscriber(ctx, newRoom)
+	go botConn.Run()
+	h.startRoom(ctx, newRoom)
 	slog.InfoContext(ctx, "Local room handler created for bot match", "room.id", roomID)
 
-	h.sendInitialRoomState(ctx, newRoom, newRoom.Players)
+	h.sendInitialRoomState(ctx, newRoom, newRoom.Players())
+}
+
+// newBot creates a bot player of room r. Its connection's Run must be started
+// for it to play.
+func (h *Hub) newBot(r *room.Room, botID, difficulty string) (*player.Player, *bot.BotConnection) {
+	p := player.NewPlayer(botID, nil)
+	p.IsBot = true
+	p.Difficulty = difficulty
+	conn := bot.NewBotConnection(botID, difficulty, p, r.IncomingMoves(), h.moveCalculator, bot.ThinkTimeFor(h.botThinkTimes, difficulty))
+	p.Conn = conn
+	return p, conn
+}
+
+// addBots seats and starts the bots of the room's game that the room doesn't
+// have yet, as when a bot game resumes on this server, and returns them.
+func (h *Hub) addBots(ctx context.Context, r *room.Room) []*player.Player {
+	state, err := h.gameRepo.FindByID(ctx, r.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Could not get game state to seat bots", "room.id", r.ID, "error", err)
+		return nil
+	}
+	seated := make(map[string]bool)
+	for _, p := range r.Players() {
+		seated[p.ID] = true
+	}
+
+	var bots []*player.Player
+	for botID, difficulty := range state.BotDifficulties {
+		if seated[botID] {
+			continue
+		}
+		p, conn := h.newBot(r, botID, difficulty)
+		r.AddPlayer(p)
+		go conn.Run()
+		bots = append(bots, p)
+		slog.InfoContext(ctx, "Bot seated in resumed room", "player.id", botID, "room.id", r.ID, "difficulty", difficulty)
+	}
+	return bots
+}
+
+// botTimeControls are the time controls of bot games by difficulty, for players
+// who didn't choose one. Harder bots give less time.
+var botTimeControls = map[string]game.TimeControl{
+	"easy":   {Base: 3 * time.Minute, Increment: 10 * time.Second},
+	"medium": {Base: 2 * time.Minute, Increment: 5 * time.Second},
+	"hard":   {Base: time.Minute, Increment: 2 * time.Second},
+}
+
+// botTimeControl returns the time control preset of a bot difficulty, the
+// medium one for unknown difficulties.
+func botTimeControl(difficulty string) game.TimeControl {
+	if tc, ok := botTimeControls[difficulty]; ok {
+		return tc
+	}
+	return botTimeControls["medium"]
 }
 
 func (h *Hub) queuePlayerForMatchmaking(ctx context.Context, req *types.RegistrationRequest) {
@@ -93,11 +167,146 @@ func (h *Hub) queuePlayerForMatchmaking(ctx context.Context, req *types.Registra
 	))
 	defer span.End()
 
-	slog.InfoContext(ctx, "Player added to matchmaking queue", "player.id", req.Player.ID)
+	cfg := req.Config
+	if cfg.TimeControl.IsZero() {
+		cfg.TimeControl = game.DefaultTimeControl
+	}
+	pool := cfg.Key()
+	span.SetAttributes(attribute.String("matchmaking.pool", pool))
+	slog.InfoContext(ctx, "Player added to matchmaking queue", "player.id", req.Player.ID, "pool", pool)
 
-	if err := h.matchmakingRepo.AddToQueue(ctx, req.Player.ID); err != nil {
+	if err := h.addToQueue(ctx, req.Player.ID, pool); err != nil {
 		slog.ErrorContext(ctx, "Failed to add player to queue", "player.id", req.Player.ID, "error", err)
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to add player to queue")
 	}
 }
+
+// addToQueue queues a player for matchmaking with their current rating.
+func (h *Hub) addToQueue(ctx context.Context, playerID, pool string) error {
+	rating, err := h.ratings.MatchmakingRating(ctx, playerID)
+	if err != nil {
+		return err
+	}
+	return h.matchmakingRepo.AddToQueue(ctx, playerID, pool, rating)
+}
+
+// registerSpectator lets a connection watch a room. Rooms whose players are all
+// on other servers get a local handler, so the spectator receives the updates
+// published for the room like any local player would.
+func (h *Hub) registerSpectator(ctx context.Context, req *types.RegistrationRequest) {
+	roomID := req.SpectateRoomID
+	ctx, span := tracer.Start(ctx, "hub.registerSpectator", trace.WithAttributes(
+		attribute.String("player.id", req.Player.ID),
+		attribute.String("room.id", roomID),
+	))
+	defer span.End()
+
+	s := req.Player
+	if _, err := h.gameRepo.AddSpectator(ctx, roomID, room.MaxSpectators); err != nil {
+		slog.WarnContext(ctx, "Rejected spectator", "player.id", s.ID, "room.id", roomID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected spectator")
+		code := proto.CloseRoomNotFound
+		if errors.Is(err, repository.ErrRoomFull) {
+			code = proto.CloseRoomFull
+		}
+		closeConnection(s, code, err.Error())
+		return
+	}
+
+	r, ok := h.localRooms[roomID]
+	if !ok {
+		r = room.NewRoom(roomID, h.rdb, h.gameRepo, h.playerRepo, h.gameOverHandler, h.chat)
+		h.startRoom(ctx, r)
+	}
+	r.AddSpectator(s)
+	go r.SpectatorReadPump(s, h.spectatorLeft)
+	slog.InfoContext(ctx, "Spectator joined room", "player.id", s.ID, "room.id", roomID)
+
+	data, _ := json.Marshal(&proto.ServerToClientMessage{Type: "spectating"})
+	if err := s.Send(data); err != nil {
+		slog.ErrorContext(ctx, "Error sending spectating message", "player.id", s.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error sending spectating message")
+	}
+	r.SendChatHistory(ctx, s)
+	// The published update carries the new spectator count to everyone in the
+	// room, including the new spectator.
+	r.PublishUpdate(ctx)
+}
+
+// joinPrivateRoom seats a player in the private room of an invite code. The
+// player who completes the room starts its game, which reaches both players
+// through the usual match_made event.
+func (h *Hub) joinPrivateRoom(ctx context.Context, req *types.RegistrationRequest) {
+	ctx, span := tracer.Start(ctx, "hub.joinPrivateRoom", trace.WithAttributes(
+		attribute.String("player.id", req.Player.ID),
+	))
+	defer span.End()
+
+	p := req.Player
+	invite, err := h.inviteRepo.Join(ctx, req.JoinCode, p.ID)
+	if err != nil {
+		slog.WarnContext(ctx, "Player could not join private room", "player.id", p.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Could not join private room")
+
+		code := websocket.CloseInternalServerErr
+		switch {
+		case errors.Is(err, repository.ErrInviteNotFound):
+			code = proto.CloseRoomNotFound
+		case errors.Is(err, repository.ErrInviteTaken):
+			code = proto.CloseRoomFull
+		}
+		delete(h.localPlayers, p.ID)
+		if err := h.playerRepo.SetOffline(ctx, p.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to set player status to offline", "player.id", p.ID, "error", err)
+		}
+		closeConnection(p, code, err.Error())
+		return
+	}
+
+	if invite == nil {
+		slog.InfoContext(ctx, "Player is waiting in private room", "player.id", p.ID)
+		data, _ := json.Marshal(&proto.ServerToClientMessage{Type: "invite_waiting"})
+		if err := p.Send(data); err != nil {
+			slog.ErrorContext(ctx, "Error sending invite_waiting to player", "player.id", p.ID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Error sending invite_waiting")
+		}
+		return
+	}
+
+	if err := h.startPrivateGame(ctx, invite); err != nil {
+		slog.ErrorContext(ctx, "Failed to start private game", "player.id", p.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to start private game")
+	}
+}
+
+// startPrivateGame creates the game of a private room with the host's settings.
+// The host plays X.
+func (h *Hub) startPrivateGame(ctx context.Context, invite *repository.Invite) error {
+	var settings repository.RoomSettings
+	switch invite.FirstMove {
+	case repository.FirstMoveHost:
+		settings.FirstTurn = game.PlayerX
+	case repository.FirstMoveGuest:
+		settings.FirstTurn = game.PlayerO
+	}
+
+	roomID := uuid.New().String()
+	if err := h.gameRepo.Create(ctx, roomID, invite.HostID, invite.GuestID, invite.Config, settings); err != nil {
+		return err
+	}
+
+	for _, playerID := range []string{invite.HostID, invite.GuestID} {
+		if err := h.playerRepo.UpdateForMatch(ctx, playerID, roomID); err != nil {
+			slog.ErrorContext(ctx, "Failed to update player state for match", "player.id", playerID, "error", err)
+		}
+	}
+
+	slog.InfoContext(ctx, "Private room started", "room.id", roomID, "player1.id", invite.HostID, "player2.id", invite.GuestID)
+	return h.publishMatchMade(ctx, roomID, invite.HostID, invite.GuestID)
+}
@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/room"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServerHeartbeatInterval is how often the server renews its entry in the
+// server registry. It must be well below repository.ServerTTL.
+var ServerHeartbeatInterval = 5 * time.Second
+
+// orphanedRoom is a room whose players on a dead server are to be adopted.
+type orphanedRoom struct {
+	RoomID    string
+	PlayerIDs []string
+}
+
+// runRegistry keeps this server in the server registry. The server holding
+// the janitor lease also reaps the servers that stopped heartbeating.
+func (h *Hub) runRegistry(ctx context.Context) {
+	defer close(h.registryDone)
+	ticker := time.NewTicker(ServerHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.servers.Heartbeat(ctx, h.serverID); err != nil {
+			slog.ErrorContext(ctx, "Failed to heartbeat into server registry", "server.id", h.serverID, "error", err)
+		} else if janitor, err := h.servers.AcquireJanitor(ctx, h.serverID); err != nil {
+			slog.ErrorContext(ctx, "Failed to acquire janitor lease", "server.id", h.serverID, "error", err)
+		} else if janitor {
+			h.reapDeadServers(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reapDeadServers takes over the players of every server whose registry entry
+// expired.
+func (h *Hub) reapDeadServers(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "hub.reapDeadServers")
+	defer span.End()
+
+	dead, err := h.servers.Expired(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to find dead servers", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to find dead servers")
+		return
+	}
+	for _, serverID := range dead {
+		if err := h.reapServer(ctx, serverID); err != nil {
+			slog.ErrorContext(ctx, "Failed to reap dead server", "server.id", serverID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to reap dead server")
+			continue
+		}
+		if err := h.servers.Forget(ctx, serverID); err != nil {
+			slog.ErrorContext(ctx, "Failed to forget dead server", "server.id", serverID, "error", err)
+		}
+	}
+}
+
+// reapServer marks the players of a dead server disconnected and has this
+// server adopt their rooms, so their games go on when they reconnect to any
+// server and are forfeited when they don't. Players who weren't in a room
+// leave the matchmaking queue.
+func (h *Hub) reapServer(ctx context.Context, serverID string) error {
+	ctx, span := tracer.Start(ctx, "hub.reapServer", trace.WithAttributes(
+		attribute.String("server.id", serverID),
+	))
+	defer span.End()
+
+	lost, err := h.playerRepo.DisconnectServer(ctx, serverID)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to disconnect players of dead server")
+		return err
+	}
+	slog.WarnContext(ctx, "Server stopped heartbeating, taking over its players", "server.id", serverID, "players.count", len(lost))
+
+	var orphans []orphanedRoom
+	byRoom := make(map[string]int)
+	for _, lp := range lost {
+		if lp.RoomID == "" {
+			if err := h.matchmakingRepo.RemoveFromQueue(ctx, lp.PlayerID); err != nil {
+				slog.WarnContext(ctx, "Failed to remove player of dead server from matchmaking queue", "player.id", lp.PlayerID, "error", err)
+			}
+			continue
+		}
+
+		// Servers hosting the opponent let them know, as when the player's
+		// own server notices a disconnect.
+		if err := h.publishEvent(ctx, "player_disconnected", events.PlayerDisconnectedPayload{RoomID: lp.RoomID, PlayerID: lp.PlayerID}); err != nil {
+			slog.ErrorContext(ctx, "Failed to publish player_disconnected event", "player.id", lp.PlayerID, "room.id", lp.RoomID, "error", err)
+			span.RecordError(err)
+		}
+
+		i, ok := byRoom[lp.RoomID]
+		if !ok {
+			i = len(orphans)
+			byRoom[lp.RoomID] = i
+			orphans = append(orphans, orphanedRoom{RoomID: lp.RoomID})
+		}
+		orphans[i].PlayerIDs = append(orphans[i].PlayerIDs, lp.PlayerID)
+	}
+
+	for _, o := range orphans {
+		select {
+		case h.orphans <- o:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// adoptRoom hosts a room of a dead server's players on this server, adding
+// them as absent players so the room settles their game if they don't come
+// back. Players who reconnect, here or elsewhere, take their place. The bots
+// of a bot game are seated again, so the game goes on if its player returns.
+func (h *Hub) adoptRoom(ctx context.Context, o orphanedRoom) {
+	ctx, span := tracer.Start(ctx, "hub.adoptRoom", trace.WithAttributes(
+		attribute.String("room.id", o.RoomID),
+		attribute.Int("player.count", len(o.PlayerIDs)),
+	))
+	defer span.End()
+
+	r, ok := h.localRooms[o.RoomID]
+	if !ok {
+		r = room.NewRoom(o.RoomID, h.rdb, h.gameRepo, h.playerRepo, h.gameOverHandler, h.chat)
+	}
+	for _, playerID := range o.PlayerIDs {
+		r.AddAbsentPlayer(playerID)
+	}
+	if !ok {
+		h.startRoom(ctx, r)
+	}
+	if bots := h.addBots(ctx, r); len(bots) > 0 {
+		h.sendInitialRoomState(ctx, r, bots)
+	}
+	slog.InfoContext(ctx, "Adopted room of dead server", "room.id", o.RoomID, "players", o.PlayerIDs)
+}
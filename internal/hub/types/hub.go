@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"ctchen222/Tic-Tac-Toe/internal/game"
 	"ctchen222/Tic-Tac-Toe/internal/player"
 )
 
@@ -11,7 +12,12 @@ type RegistrationRequest struct {
 	PlayerID   string
 	Mode       string
 	Difficulty string
-	Ctx        context.Context
+	Config     game.Config
+	// SpectateRoomID is set when the connection watches a room instead of playing.
+	SpectateRoomID string
+	// JoinCode is set when the player joins a private room instead of the queue.
+	JoinCode string
+	Ctx      context.Context
 }
 
 // PlayerMove is a message from a player, bundled with the player object.
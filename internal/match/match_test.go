@@ -1,7 +1,7 @@
 package match
 
 import (
-	"ctchen222/Tic-Tac-Toe/internal/room"
+	"ctchen222/Tic-Tac-Toe/internal/player"
 	"testing"
 	"time"
 )
@@ -10,9 +10,9 @@ func TestMatchManager_AddThreePlayers(t *testing.T) {
 	mm := NewMatchManager()
 	go mm.Run()
 
-	player1 := &room.Player{ID: "player1"}
-	player2 := &room.Player{ID: "player2"}
-	player3 := &room.Player{ID: "player3"}
+	player1 := &player.Player{ID: "player1"}
+	player2 := &player.Player{ID: "player2"}
+	player3 := &player.Player{ID: "player3"}
 
 	mm.AddPlayer(player1)
 	mm.AddPlayer(player2)
@@ -44,8 +44,8 @@ func TestMatchManager_MatchPlayers(t *testing.T) {
 	mm := NewMatchManager()
 	go mm.Run()
 
-	player1 := &room.Player{ID: "player1"}
-	player2 := &room.Player{ID: "player2"}
+	player1 := &player.Player{ID: "player1"}
+	player2 := &player.Player{ID: "player2"}
 
 	mm.AddPlayer(player1)
 	mm.AddPlayer(player2)
@@ -70,7 +70,7 @@ func TestMatchManager_RemovePlayerFromSingleList(t *testing.T) {
 	mm := NewMatchManager()
 	go mm.Run()
 
-	player1 := &room.Player{ID: "player1"}
+	player1 := &player.Player{ID: "player1"}
 
 	mm.AddPlayer(player1)
 	time.Sleep(10 * time.Millisecond) // allow time for the player to be added
@@ -89,7 +89,7 @@ func TestMatchManager_RemoveNonExistentPlayer(t *testing.T) {
 	mm := NewMatchManager()
 	go mm.Run()
 
-	player1 := &room.Player{ID: "player1"}
+	player1 := &player.Player{ID: "player1"}
 
 	mm.AddPlayer(player1)
 	time.Sleep(10 * time.Millisecond) // allow time for the player to be added
@@ -0,0 +1,100 @@
+package player
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	// HeartbeatInterval is how often players are pinged.
+	HeartbeatInterval = 10 * time.Second
+	// MissedHeartbeats is how many pings in a row a player may leave
+	// unanswered before their connection is considered dead.
+	MissedHeartbeats = 3
+)
+
+var rttHistogram metric.Float64Histogram
+
+func init() {
+	var err error
+	rttHistogram, err = otel.Meter("player").Float64Histogram("player_rtt_seconds", metric.WithDescription("Round-trip time of pings to players."), metric.WithUnit("s"))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// heartbeatConn is implemented by connections that answer pings, such as
+// *websocket.Conn.
+type heartbeatConn interface {
+	SetReadDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+}
+
+// readTimeout is how long a player may stay silent before the read fails.
+func readTimeout() time.Duration {
+	return HeartbeatInterval * time.Duration(MissedHeartbeats)
+}
+
+// ReadMessage reads the player's next message. Every frame, pongs included,
+// counts as contact: it updates LastSeen and extends the read deadline, so the
+// read fails once the player missed MissedHeartbeats pings in a row.
+func (p *Player) ReadMessage() (int, []byte, error) {
+	if hc, ok := p.Conn.(heartbeatConn); ok {
+		p.pongOnce.Do(func() {
+			hc.SetPongHandler(func(appData string) error {
+				p.handlePong(appData, time.Now())
+				return hc.SetReadDeadline(time.Now().Add(readTimeout()))
+			})
+		})
+		hc.SetReadDeadline(time.Now().Add(readTimeout()))
+	}
+
+	messageType, data, err := p.Conn.ReadMessage()
+	if err == nil {
+		p.touch(time.Now())
+	}
+	return messageType, data, err
+}
+
+// handlePong records a pong answering a ping sent with pingPayload.
+func (p *Player) handlePong(appData string, now time.Time) {
+	p.touch(now)
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := now.Sub(time.Unix(0, sent))
+	if rtt < 0 {
+		return
+	}
+	p.rtt.Store(int64(rtt))
+	rttHistogram.Record(context.Background(), rtt.Seconds())
+}
+
+// pingPayload is the payload of a ping sent at now, echoed back by the pong.
+func pingPayload(now time.Time) []byte {
+	return []byte(strconv.FormatInt(now.UnixNano(), 10))
+}
+
+// touch records contact with the player at now.
+func (p *Player) touch(now time.Time) {
+	p.lastSeen.Store(now.UnixNano())
+}
+
+// LastSeen returns when the player was last heard from.
+func (p *Player) LastSeen() time.Time {
+	if ns := p.lastSeen.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// RTT returns the round-trip time of the player's last answered ping, or zero
+// before they answered one.
+func (p *Player) RTT() time.Duration {
+	return time.Duration(p.rtt.Load())
+}
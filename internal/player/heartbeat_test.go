@@ -0,0 +1,90 @@
+package player
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// pongingConn answers every read with a pong for a ping sent rtt ago, then
+// the queued message.
+type pongingConn struct {
+	rtt         time.Duration
+	messages    []string
+	pongHandler func(string) error
+	deadline    time.Time
+}
+
+func (c *pongingConn) WriteMessage(int, []byte) error { return nil }
+func (c *pongingConn) Close() error                   { return nil }
+
+func (c *pongingConn) SetReadDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *pongingConn) SetPongHandler(h func(string) error) {
+	c.pongHandler = h
+}
+
+func (c *pongingConn) ReadMessage() (int, []byte, error) {
+	sent := time.Now().Add(-c.rtt)
+	if err := c.pongHandler(strconv.FormatInt(sent.UnixNano(), 10)); err != nil {
+		return 0, nil, err
+	}
+	if len(c.messages) == 0 {
+		return 0, nil, errors.New("closed")
+	}
+	msg := c.messages[0]
+	c.messages = c.messages[1:]
+	return 1, []byte(msg), nil
+}
+
+func TestReadMessageTracksContact(t *testing.T) {
+	conn := &pongingConn{rtt: 40 * time.Millisecond, messages: []string{"move"}}
+	p := &Player{ID: "p1", Conn: conn}
+	if !p.LastSeen().IsZero() {
+		t.Fatalf("LastSeen() = %v before any contact, want zero", p.LastSeen())
+	}
+
+	before := time.Now()
+	_, data, err := p.ReadMessage()
+	if err != nil || string(data) != "move" {
+		t.Fatalf("ReadMessage() = %q, %v, want the message", data, err)
+	}
+
+	if p.LastSeen().Before(before) {
+		t.Errorf("LastSeen() = %v, want after %v", p.LastSeen(), before)
+	}
+	if rtt := p.RTT(); rtt < 40*time.Millisecond || rtt > time.Second {
+		t.Errorf("RTT() = %v, want about 40ms", rtt)
+	}
+	if want := before.Add(readTimeout()); conn.deadline.Before(want) {
+		t.Errorf("read deadline = %v, want at least %v", conn.deadline, want)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	defer func(interval time.Duration, missed int) {
+		HeartbeatInterval, MissedHeartbeats = interval, missed
+	}(HeartbeatInterval, MissedHeartbeats)
+
+	HeartbeatInterval, MissedHeartbeats = 5*time.Second, 4
+	if got := readTimeout(); got != 20*time.Second {
+		t.Errorf("readTimeout() = %v, want 20s", got)
+	}
+}
+
+func TestHandlePongIgnoresForeignPayloads(t *testing.T) {
+	p := &Player{ID: "p1"}
+	now := time.Now()
+	p.handlePong("not a timestamp", now)
+
+	if p.RTT() != 0 {
+		t.Errorf("RTT() = %v, want zero for a pong without a timestamp", p.RTT())
+	}
+	if !p.LastSeen().Equal(now) {
+		t.Errorf("LastSeen() = %v, want %v", p.LastSeen(), now)
+	}
+}
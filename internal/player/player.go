@@ -1,6 +1,10 @@
 package player
 
-import "time"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Connection is an interface that abstracts the websocket connection.
 type Connection interface {
@@ -17,22 +21,46 @@ const (
 	StatusDisconnected PlayerStatus = "disconnected"
 )
 
-// Player represents a player in a room.
+// Player represents a player in a room. Messages to the player go through Send
+// and its siblings, so only one goroutine ever writes to Conn.
 type Player struct {
-	ID       string
-	Conn     Connection
-	Status   PlayerStatus
-	LastSeen time.Time
-	IsBot    bool
+	ID    string
+	Conn  Connection
+	IsBot bool
+	// Difficulty is the difficulty a bot plays at. It is empty for humans.
+	Difficulty string
+
+	writerOnce sync.Once
+	w          *writer
+	closeOnce  sync.Once
+
+	pongOnce sync.Once
+	// lastSeen and rtt are in nanoseconds, as they are updated by the
+	// goroutine reading from the player.
+	lastSeen atomic.Int64
+	rtt      atomic.Int64
+	status   atomic.Value
 }
 
 // NewPlayer creates a new player instance.
 func NewPlayer(id string, conn Connection) *Player {
-	return &Player{
-		ID:       id,
-		Conn:     conn,
-		Status:   StatusConnected,
-		LastSeen: time.Now(),
-		IsBot:    false, // Defaults to human player
+	p := &Player{
+		ID:    id,
+		Conn:  conn,
+		IsBot: false, // Defaults to human player
 	}
+	p.SetStatus(StatusConnected)
+	p.touch(time.Now())
+	return p
+}
+
+// Status returns the player's connection status.
+func (p *Player) Status() PlayerStatus {
+	status, _ := p.status.Load().(PlayerStatus)
+	return status
+}
+
+// SetStatus sets the player's connection status.
+func (p *Player) SetStatus(status PlayerStatus) {
+	p.status.Store(status)
 }
@@ -0,0 +1,200 @@
+package player
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// SendQueueSize is how many messages may wait to be written to a player.
+	// A player who falls further behind is disconnected as a slow consumer.
+	SendQueueSize = 64
+	// WriteWait is how long a single write to a player may take.
+	WriteWait = 10 * time.Second
+)
+
+var (
+	// ErrSendQueueFull is returned when a player was disconnected for not
+	// reading their messages fast enough.
+	ErrSendQueueFull = errors.New("send queue full")
+	// ErrConnectionClosed is returned for messages sent to a closed connection.
+	ErrConnectionClosed = errors.New("connection closed")
+)
+
+// writeDeadliner is implemented by connections with write deadlines, such as
+// *websocket.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+type frameKind int
+
+const (
+	frameMessage frameKind = iota
+	// frameState carries the whole game state, so a newer one supersedes it.
+	frameState
+	framePing
+	frameClose
+)
+
+type frame struct {
+	kind frameKind
+	data []byte
+}
+
+// writer is the outbound queue of a player, drained by the player's only
+// goroutine that writes to their connection.
+type writer struct {
+	mu     sync.Mutex
+	queue  []frame
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// Send queues a text message for the player.
+func (p *Player) Send(data []byte) error {
+	return p.enqueue(frame{kind: frameMessage, data: data})
+}
+
+// SendState queues a text message carrying the whole game state. A state
+// still waiting to be written is dropped, as this one supersedes it.
+func (p *Player) SendState(data []byte) error {
+	return p.enqueue(frame{kind: frameState, data: data})
+}
+
+// Ping queues a ping, unless one is already waiting to be written.
+func (p *Player) Ping() error {
+	return p.enqueue(frame{kind: framePing})
+}
+
+// Disconnect sends the player a close frame with code and reason after the
+// messages already queued, then closes the connection.
+func (p *Player) Disconnect(code int, reason string) error {
+	return p.enqueue(frame{kind: frameClose, data: websocket.FormatCloseMessage(code, reason)})
+}
+
+// Close drops the player's queued messages and closes the connection. It is
+// safe to call more than once.
+func (p *Player) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		w := p.writer()
+		w.mu.Lock()
+		w.closed = true
+		w.queue = nil
+		w.mu.Unlock()
+		close(w.done)
+		if p.Conn != nil {
+			err = p.Conn.Close()
+		}
+	})
+	return err
+}
+
+// writer returns the player's outbound queue, starting its goroutine the
+// first time.
+func (p *Player) writer() *writer {
+	p.writerOnce.Do(func() {
+		p.w = &writer{wake: make(chan struct{}, 1), done: make(chan struct{})}
+		go p.writePump(p.w)
+	})
+	return p.w
+}
+
+func (p *Player) enqueue(f frame) error {
+	w := p.writer()
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrConnectionClosed
+	}
+	if f.kind == frameState || f.kind == framePing {
+		kept := w.queue[:0]
+		for _, queued := range w.queue {
+			if queued.kind != f.kind {
+				kept = append(kept, queued)
+			}
+		}
+		w.queue = kept
+	}
+	if len(w.queue) >= SendQueueSize && f.kind != frameClose {
+		w.mu.Unlock()
+		slog.Warn("Player is too slow to keep up, disconnecting", "player.id", p.ID, "queue.size", SendQueueSize)
+		p.Close()
+		return ErrSendQueueFull
+	}
+	if f.kind == frameClose {
+		w.closed = true
+	}
+	w.queue = append(w.queue, f)
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// next takes the next frame off the queue.
+func (w *writer) next() (frame, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.queue) == 0 {
+		return frame{}, false
+	}
+	f := w.queue[0]
+	w.queue = w.queue[1:]
+	return f, true
+}
+
+// writePump writes the player's queued frames until the connection is closed
+// or a write fails.
+func (p *Player) writePump(w *writer) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		}
+
+		for {
+			f, ok := w.next()
+			if !ok {
+				break
+			}
+			if err := p.write(f); err != nil {
+				slog.Warn("Failed to write to player, closing connection", "player.id", p.ID, "error", err)
+				p.Close()
+				return
+			}
+			if f.kind == frameClose {
+				p.Close()
+				return
+			}
+		}
+	}
+}
+
+func (p *Player) write(f frame) error {
+	if p.Conn == nil {
+		return ErrConnectionClosed
+	}
+	if d, ok := p.Conn.(writeDeadliner); ok {
+		d.SetWriteDeadline(time.Now().Add(WriteWait))
+	}
+
+	switch f.kind {
+	case framePing:
+		return p.Conn.WriteMessage(websocket.PingMessage, pingPayload(time.Now()))
+	case frameClose:
+		return p.Conn.WriteMessage(websocket.CloseMessage, f.data)
+	default:
+		return p.Conn.WriteMessage(websocket.TextMessage, f.data)
+	}
+}
@@ -0,0 +1,169 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingConn records the messages written to it and fails the test if two
+// goroutines ever write at once. Writes block until release is closed, if set.
+type recordingConn struct {
+	t       *testing.T
+	release chan struct{}
+	writing atomic.Int32
+
+	mu       sync.Mutex
+	messages []string
+	closed   bool
+}
+
+func (c *recordingConn) WriteMessage(messageType int, data []byte) error {
+	if c.writing.Add(1) > 1 {
+		c.t.Error("concurrent writes to the connection")
+	}
+	defer c.writing.Add(-1)
+	if c.release != nil {
+		<-c.release
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("closed")
+	}
+	c.messages = append(c.messages, string(data))
+	return nil
+}
+
+func (c *recordingConn) ReadMessage() (int, []byte, error) { return 0, nil, errors.New("not readable") }
+
+func (c *recordingConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *recordingConn) snapshot() ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.messages...), c.closed
+}
+
+// waitFor polls until cond holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the writer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSendFromManyGoroutines(t *testing.T) {
+	conn := &recordingConn{t: t}
+	p := NewPlayer("p1", conn)
+
+	const senders, perSender = 8, 5
+	var wg sync.WaitGroup
+	for i := range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perSender {
+				if err := p.Send([]byte(fmt.Sprintf("%d-%d", i, j))); err != nil {
+					t.Errorf("Send() returned error: %v", err)
+				}
+				p.SendState([]byte("state"))
+				p.Ping()
+			}
+		}()
+	}
+	wg.Wait()
+
+	waitFor(t, func() bool {
+		messages, _ := conn.snapshot()
+		sent := 0
+		for _, m := range messages {
+			if strings.Contains(m, "-") {
+				sent++
+			}
+		}
+		return sent == senders*perSender
+	})
+}
+
+func TestSendStateSupersedesQueuedState(t *testing.T) {
+	conn := &recordingConn{t: t, release: make(chan struct{})}
+	p := NewPlayer("p1", conn)
+
+	p.Send([]byte("first"))
+	waitFor(t, func() bool { return conn.writing.Load() == 1 })
+	p.Send([]byte("notice"))
+	p.SendState([]byte("state 1"))
+	p.SendState([]byte("state 2"))
+	p.Send([]byte("chat"))
+	close(conn.release)
+
+	want := []string{"first", "notice", "state 2", "chat"}
+	waitFor(t, func() bool {
+		messages, _ := conn.snapshot()
+		return len(messages) == len(want)
+	})
+	messages, _ := conn.snapshot()
+	for i := range want {
+		if messages[i] != want[i] {
+			t.Fatalf("written %q, want %q", messages, want)
+		}
+	}
+}
+
+func TestSlowConsumerIsDisconnected(t *testing.T) {
+	defer func(size int) { SendQueueSize = size }(SendQueueSize)
+	SendQueueSize = 2
+
+	conn := &recordingConn{t: t, release: make(chan struct{})}
+	defer close(conn.release)
+	p := NewPlayer("p1", conn)
+
+	p.Send([]byte("in flight"))
+	waitFor(t, func() bool { return conn.writing.Load() == 1 })
+	p.Send([]byte("queued 1"))
+	p.Send([]byte("queued 2"))
+
+	if err := p.Send([]byte("one too many")); !errors.Is(err, ErrSendQueueFull) {
+		t.Fatalf("Send() to a full queue returned %v, want ErrSendQueueFull", err)
+	}
+	if _, closed := conn.snapshot(); !closed {
+		t.Error("slow consumer's connection is still open")
+	}
+	if err := p.Send([]byte("after")); !errors.Is(err, ErrConnectionClosed) {
+		t.Errorf("Send() after disconnect returned %v, want ErrConnectionClosed", err)
+	}
+}
+
+func TestDisconnectFlushesQueue(t *testing.T) {
+	conn := &recordingConn{t: t}
+	p := NewPlayer("p1", conn)
+
+	p.Send([]byte("bye"))
+	if err := p.Disconnect(1000, "game over"); err != nil {
+		t.Fatalf("Disconnect() returned error: %v", err)
+	}
+
+	waitFor(t, func() bool {
+		_, closed := conn.snapshot()
+		return closed
+	})
+	messages, _ := conn.snapshot()
+	if len(messages) != 2 || messages[0] != "bye" {
+		t.Errorf("written %q, want the message and then the close frame", messages)
+	}
+}
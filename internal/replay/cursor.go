@@ -0,0 +1,116 @@
+package replay
+
+import (
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// MinSpeed and MaxSpeed bound the playback speed.
+	MinSpeed = 0.25
+	MaxSpeed = 8.0
+	// baseInterval is the time between moves at speed 1.
+	baseInterval = time.Second
+)
+
+// ErrInvalidCommand is returned for replay commands that can't be carried out.
+var ErrInvalidCommand = errors.New("invalid replay command")
+
+// Cursor steps through the frames of a replay. Playback starts from the empty
+// board and stops at the last frame. A Cursor is not safe for concurrent use.
+type Cursor struct {
+	frames  []proto.ServerToClientMessage
+	ply     int
+	playing bool
+	speed   float64
+}
+
+// NewCursor creates a cursor at the first frame, playing at the given speed.
+func NewCursor(frames []proto.ServerToClientMessage, speed float64) *Cursor {
+	return &Cursor{
+		frames:  frames,
+		playing: len(frames) > 1,
+		speed:   ClampSpeed(speed),
+	}
+}
+
+// ClampSpeed returns speed within MinSpeed and MaxSpeed, or 1 when it isn't positive.
+func ClampSpeed(speed float64) float64 {
+	if speed <= 0 {
+		return 1
+	}
+	return min(max(speed, MinSpeed), MaxSpeed)
+}
+
+// Frame returns the current frame with the playback state filled in.
+func (c *Cursor) Frame() proto.ServerToClientMessage {
+	frame := c.frames[c.ply]
+	state := proto.ReplayState{}
+	if frame.Replay != nil {
+		state = *frame.Replay
+	}
+	state.Ply = c.ply
+	state.Plies = len(c.frames) - 1
+	state.Playing = c.playing
+	state.Speed = c.speed
+	frame.Replay = &state
+	return frame
+}
+
+// Playing reports whether the replay advances on its own.
+func (c *Cursor) Playing() bool {
+	return c.playing
+}
+
+// Interval is the time until the next frame while playing.
+func (c *Cursor) Interval() time.Duration {
+	return time.Duration(float64(baseInterval) / c.speed)
+}
+
+// Advance moves to the next frame, stopping playback at the last one.
+func (c *Cursor) Advance() {
+	c.seek(c.ply + 1)
+}
+
+// Handle applies a "play", "pause", "seek", "step" or "speed" command.
+func (c *Cursor) Handle(msg proto.ClientToServerMessage) error {
+	switch msg.Type {
+	case "play":
+		if c.ply == len(c.frames)-1 {
+			c.ply = 0
+		}
+		c.playing = len(c.frames) > 1
+	case "pause":
+		c.playing = false
+	case "seek":
+		if msg.Ply == nil || *msg.Ply < 0 || *msg.Ply >= len(c.frames) {
+			return fmt.Errorf("%w: seek needs a ply from 0 to %d", ErrInvalidCommand, len(c.frames)-1)
+		}
+		c.seek(*msg.Ply)
+	case "step":
+		steps := msg.Steps
+		if steps == 0 {
+			steps = 1
+		}
+		c.playing = false
+		c.seek(min(max(c.ply+steps, 0), len(c.frames)-1))
+	case "speed":
+		if msg.Speed <= 0 {
+			return fmt.Errorf("%w: speed must be positive", ErrInvalidCommand)
+		}
+		c.speed = ClampSpeed(msg.Speed)
+	default:
+		return fmt.Errorf("%w: unknown command %q", ErrInvalidCommand, msg.Type)
+	}
+	return nil
+}
+
+// seek moves to a frame, stopping playback at the last one.
+func (c *Cursor) seek(ply int) {
+	c.ply = min(ply, len(c.frames)-1)
+	if c.ply == len(c.frames)-1 {
+		c.playing = false
+	}
+}
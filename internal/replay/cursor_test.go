@@ -0,0 +1,93 @@
+package replay
+
+import (
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testFrames(n int) []proto.ServerToClientMessage {
+	frames := make([]proto.ServerToClientMessage, n)
+	for i := range frames {
+		frames[i] = proto.ServerToClientMessage{Type: "update", Replay: &proto.ReplayState{GameID: "game-1", Ply: i, Plies: n - 1}}
+	}
+	return frames
+}
+
+func ply(n int) *int {
+	return &n
+}
+
+func TestCursorPlaysToTheEnd(t *testing.T) {
+	c := NewCursor(testFrames(3), 2)
+	if !c.Playing() || c.Interval() != 500*time.Millisecond {
+		t.Fatalf("new cursor playing=%v interval=%v, want playing every 500ms", c.Playing(), c.Interval())
+	}
+
+	c.Advance()
+	c.Advance()
+	frame := c.Frame()
+	if frame.Replay.Ply != 2 || frame.Replay.Plies != 2 || frame.Replay.Playing || c.Playing() {
+		t.Errorf("after playing through got %+v, want stopped at the last ply", frame.Replay)
+	}
+	if frame.Replay.GameID != "game-1" || frame.Replay.Speed != 2 {
+		t.Errorf("frame replay state = %+v, want the game ID and speed kept", frame.Replay)
+	}
+
+	// Playing from the end starts over.
+	if err := c.Handle(proto.ClientToServerMessage{Type: "play"}); err != nil {
+		t.Fatalf("Handle(play) returned error: %v", err)
+	}
+	if c.Frame().Replay.Ply != 0 || !c.Playing() {
+		t.Errorf("play at the end got %+v, want playing from ply 0", c.Frame().Replay)
+	}
+}
+
+func TestCursorCommands(t *testing.T) {
+	c := NewCursor(testFrames(5), 1)
+
+	steps := []struct {
+		msg         proto.ClientToServerMessage
+		wantPly     int
+		wantPlaying bool
+	}{
+		{proto.ClientToServerMessage{Type: "pause"}, 0, false},
+		{proto.ClientToServerMessage{Type: "step"}, 1, false},
+		{proto.ClientToServerMessage{Type: "step", Steps: 2}, 3, false},
+		{proto.ClientToServerMessage{Type: "step", Steps: -10}, 0, false},
+		{proto.ClientToServerMessage{Type: "seek", Ply: ply(3)}, 3, false},
+		{proto.ClientToServerMessage{Type: "play"}, 3, true},
+		{proto.ClientToServerMessage{Type: "seek", Ply: ply(1)}, 1, true},
+		{proto.ClientToServerMessage{Type: "seek", Ply: ply(4)}, 4, false},
+		{proto.ClientToServerMessage{Type: "step", Steps: 3}, 4, false},
+	}
+	for _, step := range steps {
+		if err := c.Handle(step.msg); err != nil {
+			t.Fatalf("Handle(%+v) returned error: %v", step.msg, err)
+		}
+		if got := c.Frame().Replay; got.Ply != step.wantPly || got.Playing != step.wantPlaying {
+			t.Errorf("after %+v got ply %d playing %v, want ply %d playing %v", step.msg, got.Ply, got.Playing, step.wantPly, step.wantPlaying)
+		}
+	}
+
+	if err := c.Handle(proto.ClientToServerMessage{Type: "speed", Speed: 100}); err != nil {
+		t.Fatalf("Handle(speed) returned error: %v", err)
+	}
+	if c.Frame().Replay.Speed != MaxSpeed {
+		t.Errorf("speed = %v, want it clamped to %v", c.Frame().Replay.Speed, MaxSpeed)
+	}
+
+	invalid := []proto.ClientToServerMessage{
+		{Type: "seek"},
+		{Type: "seek", Ply: ply(5)},
+		{Type: "seek", Ply: ply(-1)},
+		{Type: "speed"},
+		{Type: "move"},
+	}
+	for _, msg := range invalid {
+		if err := c.Handle(msg); !errors.Is(err, ErrInvalidCommand) {
+			t.Errorf("Handle(%+v) returned %v, want ErrInvalidCommand", msg, err)
+		}
+	}
+}
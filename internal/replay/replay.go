@@ -0,0 +1,132 @@
+// Package replay plays archived games back to a WebSocket client.
+package replay
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("replay")
+
+// Serve streams the frames of a game over conn, one move per interval, until
+// the client disconnects. The client controls playback with "play", "pause",
+// "seek", "step" and "speed" messages; every command is answered with the
+// frame it leads to, or an "error" message. The client is pinged like a player
+// and dropped once it misses player.MissedHeartbeats pings in a row. When ctx
+// is done, as when the server drains, the client is told to reconnect
+// elsewhere. Serve closes conn when it returns.
+func Serve(ctx context.Context, conn *websocket.Conn, gameID string, frames []proto.ServerToClientMessage, speed float64) {
+	ctx, span := tracer.Start(ctx, "replay.Serve", trace.WithAttributes(
+		attribute.String("game.id", gameID),
+		attribute.Int("replay.frames", len(frames)),
+	))
+	defer span.End()
+	defer conn.Close()
+
+	commands := make(chan proto.ClientToServerMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go readCommands(conn, commands, done)
+
+	pingTicker := time.NewTicker(player.HeartbeatInterval)
+	defer pingTicker.Stop()
+
+	cursor := NewCursor(frames, speed)
+	if !send(ctx, conn, cursor.Frame()) {
+		return
+	}
+	slog.InfoContext(ctx, "Replay started", "game.id", gameID, "replay.speed", speed)
+
+	// tick outlives pings, so they don't hold the next move back.
+	var tick <-chan time.Time
+	for {
+		if tick == nil && cursor.Playing() {
+			tick = time.After(cursor.Interval())
+		}
+
+		select {
+		case msg, ok := <-commands:
+			tick = nil
+			if !ok {
+				slog.InfoContext(ctx, "Replay client disconnected", "game.id", gameID)
+				return
+			}
+			if err := cursor.Handle(msg); err != nil {
+				if !send(ctx, conn, proto.ServerToClientMessage{Type: "error", Reason: err.Error()}) {
+					return
+				}
+				continue
+			}
+		case <-tick:
+			tick = nil
+			cursor.Advance()
+		case <-pingTicker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(player.WriteWait)); err != nil {
+				slog.WarnContext(ctx, "Failed to ping replay client", "game.id", gameID, "error", err)
+				return
+			}
+			continue
+		case <-ctx.Done():
+			slog.InfoContext(ctx, "Replay stopped", "game.id", gameID)
+			msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server draining")
+			conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(player.WriteWait))
+			return
+		}
+
+		if !send(ctx, conn, cursor.Frame()) {
+			return
+		}
+	}
+}
+
+// readCommands passes the client's messages on until the connection fails or
+// done is closed. Messages that aren't valid JSON are passed on without a type,
+// so they are answered as unknown commands. Every frame, pongs included,
+// extends the read deadline, so the read fails once the client stops answering.
+func readCommands(conn *websocket.Conn, commands chan<- proto.ClientToServerMessage, done <-chan struct{}) {
+	defer close(commands)
+	readTimeout := player.HeartbeatInterval * time.Duration(player.MissedHeartbeats)
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg proto.ClientToServerMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			msg = proto.ClientToServerMessage{}
+		}
+		select {
+		case commands <- msg:
+		case <-done:
+			return
+		}
+	}
+}
+
+// send writes a message to the client, reporting whether it could.
+func send(ctx context.Context, conn *websocket.Conn, msg proto.ServerToClientMessage) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		slog.ErrorContext(ctx, "error marshalling replay message", "error", err)
+		return false
+	}
+	conn.SetWriteDeadline(time.Now().Add(player.WriteWait))
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		slog.WarnContext(ctx, "error writing replay message", "error", err)
+		return false
+	}
+	return true
+}
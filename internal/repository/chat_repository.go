@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ChatRepository defines the interface for room chat data operations.
+type ChatRepository interface {
+	// Append adds a message to a room's history, keeping only the last max messages.
+	Append(ctx context.Context, roomID string, entry proto.ChatEntry, max int) error
+	// History returns a room's messages, oldest first.
+	History(ctx context.Context, roomID string) ([]proto.ChatEntry, error)
+	// SetMuted mutes or unmutes the opponent of a player.
+	SetMuted(ctx context.Context, roomID, playerID string, muted bool) error
+	// Muting returns the players of a room who muted their opponent.
+	Muting(ctx context.Context, roomID string) (map[string]bool, error)
+}
+
+type redisChatRepository struct {
+	rdb *redis.Client
+}
+
+// NewChatRepository creates a new Redis-based ChatRepository. A room's history
+// is kept in the room:<id>:chat list and its mutes in the room:<id>:mutes set.
+func NewChatRepository(rdb *redis.Client) ChatRepository {
+	return &redisChatRepository{rdb: rdb}
+}
+
+func chatKey(roomID string) string {
+	return fmt.Sprintf("room:%s:chat", roomID)
+}
+
+func mutesKey(roomID string) string {
+	return fmt.Sprintf("room:%s:mutes", roomID)
+}
+
+// Append adds a message to a room's history.
+func (r *redisChatRepository) Append(ctx context.Context, roomID string, entry proto.ChatEntry, max int) error {
+	ctx, span := tracer.Start(ctx, "ChatRepository.Append")
+	defer span.End()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat message: %w", err)
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.RPush(ctx, chatKey(roomID), data)
+	pipe.LTrim(ctx, chatKey(roomID), int64(-max), -1)
+	pipe.Expire(ctx, chatKey(roomID), RoomTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// History returns a room's messages, oldest first.
+func (r *redisChatRepository) History(ctx context.Context, roomID string) ([]proto.ChatEntry, error) {
+	ctx, span := tracer.Start(ctx, "ChatRepository.History")
+	defer span.End()
+
+	raw, err := r.rdb.LRange(ctx, chatKey(roomID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]proto.ChatEntry, 0, len(raw))
+	for _, data := range raw {
+		var entry proto.ChatEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal chat message: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SetMuted mutes or unmutes the opponent of a player.
+func (r *redisChatRepository) SetMuted(ctx context.Context, roomID, playerID string, muted bool) error {
+	ctx, span := tracer.Start(ctx, "ChatRepository.SetMuted")
+	defer span.End()
+
+	if !muted {
+		return r.rdb.SRem(ctx, mutesKey(roomID), playerID).Err()
+	}
+	pipe := r.rdb.TxPipeline()
+	pipe.SAdd(ctx, mutesKey(roomID), playerID)
+	pipe.Expire(ctx, mutesKey(roomID), RoomTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Muting returns the players of a room who muted their opponent.
+func (r *redisChatRepository) Muting(ctx context.Context, roomID string) (map[string]bool, error) {
+	ctx, span := tracer.Start(ctx, "ChatRepository.Muting")
+	defer span.End()
+
+	members, err := r.rdb.SMembers(ctx, mutesKey(roomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	muting := make(map[string]bool, len(members))
+	for _, id := range members {
+		muting[id] = true
+	}
+	return muting, nil
+}
@@ -4,21 +4,139 @@ import (
 	"context"
 	"ctchen222/Tic-Tac-Toe/internal/game"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 )
 
 // var tracer = otel.Tracer("repository.game")
 
+var (
+	// ErrGameNotFound is returned for rooms without a game state.
+	ErrGameNotFound = errors.New("game not found")
+	// ErrRoomFull is returned when a room already has its maximum number of spectators.
+	ErrRoomFull = errors.New("room is full")
+	// ErrTakebackPending is returned when a takeback request is already waiting for an answer.
+	ErrTakebackPending = errors.New("a takeback request is already pending")
+	// ErrNoTakebackRequest is returned when there is no opponent's takeback request to answer.
+	ErrNoTakebackRequest = errors.New("no takeback request to answer")
+	// ErrNothingToTakeBack is returned when the player has no move to take back.
+	ErrNothingToTakeBack = errors.New("no move to take back")
+	// ErrDrawOfferPending is returned when a draw offer is already waiting for an answer.
+	ErrDrawOfferPending = errors.New("a draw offer is already pending")
+	// ErrNoDrawOffer is returned when there is no opponent's draw offer to answer.
+	ErrNoDrawOffer = errors.New("no draw offer to answer")
+	// ErrNotAbortable is returned when both players have moved, so the game can't be aborted.
+	ErrNotAbortable = errors.New("game can only be aborted before both players have moved")
+	// ErrNotInGame is returned for players who don't play in the room's game.
+	ErrNotInGame = errors.New("player is not part of the game")
+	// ErrNotAbandoned is returned when the player hasn't been marked as having left the game.
+	ErrNotAbandoned = errors.New("player has not left the game")
+	// ErrOpponentAbandoned is returned when marking a player who left a game
+	// whose other player had already left.
+	ErrOpponentAbandoned = errors.New("opponent has left the game too")
+	// ErrFlagFell is returned for a move played after the player's time ran
+	// out. The game is lost on time instead.
+	ErrFlagFell = errors.New("time ran out")
+	// ErrClockRunning is returned when calling a flag fall on a player who still has time.
+	ErrClockRunning = errors.New("player to move still has time")
+)
+
+// addSpectatorScript counts a spectator into an existing room unless it already
+// has ARGV[1] spectators. It returns the new count, -1 when the room doesn't
+// exist and -2 when it is full.
+var addSpectatorScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+local count = tonumber(redis.call('HGET', KEYS[1], ARGV[2]) or '0')
+if count >= tonumber(ARGV[1]) then
+	return -2
+end
+return redis.call('HINCRBY', KEYS[1], ARGV[2], 1)
+`)
+
+// removeSpectatorScript counts a spectator out of a room, never going below zero
+// or recreating a room that has been deleted.
+var removeSpectatorScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local count = redis.call('HINCRBY', KEYS[1], ARGV[1], -1)
+if count < 0 then
+	redis.call('HSET', KEYS[1], ARGV[1], 0)
+	return 0
+end
+return count
+`)
+
 // GameRepository defines the interface for game data operations.
 type GameRepository interface {
-	Create(ctx context.Context, roomID, playerXID, playerOID string) error
+	// Create starts a new game in the room with the given config and settings.
+	Create(ctx context.Context, roomID, playerXID, playerOID string, cfg game.Config, settings RoomSettings) error
 	FindByID(ctx context.Context, id string) (*game.GameStateDTO, error)
-	Update(ctx context.Context, id string, mark game.PlayerMark, row, col int) (*game.GameStateDTO, error)
+	// Update applies a move, appends it to the game's move list and charges the
+	// mover's clock.
+	Update(ctx context.Context, id string, move game.Move) (*game.GameStateDTO, error)
+	// FlagFall ends the game with a loss on time for the player to move once
+	// their clock has run out.
+	FlagFall(ctx context.Context, roomID string) error
+	// Moves returns the moves of the room's current game in the order they were played.
+	Moves(ctx context.Context, roomID string) ([]game.MoveRecord, error)
+	// RequestTakeback records a player's request to take back their last move
+	// until the opponent answers it or a move is played.
+	RequestTakeback(ctx context.Context, roomID, playerID string) error
+	// ResolveTakeback answers the opponent's pending takeback request and
+	// returns the ID of the player who made it. Accepting it takes back the
+	// requester's last move and every move played since.
+	ResolveTakeback(ctx context.Context, roomID, playerID string, accept bool) (string, error)
+	// Resign ends the game with a win for the player's opponent.
+	Resign(ctx context.Context, roomID, playerID string) error
+	// Abort ends the game without a result, which is only allowed until both
+	// players have moved.
+	Abort(ctx context.Context, roomID, playerID string) error
+	// OfferDraw records a player's draw offer until the opponent answers it or a
+	// move is played.
+	OfferDraw(ctx context.Context, roomID, playerID string) error
+	// ResolveDrawOffer answers the opponent's pending draw offer and returns the
+	// ID of the player who made it. Accepting it ends the game in a draw.
+	ResolveDrawOffer(ctx context.Context, roomID, playerID string, accept bool) (string, error)
+	// MarkAbandoned records that a player left the game in progress and didn't
+	// reconnect in time. It reports whether the player was newly marked.
+	MarkAbandoned(ctx context.Context, roomID, playerID string) (bool, error)
+	// ClearAbandoned takes back the mark of a player who left the game.
+	ClearAbandoned(ctx context.Context, roomID, playerID string) error
+	// Forfeit ends the game with a win for the opponent of a player marked as
+	// having left it.
+	Forfeit(ctx context.Context, roomID, playerID string) error
+	// Abandon ends the game in progress without a winner.
+	Abandon(ctx context.Context, roomID string) error
 	RecordVote(ctx context.Context, roomID, playerID string) error
 	GetVotes(ctx context.Context, roomID string) (map[string]string, error)
 	ClearVotes(ctx context.Context, roomID, playerXID, playerOID string) error
+	// AddSpectator counts a spectator into a room that has fewer than max, and
+	// returns the new number of spectators.
+	AddSpectator(ctx context.Context, roomID string, max int) (int, error)
+	RemoveSpectator(ctx context.Context, roomID string) error
+	// Expire has Redis delete the room's keys after ttl.
+	Expire(ctx context.Context, roomID string, ttl time.Duration) error
+}
+
+// RoomTTL is how long the keys of a room outlive its last game or move, so rooms
+// no server closed don't stay in Redis forever.
+const RoomTTL = 24 * time.Hour
+
+// RoomSettings are the settings of a room's game that aren't part of its config,
+// such as those a private room's host chose.
+type RoomSettings struct {
+	// FirstTurn is the mark that moves first, or None for a random pick.
+	FirstTurn game.PlayerMark
+	// Bots maps the player ID of each bot in the game to its difficulty.
+	Bots map[string]string
 }
 
 type redisGameRepository struct {
@@ -30,25 +148,66 @@ func NewGameRepository(rdb *redis.Client) GameRepository {
 	return &redisGameRepository{rdb: rdb}
 }
 
-// Create initializes a new game state in Redis.
-func (r *redisGameRepository) Create(ctx context.Context, roomID, playerXID, playerOID string) error {
+// Create initializes a new game state in Redis in a single transaction, with a
+// new game ID, an empty move list and both clocks started. Configs without a
+// time control are played with the default one.
+func (r *redisGameRepository) Create(ctx context.Context, roomID, playerXID, playerOID string, cfg game.Config, settings RoomSettings) error {
 	ctx, span := tracer.Start(ctx, "GameRepository.Create")
 	defer span.End()
 
-	board := [3][3]game.PlayerMark{}
-	boardJSON, err := json.Marshal(board)
+	if cfg.Variant == "" {
+		cfg.Variant = game.DefaultVariant
+	}
+	if cfg.TimeControl.IsZero() {
+		cfg.TimeControl = game.DefaultTimeControl
+	}
+	ruleset, err := cfg.Ruleset()
+	if err != nil {
+		return err
+	}
+
+	board := cfg.NewBoard()
+	boardJSON, err := json.Marshal(board.Cells)
 	if err != nil {
 		return fmt.Errorf("failed to marshal initial board: %w", err)
 	}
 
-	pipe := r.rdb.Pipeline()
+	firstTurn := settings.FirstTurn
+	if firstTurn == game.None {
+		firstTurn = game.RandomlyChooseFirstPlayer()
+	}
+
+	pipe := r.rdb.TxPipeline()
 	roomKey := fmt.Sprintf("room:%s", roomID)
+	pipe.HDel(ctx, roomKey, game.FieldTakeback, game.FieldDrawOffer, game.FieldAbandonedBy, game.FieldBots)
+	if len(settings.Bots) > 0 {
+		botsJSON, err := json.Marshal(settings.Bots)
+		if err != nil {
+			return fmt.Errorf("failed to marshal bots: %w", err)
+		}
+		pipe.HSet(ctx, roomKey, game.FieldBots, botsJSON)
+	}
+	pipe.HSet(ctx, roomKey, game.FieldVariant, cfg.Variant)
 	pipe.HSet(ctx, roomKey, game.FieldBoard, boardJSON)
+	pipe.HSet(ctx, roomKey, game.FieldBoardSize, cfg.Size)
+	pipe.HSet(ctx, roomKey, game.FieldWinLength, cfg.WinLength)
 	pipe.HSet(ctx, roomKey, game.FieldPlayerX, playerXID)
 	pipe.HSet(ctx, roomKey, game.FieldPlayerO, playerOID)
-	pipe.HSet(ctx, roomKey, game.FieldNextTurn, string(game.RandomlyChooseFirstPlayer()))
+	pipe.HSet(ctx, roomKey, game.FieldNextTurn, string(firstTurn))
+	pipe.HSet(ctx, roomKey, game.FieldLastMove, "")
 	pipe.HSet(ctx, roomKey, game.FieldWinner, "")
 	pipe.HSet(ctx, roomKey, game.FieldStatus, "in_progress")
+	pipe.HSet(ctx, roomKey, game.FieldTermination, "")
+	pipe.HSet(ctx, roomKey, game.FieldGameID, uuid.NewString())
+	now := time.Now()
+	pipe.HSet(ctx, roomKey, game.FieldStartedAt, now.UnixMilli())
+	pipe.HSet(ctx, roomKey, game.FieldTimeControl, cfg.TimeControl.String())
+	queueClock(ctx, pipe, roomKey, game.NewClock(cfg.TimeControl, now))
+	pipe.Del(ctx, movesKey(roomID))
+	if err := setMetaState(ctx, pipe, roomID, ruleset, game.State{Board: board}); err != nil {
+		return err
+	}
+	queueExpire(ctx, pipe, roomID, RoomTTL)
 
 	_, err = pipe.Exec(ctx)
 	if err != nil {
@@ -68,28 +227,24 @@ func (r *redisGameRepository) FindByID(ctx context.Context, id string) (*game.Ga
 		return nil, fmt.Errorf("failed to get game state from redis: %w", err)
 	}
 	if len(data) == 0 {
-		return nil, fmt.Errorf("game not found")
+		return nil, ErrGameNotFound
 	}
 
-	var board [3][3]game.PlayerMark
-	if err := json.Unmarshal([]byte(data[game.FieldBoard]), &board); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal board: %w", err)
+	state, err := decodeGameState(data)
+	if err != nil {
+		return nil, err
 	}
-
-	isDraw := game.IsBoardFull(board) && data[game.FieldWinner] == ""
-
-	return &game.GameStateDTO{
-		Board:       board,
-		CurrentTurn: game.PlayerMark(data[game.FieldNextTurn]),
-		Winner:      game.PlayerMark(data[game.FieldWinner]),
-		IsDraw:      isDraw,
-		PlayerXID:   data[game.FieldPlayerX],
-		PlayerOID:   data[game.FieldPlayerO],
-	}, nil
+	if err := r.loadMetaState(ctx, id, state); err != nil {
+		return nil, err
+	}
+	return state, nil
 }
 
 // Update applies a player's move to the game state in Redis.
-func (r *redisGameRepository) Update(ctx context.Context, id string, mark game.PlayerMark, row, col int) (*game.GameStateDTO, error) {
+// Legality, the next turn and the result are decided by the game's ruleset. A
+// move played after the mover's time ran out loses the game on time and
+// returns ErrFlagFell.
+func (r *redisGameRepository) Update(ctx context.Context, id string, move game.Move) (*game.GameStateDTO, error) {
 	ctx, span := tracer.Start(ctx, "GameRepository.Update")
 	defer span.End()
 
@@ -100,54 +255,804 @@ func (r *redisGameRepository) Update(ctx context.Context, id string, mark game.P
 		if err != nil {
 			return err
 		}
+		if len(data) == 0 {
+			return ErrGameNotFound
+		}
 
 		if data[game.FieldWinner] != "" || data[game.FieldStatus] == "finished" {
-			return fmt.Errorf("game is already over")
+			return game.ErrGameOver
 		}
-		if game.PlayerMark(data[game.FieldNextTurn]) != mark {
-			return fmt.Errorf("not player's turn")
+		state, err := decodeGameState(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode game state for update: %w", err)
 		}
-		var board [3][3]game.PlayerMark
-		if err := json.Unmarshal([]byte(data[game.FieldBoard]), &board); err != nil {
-			return fmt.Errorf("failed to unmarshal board for update: %w", err)
+		ruleset, err := state.Ruleset()
+		if err != nil {
+			return err
+		}
+
+		next, err := ruleset.Apply(state.State(), move)
+		if err != nil {
+			return err
 		}
-		if row < game.BorderMin || row > game.BorderMax || col < game.BorderMin || col > game.BorderMax || board[row][col] != game.None {
-			return fmt.Errorf("invalid move")
+
+		now := time.Now()
+		clock := state.Clock
+		if !state.TimeControl.IsZero() {
+			left, ok := state.TimeControl.Charge(clock.Bank(state.CurrentTurn), now.Sub(clock.TurnStartedAt))
+			if !ok {
+				pipe := tx.TxPipeline()
+				clock.SetBank(state.CurrentTurn, 0)
+				queueClock(ctx, pipe, roomKey, clock)
+				queueFinish(ctx, pipe, roomKey, opponentMark(state.CurrentTurn), game.TerminationTimeout)
+				if _, err := pipe.Exec(ctx); err != nil {
+					return err
+				}
+				return ErrFlagFell
+			}
+			clock.SetBank(state.CurrentTurn, left)
+			clock.TurnStartedAt = now
 		}
 
-		board[row][col] = mark
-		newBoardJSON, err := json.Marshal(board)
+		newBoardJSON, err := json.Marshal(next.Board.Cells)
 		if err != nil {
 			return fmt.Errorf("failed to marshal updated board: %w", err)
 		}
-
-		winner := game.CheckWinner(board)
-		isFull := game.IsBoardFull(board)
-		nextTurn := game.PlayerO
-		if mark == game.PlayerO {
-			nextTurn = game.PlayerX
+		lastMoveJSON, err := json.Marshal(next.LastMove)
+		if err != nil {
+			return fmt.Errorf("failed to marshal last move: %w", err)
+		}
+		record := game.MoveRecord{Move: move, At: now}
+		recordJSON, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal move record: %w", err)
 		}
+
+		winner := ruleset.Outcome(next)
 		status := "in_progress"
-		if winner != game.None || isFull {
+		var termination game.Termination
+		if winner != game.None {
 			status = "finished"
+			termination = game.TerminationOf(winner, []game.MoveRecord{record})
 		}
 
 		pipe := tx.TxPipeline()
 		pipe.HSet(ctx, roomKey, game.FieldBoard, newBoardJSON)
-		pipe.HSet(ctx, roomKey, game.FieldNextTurn, string(nextTurn))
+		pipe.HSet(ctx, roomKey, game.FieldNextTurn, string(next.Turn))
+		pipe.HSet(ctx, roomKey, game.FieldLastMove, lastMoveJSON)
 		pipe.HSet(ctx, roomKey, game.FieldWinner, string(winner))
 		pipe.HSet(ctx, roomKey, game.FieldStatus, status)
+		pipe.HSet(ctx, roomKey, game.FieldTermination, string(termination))
+		queueClock(ctx, pipe, roomKey, clock)
+		// A move cancels a pending takeback request or draw offer.
+		pipe.HDel(ctx, roomKey, game.FieldTakeback, game.FieldDrawOffer)
+		pipe.RPush(ctx, movesKey(id), recordJSON)
+		if err := setMetaState(ctx, pipe, id, ruleset, next); err != nil {
+			return err
+		}
+		queueExpire(ctx, pipe, id, RoomTTL)
 		_, err = pipe.Exec(ctx)
 		return err
 	}
 
-	if err := r.rdb.Watch(ctx, txf, roomKey); err != nil {
+	if err := r.rdb.Watch(ctx, txf, roomKey, metaKey(id)); err != nil {
 		return nil, err
 	}
 
 	return r.FindByID(ctx, id)
 }
 
+// FlagFall checks the clock of the player to move in the same transaction that
+// ends the game, so only one server ends it.
+func (r *redisGameRepository) FlagFall(ctx context.Context, roomID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.FlagFall")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		state, err := decodeGameState(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode game state for flag fall: %w", err)
+		}
+		if state.TimeControl.IsZero() || state.TimeLeft(state.CurrentTurn, time.Now()) > 0 {
+			return ErrClockRunning
+		}
+
+		clock := state.Clock
+		clock.SetBank(state.CurrentTurn, 0)
+		pipe := tx.TxPipeline()
+		queueClock(ctx, pipe, roomKey, clock)
+		queueFinish(ctx, pipe, roomKey, opponentMark(state.CurrentTurn), game.TerminationTimeout)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey)
+}
+
+// Moves returns the moves of the room's current game.
+func (r *redisGameRepository) Moves(ctx context.Context, roomID string) ([]game.MoveRecord, error) {
+	ctx, span := tracer.Start(ctx, "GameRepository.Moves")
+	defer span.End()
+
+	raw, err := r.rdb.LRange(ctx, movesKey(roomID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moves from redis: %w", err)
+	}
+	return decodeMoves(raw)
+}
+
+// RequestTakeback stores the player's request in the room hash. The game must
+// be in progress and the player must have a move to take back.
+func (r *redisGameRepository) RequestTakeback(ctx context.Context, roomID, playerID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.RequestTakeback")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		if data[game.FieldTakeback] != "" {
+			return ErrTakebackPending
+		}
+
+		raw, err := tx.LRange(ctx, movesKey(roomID), 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		moves, err := decodeMoves(raw)
+		if err != nil {
+			return err
+		}
+		mark := markOf(data, playerID)
+		if mark == game.None || game.TakebackPlies(moves, mark) == 0 {
+			return ErrNothingToTakeBack
+		}
+
+		pipe := tx.TxPipeline()
+		pipe.HSet(ctx, roomKey, game.FieldTakeback, playerID)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey, movesKey(roomID))
+}
+
+// ResolveTakeback clears the opponent's pending request and, if the player
+// accepts it, rolls the board, next turn, result and move list back in the
+// same transaction.
+func (r *redisGameRepository) ResolveTakeback(ctx context.Context, roomID, playerID string, accept bool) (string, error) {
+	ctx, span := tracer.Start(ctx, "GameRepository.ResolveTakeback")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+	var requester string
+
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.HGetAll(ctx, roomKey).Result()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return ErrGameNotFound
+		}
+		requester = data[game.FieldTakeback]
+		if requester == "" || requester == playerID || markOf(data, playerID) == game.None {
+			return ErrNoTakebackRequest
+		}
+
+		pipe := tx.TxPipeline()
+		pipe.HDel(ctx, roomKey, game.FieldTakeback)
+		if accept {
+			if err := r.queueTakeback(ctx, tx, pipe, roomID, data, requester); err != nil {
+				return err
+			}
+		}
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	if err := r.rdb.Watch(ctx, txf, roomKey, metaKey(roomID), movesKey(roomID)); err != nil {
+		return "", err
+	}
+	return requester, nil
+}
+
+// queueTakeback queues the writes that take back the requester's last move and
+// every move played since, replaying the remaining moves to rebuild the game.
+func (r *redisGameRepository) queueTakeback(ctx context.Context, tx *redis.Tx, pipe redis.Pipeliner, roomID string, data map[string]string, requester string) error {
+	state, err := decodeGameState(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode game state for takeback: %w", err)
+	}
+	if state.Winner != game.None || data[game.FieldStatus] == "finished" {
+		return game.ErrGameOver
+	}
+	ruleset, err := state.Ruleset()
+	if err != nil {
+		return err
+	}
+
+	raw, err := tx.LRange(ctx, movesKey(roomID), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	records, err := decodeMoves(raw)
+	if err != nil {
+		return err
+	}
+	plies := game.TakebackPlies(records, state.MarkOf(requester))
+	if plies == 0 {
+		return ErrNothingToTakeBack
+	}
+	moves := make([]game.Move, len(records))
+	for i, record := range records {
+		moves[i] = record.Move
+	}
+	rewound, err := game.Rewind(state.Config(), moves, plies)
+	if err != nil {
+		return fmt.Errorf("failed to rewind game: %w", err)
+	}
+
+	boardJSON, err := json.Marshal(rewound.Board.Cells)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rewound board: %w", err)
+	}
+	lastMove := ""
+	if rewound.LastMove != nil {
+		lastMoveJSON, err := json.Marshal(rewound.LastMove)
+		if err != nil {
+			return fmt.Errorf("failed to marshal last move: %w", err)
+		}
+		lastMove = string(lastMoveJSON)
+	}
+	status := "in_progress"
+	if rewound.Winner != game.None {
+		status = "finished"
+	}
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+	pipe.HSet(ctx, roomKey, game.FieldBoard, boardJSON)
+	pipe.HSet(ctx, roomKey, game.FieldNextTurn, string(rewound.CurrentTurn))
+	pipe.HSet(ctx, roomKey, game.FieldLastMove, lastMove)
+	pipe.HSet(ctx, roomKey, game.FieldWinner, string(rewound.Winner))
+	pipe.HSet(ctx, roomKey, game.FieldStatus, status)
+	if !state.TimeControl.IsZero() {
+		// The player to move is charged for the time spent so far, and the
+		// requester's clock starts again.
+		now := time.Now()
+		clock := state.Clock
+		clock.SetBank(state.CurrentTurn, state.TimeLeft(state.CurrentTurn, now))
+		clock.TurnStartedAt = now
+		queueClock(ctx, pipe, roomKey, clock)
+	}
+	if kept := len(records) - plies; kept > 0 {
+		pipe.LTrim(ctx, movesKey(roomID), 0, int64(kept-1))
+	} else {
+		pipe.Del(ctx, movesKey(roomID))
+	}
+	return setMetaState(ctx, pipe, roomID, ruleset, rewound.State())
+}
+
+// Resign ends the game in progress with a win for the player's opponent.
+func (r *redisGameRepository) Resign(ctx context.Context, roomID, playerID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.Resign")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		var winner game.PlayerMark
+		switch markOf(data, playerID) {
+		case game.PlayerX:
+			winner = game.PlayerO
+		case game.PlayerO:
+			winner = game.PlayerX
+		default:
+			return ErrNotInGame
+		}
+
+		pipe := tx.TxPipeline()
+		queueFinish(ctx, pipe, roomKey, winner, game.TerminationResign)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey)
+}
+
+// Abort ends the game in progress without a winner if at most one of its
+// players has moved.
+func (r *redisGameRepository) Abort(ctx context.Context, roomID, playerID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.Abort")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		if markOf(data, playerID) == game.None {
+			return ErrNotInGame
+		}
+		raw, err := tx.LRange(ctx, movesKey(roomID), 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		moves, err := decodeMoves(raw)
+		if err != nil {
+			return err
+		}
+		if !game.Abortable(moves) {
+			return ErrNotAbortable
+		}
+
+		pipe := tx.TxPipeline()
+		queueFinish(ctx, pipe, roomKey, game.None, game.TerminationAbort)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey, movesKey(roomID))
+}
+
+// OfferDraw stores the player's draw offer in the room hash.
+func (r *redisGameRepository) OfferDraw(ctx context.Context, roomID, playerID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.OfferDraw")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		if markOf(data, playerID) == game.None {
+			return ErrNotInGame
+		}
+		if data[game.FieldDrawOffer] != "" {
+			return ErrDrawOfferPending
+		}
+
+		pipe := tx.TxPipeline()
+		pipe.HSet(ctx, roomKey, game.FieldDrawOffer, playerID)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey)
+}
+
+// ResolveDrawOffer clears the opponent's pending draw offer and, if the player
+// accepts it, ends the game in a draw in the same transaction.
+func (r *redisGameRepository) ResolveDrawOffer(ctx context.Context, roomID, playerID string, accept bool) (string, error) {
+	ctx, span := tracer.Start(ctx, "GameRepository.ResolveDrawOffer")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+	var offerer string
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		offerer = data[game.FieldDrawOffer]
+		if offerer == "" || offerer == playerID || markOf(data, playerID) == game.None {
+			return ErrNoDrawOffer
+		}
+
+		pipe := tx.TxPipeline()
+		pipe.HDel(ctx, roomKey, game.FieldDrawOffer)
+		if accept {
+			queueFinish(ctx, pipe, roomKey, game.DRAW, game.TerminationAgreement)
+		}
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	if err := r.rdb.Watch(ctx, txf, roomKey); err != nil {
+		return "", err
+	}
+	return offerer, nil
+}
+
+// MarkAbandoned stores the ID of the player who left in the room hash. Only one
+// player is marked at a time; marking the second fails with ErrOpponentAbandoned.
+func (r *redisGameRepository) MarkAbandoned(ctx context.Context, roomID, playerID string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "GameRepository.MarkAbandoned")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+	var marked bool
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		if markOf(data, playerID) == game.None {
+			return ErrNotInGame
+		}
+		switch data[game.FieldAbandonedBy] {
+		case playerID:
+			return nil
+		case "":
+		default:
+			return ErrOpponentAbandoned
+		}
+
+		pipe := tx.TxPipeline()
+		pipe.HSet(ctx, roomKey, game.FieldAbandonedBy, playerID)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		marked = true
+		return nil
+	}
+
+	if err := r.rdb.Watch(ctx, txf, roomKey); err != nil {
+		return false, err
+	}
+	return marked, nil
+}
+
+// ClearAbandoned removes the player's mark from the room hash.
+func (r *redisGameRepository) ClearAbandoned(ctx context.Context, roomID, playerID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.ClearAbandoned")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		abandonedBy, err := tx.HGet(ctx, roomKey, game.FieldAbandonedBy).Result()
+		if err == redis.Nil || (err == nil && abandonedBy != playerID) {
+			return ErrNotAbandoned
+		}
+		if err != nil {
+			return err
+		}
+
+		pipe := tx.TxPipeline()
+		pipe.HDel(ctx, roomKey, game.FieldAbandonedBy)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey)
+}
+
+// Forfeit ends the game in progress with a win for the opponent of the player
+// who left it.
+func (r *redisGameRepository) Forfeit(ctx context.Context, roomID, playerID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.Forfeit")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := r.gameInProgress(ctx, tx, roomKey)
+		if err != nil {
+			return err
+		}
+		if data[game.FieldAbandonedBy] != playerID {
+			return ErrNotAbandoned
+		}
+		winner := game.PlayerX
+		if markOf(data, playerID) == game.PlayerX {
+			winner = game.PlayerO
+		}
+
+		pipe := tx.TxPipeline()
+		queueFinish(ctx, pipe, roomKey, winner, game.TerminationForfeit)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey)
+}
+
+// Abandon ends the game in progress without a winner.
+func (r *redisGameRepository) Abandon(ctx context.Context, roomID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.Abandon")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+
+	txf := func(tx *redis.Tx) error {
+		if _, err := r.gameInProgress(ctx, tx, roomKey); err != nil {
+			return err
+		}
+
+		pipe := tx.TxPipeline()
+		queueFinish(ctx, pipe, roomKey, game.None, game.TerminationAbandon)
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+
+	return r.rdb.Watch(ctx, txf, roomKey)
+}
+
+// Expire has Redis delete the room hash and its moves, meta, chat and mutes
+// keys after ttl.
+func (r *redisGameRepository) Expire(ctx context.Context, roomID string, ttl time.Duration) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.Expire")
+	defer span.End()
+
+	pipe := r.rdb.Pipeline()
+	queueExpire(ctx, pipe, roomID, ttl)
+	pipe.Expire(ctx, chatKey(roomID), ttl)
+	pipe.Expire(ctx, mutesKey(roomID), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// queueExpire queues the writes that expire a room's game keys after ttl.
+func queueExpire(ctx context.Context, pipe redis.Pipeliner, roomID string, ttl time.Duration) {
+	pipe.Expire(ctx, fmt.Sprintf("room:%s", roomID), ttl)
+	pipe.Expire(ctx, movesKey(roomID), ttl)
+	pipe.Expire(ctx, metaKey(roomID), ttl)
+}
+
+// gameInProgress reads a watched room hash, failing if the room has no game in progress.
+func (r *redisGameRepository) gameInProgress(ctx context.Context, tx *redis.Tx, roomKey string) (map[string]string, error) {
+	data, err := tx.HGetAll(ctx, roomKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrGameNotFound
+	}
+	if data[game.FieldWinner] != "" || data[game.FieldStatus] == "finished" {
+		return nil, game.ErrGameOver
+	}
+	return data, nil
+}
+
+// queueFinish queues the writes that end a game without a move. Pending
+// takeback requests, draw offers and abandonment marks go with it.
+func queueFinish(ctx context.Context, pipe redis.Pipeliner, roomKey string, winner game.PlayerMark, termination game.Termination) {
+	pipe.HSet(ctx, roomKey, game.FieldWinner, string(winner))
+	pipe.HSet(ctx, roomKey, game.FieldStatus, "finished")
+	pipe.HSet(ctx, roomKey, game.FieldTermination, string(termination))
+	pipe.HDel(ctx, roomKey, game.FieldTakeback, game.FieldDrawOffer, game.FieldAbandonedBy)
+}
+
+// queueClock queues the writes that store a game's clock.
+func queueClock(ctx context.Context, pipe redis.Pipeliner, roomKey string, clock game.Clock) {
+	pipe.HSet(ctx, roomKey,
+		game.FieldClockX, clock.X.Milliseconds(),
+		game.FieldClockO, clock.O.Milliseconds(),
+		game.FieldTurnStarted, clock.TurnStartedAt.UnixMilli(),
+	)
+}
+
+// opponentMark returns the mark of the other player.
+func opponentMark(mark game.PlayerMark) game.PlayerMark {
+	if mark == game.PlayerX {
+		return game.PlayerO
+	}
+	return game.PlayerX
+}
+
+// markOf returns the mark of a player in a room hash, or None for anybody else.
+func markOf(data map[string]string, playerID string) game.PlayerMark {
+	players := game.GameStateDTO{PlayerXID: data[game.FieldPlayerX], PlayerOID: data[game.FieldPlayerO]}
+	return players.MarkOf(playerID)
+}
+
+// movesKey is the list of the moves played in the room's current game.
+func movesKey(roomID string) string {
+	return fmt.Sprintf("room:%s:moves", roomID)
+}
+
+// decodeMoves decodes the entries of a move list.
+func decodeMoves(raw []string) ([]game.MoveRecord, error) {
+	moves := make([]game.MoveRecord, 0, len(raw))
+	for _, entry := range raw {
+		var move game.MoveRecord
+		if err := json.Unmarshal([]byte(entry), &move); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal move record: %w", err)
+		}
+		moves = append(moves, move)
+	}
+	return moves, nil
+}
+
+// metaKey is the hash holding the macro board and forced board of games played
+// with a MetaRuleset, kept next to the room:<id> hash.
+func metaKey(roomID string) string {
+	return fmt.Sprintf("room:%s:meta", roomID)
+}
+
+// setMetaState queues the writes that store the meta state of s, or removes it
+// when the ruleset has none.
+func setMetaState(ctx context.Context, pipe redis.Pipeliner, roomID string, ruleset game.Ruleset, s game.State) error {
+	meta, ok := ruleset.(game.MetaRuleset)
+	if !ok {
+		pipe.Del(ctx, metaKey(roomID))
+		return nil
+	}
+
+	macroJSON, err := json.Marshal(meta.MacroBoard(s))
+	if err != nil {
+		return fmt.Errorf("failed to marshal macro board: %w", err)
+	}
+	forced := ""
+	if board := meta.ForcedBoard(s); board != nil {
+		forcedJSON, err := json.Marshal(board)
+		if err != nil {
+			return fmt.Errorf("failed to marshal forced board: %w", err)
+		}
+		forced = string(forcedJSON)
+	}
+
+	pipe.HSet(ctx, metaKey(roomID), game.FieldMacroBoard, macroJSON, game.FieldForcedBoard, forced)
+	return nil
+}
+
+// loadMetaState fills in the macro board and forced board of games played with a MetaRuleset.
+func (r *redisGameRepository) loadMetaState(ctx context.Context, roomID string, state *game.GameStateDTO) error {
+	ruleset, err := state.Ruleset()
+	if err != nil {
+		return err
+	}
+	if _, ok := ruleset.(game.MetaRuleset); !ok {
+		return nil
+	}
+
+	data, err := r.rdb.HGetAll(ctx, metaKey(roomID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get meta state from redis: %w", err)
+	}
+	if raw := data[game.FieldMacroBoard]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &state.MacroBoard); err != nil {
+			return fmt.Errorf("failed to unmarshal macro board: %w", err)
+		}
+	}
+	if raw := data[game.FieldForcedBoard]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &state.ForcedBoard); err != nil {
+			return fmt.Errorf("failed to unmarshal forced board: %w", err)
+		}
+	}
+	return nil
+}
+
+// decodeGameState rebuilds a game state from a room hash.
+func decodeGameState(data map[string]string) (*game.GameStateDTO, error) {
+	board, err := decodeBoard(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastMove *game.Move
+	if raw := data[game.FieldLastMove]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &lastMove); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal last move: %w", err)
+		}
+	}
+
+	variant := data[game.FieldVariant]
+	if variant == "" {
+		variant = game.DefaultVariant
+	}
+
+	isDraw := game.IsBoardFull(board) && data[game.FieldWinner] == ""
+
+	spectators := 0
+	if raw := data[game.FieldSpectators]; raw != "" {
+		if spectators, err = strconv.Atoi(raw); err != nil {
+			return nil, fmt.Errorf("invalid spectator count: %w", err)
+		}
+	}
+
+	var startedAt time.Time
+	if raw := data[game.FieldStartedAt]; raw != "" {
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start time: %w", err)
+		}
+		startedAt = time.UnixMilli(ms)
+	}
+
+	var bots map[string]string
+	if raw := data[game.FieldBots]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &bots); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal bots: %w", err)
+		}
+	}
+
+	// Games started before clocks have no time control and are played untimed.
+	var timeControl game.TimeControl
+	var clock game.Clock
+	if raw := data[game.FieldTimeControl]; raw != "" {
+		if timeControl, err = game.ParseTimeControl(raw); err != nil {
+			return nil, fmt.Errorf("invalid time control: %w", err)
+		}
+		var ms [3]int64
+		for i, field := range []string{game.FieldClockX, game.FieldClockO, game.FieldTurnStarted} {
+			if ms[i], err = strconv.ParseInt(data[field], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid clock field %s: %w", field, err)
+			}
+		}
+		clock = game.Clock{
+			X:             time.Duration(ms[0]) * time.Millisecond,
+			O:             time.Duration(ms[1]) * time.Millisecond,
+			TurnStartedAt: time.UnixMilli(ms[2]),
+		}
+	}
+
+	return &game.GameStateDTO{
+		Variant:         variant,
+		Board:           board,
+		CurrentTurn:     game.PlayerMark(data[game.FieldNextTurn]),
+		LastMove:        lastMove,
+		Winner:          game.PlayerMark(data[game.FieldWinner]),
+		IsDraw:          isDraw,
+		PlayerXID:       data[game.FieldPlayerX],
+		PlayerOID:       data[game.FieldPlayerO],
+		Spectators:      spectators,
+		TimeControl:     timeControl,
+		Clock:           clock,
+		GameID:          data[game.FieldGameID],
+		StartedAt:       startedAt,
+		Termination:     game.Termination(data[game.FieldTermination]),
+		BotDifficulties: bots,
+	}, nil
+}
+
+// decodeBoard rebuilds the board from a room hash. Rooms created before board
+// dimensions were stored are treated as classic 3x3 games.
+func decodeBoard(data map[string]string) (game.Board, error) {
+	var cells [][]game.PlayerMark
+	if err := json.Unmarshal([]byte(data[game.FieldBoard]), &cells); err != nil {
+		return game.Board{}, fmt.Errorf("failed to unmarshal board: %w", err)
+	}
+
+	size := len(cells)
+	if raw, ok := data[game.FieldBoardSize]; ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return game.Board{}, fmt.Errorf("invalid board size: %w", err)
+		}
+		size = n
+	}
+	if size != len(cells) {
+		return game.Board{}, fmt.Errorf("board has %d rows, expected %d", len(cells), size)
+	}
+	for _, rowData := range cells {
+		if len(rowData) != size {
+			return game.Board{}, fmt.Errorf("board row has %d columns, expected %d", len(rowData), size)
+		}
+	}
+
+	winLength := game.DefaultWinLength(size)
+	if raw, ok := data[game.FieldWinLength]; ok {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return game.Board{}, fmt.Errorf("invalid win length: %w", err)
+		}
+		winLength = n
+	}
+
+	return game.Board{Cells: cells, WinLength: winLength}, nil
+}
+
 // RecordVote records a player's vote for a rematch.
 func (r *redisGameRepository) RecordVote(ctx context.Context, roomID, playerID string) error {
 	ctx, span := tracer.Start(ctx, "GameRepository.RecordVote")
@@ -178,3 +1083,31 @@ func (r *redisGameRepository) ClearVotes(ctx context.Context, roomID, playerXID,
 	return r.rdb.HDel(ctx, roomKey, voteKey1, voteKey2).Err()
 }
 
+// AddSpectator counts a spectator into a room. The count lives in the room hash,
+// so it is shared by all servers and survives rematch resets.
+func (r *redisGameRepository) AddSpectator(ctx context.Context, roomID string, max int) (int, error) {
+	ctx, span := tracer.Start(ctx, "GameRepository.AddSpectator")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+	count, err := addSpectatorScript.Run(ctx, r.rdb, []string{roomKey}, max, game.FieldSpectators).Int()
+	if err != nil {
+		return 0, err
+	}
+	switch count {
+	case -1:
+		return 0, ErrGameNotFound
+	case -2:
+		return 0, ErrRoomFull
+	}
+	return count, nil
+}
+
+// RemoveSpectator counts a spectator out of a room.
+func (r *redisGameRepository) RemoveSpectator(ctx context.Context, roomID string) error {
+	ctx, span := tracer.Start(ctx, "GameRepository.RemoveSpectator")
+	defer span.End()
+
+	roomKey := fmt.Sprintf("room:%s", roomID)
+	return removeSpectatorScript.Run(ctx, r.rdb, []string{roomKey}, game.FieldSpectators).Err()
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"testing"
+	"time"
+)
+
+func TestDecodeGameStateSpectators(t *testing.T) {
+	room := map[string]string{
+		game.FieldBoard:    `[["","",""],["","",""],["","",""]]`,
+		game.FieldPlayerX:  "alice",
+		game.FieldPlayerO:  "bob",
+		game.FieldNextTurn: "X",
+	}
+
+	state, err := decodeGameState(room)
+	if err != nil {
+		t.Fatalf("decodeGameState() returned error: %v", err)
+	}
+	if state.Spectators != 0 {
+		t.Errorf("Spectators = %d for a room without spectators, want 0", state.Spectators)
+	}
+
+	room[game.FieldSpectators] = "3"
+	state, err = decodeGameState(room)
+	if err != nil {
+		t.Fatalf("decodeGameState() returned error: %v", err)
+	}
+	if state.Spectators != 3 {
+		t.Errorf("Spectators = %d, want 3", state.Spectators)
+	}
+
+	room[game.FieldSpectators] = "many"
+	if _, err := decodeGameState(room); err == nil {
+		t.Error("decodeGameState() accepted an invalid spectator count")
+	}
+}
+
+func TestDecodeGameStateClock(t *testing.T) {
+	room := map[string]string{
+		game.FieldBoard:    `[["","",""],["","",""],["","",""]]`,
+		game.FieldNextTurn: "X",
+	}
+	state, err := decodeGameState(room)
+	if err != nil {
+		t.Fatalf("decodeGameState() returned error: %v", err)
+	}
+	if !state.TimeControl.IsZero() {
+		t.Errorf("TimeControl = %v for a room without a clock, want an untimed game", state.TimeControl)
+	}
+
+	room[game.FieldTimeControl] = "60+2"
+	room[game.FieldClockX] = "45000"
+	room[game.FieldClockO] = "61500"
+	room[game.FieldTurnStarted] = "1735787045000"
+	state, err = decodeGameState(room)
+	if err != nil {
+		t.Fatalf("decodeGameState() returned error: %v", err)
+	}
+	want := game.Clock{X: 45 * time.Second, O: 61500 * time.Millisecond, TurnStartedAt: time.UnixMilli(1735787045000)}
+	if state.TimeControl != game.DefaultTimeControl || state.Clock != want {
+		t.Errorf("got %v with clock %+v, want 60+2 with %+v", state.TimeControl, state.Clock, want)
+	}
+
+	room[game.FieldClockO] = ""
+	if _, err := decodeGameState(room); err == nil {
+		t.Error("decodeGameState() accepted a timed game without a clock")
+	}
+}
+
+func TestDecodeGameStateBots(t *testing.T) {
+	room := map[string]string{
+		game.FieldBoard:    `[["","",""],["","",""],["","",""]]`,
+		game.FieldNextTurn: "X",
+		game.FieldBots:     `{"bot-1234":"hard"}`,
+	}
+	state, err := decodeGameState(room)
+	if err != nil {
+		t.Fatalf("decodeGameState() returned error: %v", err)
+	}
+	if got := state.BotDifficulties["bot-1234"]; got != "hard" {
+		t.Errorf("BotDifficulties[bot-1234] = %q, want hard", got)
+	}
+
+	delete(room, game.FieldBots)
+	if state, err = decodeGameState(room); err != nil || state.BotDifficulties != nil {
+		t.Errorf("decodeGameState() = %v, %v for a game without bots, want no bots", state.BotDifficulties, err)
+	}
+}
+
+func TestDecodeMoves(t *testing.T) {
+	moves, err := decodeMoves([]string{
+		`{"player":"X","piece":"X","row":1,"col":1,"at":"2025-01-02T03:04:05Z"}`,
+		`{"player":"O","piece":"O","row":0,"col":2,"at":"2025-01-02T03:04:10Z","proxy":true}`,
+	})
+	if err != nil {
+		t.Fatalf("decodeMoves() returned error: %v", err)
+	}
+	if len(moves) != 2 {
+		t.Fatalf("decodeMoves() returned %d moves, want 2", len(moves))
+	}
+	if moves[0].Player != game.PlayerX || moves[0].Row != 1 || moves[0].Col != 1 || moves[0].Proxy {
+		t.Errorf("first move = %+v, want X at (1, 1)", moves[0])
+	}
+	if !moves[1].Proxy || moves[1].At.Sub(moves[0].At) != 5*time.Second {
+		t.Errorf("second move = %+v, want a proxy move 5s after the first", moves[1])
+	}
+
+	if _, err := decodeMoves([]string{"not json"}); err == nil {
+		t.Error("decodeMoves() accepted an invalid entry")
+	}
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	inviteKeyPrefix = "invite"
+	// inviteCodeAlphabet leaves out letters and digits that are easily confused, like O and 0.
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	inviteCodeLength   = 6
+	// inviteCodeAttempts is how many codes are tried before giving up on collisions.
+	inviteCodeAttempts = 5
+)
+
+// Who moves first in a private room.
+const (
+	FirstMoveRandom = "random"
+	FirstMoveHost   = "host"
+	FirstMoveGuest  = "guest"
+)
+
+var (
+	// ErrInviteNotFound is returned for unknown, expired or already used invite codes.
+	ErrInviteNotFound = errors.New("invite code not found or expired")
+	// ErrInviteTaken is returned when another player already took the guest seat.
+	ErrInviteTaken = errors.New("invite code is already taken")
+)
+
+// joinInviteScript seats a player in a private room: the host when ARGV[1] is
+// the host, the guest otherwise. When both seats are taken the invite is used
+// up, and its fields are returned after "ready"; otherwise "waiting" is returned.
+var joinInviteScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {'missing'}
+end
+if redis.call('HGET', KEYS[1], 'host') == ARGV[1] then
+	redis.call('HSET', KEYS[1], 'host_joined', '1')
+else
+	local guest = redis.call('HGET', KEYS[1], 'guest')
+	if guest and guest ~= '' and guest ~= ARGV[1] then
+		return {'taken'}
+	end
+	redis.call('HSET', KEYS[1], 'guest', ARGV[1])
+end
+if redis.call('HGET', KEYS[1], 'host_joined') ~= '1' or (redis.call('HGET', KEYS[1], 'guest') or '') == '' then
+	return {'waiting'}
+end
+local result = {'ready'}
+for _, v in ipairs(redis.call('HGETALL', KEYS[1])) do
+	result[#result + 1] = v
+end
+redis.call('DEL', KEYS[1])
+return result
+`)
+
+// createInviteScript stores an invite unless its code is already in use. ARGV[1]
+// is the expiry in Unix milliseconds, followed by the invite's field-value pairs.
+var createInviteScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+redis.call('PEXPIREAT', KEYS[1], ARGV[1])
+return 1
+`)
+
+// Invite is a private room waiting for its players.
+type Invite struct {
+	Code   string
+	HostID string
+	// GuestID is set once the guest has joined.
+	GuestID string
+	Config  game.Config
+	// FirstMove is FirstMoveRandom, FirstMoveHost or FirstMoveGuest.
+	FirstMove string
+	ExpiresAt time.Time
+}
+
+// InviteRepository defines the interface for private room invites.
+type InviteRepository interface {
+	// Create stores an invite under a new code, valid for ttl.
+	Create(ctx context.Context, invite *Invite, ttl time.Duration) (*Invite, error)
+	// Join seats a player. It returns the invite, used up, once both the host and
+	// a guest have joined, or nil while the other player is still missing.
+	Join(ctx context.Context, code, playerID string) (*Invite, error)
+}
+
+type redisInviteRepository struct {
+	rdb *redis.Client
+}
+
+// NewInviteRepository creates a new Redis-based InviteRepository. Each invite is
+// an invite:<code> hash expiring with the invite.
+func NewInviteRepository(rdb *redis.Client) InviteRepository {
+	return &redisInviteRepository{rdb: rdb}
+}
+
+func inviteKey(code string) string {
+	return fmt.Sprintf("%s:%s", inviteKeyPrefix, code)
+}
+
+// NormalizeInviteCode makes codes typed by hand match the stored ones.
+func NormalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// newInviteCode returns a random, human-readable invite code.
+func newInviteCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	for i := 0; i < inviteCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(inviteCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// Create stores an invite under a new code.
+func (r *redisInviteRepository) Create(ctx context.Context, invite *Invite, ttl time.Duration) (*Invite, error) {
+	ctx, span := tracer.Start(ctx, "InviteRepository.Create")
+	defer span.End()
+
+	created := *invite
+	created.ExpiresAt = time.Now().Add(ttl)
+	for attempt := 0; attempt < inviteCodeAttempts; attempt++ {
+		code, err := newInviteCode()
+		if err != nil {
+			return nil, err
+		}
+		stored, err := createInviteScript.Run(ctx, r.rdb, []string{inviteKey(code)},
+			created.ExpiresAt.UnixMilli(),
+			"host", invite.HostID,
+			game.FieldVariant, invite.Config.Variant,
+			game.FieldBoardSize, invite.Config.Size,
+			game.FieldWinLength, invite.Config.WinLength,
+			"first", invite.FirstMove,
+			game.FieldTimeControl, invite.Config.TimeControl.String(),
+		).Int()
+		if err != nil {
+			return nil, err
+		}
+		if stored == 0 {
+			continue
+		}
+		created.Code = code
+		return &created, nil
+	}
+	return nil, errors.New("could not find a free invite code")
+}
+
+// Join seats a player in a private room.
+func (r *redisInviteRepository) Join(ctx context.Context, code, playerID string) (*Invite, error) {
+	ctx, span := tracer.Start(ctx, "InviteRepository.Join")
+	defer span.End()
+
+	code = NormalizeInviteCode(code)
+	result, err := joinInviteScript.Run(ctx, r.rdb, []string{inviteKey(code)}, playerID).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	switch result[0] {
+	case "missing":
+		return nil, ErrInviteNotFound
+	case "taken":
+		return nil, ErrInviteTaken
+	case "waiting":
+		return nil, nil
+	}
+
+	fields := make(map[string]string, (len(result)-1)/2)
+	for i := 1; i+1 < len(result); i += 2 {
+		fields[result[i]] = result[i+1]
+	}
+	return decodeInvite(code, fields)
+}
+
+// decodeInvite rebuilds an invite from its hash.
+func decodeInvite(code string, fields map[string]string) (*Invite, error) {
+	size, err := strconv.Atoi(fields[game.FieldBoardSize])
+	if err != nil {
+		return nil, fmt.Errorf("invalid invite board size: %w", err)
+	}
+	winLength, err := strconv.Atoi(fields[game.FieldWinLength])
+	if err != nil {
+		return nil, fmt.Errorf("invalid invite win length: %w", err)
+	}
+	cfg, err := game.NewConfig(fields[game.FieldVariant], size, winLength)
+	if err != nil {
+		return nil, err
+	}
+	if raw := fields[game.FieldTimeControl]; raw != "" {
+		if cfg.TimeControl, err = game.ParseTimeControl(raw); err != nil {
+			return nil, fmt.Errorf("invalid invite time control: %w", err)
+		}
+	}
+
+	return &Invite{
+		Code:      code,
+		HostID:    fields["host"],
+		GuestID:   fields["guest"],
+		Config:    cfg,
+		FirstMove: fields["first"],
+	}, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewInviteCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := newInviteCode()
+		if err != nil {
+			t.Fatalf("newInviteCode() returned error: %v", err)
+		}
+		if len(code) != inviteCodeLength {
+			t.Errorf("newInviteCode() = %q, want %d characters", code, inviteCodeLength)
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(inviteCodeAlphabet, c) {
+				t.Errorf("newInviteCode() = %q, contains %q", code, c)
+			}
+		}
+		if NormalizeInviteCode(" "+strings.ToLower(code)+" ") != code {
+			t.Errorf("NormalizeInviteCode() does not restore %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 95 {
+		t.Errorf("newInviteCode() returned only %d distinct codes out of 100", len(seen))
+	}
+}
+
+func TestDecodeInvite(t *testing.T) {
+	invite, err := decodeInvite("ABC234", map[string]string{
+		"host":                "alice",
+		"guest":               "bob",
+		game.FieldVariant:     "classic",
+		game.FieldBoardSize:   "15",
+		game.FieldWinLength:   "5",
+		"first":               FirstMoveHost,
+		game.FieldTimeControl: "30+1",
+		"host_joined":         "1",
+	})
+	if err != nil {
+		t.Fatalf("decodeInvite() returned error: %v", err)
+	}
+	want := Invite{
+		Code:    "ABC234",
+		HostID:  "alice",
+		GuestID: "bob",
+		Config: game.Config{Variant: "classic", Size: 15, WinLength: 5,
+			TimeControl: game.TimeControl{Base: 30 * time.Second, Increment: time.Second}},
+		FirstMove: FirstMoveHost,
+	}
+	if *invite != want {
+		t.Errorf("decodeInvite() = %+v, want %+v", *invite, want)
+	}
+
+	if _, err := decodeInvite("ABC234", map[string]string{game.FieldBoardSize: "x"}); err == nil {
+		t.Error("decodeInvite() accepted an invalid board size")
+	}
+	if _, err := decodeInvite("ABC234", map[string]string{
+		game.FieldBoardSize:   "3",
+		game.FieldWinLength:   "3",
+		game.FieldTimeControl: "forever",
+	}); err == nil {
+		t.Error("decodeInvite() accepted an invalid time control")
+	}
+}
@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -10,67 +13,182 @@ import (
 // var tracer = otel.Tracer("repository.matchmaking")
 
 const (
-	matchmakingQueueKey = "queue:matchmaking"
+	matchmakingQueueKey  = "queue:matchmaking"
+	matchmakingSignalKey = "queue:matchmaking:signal"
+	matchmakingPoolsKey  = "queue:matchmaking:pools"
+	// matchmakingJoinedKey maps each queued player to the Unix time in milliseconds they joined.
+	matchmakingJoinedKey = "queue:matchmaking:joined"
 )
 
+// Matchmaking modes.
+const (
+	// MatchmakingModeFIFO pairs players in the order they joined a pool.
+	MatchmakingModeFIFO = "fifo"
+	// MatchmakingModeRated pairs players with close ratings, see NewRatedMatchmakingRepository.
+	MatchmakingModeRated = "rated"
+)
+
+// popPairScript atomically pops two players from a pool queue if at least two are waiting,
+// so matchers on different nodes never split a pair between them.
+var popPairScript = redis.NewScript(`
+if redis.call('LLEN', KEYS[1]) < 2 then
+	return nil
+end
+local player1 = redis.call('LPOP', KEYS[1])
+local player2 = redis.call('LPOP', KEYS[1])
+local joined = redis.call('HMGET', KEYS[3], player1, player2)
+redis.call('HDEL', KEYS[2], player1, player2)
+redis.call('HDEL', KEYS[3], player1, player2)
+return {player1, player2, joined[1] or '', joined[2] or ''}
+`)
+
+// Match is a pair of players taken from a matchmaking pool.
+type Match struct {
+	Player1ID string
+	Player2ID string
+	Pool      string
+	// Waited is how long the longer-waiting of the two players was queued.
+	Waited time.Duration
+}
+
+// QueueStats describes the players waiting in one matchmaking pool.
+type QueueStats struct {
+	Pool       string
+	Waiting    int
+	OldestWait time.Duration
+}
+
 // MatchmakingRepository defines the interface for matchmaking queue operations.
+// Players are queued into pools; only players in the same pool are matched with each other.
 type MatchmakingRepository interface {
-	AddToQueue(ctx context.Context, playerID string) error
-	GetPlayersFromQueue(ctx context.Context) (player1ID, player2ID string, err error)
+	// AddToQueue queues a player. rating is used by modes that match on skill.
+	AddToQueue(ctx context.Context, playerID, pool string, rating float64) error
+	// GetPlayersFromQueue blocks until two players can be matched and returns them.
+	GetPlayersFromQueue(ctx context.Context) (*Match, error)
 	RemoveFromQueue(ctx context.Context, playerID string) error
+	QueueStats(ctx context.Context) ([]QueueStats, error)
 }
 
 type redisMatchmakingRepository struct {
 	rdb *redis.Client
 }
 
-// NewMatchmakingRepository creates a new Redis-based MatchmakingRepository.
+// NewMatchmakingRepository creates a new Redis-based MatchmakingRepository that
+// pairs players first come, first served.
 func NewMatchmakingRepository(rdb *redis.Client) MatchmakingRepository {
 	return &redisMatchmakingRepository{rdb: rdb}
 }
 
-// AddToQueue adds a player to the matchmaking queue.
-func (r *redisMatchmakingRepository) AddToQueue(ctx context.Context, playerID string) error {
+func poolQueueKey(pool string) string {
+	return fmt.Sprintf("%s:%s", matchmakingQueueKey, pool)
+}
+
+// AddToQueue adds a player to the matchmaking queue of the given pool and signals the matchers.
+func (r *redisMatchmakingRepository) AddToQueue(ctx context.Context, playerID, pool string, rating float64) error {
 	ctx, span := tracer.Start(ctx, "MatchmakingRepository.AddToQueue")
 	defer span.End()
 
-	return r.rdb.RPush(ctx, matchmakingQueueKey, playerID).Err()
+	pipe := r.rdb.TxPipeline()
+	pipe.RPush(ctx, poolQueueKey(pool), playerID)
+	pipe.HSet(ctx, matchmakingPoolsKey, playerID, pool)
+	pipe.HSet(ctx, matchmakingJoinedKey, playerID, time.Now().UnixMilli())
+	pipe.RPush(ctx, matchmakingSignalKey, pool)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-// GetPlayersFromQueue blocks until two players are available in the queue and returns them.
-func (r *redisMatchmakingRepository) GetPlayersFromQueue(ctx context.Context) (string, string, error) {
+// GetPlayersFromQueue blocks until two players are available in the same pool and returns them.
+func (r *redisMatchmakingRepository) GetPlayersFromQueue(ctx context.Context) (*Match, error) {
 	ctx, span := tracer.Start(ctx, "MatchmakingRepository.GetPlayersFromQueue")
 	defer span.End()
 
-	// Block until one player is available
-	player1Res, err := r.rdb.BLPop(ctx, 0, matchmakingQueueKey).Result()
-	if err != nil {
-		return "", "", err
-	}
-	player1ID := player1Res[1]
-	slog.InfoContext(ctx, "Matcher found player 1, waiting for player 2...", "player.id", player1ID)
+	for {
+		// Block until a pool has received a new player
+		signal, err := r.rdb.BLPop(ctx, 0, matchmakingSignalKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		pool := signal[1]
 
-	// Block until a second player is available
-	player2Res, err := r.rdb.BLPop(ctx, 0, matchmakingQueueKey).Result()
-	if err != nil {
-		slog.ErrorContext(ctx, "Matcher error on player 2, re-queuing player 1", "player.id", player1ID, "error", err)
-		if requeueErr := r.AddToQueue(ctx, player1ID); requeueErr != nil {
-			slog.ErrorContext(ctx, "FATAL: Failed to re-queue player", "player.id", player1ID, "error", requeueErr)
+		res, err := popPairScript.Run(ctx, r.rdb, []string{poolQueueKey(pool), matchmakingPoolsKey, matchmakingJoinedKey}).StringSlice()
+		if err == redis.Nil {
+			slog.DebugContext(ctx, "Matcher woke up but pool has fewer than two players", "pool", pool)
+			continue
 		}
-		return "", "", err
-	}
-	player2ID := player2Res[1]
-	slog.InfoContext(ctx, "Matcher found player 2. Creating match...", "player.id", player2ID)
+		if err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Matcher found two players. Creating match...", "player1.id", res[0], "player2.id", res[1], "pool", pool)
 
-	return player1ID, player2ID, nil
+		now := time.Now()
+		waited := max(waitedSince(res[2], now), waitedSince(res[3], now))
+		return &Match{Player1ID: res[0], Player2ID: res[1], Pool: pool, Waited: waited}, nil
+	}
 }
 
-// RemoveFromQueue removes a specific player from the queue.
+// RemoveFromQueue removes a specific player from the queue of whichever pool they joined.
 func (r *redisMatchmakingRepository) RemoveFromQueue(ctx context.Context, playerID string) error {
 	ctx, span := tracer.Start(ctx, "MatchmakingRepository.RemoveFromQueue")
 	defer span.End()
 
+	pool, err := r.rdb.HGet(ctx, matchmakingPoolsKey, playerID).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
 	// LRem removes count occurrences of value from the list.
 	// If count is 0, all occurrences are removed.
-	return r.rdb.LRem(ctx, matchmakingQueueKey, 0, playerID).Err()
+	pipe := r.rdb.TxPipeline()
+	pipe.LRem(ctx, poolQueueKey(pool), 0, playerID)
+	pipe.HDel(ctx, matchmakingPoolsKey, playerID)
+	pipe.HDel(ctx, matchmakingJoinedKey, playerID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// QueueStats returns the number of waiting players and the longest wait of each pool.
+func (r *redisMatchmakingRepository) QueueStats(ctx context.Context) ([]QueueStats, error) {
+	ctx, span := tracer.Start(ctx, "MatchmakingRepository.QueueStats")
+	defer span.End()
+
+	return queueStats(ctx, r.rdb)
+}
+
+// queueStats summarizes the pools and join times shared by all matchmaking modes.
+func queueStats(ctx context.Context, rdb *redis.Client) ([]QueueStats, error) {
+	pools, err := rdb.HGetAll(ctx, matchmakingPoolsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	joined, err := rdb.HGetAll(ctx, matchmakingJoinedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	index := make(map[string]int)
+	var stats []QueueStats
+	for playerID, pool := range pools {
+		i, ok := index[pool]
+		if !ok {
+			i = len(stats)
+			index[pool] = i
+			stats = append(stats, QueueStats{Pool: pool})
+		}
+		stats[i].Waiting++
+		stats[i].OldestWait = max(stats[i].OldestWait, waitedSince(joined[playerID], now))
+	}
+	return stats, nil
+}
+
+// waitedSince returns how long ago the Unix millisecond time joined was, or zero if it is unknown.
+func waitedSince(joined string, now time.Time) time.Duration {
+	ms, err := strconv.ParseInt(joined, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return max(now.Sub(time.UnixMilli(ms)), 0)
 }
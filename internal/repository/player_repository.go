@@ -4,6 +4,7 @@ import (
 	"context"
 	"ctchen222/Tic-Tac-Toe/internal/player"
 	"fmt"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.opentelemetry.io/otel"
@@ -11,6 +12,13 @@ import (
 
 var tracer = otel.Tracer("repository.player")
 
+// Player keys expire after PlayerTTL without a write, or OfflinePlayerTTL once
+// the player is offline, so players who never come back don't stay in Redis.
+const (
+	PlayerTTL        = 24 * time.Hour
+	OfflinePlayerTTL = time.Hour
+)
+
 // PlayerRepository defines the interface for player data operations.
 type PlayerRepository interface {
 	FindForReconnection(ctx context.Context, id string) (roomID string, status player.PlayerStatus, err error)
@@ -18,8 +26,40 @@ type PlayerRepository interface {
 	SetInitialState(ctx context.Context, id, serverID string) error
 	UpdateForMatch(ctx context.Context, id, roomID string) error
 	SetOffline(ctx context.Context, id string) error
+	// LeaveRoom forgets the player's room, so they don't reconnect to it.
+	LeaveRoom(ctx context.Context, id string) error
+	// SetServer records that the player is connected to serverID.
+	SetServer(ctx context.Context, id, serverID string) error
+	// DisconnectServer marks the players of a dead server disconnected from
+	// their rooms and offline otherwise, and returns them.
+	DisconnectServer(ctx context.Context, serverID string) ([]LostPlayer, error)
 }
 
+// LostPlayer is a player whose server died.
+type LostPlayer struct {
+	PlayerID string
+	// RoomID is the room the player was in, if any.
+	RoomID string
+}
+
+// disconnectFromServerScript marks the player of KEYS[1] as lost, provided
+// they are still on server ARGV[1] and not offline: disconnected if they are in
+// a room, which is returned, and offline with an expiry of ARGV[2]
+// milliseconds otherwise. It returns false for players who moved on.
+var disconnectFromServerScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'server_id') ~= ARGV[1] or redis.call('HGET', KEYS[1], 'status') == 'offline' then
+	return false
+end
+local room = redis.call('HGET', KEYS[1], 'room_id')
+if room and room ~= '' then
+	redis.call('HSET', KEYS[1], 'connection_status', 'disconnected')
+	return room
+end
+redis.call('HSET', KEYS[1], 'status', 'offline')
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return ''
+`)
+
 type redisPlayerRepository struct {
 	rdb *redis.Client
 }
@@ -50,7 +90,11 @@ func (r *redisPlayerRepository) UpdateConnectionStatus(ctx context.Context, id s
 	defer span.End()
 
 	playerKey := fmt.Sprintf("player:%s", id)
-	return r.rdb.HSet(ctx, playerKey, "connection_status", string(status)).Err()
+	pipe := r.rdb.Pipeline()
+	pipe.HSet(ctx, playerKey, "connection_status", string(status))
+	pipe.Expire(ctx, playerKey, PlayerTTL)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 // SetInitialState sets the initial data for a newly registered player.
@@ -62,10 +106,59 @@ func (r *redisPlayerRepository) SetInitialState(ctx context.Context, id, serverI
 	pipe := r.rdb.Pipeline()
 	pipe.HSet(ctx, playerKey, "server_id", serverID)
 	pipe.HSet(ctx, playerKey, "status", "waiting")
+	pipe.Expire(ctx, playerKey, PlayerTTL)
+	pipe.SAdd(ctx, serverPlayersKey(serverID), id)
+	pipe.Expire(ctx, serverPlayersKey(serverID), PlayerTTL)
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
+// serverPlayersKey is the set of the players who registered with a server.
+// Players who moved on to another server are only dropped once it is reaped.
+func serverPlayersKey(serverID string) string {
+	return fmt.Sprintf("server:%s:players", serverID)
+}
+
+// SetServer records which server a reconnected player is connected to.
+func (r *redisPlayerRepository) SetServer(ctx context.Context, id, serverID string) error {
+	ctx, span := tracer.Start(ctx, "PlayerRepository.SetServer")
+	defer span.End()
+
+	playerKey := fmt.Sprintf("player:%s", id)
+	pipe := r.rdb.Pipeline()
+	pipe.HSet(ctx, playerKey, "server_id", serverID)
+	pipe.Expire(ctx, playerKey, PlayerTTL)
+	pipe.SAdd(ctx, serverPlayersKey(serverID), id)
+	pipe.Expire(ctx, serverPlayersKey(serverID), PlayerTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// DisconnectServer marks the players still on a dead server as lost and
+// forgets the server's players.
+func (r *redisPlayerRepository) DisconnectServer(ctx context.Context, serverID string) ([]LostPlayer, error) {
+	ctx, span := tracer.Start(ctx, "PlayerRepository.DisconnectServer")
+	defer span.End()
+
+	ids, err := r.rdb.SMembers(ctx, serverPlayersKey(serverID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var lost []LostPlayer
+	for _, id := range ids {
+		roomID, err := disconnectFromServerScript.Run(ctx, r.rdb, []string{fmt.Sprintf("player:%s", id)}, serverID, OfflinePlayerTTL.Milliseconds()).Text()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return lost, err
+		}
+		lost = append(lost, LostPlayer{PlayerID: id, RoomID: roomID})
+	}
+	return lost, r.rdb.Del(ctx, serverPlayersKey(serverID)).Err()
+}
+
 // UpdateForMatch updates a player's state when they are put into a match.
 func (r *redisPlayerRepository) UpdateForMatch(ctx context.Context, id, roomID string) error {
 	ctx, span := tracer.Start(ctx, "PlayerRepository.UpdateForMatch")
@@ -76,6 +169,7 @@ func (r *redisPlayerRepository) UpdateForMatch(ctx context.Context, id, roomID s
 	pipe.HSet(ctx, playerKey, "room_id", roomID)
 	pipe.HSet(ctx, playerKey, "status", "in_game")
 	pipe.HSet(ctx, playerKey, "connection_status", string(player.StatusConnected))
+	pipe.Expire(ctx, playerKey, PlayerTTL)
 	_, err := pipe.Exec(ctx)
 	return err
 }
@@ -86,5 +180,18 @@ func (r *redisPlayerRepository) SetOffline(ctx context.Context, id string) error
 	defer span.End()
 
 	playerKey := fmt.Sprintf("player:%s", id)
-	return r.rdb.HSet(ctx, playerKey, "status", "offline").Err()
+	pipe := r.rdb.Pipeline()
+	pipe.HSet(ctx, playerKey, "status", "offline")
+	pipe.Expire(ctx, playerKey, OfflinePlayerTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LeaveRoom removes the room from a player's data once its game is settled.
+func (r *redisPlayerRepository) LeaveRoom(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "PlayerRepository.LeaveRoom")
+	defer span.End()
+
+	playerKey := fmt.Sprintf("player:%s", id)
+	return r.rdb.HDel(ctx, playerKey, "room_id").Err()
 }
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ratedQueueKeyPrefix = "queue:matchmaking:rated"
+	recentOpponentsKey  = "queue:matchmaking:recent"
+)
+
+// claimPairScript takes two players out of a rated pool if both are still
+// waiting, and remembers them as recent opponents. Matchers on different nodes
+// may pick overlapping pairs; only one of them claims each player.
+var claimPairScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) or not redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1], ARGV[2])
+redis.call('HDEL', KEYS[2], ARGV[1], ARGV[2])
+redis.call('HDEL', KEYS[3], ARGV[1], ARGV[2])
+redis.call('SET', KEYS[4], '1', 'PX', ARGV[3])
+return 1
+`)
+
+// RatedMatchmakingConfig tunes rating-based matchmaking.
+type RatedMatchmakingConfig struct {
+	// BaseWindow is the rating difference accepted as soon as a player joins.
+	BaseWindow float64
+	// WidenPerSecond is how much the window grows for every second a player waits.
+	WidenPerSecond float64
+	// MaxWindow caps the window; zero means it keeps growing.
+	MaxWindow float64
+	// RepeatOpponentAfter is how long a player waits before being matched again
+	// with the opponent of their previous match.
+	RepeatOpponentAfter time.Duration
+	// RecentOpponentTTL is how long a match is remembered.
+	RecentOpponentTTL time.Duration
+	// PollInterval is how often waiting players are reconsidered as their windows widen.
+	PollInterval time.Duration
+}
+
+// DefaultRatedMatchmakingConfig is used by NewRatedMatchmakingRepository for zero fields.
+var DefaultRatedMatchmakingConfig = RatedMatchmakingConfig{
+	BaseWindow:          100,
+	WidenPerSecond:      10,
+	MaxWindow:           800,
+	RepeatOpponentAfter: 30 * time.Second,
+	RecentOpponentTTL:   10 * time.Minute,
+	PollInterval:        time.Second,
+}
+
+// window returns the rating difference accepted for a player who has waited for wait.
+func (c RatedMatchmakingConfig) window(wait time.Duration) float64 {
+	w := c.BaseWindow + c.WidenPerSecond*wait.Seconds()
+	if c.MaxWindow > 0 {
+		w = math.Min(w, c.MaxWindow)
+	}
+	return w
+}
+
+// queuedPlayer is a player waiting in a rated pool.
+type queuedPlayer struct {
+	id     string
+	rating float64
+	wait   time.Duration
+}
+
+// choosePair picks the next pair to match from a pool, or false if nobody can be
+// matched yet. Players are considered longest wait first, and each is paired
+// with the closest-rated player within the window of whichever of the two has
+// waited longer. recent reports whether two players were just matched together.
+func (c RatedMatchmakingConfig) choosePair(players []queuedPlayer, recent func(a, b string) bool) (queuedPlayer, queuedPlayer, bool) {
+	order := make([]queuedPlayer, len(players))
+	copy(order, players)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].wait > order[j].wait })
+
+	for _, p := range order {
+		var best queuedPlayer
+		bestDiff := math.Inf(1)
+		for _, q := range players {
+			if q.id == p.id {
+				continue
+			}
+			diff := math.Abs(p.rating - q.rating)
+			wait := max(p.wait, q.wait)
+			if diff > c.window(wait) || diff >= bestDiff {
+				continue
+			}
+			if wait < c.RepeatOpponentAfter && recent(p.id, q.id) {
+				continue
+			}
+			best, bestDiff = q, diff
+		}
+		if !math.IsInf(bestDiff, 1) {
+			return p, best, true
+		}
+	}
+	return queuedPlayer{}, queuedPlayer{}, false
+}
+
+type ratedMatchmakingRepository struct {
+	rdb *redis.Client
+	cfg RatedMatchmakingConfig
+}
+
+// NewRatedMatchmakingRepository creates a Redis-based MatchmakingRepository that
+// matches players by rating. Each pool is a sorted set scored by rating; a
+// player's acceptable rating difference widens the longer they wait, and the
+// two players of a match are kept apart for a while afterwards.
+func NewRatedMatchmakingRepository(rdb *redis.Client, cfg RatedMatchmakingConfig) MatchmakingRepository {
+	defaults := DefaultRatedMatchmakingConfig
+	if cfg.BaseWindow <= 0 {
+		cfg.BaseWindow = defaults.BaseWindow
+	}
+	if cfg.WidenPerSecond <= 0 {
+		cfg.WidenPerSecond = defaults.WidenPerSecond
+	}
+	if cfg.MaxWindow < 0 {
+		cfg.MaxWindow = 0
+	}
+	if cfg.RepeatOpponentAfter <= 0 {
+		cfg.RepeatOpponentAfter = defaults.RepeatOpponentAfter
+	}
+	if cfg.RecentOpponentTTL <= 0 {
+		cfg.RecentOpponentTTL = defaults.RecentOpponentTTL
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	return &ratedMatchmakingRepository{rdb: rdb, cfg: cfg}
+}
+
+func ratedQueueKey(pool string) string {
+	return fmt.Sprintf("%s:%s", ratedQueueKeyPrefix, pool)
+}
+
+// recentOpponentKey is the same for both orders of the two players.
+func recentOpponentKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%s:%s:%s", recentOpponentsKey, a, b)
+}
+
+// AddToQueue adds a player with their rating to a pool and signals the matchers.
+func (r *ratedMatchmakingRepository) AddToQueue(ctx context.Context, playerID, pool string, rating float64) error {
+	ctx, span := tracer.Start(ctx, "RatedMatchmakingRepository.AddToQueue")
+	defer span.End()
+
+	pipe := r.rdb.TxPipeline()
+	pipe.ZAdd(ctx, ratedQueueKey(pool), &redis.Z{Score: rating, Member: playerID})
+	pipe.HSet(ctx, matchmakingPoolsKey, playerID, pool)
+	pipe.HSet(ctx, matchmakingJoinedKey, playerID, time.Now().UnixMilli())
+	pipe.RPush(ctx, matchmakingSignalKey, pool)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetPlayersFromQueue blocks until two players in the same pool are within each
+// other's rating window. Pools are rechecked whenever a player joins and every
+// PollInterval, as the windows widen.
+func (r *ratedMatchmakingRepository) GetPlayersFromQueue(ctx context.Context) (*Match, error) {
+	ctx, span := tracer.Start(ctx, "RatedMatchmakingRepository.GetPlayersFromQueue")
+	defer span.End()
+
+	for {
+		pools, err := r.waitingPools(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, pool := range pools {
+			match, err := r.matchPool(ctx, pool)
+			if err != nil {
+				return nil, err
+			}
+			if match != nil {
+				return match, nil
+			}
+		}
+
+		// Sleep until a player joins or the windows have widened.
+		if err := r.rdb.BLPop(ctx, r.cfg.PollInterval, matchmakingSignalKey).Err(); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+}
+
+// waitingPools returns the pools with at least two queued players.
+func (r *ratedMatchmakingRepository) waitingPools(ctx context.Context) ([]string, error) {
+	assignments, err := r.rdb.HVals(ctx, matchmakingPoolsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	var pools []string
+	for _, pool := range assignments {
+		counts[pool]++
+		if counts[pool] == 2 {
+			pools = append(pools, pool)
+		}
+	}
+	return pools, nil
+}
+
+// matchPool tries to claim a pair from the pool. It returns nil if no pair is
+// acceptable yet, or another matcher claimed the chosen players first.
+func (r *ratedMatchmakingRepository) matchPool(ctx context.Context, pool string) (*Match, error) {
+	members, err := r.rdb.ZRangeWithScores(ctx, ratedQueueKey(pool), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(members) < 2 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(members))
+	for i, z := range members {
+		ids[i] = z.Member.(string)
+	}
+	joined, err := r.rdb.HMGet(ctx, matchmakingJoinedKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	players := make([]queuedPlayer, len(members))
+	for i, z := range members {
+		joinedAt, _ := joined[i].(string)
+		players[i] = queuedPlayer{id: ids[i], rating: z.Score, wait: waitedSince(joinedAt, now)}
+	}
+
+	var recentErr error
+	recent := func(a, b string) bool {
+		n, err := r.rdb.Exists(ctx, recentOpponentKey(a, b)).Result()
+		if err != nil {
+			recentErr = err
+		}
+		return n > 0
+	}
+	p1, p2, ok := r.cfg.choosePair(players, recent)
+	if recentErr != nil {
+		return nil, recentErr
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	keys := []string{ratedQueueKey(pool), matchmakingPoolsKey, matchmakingJoinedKey, recentOpponentKey(p1.id, p2.id)}
+	claimed, err := claimPairScript.Run(ctx, r.rdb, keys, p1.id, p2.id, r.cfg.RecentOpponentTTL.Milliseconds()).Int()
+	if err != nil {
+		return nil, err
+	}
+	if claimed == 0 {
+		slog.DebugContext(ctx, "Matcher lost the race for a pair", "player1.id", p1.id, "player2.id", p2.id, "pool", pool)
+		return nil, nil
+	}
+	slog.InfoContext(ctx, "Matcher found two players. Creating match...", "player1.id", p1.id, "player2.id", p2.id, "pool", pool,
+		"rating.diff", math.Abs(p1.rating-p2.rating))
+
+	return &Match{Player1ID: p1.id, Player2ID: p2.id, Pool: pool, Waited: max(p1.wait, p2.wait)}, nil
+}
+
+// RemoveFromQueue removes a player from whichever pool they joined.
+func (r *ratedMatchmakingRepository) RemoveFromQueue(ctx context.Context, playerID string) error {
+	ctx, span := tracer.Start(ctx, "RatedMatchmakingRepository.RemoveFromQueue")
+	defer span.End()
+
+	pool, err := r.rdb.HGet(ctx, matchmakingPoolsKey, playerID).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.ZRem(ctx, ratedQueueKey(pool), playerID)
+	pipe.HDel(ctx, matchmakingPoolsKey, playerID)
+	pipe.HDel(ctx, matchmakingJoinedKey, playerID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// QueueStats returns the number of waiting players and the longest wait of each pool.
+func (r *ratedMatchmakingRepository) QueueStats(ctx context.Context) ([]QueueStats, error) {
+	ctx, span := tracer.Start(ctx, "RatedMatchmakingRepository.QueueStats")
+	defer span.End()
+
+	return queueStats(ctx, r.rdb)
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChoosePair(t *testing.T) {
+	cfg := RatedMatchmakingConfig{
+		BaseWindow:          100,
+		WidenPerSecond:      10,
+		MaxWindow:           500,
+		RepeatOpponentAfter: 30 * time.Second,
+	}
+	noneRecent := func(a, b string) bool { return false }
+
+	tests := []struct {
+		name    string
+		players []queuedPlayer
+		recent  func(a, b string) bool
+		want    [2]string
+		wantOK  bool
+	}{
+		{
+			name: "closest rating within the window",
+			players: []queuedPlayer{
+				{id: "a", rating: 1500, wait: 5 * time.Second},
+				{id: "b", rating: 1590},
+				{id: "c", rating: 1530},
+			},
+			recent: noneRecent,
+			want:   [2]string{"a", "c"},
+			wantOK: true,
+		},
+		{
+			name: "too far apart for new players",
+			players: []queuedPlayer{
+				{id: "a", rating: 1500},
+				{id: "b", rating: 1700},
+			},
+			recent: noneRecent,
+		},
+		{
+			name: "window widens with the longer wait",
+			players: []queuedPlayer{
+				{id: "a", rating: 1500, wait: 15 * time.Second},
+				{id: "b", rating: 1700},
+			},
+			recent: noneRecent,
+			want:   [2]string{"a", "b"},
+			wantOK: true,
+		},
+		{
+			name: "window is capped",
+			players: []queuedPlayer{
+				{id: "a", rating: 1000, wait: time.Hour},
+				{id: "b", rating: 1600},
+			},
+			recent: noneRecent,
+		},
+		{
+			name: "longest waiter is matched first",
+			players: []queuedPlayer{
+				{id: "a", rating: 1500},
+				{id: "b", rating: 1510},
+				{id: "c", rating: 1580, wait: 10 * time.Second},
+			},
+			recent: noneRecent,
+			want:   [2]string{"c", "b"},
+			wantOK: true,
+		},
+		{
+			name: "recent opponents are kept apart",
+			players: []queuedPlayer{
+				{id: "a", rating: 1500, wait: 5 * time.Second},
+				{id: "b", rating: 1500},
+				{id: "c", rating: 1550},
+			},
+			recent: func(x, y string) bool { return recentOpponentKey(x, y) == recentOpponentKey("a", "b") },
+			want:   [2]string{"a", "c"},
+			wantOK: true,
+		},
+		{
+			name: "recent opponents are matched again after waiting",
+			players: []queuedPlayer{
+				{id: "a", rating: 1500, wait: time.Minute},
+				{id: "b", rating: 1500},
+			},
+			recent: func(x, y string) bool { return true },
+			want:   [2]string{"a", "b"},
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p1, p2, ok := cfg.choosePair(tt.players, tt.recent)
+			if ok != tt.wantOK {
+				t.Fatalf("choosePair() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && [2]string{p1.id, p2.id} != tt.want {
+				t.Errorf("choosePair() got (%s, %s), want %v", p1.id, p2.id, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecentOpponentKeyIsSymmetric(t *testing.T) {
+	if recentOpponentKey("alice", "bob") != recentOpponentKey("bob", "alice") {
+		t.Error("recentOpponentKey() should not depend on the order of the players")
+	}
+}
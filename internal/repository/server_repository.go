@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ServerTTL is how long a server stays in the registry after its last
+// heartbeat, and how long the janitor lease lasts.
+var ServerTTL = 15 * time.Second
+
+const (
+	// serversKey is the set of every server that joined the registry and
+	// hasn't been reaped yet.
+	serversKey = "servers"
+	// janitorKey holds the ID of the server that reaps dead servers.
+	janitorKey = "servers:janitor"
+)
+
+// acquireJanitorScript takes the janitor lease of KEYS[1] for server ARGV[1],
+// or renews it if the server already holds it, for ARGV[2] milliseconds. It
+// returns 1 if the server holds the lease.
+var acquireJanitorScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if not holder then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// ServerRepository is the registry of the servers sharing the Redis instance.
+type ServerRepository interface {
+	// Heartbeat keeps the server in the registry for another ServerTTL.
+	Heartbeat(ctx context.Context, serverID string) error
+	// AcquireJanitor reports whether the server holds the janitor lease,
+	// taking or renewing it for another ServerTTL.
+	AcquireJanitor(ctx context.Context, serverID string) (bool, error)
+	// Expired returns the servers that stopped heartbeating.
+	Expired(ctx context.Context) ([]string, error)
+	// Forget removes a reaped server from the registry.
+	Forget(ctx context.Context, serverID string) error
+	// Deregister expires a server that is shutting down at once, so the
+	// janitor reaps it without waiting for its entry to expire.
+	Deregister(ctx context.Context, serverID string) error
+}
+
+type redisServerRepository struct {
+	rdb *redis.Client
+}
+
+// NewServerRepository creates a new Redis-based ServerRepository.
+func NewServerRepository(rdb *redis.Client) ServerRepository {
+	return &redisServerRepository{rdb: rdb}
+}
+
+func serverKey(serverID string) string {
+	return fmt.Sprintf("server:%s", serverID)
+}
+
+// Heartbeat records when the server was last alive in server:<id>, which
+// expires after ServerTTL.
+func (r *redisServerRepository) Heartbeat(ctx context.Context, serverID string) error {
+	ctx, span := tracer.Start(ctx, "ServerRepository.Heartbeat")
+	defer span.End()
+
+	pipe := r.rdb.TxPipeline()
+	pipe.Set(ctx, serverKey(serverID), time.Now().UnixMilli(), ServerTTL)
+	pipe.SAdd(ctx, serversKey, serverID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AcquireJanitor takes or renews the janitor lease.
+func (r *redisServerRepository) AcquireJanitor(ctx context.Context, serverID string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "ServerRepository.AcquireJanitor")
+	defer span.End()
+
+	held, err := acquireJanitorScript.Run(ctx, r.rdb, []string{janitorKey}, serverID, ServerTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return held == 1, nil
+}
+
+// Expired returns the registered servers whose server:<id> key expired.
+func (r *redisServerRepository) Expired(ctx context.Context) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "ServerRepository.Expired")
+	defer span.End()
+
+	serverIDs, err := r.rdb.SMembers(ctx, serversKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(serverIDs) == 0 {
+		return nil, nil
+	}
+
+	pipe := r.rdb.Pipeline()
+	alive := make([]*redis.IntCmd, len(serverIDs))
+	for i, id := range serverIDs {
+		alive[i] = pipe.Exists(ctx, serverKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for i, id := range serverIDs {
+		if alive[i].Val() == 0 {
+			expired = append(expired, id)
+		}
+	}
+	return expired, nil
+}
+
+// Forget removes a server from the registry.
+func (r *redisServerRepository) Forget(ctx context.Context, serverID string) error {
+	ctx, span := tracer.Start(ctx, "ServerRepository.Forget")
+	defer span.End()
+
+	return r.rdb.SRem(ctx, serversKey, serverID).Err()
+}
+
+// Deregister deletes the server's server:<id> key, leaving it in the servers
+// set for the janitor to reap.
+func (r *redisServerRepository) Deregister(ctx context.Context, serverID string) error {
+	ctx, span := tracer.Start(ctx, "ServerRepository.Deregister")
+	defer span.End()
+
+	return r.rdb.Del(ctx, serverKey(serverID)).Err()
+}
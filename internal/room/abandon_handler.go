@@ -0,0 +1,125 @@
+package room
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleAbandonment settles a game in progress whose player p exceeded the
+// reconnection grace period. The opponent is first asked to claim the win or
+// wait longer; if they haven't answered by the next cleanup, they win by
+// forfeit. A game both players left ends without a winner.
+func (r *Room) handleAbandonment(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.handleAbandonment", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	marked, err := r.gameRepo.MarkAbandoned(ctx, r.ID, p.ID)
+	switch {
+	case errors.Is(err, repository.ErrOpponentAbandoned):
+		slog.InfoContext(ctx, "Both players left the game", "player.id", p.ID, "room.id", r.ID)
+		if err := r.gameRepo.Abandon(ctx, r.ID); err != nil {
+			slog.ErrorContext(ctx, "failed to abandon game", "room.id", r.ID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to abandon game")
+			return
+		}
+		r.endAbandonedGame(ctx)
+
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to mark player as having left the game", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to mark abandoned game")
+
+	case marked:
+		slog.InfoContext(ctx, "Player left the game. Asking the opponent to claim the win.", "player.id", p.ID, "room.id", r.ID)
+		r.publishNotice(ctx, &proto.ServerToClientMessage{Type: "opponent_abandoned", From: p.ID})
+
+	default:
+		slog.InfoContext(ctx, "Opponent didn't answer in time. Player forfeits.", "player.id", p.ID, "room.id", r.ID)
+		if err := r.gameRepo.Forfeit(ctx, r.ID, p.ID); err != nil {
+			slog.ErrorContext(ctx, "failed to forfeit game", "player.id", p.ID, "room.id", r.ID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Failed to forfeit game")
+			return
+		}
+		r.endAbandonedGame(ctx)
+	}
+}
+
+// handleClaimWin ends the game with a win by forfeit for a player whose
+// opponent left it.
+func (r *Room) handleClaimWin(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.handleClaimWin", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	if err := r.answerAbandonment(ctx, p, r.gameRepo.Forfeit); err != nil {
+		slog.WarnContext(ctx, "Rejected win claim from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected win claim")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	slog.InfoContext(ctx, "Player claimed the win by forfeit", "player.id", p.ID, "room.id", r.ID)
+	r.endAbandonedGame(ctx)
+}
+
+// handleWait gives a player's opponent who left another grace period to reconnect.
+func (r *Room) handleWait(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.handleWait", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	if err := r.answerAbandonment(ctx, p, r.gameRepo.ClearAbandoned); err != nil {
+		slog.WarnContext(ctx, "Rejected wait from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected wait")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+	slog.InfoContext(ctx, "Player waits for the opponent to reconnect", "player.id", p.ID, "room.id", r.ID)
+}
+
+// answerAbandonment applies a player's answer to their opponent leaving the game.
+func (r *Room) answerAbandonment(ctx context.Context, p *player.Player, apply func(ctx context.Context, roomID, playerID string) error) error {
+	state, err := r.gameRepo.FindByID(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+	opponent := state.OpponentOf(p.ID)
+	if opponent == "" {
+		return repository.ErrNotInGame
+	}
+	return apply(ctx, r.ID, opponent)
+}
+
+// endAbandonedGame broadcasts the result of a game that ended because a player
+// left and has every server close the room.
+func (r *Room) endAbandonedGame(ctx context.Context) {
+	state := r.finishGame(ctx)
+	if state == nil {
+		return
+	}
+
+	notice := &proto.ServerToClientMessage{Type: "game_over", Winner: state.Winner, Termination: state.Termination}
+	if err := r.publish(ctx, events.RoomEvent{Type: events.RoomEventGameOver, Notice: notice}); err != nil {
+		slog.ErrorContext(ctx, "failed to publish game over for room", "room.id", r.ID, "error", err)
+	}
+}
@@ -0,0 +1,129 @@
+package room
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/chat"
+	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleChat records a player's chat message or emote and fans it out to every
+// server hosting the room. Rejected messages are reported to the sender only.
+func (r *Room) handleChat(ctx context.Context, p *player.Player, message *proto.ClientToServerMessage) {
+	ctx, span := tracer.Start(ctx, "room.handleChat", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	entry, err := r.chat.Post(ctx, r.ID, p.ID, message)
+	if err != nil {
+		slog.WarnContext(ctx, "Rejected chat message from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected chat message")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	if err := r.publish(ctx, events.RoomEvent{Type: events.RoomEventChat, Chat: entry}); err != nil {
+		slog.ErrorContext(ctx, "failed to publish chat message for room", "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to publish chat message")
+	}
+}
+
+// handleMute mutes or unmutes the opponent of a player.
+func (r *Room) handleMute(ctx context.Context, p *player.Player, message *proto.ClientToServerMessage) {
+	ctx, span := tracer.Start(ctx, "room.handleMute", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+		attribute.Bool("chat.mute", message.Mute),
+	))
+	defer span.End()
+
+	if err := r.chat.SetMuted(ctx, r.ID, p.ID, message.Mute); err != nil {
+		slog.ErrorContext(ctx, "failed to mute opponent", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to mute opponent")
+		return
+	}
+	slog.InfoContext(ctx, "Player changed opponent mute", "player.id", p.ID, "room.id", r.ID, "mute", message.Mute)
+}
+
+// DeliverChat sends a chat message or emote to the room's local players and
+// spectators, except players who muted the sender.
+func (r *Room) DeliverChat(ctx context.Context, entry *proto.ChatEntry) {
+	ctx, span := tracer.Start(ctx, "room.DeliverChat", trace.WithAttributes(
+		attribute.String("room.id", r.ID),
+		attribute.String("player.id", entry.From),
+	))
+	defer span.End()
+
+	muting, err := r.chat.Muting(ctx, r.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get mutes of room", "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to get mutes of room")
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		slog.ErrorContext(ctx, "error marshalling chat message", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Error marshalling chat message")
+		return
+	}
+
+	recipients := append(r.spectators(), r.Players()...)
+	for _, p := range recipients {
+		if p.IsBot || p.Status() != player.StatusConnected || !chat.Visible(*entry, p.ID, muting) {
+			continue
+		}
+		if err := p.Send(data); err != nil {
+			slog.ErrorContext(ctx, "error writing chat message to player", "player.id", p.ID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Error writing chat message")
+		}
+	}
+}
+
+// SendChatHistory replays the room's chat history to a player.
+func (r *Room) SendChatHistory(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.SendChatHistory", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	history, err := r.chat.History(ctx, r.ID, p.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get chat history of room", "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to get chat history")
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+	r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "chat_history", Messages: history})
+}
+
+// sendTo sends a message to a single player.
+func (r *Room) sendTo(ctx context.Context, p *player.Player, message *proto.ServerToClientMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.ErrorContext(ctx, "error marshalling message", "error", err)
+		return
+	}
+	if err := p.Send(data); err != nil {
+		slog.ErrorContext(ctx, "error writing message to player", "player.id", p.ID, "error", err)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"encoding/json"
 	"log/slog"
 
-	"github.com/gorilla/websocket"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -32,15 +31,28 @@ func (r *Room) Broadcast(message *proto.ServerToClientMessage) {
 		return
 	}
 
-	for _, p := range r.Players {
-		if p.Status == player.StatusConnected {
-			if err := p.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+	// Updates carry the whole game state, so a newer one replaces any still queued.
+	send := (*player.Player).Send
+	if message.Type == "update" {
+		send = (*player.Player).SendState
+	}
+
+	for _, p := range r.Players() {
+		if p.Status() == player.StatusConnected {
+			if err := send(p, data); err != nil {
 				slog.ErrorContext(ctx, "error writing message to player", "player.id", p.ID, "error", err)
 				span.RecordError(err)
 				span.SetStatus(codes.Error, "Error writing message to player")
 			}
 		}
 	}
+	for _, s := range r.spectators() {
+		if err := send(s, data); err != nil {
+			slog.ErrorContext(ctx, "error writing message to spectator", "player.id", s.ID, "room.id", r.ID, "error", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Error writing message to spectator")
+		}
+	}
 }
 
 // ReadPump pumps messages from the websocket connection to the room's incomingMoves channel.
@@ -52,7 +64,8 @@ func (r *Room) ReadPump(p *player.Player) {
 	defer span.End()
 
 	defer func() {
-		p.Conn.Close()
+		p.Close()
+		p.SetStatus(player.StatusDisconnected)
 		disconnectCtx, disconnectSpan := tracer.Start(ctx, "room.ReadPump.disconnectHandler", trace.WithAttributes(
 			attribute.String("player.id", p.ID),
 			attribute.String("room.id", r.ID),
@@ -79,13 +92,70 @@ func (r *Room) ReadPump(p *player.Player) {
 	}()
 
 	for {
-		_, msg, err := p.Conn.ReadMessage()
+		_, msg, err := p.ReadMessage()
 		if err != nil {
 			slog.WarnContext(ctx, "Player connection error", "player.id", p.ID, "room.id", r.ID, "error", err)
 			span.RecordError(err)
 			span.SetStatus(codes.Error, "Player connection error")
 			return
 		}
-		r.incomingMoves <- &types.PlayerMove{Player: p, Message: msg}
+		select {
+		case r.incomingMoves <- &types.PlayerMove{Player: p, Message: msg}:
+		case <-r.Done:
+			return
+		}
+	}
+}
+
+// SpectatorReadPump reads from a spectator's connection until it closes, then
+// takes the spectator out of the room and sends the room's ID to left.
+// Spectators can't play, so anything they send is discarded.
+func (r *Room) SpectatorReadPump(s *player.Player, left chan<- string) {
+	ctx, span := tracer.Start(context.Background(), "room.SpectatorReadPump", trace.WithAttributes(
+		attribute.String("player.id", s.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	defer func() {
+		s.Close()
+		if r.RemoveSpectator(s) {
+			if err := r.gameRepo.RemoveSpectator(ctx, r.ID); err != nil {
+				slog.ErrorContext(ctx, "Failed to remove spectator from room", "player.id", s.ID, "room.id", r.ID, "error", err)
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "Failed to remove spectator from room")
+			}
+			r.PublishUpdate(ctx)
+		}
+		slog.InfoContext(ctx, "Spectator left room", "player.id", s.ID, "room.id", r.ID)
+		left <- r.ID
+	}()
+
+	for {
+		if _, _, err := s.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// heartbeat pings the room's players and spectators on this server, and tells
+// each player the round-trip time of their last answered ping. Bots have no
+// connection to keep alive.
+func (r *Room) heartbeat(ctx context.Context) {
+	for _, p := range r.Players() {
+		if p.IsBot || p.Status() != player.StatusConnected {
+			continue
+		}
+		if rtt := p.RTT(); rtt > 0 {
+			r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "latency", RTT: rtt.Milliseconds()})
+		}
+		if err := p.Ping(); err != nil {
+			slog.WarnContext(ctx, "Failed to send ping to player, assuming disconnect", "player.id", p.ID, "room.id", r.ID, "error", err)
+		}
+	}
+	for _, s := range r.spectators() {
+		if err := s.Ping(); err != nil {
+			slog.WarnContext(ctx, "Failed to send ping to spectator", "player.id", s.ID, "room.id", r.ID, "error", err)
+		}
 	}
 }
@@ -0,0 +1,76 @@
+package room
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// exclusiveConn fails the test if two goroutines ever write to it at once.
+type exclusiveConn struct {
+	t       *testing.T
+	writing atomic.Int32
+	written atomic.Int32
+}
+
+func (c *exclusiveConn) WriteMessage(messageType int, data []byte) error {
+	if c.writing.Add(1) > 1 {
+		c.t.Error("concurrent writes to the connection")
+	}
+	time.Sleep(10 * time.Microsecond)
+	c.writing.Add(-1)
+	c.written.Add(1)
+	return nil
+}
+
+func (c *exclusiveConn) ReadMessage() (int, []byte, error) { return 0, nil, errors.New("not readable") }
+func (c *exclusiveConn) Close() error                      { return nil }
+
+func TestBroadcastPingAndSendDoNotWriteConcurrently(t *testing.T) {
+	defer func(size int) { player.SendQueueSize = size }(player.SendQueueSize)
+	player.SendQueueSize = 1000
+
+	conn := &exclusiveConn{t: t}
+	p := player.NewPlayer("p1", conn)
+	spectatorConn := &exclusiveConn{t: t}
+	r := NewRoom("room-1", nil, nil, nil, nil, nil)
+	r.AddPlayer(p)
+	r.AddSpectator(player.NewPlayer("s1", spectatorConn))
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				r.Broadcast(&proto.ServerToClientMessage{Type: "notice"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				p.Ping()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				r.sendTo(context.Background(), p, &proto.ServerToClientMessage{Type: "error"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for conn.written.Load() < 160 || spectatorConn.written.Load() < 80 {
+		if time.Now().After(deadline) {
+			t.Fatalf("wrote %d messages to the player and %d to the spectator, want at least 160 and 80", conn.written.Load(), spectatorConn.written.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,121 @@
+package room
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"log/slog"
+	"time"
+)
+
+// State is the stage of a room's lifecycle. A room waits for the first move,
+// is playing until its game is over, then is finished until a rematch starts
+// another game or it closes.
+type State string
+
+const (
+	StateWaiting  State = "waiting"
+	StatePlaying  State = "playing"
+	StateFinished State = "finished"
+	StateClosed   State = "closed"
+)
+
+var (
+	// IdleRoomTimeout is how long a waiting or finished room stays open with
+	// nobody connected to it on this server. It outlasts the forfeit of players
+	// who left, so it only catches games nobody ever showed up for.
+	IdleRoomTimeout = 5 * time.Minute
+	// FinishedRoomTimeout is how long a finished room waits for a rematch.
+	FinishedRoomTimeout = 10 * time.Minute
+)
+
+// lifecycleCheckInterval is how often the run loop checks the room's timeouts.
+const lifecycleCheckInterval = 10 * time.Second
+
+// CloseRequest asks the hub to close a room. Reason is sent to its players as
+// the reason of their WebSocket close frame.
+type CloseRequest struct {
+	RoomID string
+	Reason string
+}
+
+// stateOf returns the state of a room whose game is in state.
+func stateOf(state *game.GameStateDTO) State {
+	switch {
+	case state.Over():
+		return StateFinished
+	case state.LastMove == nil:
+		return StateWaiting
+	default:
+		return StatePlaying
+	}
+}
+
+// expiry returns why a room that has been in state since the given time
+// should close at now, or "" if it should stay open. idleSince is when the
+// last person connected to the room left, or zero if somebody still is.
+// Games under way are never cut short: clocks and forfeits end them.
+func expiry(state State, since, idleSince, now time.Time) string {
+	if state == StateFinished && now.Sub(since) >= FinishedRoomTimeout {
+		return "rematch window expired"
+	}
+	if state != StatePlaying && !idleSince.IsZero() && now.Sub(idleSince) >= IdleRoomTimeout {
+		return "room idle"
+	}
+	return ""
+}
+
+// State returns the room's lifecycle state.
+func (r *Room) State() State {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	return r.state
+}
+
+// setState moves the room to state. Closed rooms stay closed.
+func (r *Room) setState(state State) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	if r.state == state || r.state == StateClosed {
+		return
+	}
+	slog.Info("Room changed state", "room.id", r.ID, "from", r.state, "to", state)
+	r.state = state
+	r.stateSince = time.Now()
+}
+
+// checkExpiry asks the hub to close the room once it timed out.
+func (r *Room) checkExpiry(now time.Time) {
+	if r.hasAudience() {
+		r.idleSince = time.Time{}
+	} else if r.idleSince.IsZero() {
+		r.idleSince = now
+	}
+
+	r.stateMu.Lock()
+	state, since := r.state, r.stateSince
+	r.stateMu.Unlock()
+
+	if reason := expiry(state, since, r.idleSince, now); reason != "" {
+		slog.Info("Room timed out", "room.id", r.ID, "state", state, "reason", reason)
+		r.requestClose(reason)
+	}
+}
+
+// hasAudience reports whether a player or spectator is connected to the room
+// on this server. Bots don't count.
+func (r *Room) hasAudience() bool {
+	for _, p := range r.Players() {
+		if !p.IsBot && p.Status() == player.StatusConnected {
+			return true
+		}
+	}
+	return len(r.spectators()) > 0
+}
+
+// requestClose asks the hub to close the room, unless it already closed.
+func (r *Room) requestClose(reason string) {
+	select {
+	case r.closeRoom <- CloseRequest{RoomID: r.ID, Reason: reason}:
+	case <-r.Done:
+	}
+}
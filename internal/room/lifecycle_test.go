@@ -0,0 +1,57 @@
+package room
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"testing"
+	"time"
+)
+
+func TestStateOf(t *testing.T) {
+	move := &game.Move{Player: game.PlayerX, Piece: game.PlayerX, Row: 1, Col: 1}
+	tests := []struct {
+		name  string
+		state game.GameStateDTO
+		want  State
+	}{
+		{"no move yet", game.GameStateDTO{}, StateWaiting},
+		{"under way", game.GameStateDTO{LastMove: move}, StatePlaying},
+		{"won", game.GameStateDTO{Winner: game.PlayerX, LastMove: move}, StateFinished},
+		{"aborted before a move", game.GameStateDTO{Termination: game.TerminationAbort}, StateFinished},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stateOf(&tt.state); got != tt.want {
+				t.Errorf("stateOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Now()
+	long := now.Add(-time.Hour)
+	recent := now.Add(-time.Second)
+
+	tests := []struct {
+		name      string
+		state     State
+		since     time.Time
+		idleSince time.Time
+		expired   bool
+	}{
+		{"finished with players waiting for a rematch", StateFinished, recent, time.Time{}, false},
+		{"rematch window over", StateFinished, long, time.Time{}, true},
+		{"finished and deserted", StateFinished, recent, long, true},
+		{"waiting for a first move", StateWaiting, long, time.Time{}, false},
+		{"nobody showed up", StateWaiting, long, long, true},
+		{"just deserted", StateWaiting, long, recent, false},
+		{"game under way and deserted", StatePlaying, long, long, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiry(tt.state, tt.since, tt.idleSince, now); (got != "") != tt.expired {
+				t.Errorf("expiry() = %q, want expired %v", got, tt.expired)
+			}
+		})
+	}
+}
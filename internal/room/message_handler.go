@@ -2,14 +2,18 @@ package room
 
 import (
 	"context"
+	"ctchen222/Tic-Tac-Toe/internal/chat"
 	"ctchen222/Tic-Tac-Toe/internal/events"
 	"ctchen222/Tic-Tac-Toe/internal/game"
 	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
 	"ctchen222/Tic-Tac-Toe/internal/validator"
 	"ctchen222/Tic-Tac-Toe/pkg/proto"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -28,7 +32,7 @@ func (r *Room) HandleMessage(p *player.Player, rawMessage []byte) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if p.Status == player.StatusDisconnected {
+	if p.Status() == player.StatusDisconnected {
 		slog.WarnContext(ctx, "ignoring message from disconnected player", "player.id", p.ID)
 		span.SetStatus(codes.Error, "Message from disconnected player")
 		return
@@ -56,6 +60,28 @@ func (r *Room) HandleMessage(p *player.Player, rawMessage []byte) {
 		r.handleMove(ctx, p, &message)
 	case "rematch":
 		r.handleRematch(ctx, p, &message)
+	case chat.TypeChat, chat.TypeEmote:
+		r.handleChat(ctx, p, &message)
+	case "mute":
+		r.handleMute(ctx, p, &message)
+	case "takeback_request":
+		r.handleTakebackRequest(ctx, p)
+	case "takeback_response":
+		r.handleTakebackResponse(ctx, p, &message)
+	case "resign":
+		r.handleResign(ctx, p)
+	case "abort":
+		r.handleAbort(ctx, p)
+	case "offer_draw":
+		r.handleOfferDraw(ctx, p)
+	case "accept_draw":
+		r.handleDrawAnswer(ctx, p, true)
+	case "decline_draw":
+		r.handleDrawAnswer(ctx, p, false)
+	case "claim_win":
+		r.handleClaimWin(ctx, p)
+	case "wait":
+		r.handleWait(ctx, p)
 	}
 }
 
@@ -64,8 +90,7 @@ func (r *Room) handleMove(ctx context.Context, p *player.Player, message *proto.
 	ctx, moveSpan := tracer.Start(ctx, "room.handleMove", trace.WithAttributes(
 		attribute.String("player.id", p.ID),
 		attribute.String("room.id", r.ID),
-		attribute.Int("move.row", message.Position[0]),
-		attribute.Int("move.col", message.Position[1]),
+		attribute.IntSlice("move.position", message.Position),
 	))
 	defer moveSpan.End()
 
@@ -77,20 +102,38 @@ func (r *Room) handleMove(ctx context.Context, p *player.Player, message *proto.
 		return
 	}
 
-	var playerMark game.PlayerMark
-	if p.ID == gameState.PlayerXID {
-		playerMark = game.PlayerX
-	} else if p.ID == gameState.PlayerOID {
-		playerMark = game.PlayerO
-	}
-
-	if playerMark == "" {
+	playerMark := gameState.MarkOf(p.ID)
+	if playerMark == game.None {
 		slog.WarnContext(ctx, "player is not part of room", "player.id", p.ID, "room.id", r.ID)
 		moveSpan.SetStatus(codes.Error, "Player not part of room")
 		return
 	}
 
-	_, err = r.gameRepo.Update(ctx, r.ID, playerMark, message.Position[0], message.Position[1])
+	ruleset, err := gameState.Ruleset()
+	if err != nil {
+		slog.ErrorContext(ctx, "handleMove could not find ruleset for room", "room.id", r.ID, "variant", gameState.Variant, "error", err)
+		moveSpan.RecordError(err)
+		moveSpan.SetStatus(codes.Error, "Unknown game variant")
+		return
+	}
+	moveSpan.SetAttributes(attribute.String("game.variant", ruleset.Name()))
+
+	move, err := ruleset.ParseMove(gameState.State(), playerMark, message.Position, message.Piece)
+	if err != nil {
+		slog.WarnContext(ctx, "malformed move from player", "player.id", p.ID, "error", err)
+		moveSpan.SetAttributes(attribute.Bool("move.valid", false))
+		moveSpan.RecordError(err)
+		moveSpan.SetStatus(codes.Error, "Malformed move")
+		return
+	}
+
+	newState, err := r.gameRepo.Update(ctx, r.ID, move)
+	if errors.Is(err, repository.ErrFlagFell) {
+		slog.InfoContext(ctx, "Player moved after their time ran out", "player.id", p.ID, "room.id", r.ID)
+		moveSpan.SetAttributes(attribute.Bool("move.valid", false))
+		r.finishGame(ctx)
+		return
+	}
 	if err != nil {
 		slog.WarnContext(ctx, "invalid move from player", "player.id", p.ID, "error", err)
 		moveSpan.SetAttributes(attribute.Bool("move.valid", false))
@@ -100,12 +143,60 @@ func (r *Room) handleMove(ctx context.Context, p *player.Player, message *proto.
 	}
 	moveSpan.SetAttributes(attribute.Bool("move.valid", true))
 
-	roomChannel := fmt.Sprintf("channel:room:%s", r.ID)
-	if err := r.rdb.Publish(ctx, roomChannel, "update").Err(); err != nil {
+	r.PublishUpdate(ctx)
+
+	if newState.Over() {
+		r.notifyGameOver(ctx, newState, newState.Termination)
+	}
+}
+
+// PublishUpdate tells the servers hosting the room to broadcast its current state.
+func (r *Room) PublishUpdate(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "room.PublishUpdate", trace.WithAttributes(
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	if err := r.publish(ctx, events.RoomEvent{Type: events.RoomEventUpdate}); err != nil {
 		slog.ErrorContext(ctx, "failed to publish update for room", "room.id", r.ID, "error", err)
-		moveSpan.RecordError(err)
-		moveSpan.SetStatus(codes.Error, "Failed to publish room update")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to publish room update")
+	}
+}
+
+// publish sends an event to every server hosting the room.
+func (r *Room) publish(ctx context.Context, event events.RoomEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
 	}
+	return r.rdb.Publish(ctx, events.RoomChannel(r.ID), data).Err()
+}
+
+// notifyGameOver passes a finished game and its moves to the room's
+// GameOverHandler. An empty termination, as for games finished on servers that
+// didn't record one, is worked out from the result.
+func (r *Room) notifyGameOver(ctx context.Context, state *game.GameStateDTO, termination game.Termination) {
+	if r.gameOver == nil {
+		return
+	}
+
+	moves, err := r.gameRepo.Moves(ctx, r.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get moves of finished game", "room.id", r.ID, "error", err)
+	}
+	if termination == "" {
+		termination = game.TerminationOf(state.Winner, moves)
+	}
+
+	r.gameOver.HandleGameOver(ctx, GameOver{
+		RoomID:          r.ID,
+		State:           state,
+		BotDifficulties: state.BotDifficulties,
+		Termination:     termination,
+		Moves:           moves,
+		EndedAt:         time.Now(),
+	})
 }
 
 // handleRematch processes a player's rematch request.
@@ -124,7 +215,7 @@ func (r *Room) handleRematch(ctx context.Context, p *player.Player, message *pro
 		return
 	}
 
-	if gameState.Winner == game.None && !gameState.IsDraw {
+	if !gameState.Over() {
 		slog.WarnContext(ctx, "Player requested rematch, but game is not over", "player.id", p.ID)
 		span.SetStatus(codes.Error, "Rematch requested before game over")
 		return
@@ -139,7 +230,7 @@ func (r *Room) handleRematch(ctx context.Context, p *player.Player, message *pro
 	}
 
 	var otherPlayerIsBot bool
-	for _, other := range r.Players {
+	for _, other := range r.Players() {
 		if other.ID != p.ID && other.IsBot {
 			otherPlayerIsBot = true
 			break
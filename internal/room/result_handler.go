@@ -0,0 +1,144 @@
+package room
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleResign ends the game with a win for the player's opponent.
+func (r *Room) handleResign(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.handleResign", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	if err := r.gameRepo.Resign(ctx, r.ID, p.ID); err != nil {
+		slog.WarnContext(ctx, "Rejected resignation from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected resignation")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	slog.InfoContext(ctx, "Player resigned", "player.id", p.ID, "room.id", r.ID)
+	r.finishGame(ctx)
+}
+
+// handleAbort calls off a game in which at most one player has moved.
+func (r *Room) handleAbort(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.handleAbort", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	if err := r.gameRepo.Abort(ctx, r.ID, p.ID); err != nil {
+		slog.WarnContext(ctx, "Rejected abort from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected abort")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	slog.InfoContext(ctx, "Player aborted the game", "player.id", p.ID, "room.id", r.ID)
+	r.finishGame(ctx)
+}
+
+// handleOfferDraw records a player's draw offer and asks the opponent, on
+// whichever server they are, to answer it.
+func (r *Room) handleOfferDraw(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.handleOfferDraw", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	if err := r.gameRepo.OfferDraw(ctx, r.ID, p.ID); err != nil {
+		slog.WarnContext(ctx, "Rejected draw offer from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected draw offer")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	slog.InfoContext(ctx, "Player offered a draw", "player.id", p.ID, "room.id", r.ID)
+	r.publishNotice(ctx, &proto.ServerToClientMessage{Type: "draw_offer", From: p.ID})
+}
+
+// handleDrawAnswer accepts or declines the opponent's draw offer.
+func (r *Room) handleDrawAnswer(ctx context.Context, p *player.Player, accept bool) {
+	ctx, span := tracer.Start(ctx, "room.handleDrawAnswer", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+		attribute.Bool("draw.accept", accept),
+	))
+	defer span.End()
+
+	offerer, err := r.gameRepo.ResolveDrawOffer(ctx, r.ID, p.ID, accept)
+	if err != nil {
+		slog.WarnContext(ctx, "Rejected draw answer from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected draw answer")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	if !accept {
+		slog.InfoContext(ctx, "Player declined a draw", "player.id", p.ID, "room.id", r.ID)
+		r.publishNotice(ctx, &proto.ServerToClientMessage{Type: "draw_declined", From: offerer})
+		return
+	}
+
+	slog.InfoContext(ctx, "Player accepted a draw", "player.id", p.ID, "room.id", r.ID)
+	r.finishGame(ctx)
+}
+
+// handleFlagFall ends the game with a loss on time once the clock of the player
+// to move has run out. Of the servers hosting the room, only the first one to
+// call the flag finishes the game.
+func (r *Room) handleFlagFall(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "room.handleFlagFall", trace.WithAttributes(
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	err := r.gameRepo.FlagFall(ctx, r.ID)
+	switch {
+	case errors.Is(err, repository.ErrClockRunning), errors.Is(err, game.ErrGameOver):
+		// The player moved in time, or another server called the flag first.
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to call flag fall", "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to call flag fall")
+		return
+	}
+
+	slog.InfoContext(ctx, "Player to move ran out of time", "room.id", r.ID)
+	r.finishGame(ctx)
+}
+
+// finishGame broadcasts the result of a game that ended without a move and
+// reports it to the room's GameOverHandler. It returns the final state, or nil
+// if it couldn't be read.
+func (r *Room) finishGame(ctx context.Context) *game.GameStateDTO {
+	r.PublishUpdate(ctx)
+
+	state, err := r.gameRepo.FindByID(ctx, r.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not get state of finished game", "room.id", r.ID, "error", err)
+		return nil
+	}
+	r.notifyGameOver(ctx, state, state.Termination)
+	return state
+}
@@ -0,0 +1,396 @@
+package room
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// flaggedGameRepo holds a bot game whose player to move has run out of time.
+type flaggedGameRepo struct {
+	repository.GameRepository
+	state *game.GameStateDTO
+}
+
+func (f *flaggedGameRepo) FlagFall(ctx context.Context, roomID string) error {
+	f.state.Winner = game.PlayerO
+	f.state.Termination = game.TerminationTimeout
+	return nil
+}
+
+func (f *flaggedGameRepo) FindByID(ctx context.Context, id string) (*game.GameStateDTO, error) {
+	state := *f.state
+	return &state, nil
+}
+
+func (f *flaggedGameRepo) Moves(ctx context.Context, roomID string) ([]game.MoveRecord, error) {
+	return nil, nil
+}
+
+type recordedGameOvers []GameOver
+
+func (r *recordedGameOvers) HandleGameOver(ctx context.Context, over GameOver) {
+	*r = append(*r, over)
+}
+
+func TestFlagFallWithoutLocalPlayersKeepsBotDifficulty(t *testing.T) {
+	games := &flaggedGameRepo{state: &game.GameStateDTO{
+		Variant:         game.DefaultVariant,
+		Board:           game.NewBoard(3, 3),
+		CurrentTurn:     game.PlayerX,
+		PlayerXID:       "alice",
+		PlayerOID:       "bot-1234",
+		TimeControl:     game.TimeControl{Base: time.Minute},
+		BotDifficulties: map[string]string{"bot-1234": "hard"},
+	}}
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 10 * time.Millisecond})
+	defer rdb.Close()
+
+	// A room started for spectators only has neither the player nor the bot.
+	var overs recordedGameOvers
+	r := NewRoom("room-1", rdb, games, nil, &overs, nil)
+	r.handleFlagFall(context.Background())
+
+	if len(overs) != 1 {
+		t.Fatalf("got %d game overs, want 1", len(overs))
+	}
+	if got := overs[0].BotDifficulties["bot-1234"]; got != "hard" {
+		t.Errorf("BotDifficulties[bot-1234] = %q, want hard", got)
+	}
+	if overs[0].Termination != game.TerminationTimeout {
+		t.Errorf("Termination = %q, want %q", overs[0].Termination, game.TerminationTimeout)
+	}
+}
+
+// resultGameRepo keeps a single game in memory and ends it the way the Redis
+// repository does.
+type resultGameRepo struct {
+	repository.GameRepository
+	state     game.GameStateDTO
+	moves     []game.MoveRecord
+	drawOffer string
+}
+
+func newResultGameRepo() *resultGameRepo {
+	return &resultGameRepo{state: game.GameStateDTO{
+		Variant:     game.DefaultVariant,
+		Board:       game.NewBoard(3, 3),
+		CurrentTurn: game.PlayerX,
+		Winner:      game.None,
+		PlayerXID:   "alice",
+		PlayerOID:   "bob",
+	}}
+}
+
+func (f *resultGameRepo) markOf(playerID string) game.PlayerMark {
+	switch playerID {
+	case f.state.PlayerXID:
+		return game.PlayerX
+	case f.state.PlayerOID:
+		return game.PlayerO
+	}
+	return game.None
+}
+
+func (f *resultGameRepo) finish(winner game.PlayerMark, termination game.Termination) {
+	f.state.Winner = winner
+	f.state.IsDraw = winner == game.DRAW
+	f.state.Termination = termination
+	f.drawOffer = ""
+}
+
+func (f *resultGameRepo) Resign(ctx context.Context, roomID, playerID string) error {
+	switch f.markOf(playerID) {
+	case game.PlayerX:
+		f.finish(game.PlayerO, game.TerminationResign)
+	case game.PlayerO:
+		f.finish(game.PlayerX, game.TerminationResign)
+	default:
+		return repository.ErrNotInGame
+	}
+	return nil
+}
+
+func (f *resultGameRepo) Abort(ctx context.Context, roomID, playerID string) error {
+	if f.markOf(playerID) == game.None {
+		return repository.ErrNotInGame
+	}
+	if !game.Abortable(f.moves) {
+		return repository.ErrNotAbortable
+	}
+	f.finish(game.None, game.TerminationAbort)
+	return nil
+}
+
+func (f *resultGameRepo) OfferDraw(ctx context.Context, roomID, playerID string) error {
+	if f.markOf(playerID) == game.None {
+		return repository.ErrNotInGame
+	}
+	if f.drawOffer != "" {
+		return repository.ErrDrawOfferPending
+	}
+	f.drawOffer = playerID
+	return nil
+}
+
+func (f *resultGameRepo) ResolveDrawOffer(ctx context.Context, roomID, playerID string, accept bool) (string, error) {
+	offerer := f.drawOffer
+	if offerer == "" || offerer == playerID || f.markOf(playerID) == game.None {
+		return "", repository.ErrNoDrawOffer
+	}
+	f.drawOffer = ""
+	if accept {
+		f.finish(game.DRAW, game.TerminationAgreement)
+	}
+	return offerer, nil
+}
+
+func (f *resultGameRepo) FindByID(ctx context.Context, id string) (*game.GameStateDTO, error) {
+	state := f.state
+	return &state, nil
+}
+
+func (f *resultGameRepo) Moves(ctx context.Context, roomID string) ([]game.MoveRecord, error) {
+	return f.moves, nil
+}
+
+// recordingConn passes every message written to it to the test.
+type recordingConn struct {
+	messages chan proto.ServerToClientMessage
+}
+
+func newRecordingConn() *recordingConn {
+	return &recordingConn{messages: make(chan proto.ServerToClientMessage, 64)}
+}
+
+func (c *recordingConn) WriteMessage(messageType int, data []byte) error {
+	var message proto.ServerToClientMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	c.messages <- message
+	return nil
+}
+
+func (c *recordingConn) ReadMessage() (int, []byte, error) { return 0, nil, errors.New("not readable") }
+func (c *recordingConn) Close() error                      { return nil }
+
+// next returns the next message written to the connection.
+func (c *recordingConn) next(t *testing.T) proto.ServerToClientMessage {
+	t.Helper()
+	select {
+	case message := <-c.messages:
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("no message was written to the connection")
+		return proto.ServerToClientMessage{}
+	}
+}
+
+var errNotPublished = errors.New("publish recorded but not sent")
+
+// publishRecorder is a redis hook that records the room events published to
+// any room channel instead of sending them.
+type publishRecorder struct {
+	mu     sync.Mutex
+	events map[string][]events.RoomEvent
+}
+
+// newPublishRecorder returns a client whose room events end up in the
+// returned recorder. Other commands fail, as there is no server to reach.
+func newPublishRecorder(t *testing.T) (*redis.Client, *publishRecorder) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 10 * time.Millisecond})
+	t.Cleanup(func() { rdb.Close() })
+	recorder := &publishRecorder{events: make(map[string][]events.RoomEvent)}
+	rdb.AddHook(recorder)
+	return rdb, recorder
+}
+
+func (p *publishRecorder) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	args := cmd.Args()
+	if cmd.Name() != "publish" || len(args) != 3 {
+		return ctx, nil
+	}
+	channel, _ := args[1].(string)
+	data, _ := args[2].([]byte)
+	var event events.RoomEvent
+	if err := json.Unmarshal(data, &event); err == nil {
+		p.mu.Lock()
+		p.events[channel] = append(p.events[channel], event)
+		p.mu.Unlock()
+	}
+	return ctx, errNotPublished
+}
+
+func (p *publishRecorder) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (p *publishRecorder) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (p *publishRecorder) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// roomEvents returns the events published to the room so far.
+func (p *publishRecorder) roomEvents(roomID string) []events.RoomEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]events.RoomEvent(nil), p.events[events.RoomChannel(roomID)]...)
+}
+
+// newResultRoom returns a room in which alice plays X and bob plays O.
+func newResultRoom(t *testing.T, games *resultGameRepo) (*Room, *publishRecorder, *recordedGameOvers, map[string]*recordingConn) {
+	rdb, published := newPublishRecorder(t)
+	overs := &recordedGameOvers{}
+	r := NewRoom("room-1", rdb, games, nil, overs, nil)
+	conns := make(map[string]*recordingConn)
+	for _, id := range []string{"alice", "bob"} {
+		conns[id] = newRecordingConn()
+		p := player.NewPlayer(id, conns[id])
+		t.Cleanup(func() { p.Close() })
+		r.AddPlayer(p)
+	}
+	return r, published, overs, conns
+}
+
+func sendMessage(t *testing.T, r *Room, playerID, messageType string) {
+	t.Helper()
+	for _, p := range r.Players() {
+		if p.ID == playerID {
+			r.HandleMessage(p, []byte(`{"type":"`+messageType+`"}`))
+			return
+		}
+	}
+	t.Fatalf("player %s is not in the room", playerID)
+}
+
+func TestResignEndsGameForOpponent(t *testing.T) {
+	games := newResultGameRepo()
+	r, published, overs, _ := newResultRoom(t, games)
+
+	sendMessage(t, r, "alice", "resign")
+
+	if games.state.Termination != game.TerminationResign || games.state.Winner != game.PlayerO {
+		t.Errorf("stored result = %q won by %q, want %q won by %q", games.state.Termination, games.state.Winner, game.TerminationResign, game.PlayerO)
+	}
+	if got := published.roomEvents("room-1"); len(got) != 1 || got[0].Type != events.RoomEventUpdate {
+		t.Errorf("published %+v, want a single update", got)
+	}
+	if len(*overs) != 1 || (*overs)[0].Termination != game.TerminationResign {
+		t.Errorf("game overs = %+v, want one ended by resignation", *overs)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	tests := []struct {
+		name        string
+		moves       []game.MoveRecord
+		termination game.Termination
+	}{
+		{name: "Before any move", termination: game.TerminationAbort},
+		{name: "After one player moved", moves: []game.MoveRecord{{Move: game.Move{Player: game.PlayerX}}}, termination: game.TerminationAbort},
+		{name: "After both players moved", moves: []game.MoveRecord{{Move: game.Move{Player: game.PlayerX}}, {Move: game.Move{Player: game.PlayerO, Row: 1}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			games := newResultGameRepo()
+			games.moves = tt.moves
+			r, published, overs, conns := newResultRoom(t, games)
+
+			sendMessage(t, r, "bob", "abort")
+
+			if games.state.Termination != tt.termination {
+				t.Errorf("stored termination = %q, want %q", games.state.Termination, tt.termination)
+			}
+			got := published.roomEvents("room-1")
+			if tt.termination == "" {
+				if len(got) != 0 || len(*overs) != 0 {
+					t.Errorf("published %+v and reported %d game overs for a rejected abort", got, len(*overs))
+				}
+				if message := conns["bob"].next(t); message.Type != "error" || message.Reason != repository.ErrNotAbortable.Error() {
+					t.Errorf("sent %+v to bob, want the error %q", message, repository.ErrNotAbortable)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Type != events.RoomEventUpdate {
+				t.Errorf("published %+v, want a single update", got)
+			}
+			if len(*overs) != 1 || (*overs)[0].Termination != game.TerminationAbort {
+				t.Errorf("game overs = %+v, want one aborted game", *overs)
+			}
+		})
+	}
+}
+
+func TestDrawOffer(t *testing.T) {
+	tests := []struct {
+		name        string
+		answer      string
+		notices     []string
+		termination game.Termination
+	}{
+		{name: "Accepted", answer: "accept_draw", notices: []string{"draw_offer"}, termination: game.TerminationAgreement},
+		{name: "Declined", answer: "decline_draw", notices: []string{"draw_offer", "draw_declined"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			games := newResultGameRepo()
+			r, published, overs, _ := newResultRoom(t, games)
+
+			sendMessage(t, r, "alice", "offer_draw")
+			if games.drawOffer != "alice" {
+				t.Fatalf("stored draw offer from %q, want alice", games.drawOffer)
+			}
+			sendMessage(t, r, "bob", tt.answer)
+
+			if games.state.Termination != tt.termination {
+				t.Errorf("stored termination = %q, want %q", games.state.Termination, tt.termination)
+			}
+			if games.drawOffer != "" {
+				t.Errorf("draw offer from %q is still pending", games.drawOffer)
+			}
+
+			var notices []string
+			var updates int
+			for _, event := range published.roomEvents("room-1") {
+				switch event.Type {
+				case events.RoomEventNotice:
+					if event.Notice.From != "alice" {
+						t.Errorf("%s notice is from %q, want alice", event.Notice.Type, event.Notice.From)
+					}
+					notices = append(notices, event.Notice.Type)
+				case events.RoomEventUpdate:
+					updates++
+				}
+			}
+			if !slices.Equal(notices, tt.notices) {
+				t.Errorf("published notices %v, want %v", notices, tt.notices)
+			}
+
+			wantOvers := 0
+			if tt.termination != "" {
+				wantOvers = 1
+			}
+			if updates != wantOvers || len(*overs) != wantOvers {
+				t.Fatalf("published %d updates and reported %d game overs, want %d of each", updates, len(*overs), wantOvers)
+			}
+			if wantOvers == 1 && ((*overs)[0].Termination != game.TerminationAgreement || !(*overs)[0].State.IsDraw) {
+				t.Errorf("game over = %+v, want a draw by agreement", (*overs)[0])
+			}
+		})
+	}
+}
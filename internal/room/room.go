@@ -2,126 +2,180 @@ package room
 
 import (
 	"context"
+	"ctchen222/Tic-Tac-Toe/internal/chat"
 	"ctchen222/Tic-Tac-Toe/internal/game"
 	"ctchen222/Tic-Tac-Toe/internal/hub/types"
 	"ctchen222/Tic-Tac-Toe/internal/player"
 	"ctchen222/Tic-Tac-Toe/internal/repository"
-	"ctchen222/Tic-Tac-Toe/pkg/proto"
-	"encoding/json"
 	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/gorilla/websocket"
 	"go.opentelemetry.io/otel"
 )
 
-const (
-	heartbeatInterval = 10 * time.Second
-)
-
 var reconnectionGracePeriod = 60 * time.Second
+
+// MaxSpectators is how many spectators may watch a room across all servers.
+var MaxSpectators = 50
 var tracer = otel.Tracer("room")
 
 // MoveCalculator defines an interface for an agent that can calculate a game move.
+// It returns false if the player to move has no legal move, or if ctx is done
+// before it found one.
 type MoveCalculator interface {
-	CalculateNextMove(board [][]game.PlayerMark, mark game.PlayerMark, difficulty string) (row, col int)
+	CalculateNextMove(ctx context.Context, ruleset game.Ruleset, state game.State, difficulty string) (move game.Move, ok bool)
+}
+
+// GameOver describes a game that has just finished in a room.
+type GameOver struct {
+	RoomID string
+	State  *game.GameStateDTO
+	// BotDifficulties maps the player ID of each bot in the game to its difficulty.
+	BotDifficulties map[string]string
+	Termination     game.Termination
+	// Moves are the moves of the game in the order they were played.
+	Moves   []game.MoveRecord
+	EndedAt time.Time
+}
+
+// GameOverHandler is notified once for every game that finishes, on the node
+// that applied the final move or noticed the game was abandoned.
+type GameOverHandler interface {
+	HandleGameOver(ctx context.Context, over GameOver)
+}
+
+// GameOverHandlers notifies each of its handlers in turn.
+type GameOverHandlers []GameOverHandler
+
+func (hs GameOverHandlers) HandleGameOver(ctx context.Context, over GameOver) {
+	for _, h := range hs {
+		h.HandleGameOver(ctx, over)
+	}
 }
 
 // Room represents a game room.
 type Room struct {
-	ID             string
-	rdb            *redis.Client
-	gameRepo       repository.GameRepository
-	playerRepo     repository.PlayerRepository
-	Players        []*player.Player
-	mu             sync.Mutex
-	incomingMoves  chan *types.PlayerMove
-	unregister     chan *player.Player
-	moveCalculator MoveCalculator
-	moveTimeout    time.Duration
-	Done           chan struct{}
+	ID         string
+	rdb        *redis.Client
+	gameRepo   repository.GameRepository
+	playerRepo repository.PlayerRepository
+	// players are the room's players on this server. The hub adds them while
+	// the room's goroutines read them, so they are guarded by playersMu.
+	players   []*player.Player
+	playersMu sync.Mutex
+	// Spectators watch the game from this server. They receive every broadcast
+	// but their messages are never read as moves.
+	Spectators    []*player.Player
+	spectatorsMu  sync.Mutex
+	mu            sync.Mutex
+	incomingMoves chan *types.PlayerMove
+	unregister    chan *player.Player
+	closeRoom     chan<- CloseRequest
+	gameOver      GameOverHandler
+	chat          *chat.Service
+	Done          chan struct{}
+	closeOnce     sync.Once
+
+	stateMu    sync.Mutex
+	state      State
+	stateSince time.Time
+	// idleSince is when the run loop first saw nobody connected, or zero.
+	idleSince time.Time
 }
 
 // NewRoom creates a new game room.
-func NewRoom(id string, rdb *redis.Client, gameRepo repository.GameRepository, playerRepo repository.PlayerRepository, calculator MoveCalculator, timeout time.Duration) *Room {
+func NewRoom(id string, rdb *redis.Client, gameRepo repository.GameRepository, playerRepo repository.PlayerRepository, gameOver GameOverHandler, chatService *chat.Service) *Room {
 	return &Room{
-		ID:             id,
-		rdb:            rdb,
-		gameRepo:       gameRepo,
-		playerRepo:     playerRepo,
-		Players:        make([]*player.Player, 0, 2),
-		incomingMoves:  make(chan *types.PlayerMove, 10),
-		unregister:     make(chan *player.Player),
-		moveCalculator: calculator,
-		moveTimeout:    timeout,
-		Done:           make(chan struct{}),
+		ID:            id,
+		rdb:           rdb,
+		gameRepo:      gameRepo,
+		playerRepo:    playerRepo,
+		players:       make([]*player.Player, 0, 2),
+		incomingMoves: make(chan *types.PlayerMove, 10),
+		unregister:    make(chan *player.Player),
+		gameOver:      gameOver,
+		chat:          chatService,
+		Done:          make(chan struct{}),
+		state:         StateWaiting,
+		stateSince:    time.Now(),
 	}
 }
 
-// Start starts the game room, launching the main game loop and listening for player disconnections.
-func (r *Room) Start(unregisterPlayer chan<- *player.Player) {
-	for _, p := range r.Players {
-		if !p.IsBot {
+// Start starts the game room, launching the main game loop and passing on the
+// players who left for good to unregisterPlayer until the room is closed. The
+// room sends a CloseRequest to closeRoom once it should be closed.
+func (r *Room) Start(unregisterPlayer chan<- *player.Player, closeRoom chan<- CloseRequest) {
+	r.closeRoom = closeRoom
+	for _, p := range r.Players() {
+		// Absent players have no connection to read from.
+		if !p.IsBot && p.Conn != nil {
 			go r.ReadPump(p)
 		}
 	}
 	go r.run()
 
-	for p := range r.unregister {
-		unregisterPlayer <- p
+	for {
+		select {
+		case p := <-r.unregister:
+			select {
+			case unregisterPlayer <- p:
+			case <-r.Done:
+				return
+			}
+		case <-r.Done:
+			return
+		}
 	}
 }
 
+// Close stops the room's game loop and its bots, and disconnects its spectators.
+// It is safe to call more than once.
+func (r *Room) Close() {
+	r.closeOnce.Do(func() {
+		r.setState(StateClosed)
+		close(r.Done)
+		for _, p := range r.Players() {
+			if p.IsBot && p.Conn != nil {
+				p.Close()
+			}
+		}
+		for _, s := range r.spectators() {
+			s.Close()
+		}
+	})
+}
+
 // run is the main game loop for the room.
 func (r *Room) run() {
 	ctx := context.Background()
-	moveTimer := time.NewTimer(r.moveTimeout)
-	pingTicker := time.NewTicker(heartbeatInterval)
+	flagTimer := time.NewTimer(0)
+	pingTicker := time.NewTicker(player.HeartbeatInterval)
 	cleanupTicker := time.NewTicker(reconnectionGracePeriod)
+	lifecycleTicker := time.NewTicker(lifecycleCheckInterval)
 
 	defer func() {
-		moveTimer.Stop()
+		flagTimer.Stop()
 		pingTicker.Stop()
 		cleanupTicker.Stop()
+		lifecycleTicker.Stop()
 	}()
 
 	for {
 		gameState, err := r.gameRepo.FindByID(ctx, r.ID)
 		if err != nil {
 			slog.ErrorContext(ctx, "run loop cannot get game state, closing room", "room.id", r.ID, "error", err)
-			if len(r.Players) > 0 {
-				r.unregister <- r.Players[0]
-			}
+			r.requestClose("room not found")
 			return
 		}
+		r.setState(stateOf(gameState))
 
-		var currentPlayer *player.Player
-		for _, p := range r.Players {
-			var mark game.PlayerMark
-			if p.ID == gameState.PlayerXID {
-				mark = game.PlayerX
-			} else if p.ID == gameState.PlayerOID {
-				mark = game.PlayerO
-			}
-
-			if mark == gameState.CurrentTurn {
-				currentPlayer = p
-				break
-			}
-		}
-
-		isLocalTurn := currentPlayer != nil
-
-		if isLocalTurn {
-			if currentPlayer.Status == player.StatusConnected {
-				moveTimer.Reset(r.moveTimeout)
-			} else {
-				moveTimer.Reset(1 * time.Second)
-			}
-		} else {
-			moveTimer.Stop()
+		// Every server hosting the room watches the clock of the player to
+		// move, wherever they are connected.
+		flagTimer.Stop()
+		if !gameState.Over() && !gameState.TimeControl.IsZero() {
+			flagTimer.Reset(gameState.TimeLeft(gameState.CurrentTurn, time.Now()))
 		}
 
 		select {
@@ -130,48 +184,33 @@ func (r *Room) run() {
 			return
 
 		case move := <-r.incomingMoves:
-			if !moveTimer.Stop() {
-				select {
-				case <-moveTimer.C:
-				default:
-				}
-			}
 			r.HandleMessage(move.Player, move.Message)
 
-		case <-moveTimer.C:
-			if !isLocalTurn {
-				continue
-			}
-
-			if gameState.Winner != game.None || gameState.IsDraw {
-				continue
-			}
+		case <-flagTimer.C:
+			r.handleFlagFall(ctx)
 
-			slog.Info("Player timed out", "player.id", currentPlayer.ID, "room.id", r.ID)
-			row, col := r.moveCalculator.CalculateNextMove(game.BoardArrayToSlice(gameState.Board), gameState.CurrentTurn, "medium")
-
-			if row != -1 && col != -1 {
-				slog.Info("Proxy move for player", "player.id", currentPlayer.ID, "row", row, "col", col)
-				moveMsg := proto.ClientToServerMessage{Type: "move", Position: []int{row, col}}
-				moveBytes, _ := json.Marshal(moveMsg)
-				r.HandleMessage(currentPlayer, moveBytes)
-			}
+		case now := <-lifecycleTicker.C:
+			r.checkExpiry(now)
 
 		case <-pingTicker.C:
-			for _, p := range r.Players {
-				if p.Status == player.StatusConnected {
-					if err := p.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-						slog.Warn("Failed to send ping to player, assuming disconnect", "player.id", p.ID, "error", err)
-					}
-				}
-			}
+			r.heartbeat(ctx)
 
 		case <-cleanupTicker.C:
 			r.mu.Lock()
-			for _, p := range r.Players {
-				if p.Status == player.StatusDisconnected && time.Since(p.LastSeen) > reconnectionGracePeriod {
-					slog.Info("Player exceeded reconnection grace period. Removing from room.", "player.id", p.ID, "room.id", r.ID)
-					r.unregister <- p
+			for _, p := range r.Players() {
+				if p.Status() != player.StatusDisconnected || time.Since(p.LastSeen()) <= reconnectionGracePeriod {
+					continue
+				}
+				// Players who left a game in progress stay in the room until
+				// the game is settled, so they may still come back.
+				if !gameState.Over() {
+					r.handleAbandonment(ctx, p)
+					continue
+				}
+				slog.Info("Player exceeded reconnection grace period. Removing from room.", "player.id", p.ID, "room.id", r.ID)
+				select {
+				case r.unregister <- p:
+				case <-r.Done:
 				}
 			}
 			r.mu.Unlock()
@@ -5,12 +5,130 @@ import (
 	"ctchen222/Tic-Tac-Toe/internal/player"
 )
 
-// AddPlayer adds a player to the room.
+// AddPlayer adds a player to the room. A player who reconnected replaces
+// their old connection.
 func (r *Room) AddPlayer(p *player.Player) {
-	r.Players = append(r.Players, p)
+	r.playersMu.Lock()
+	defer r.playersMu.Unlock()
+	for i, other := range r.players {
+		if other.ID == p.ID {
+			r.players[i] = p
+			return
+		}
+	}
+	r.players = append(r.players, p)
+}
+
+// AddAbsentPlayer adds a player of the room who isn't connected to this
+// server, unless the room already has them. The room settles their game like
+// that of any disconnected player, unless they reconnect in time.
+func (r *Room) AddAbsentPlayer(id string) {
+	r.playersMu.Lock()
+	defer r.playersMu.Unlock()
+	for _, other := range r.players {
+		if other.ID == id {
+			return
+		}
+	}
+	p := player.NewPlayer(id, nil)
+	p.SetStatus(player.StatusDisconnected)
+	r.players = append(r.players, p)
+}
+
+// RemoveAbsentPlayer takes out a player who isn't connected to this server,
+// such as one added with AddAbsentPlayer, once they reconnected elsewhere. It
+// returns the player taken out, or nil.
+func (r *Room) RemoveAbsentPlayer(id string) *player.Player {
+	r.playersMu.Lock()
+	defer r.playersMu.Unlock()
+	for i, other := range r.players {
+		if other.ID == id && !other.IsBot && other.Status() == player.StatusDisconnected {
+			r.players = append(r.players[:i], r.players[i+1:]...)
+			return other
+		}
+	}
+	return nil
+}
+
+// RemoveBots takes the room's bots out and stops them. It reports whether the
+// room had any.
+func (r *Room) RemoveBots() bool {
+	r.playersMu.Lock()
+	var bots []*player.Player
+	kept := r.players[:0]
+	for _, p := range r.players {
+		if p.IsBot {
+			bots = append(bots, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	r.players = kept
+	r.playersMu.Unlock()
+
+	for _, b := range bots {
+		if b.Conn != nil {
+			b.Close()
+		}
+	}
+	return len(bots) > 0
+}
+
+// Players returns a copy of the room's players on this server.
+func (r *Room) Players() []*player.Player {
+	r.playersMu.Lock()
+	defer r.playersMu.Unlock()
+	return append([]*player.Player(nil), r.players...)
+}
+
+// AddSpectator adds a spectator to the room.
+func (r *Room) AddSpectator(s *player.Player) {
+	r.spectatorsMu.Lock()
+	defer r.spectatorsMu.Unlock()
+	r.Spectators = append(r.Spectators, s)
+}
+
+// RemoveSpectator removes a spectator from the room. It reports whether the
+// spectator was in the room.
+func (r *Room) RemoveSpectator(s *player.Player) bool {
+	r.spectatorsMu.Lock()
+	defer r.spectatorsMu.Unlock()
+	for i, other := range r.Spectators {
+		if other == s {
+			r.Spectators = append(r.Spectators[:i], r.Spectators[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// spectators returns a copy of the room's spectators.
+func (r *Room) spectators() []*player.Player {
+	r.spectatorsMu.Lock()
+	defer r.spectatorsMu.Unlock()
+	return append([]*player.Player(nil), r.Spectators...)
+}
+
+// Empty reports whether the room has neither players nor spectators on this server.
+func (r *Room) Empty() bool {
+	return len(r.Players()) == 0 && len(r.spectators()) == 0
 }
 
 // IncomingMoves returns the channel for incoming player moves.
 func (r *Room) IncomingMoves() chan<- *types.PlayerMove {
 	return r.incomingMoves
 }
+
+// OnlyBotsBesides reports whether every player in the room other than playerID is a bot.
+func (r *Room) OnlyBotsBesides(playerID string) bool {
+	found := false
+	for _, p := range r.Players() {
+		switch {
+		case p.ID == playerID:
+			found = true
+		case !p.IsBot:
+			return false
+		}
+	}
+	return found
+}
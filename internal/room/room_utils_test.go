@@ -0,0 +1,38 @@
+package room
+
+import (
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"testing"
+)
+
+func TestAbsentPlayers(t *testing.T) {
+	r := NewRoom("room-1", nil, nil, nil, nil, nil)
+	connected := player.NewPlayer("x", &exclusiveConn{t: t})
+	r.AddPlayer(connected)
+
+	r.AddAbsentPlayer("x")
+	r.AddAbsentPlayer("o")
+	players := r.Players()
+	if len(players) != 2 || players[0] != connected || players[1].ID != "o" {
+		t.Fatalf("Players() = %v, want the connected player and the absent one", players)
+	}
+	if players[1].Status() != player.StatusDisconnected {
+		t.Errorf("absent player status = %s, want disconnected", players[1].Status())
+	}
+
+	// A player who reconnected here replaces their absent self.
+	reconnected := player.NewPlayer("o", &exclusiveConn{t: t})
+	r.AddPlayer(reconnected)
+	r.RemoveAbsentPlayer("o")
+	r.RemoveAbsentPlayer("x")
+	if players := r.Players(); len(players) != 2 || players[1] != reconnected {
+		t.Fatalf("Players() = %v, want both connected players", players)
+	}
+
+	// One who reconnected elsewhere leaves the room.
+	r.AddAbsentPlayer("z")
+	r.RemoveAbsentPlayer("z")
+	if players := r.Players(); len(players) != 2 {
+		t.Errorf("Players() = %v, want the absent player gone", players)
+	}
+}
@@ -3,6 +3,8 @@ package room
 import (
 	"context"
 	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/repository"
 	"ctchen222/Tic-Tac-Toe/pkg/proto"
 	"encoding/json"
 	"log/slog"
@@ -27,7 +29,9 @@ func (r *Room) resetGameForRematch(ctx context.Context) {
 		return
 	}
 
-	err = r.gameRepo.Create(ctx, r.ID, oldGameState.PlayerOID, oldGameState.PlayerXID)
+	err = r.gameRepo.Create(ctx, r.ID, oldGameState.PlayerOID, oldGameState.PlayerXID, oldGameState.Config(), repository.RoomSettings{
+		Bots: oldGameState.BotDifficulties,
+	})
 	if err != nil {
 		slog.ErrorContext(ctx, "failed to reset game for rematch in redis", "error", err)
 		span.RecordError(err)
@@ -66,13 +70,18 @@ func (r *Room) HandleOpponentDisconnected() {
 	r.Broadcast(msg)
 }
 
-// HandleOpponentReconnected broadcasts a message to local players that the opponent has reconnected.
-func (r *Room) HandleOpponentReconnected() {
-	_, span := tracer.Start(context.Background(), "room.HandleOpponentReconnected", trace.WithAttributes(
+// HandleOpponentReconnected tells the local players other than playerID that
+// their opponent has reconnected.
+func (r *Room) HandleOpponentReconnected(playerID string) {
+	ctx, span := tracer.Start(context.Background(), "room.HandleOpponentReconnected", trace.WithAttributes(
 		attribute.String("room.id", r.ID),
+		attribute.String("player.id", playerID),
 	))
 	defer span.End()
 
-	msg := &proto.ServerToClientMessage{Type: "opponent_reconnected"}
-	r.Broadcast(msg)
+	for _, p := range r.Players() {
+		if p.ID != playerID && !p.IsBot && p.Status() == player.StatusConnected {
+			r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "opponent_reconnected"})
+		}
+	}
 }
@@ -0,0 +1,71 @@
+package room
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/events"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleTakebackRequest records a player's request to take back their last
+// move and asks the opponent, on whichever server they are, to answer it.
+func (r *Room) handleTakebackRequest(ctx context.Context, p *player.Player) {
+	ctx, span := tracer.Start(ctx, "room.handleTakebackRequest", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+	))
+	defer span.End()
+
+	if err := r.gameRepo.RequestTakeback(ctx, r.ID, p.ID); err != nil {
+		slog.WarnContext(ctx, "Rejected takeback request from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected takeback request")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	slog.InfoContext(ctx, "Player requested a takeback", "player.id", p.ID, "room.id", r.ID)
+	r.publishNotice(ctx, &proto.ServerToClientMessage{Type: "takeback_request", From: p.ID})
+}
+
+// handleTakebackResponse answers the opponent's takeback request. An accepted
+// request rolls the game back and every server broadcasts the new position.
+func (r *Room) handleTakebackResponse(ctx context.Context, p *player.Player, message *proto.ClientToServerMessage) {
+	ctx, span := tracer.Start(ctx, "room.handleTakebackResponse", trace.WithAttributes(
+		attribute.String("player.id", p.ID),
+		attribute.String("room.id", r.ID),
+		attribute.Bool("takeback.accept", message.Accept),
+	))
+	defer span.End()
+
+	requester, err := r.gameRepo.ResolveTakeback(ctx, r.ID, p.ID, message.Accept)
+	if err != nil {
+		slog.WarnContext(ctx, "Rejected takeback response from player", "player.id", p.ID, "room.id", r.ID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Rejected takeback response")
+		r.sendTo(ctx, p, &proto.ServerToClientMessage{Type: "error", Reason: err.Error()})
+		return
+	}
+
+	if !message.Accept {
+		slog.InfoContext(ctx, "Player declined a takeback", "player.id", p.ID, "room.id", r.ID)
+		r.publishNotice(ctx, &proto.ServerToClientMessage{Type: "takeback_declined", From: requester})
+		return
+	}
+
+	slog.InfoContext(ctx, "Player accepted a takeback", "player.id", p.ID, "room.id", r.ID)
+	r.PublishUpdate(ctx)
+	r.publishNotice(ctx, &proto.ServerToClientMessage{Type: "takeback_accepted", From: requester})
+}
+
+// publishNotice delivers a message to the room's players and spectators on every server.
+func (r *Room) publishNotice(ctx context.Context, message *proto.ServerToClientMessage) {
+	if err := r.publish(ctx, events.RoomEvent{Type: events.RoomEventNotice, Notice: message}); err != nil {
+		slog.ErrorContext(ctx, "failed to publish notice for room", "room.id", r.ID, "message.type", message.Type, "error", err)
+	}
+}
@@ -1,15 +1,29 @@
 package server
 
 import (
+	"context"
 	"ctchen222/Tic-Tac-Toe/internal/api/controller"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/response"
+	"ctchen222/Tic-Tac-Toe/internal/api/service"
+	"ctchen222/Tic-Tac-Toe/internal/game"
 	"ctchen222/Tic-Tac-Toe/internal/hub"
 	"ctchen222/Tic-Tac-Toe/internal/hub/types"
 	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/internal/replay"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -19,23 +33,66 @@ import (
 
 var tracer = otel.Tracer("server")
 
+const (
+	// Subprotocol is the WebSocket subprotocol of the game.
+	Subprotocol = "tictactoe"
+	// bearerSubprotocolPrefix marks a token offered as a subprotocol, for clients
+	// that can't set headers on the handshake.
+	bearerSubprotocolPrefix = "bearer."
+	// authTimeout is how long a client that sent no token in the handshake has to
+	// send an auth message.
+	authTimeout = 5 * time.Second
+)
+
+// errAuthTimeout is returned when no auth message arrives within authTimeout.
+var errAuthTimeout = errors.New("no auth message received in time")
+
+// PlayerAuthenticator resolves the player a token was issued for.
+type PlayerAuthenticator interface {
+	PlayerIDFromToken(ctx context.Context, token string) (string, error)
+}
+
+// ReplaySource rebuilds the positions of archived games for replays.
+type ReplaySource interface {
+	GetReplay(ctx context.Context, gameID string) (*models.Replay, error)
+}
+
 type Server struct {
 	hub            *hub.Hub
 	engine         *gin.Engine
 	upgrader       websocket.Upgrader
 	userController *controller.UserController
+	roomController *controller.RoomController
+	gameController *controller.GameController
+	auth           PlayerAuthenticator
+	replays        ReplaySource
+
+	// replayCtx is cancelled by CloseReplays to end the replays being served,
+	// which liveReplays counts. replayMu keeps replays from starting once it is.
+	replayCtx   context.Context
+	stopReplays context.CancelFunc
+	replayMu    sync.Mutex
+	liveReplays sync.WaitGroup
 }
 
 // NewServer creates a new Server instance.
-func NewServer(h *hub.Hub, uc *controller.UserController) *Server {
+func NewServer(h *hub.Hub, uc *controller.UserController, rc *controller.RoomController, gc *controller.GameController, auth PlayerAuthenticator, replays ReplaySource) *Server {
 	engine := gin.Default()
+	replayCtx, stopReplays := context.WithCancel(context.Background())
 	s := &Server{
 		hub:            h,
 		engine:         engine,
 		userController: uc,
+		roomController: rc,
+		gameController: gc,
+		auth:           auth,
+		replays:        replays,
+		replayCtx:      replayCtx,
+		stopReplays:    stopReplays,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
+			Subprotocols:    []string{Subprotocol},
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
@@ -63,10 +120,21 @@ func (s *Server) registerHandlers() {
 		api.POST("/register", s.userController.Register)
 		api.POST("/login", s.userController.Login)
 		api.POST("/guest-login", s.userController.GuestLogin)
+		api.GET("/users/:id", s.userController.GetUser)
+		api.GET("/users/:id/games", s.gameController.ListUserGames)
+		api.GET("/games/:id", s.gameController.GetGame)
+		api.GET("/games/:id/replay", s.gameController.GetReplay)
+		api.GET("/me", s.userController.Me)
+		api.POST("/rooms", s.roomController.Create)
 	}
 }
 
-// handleWebSocket upgrades the connection and passes a registration request to the hub.
+// handleWebSocket upgrades the connection, authenticates it and passes a
+// registration request to the hub. The token is taken from the Authorization
+// header, a "bearer.<token>" subprotocol, or else the first message, which must
+// then be {"type": "auth", "token": ...}. Connections that fail authentication
+// are closed with one of the proto.Close* codes. Connections with a "replay"
+// game ID play that game back instead of joining the hub.
 func (s *Server) handleWebSocket(c *gin.Context) {
 	ctx, span := tracer.Start(c.Request.Context(), "server.handleWebSocket", trace.WithAttributes(
 		attribute.String("http.url", c.Request.URL.String()),
@@ -74,6 +142,22 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 	))
 	defer span.End()
 
+	gameConfig, err := parseGameConfig(c)
+	if err != nil {
+		slog.WarnContext(ctx, "Rejected websocket connection with invalid game settings", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Invalid game settings")
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	replaySpeed, err := parseReplaySpeed(c)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Invalid replay speed")
+		response.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		slog.ErrorContext(ctx, "Failed to upgrade connection", "error", err)
@@ -82,24 +166,224 @@ func (s *Server) handleWebSocket(c *gin.Context) {
 		return
 	}
 
-	playerID := c.Query("playerId")
-	if playerID == "" {
-		playerID = uuid.New().String()
+	playerID, code, err := s.authenticate(ctx, c.Request, conn)
+	if err != nil {
+		slog.WarnContext(ctx, "Rejected unauthenticated websocket connection", "error", err, "close.code", code)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Authentication failed")
+		closeWithCode(conn, code, err.Error())
+		return
 	}
 	span.SetAttributes(attribute.String("player.id", playerID))
 
+	if gameID := c.Query("replay"); gameID != "" {
+		s.startReplay(ctx, conn, gameID, replaySpeed)
+		return
+	}
+
+	// A draining server sends new players to the other servers.
+	if s.hub.Draining() {
+		span.SetStatus(codes.Error, "Server draining")
+		closeWithCode(conn, websocket.CloseServiceRestart, "server draining")
+		return
+	}
+
 	p := player.NewPlayer(playerID, conn)
 
 	mode := c.DefaultQuery("mode", "human")
 	difficulty := c.DefaultQuery("difficulty", "easy")
-	span.SetAttributes(attribute.String("game.mode", mode), attribute.String("game.difficulty", difficulty))
+	span.SetAttributes(attribute.String("game.mode", mode), attribute.String("game.difficulty", difficulty), attribute.String("game.config", gameConfig.Key()))
+
+	spectate := c.Query("spectate")
+	if spectate != "" {
+		span.SetAttributes(attribute.String("room.id", spectate))
+	}
 
 	req := &types.RegistrationRequest{
-		Player:     p,
-		PlayerID:   p.ID,
-		Mode:       mode,
-		Difficulty: difficulty,
-		Ctx:        ctx,
+		Player:         p,
+		PlayerID:       p.ID,
+		Mode:           mode,
+		Difficulty:     difficulty,
+		Config:         gameConfig,
+		SpectateRoomID: spectate,
+		JoinCode:       c.Query("join"),
+		Ctx:            ctx,
 	}
 	s.hub.Register() <- req
 }
+
+// startReplay plays an archived game back over conn, or closes it if the game
+// can't be replayed.
+func (s *Server) startReplay(ctx context.Context, conn *websocket.Conn, gameID string, speed float64) {
+	ctx, span := tracer.Start(ctx, "server.startReplay", trace.WithAttributes(
+		attribute.String("game.id", gameID),
+	))
+	defer span.End()
+
+	r, err := s.replays.GetReplay(ctx, gameID)
+	if errors.Is(err, service.ErrGameNotFound) {
+		slog.WarnContext(ctx, "Rejected replay of unknown game", "game.id", gameID)
+		span.SetStatus(codes.Error, "Game not found")
+		closeWithCode(conn, proto.CloseGameNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load replay", "game.id", gameID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to load replay")
+		closeWithCode(conn, websocket.CloseInternalServerErr, "failed to load replay")
+		return
+	}
+
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	if s.replayCtx.Err() != nil {
+		span.SetStatus(codes.Error, "Server draining")
+		closeWithCode(conn, websocket.CloseServiceRestart, "server draining")
+		return
+	}
+
+	// The replay outlives the upgrade request, but not the server.
+	s.liveReplays.Add(1)
+	go func() {
+		defer s.liveReplays.Done()
+		replay.Serve(trace.ContextWithSpan(s.replayCtx, span), conn, gameID, r.Frames, speed)
+	}()
+}
+
+// CloseReplays ends the replays being served, telling their clients to
+// reconnect elsewhere, and waits for them to close or for ctx to be done.
+// Replays requested afterwards are turned away.
+func (s *Server) CloseReplays(ctx context.Context) {
+	s.replayMu.Lock()
+	s.stopReplays()
+	s.replayMu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		s.liveReplays.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		slog.WarnContext(ctx, "Shutdown deadline reached with replays open")
+	}
+}
+
+// parseReplaySpeed reads the optional "speed" query parameter of replays,
+// clamped to the supported range.
+func parseReplaySpeed(c *gin.Context) (float64, error) {
+	raw := c.Query("speed")
+	if raw == "" {
+		return 1, nil
+	}
+	speed, err := strconv.ParseFloat(raw, 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid replay speed %q", raw)
+	}
+	return replay.ClampSpeed(speed), nil
+}
+
+// authenticate returns the player ID of the connection's token. On failure it
+// also returns the close code to reject the connection with.
+func (s *Server) authenticate(ctx context.Context, r *http.Request, conn *websocket.Conn) (string, int, error) {
+	token := handshakeToken(r)
+	if token == "" {
+		var err error
+		token, err = readAuthMessage(conn)
+		if errors.Is(err, errAuthTimeout) {
+			return "", proto.CloseAuthTimeout, err
+		}
+		if err != nil {
+			return "", proto.CloseUnauthorized, err
+		}
+	}
+
+	playerID, err := s.auth.PlayerIDFromToken(ctx, token)
+	if err != nil {
+		return "", proto.CloseUnauthorized, err
+	}
+	// Older clients still send the player ID they expect to play as.
+	if requested := r.URL.Query().Get("playerId"); requested != "" && requested != playerID {
+		return "", proto.CloseForbidden, fmt.Errorf("token does not belong to player %q", requested)
+	}
+	return playerID, 0, nil
+}
+
+// handshakeToken returns the bearer token of the upgrade request, or "" if it has none.
+func handshakeToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if token, ok := strings.CutPrefix(protocol, bearerSubprotocolPrefix); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// readAuthMessage waits for the auth message of a connection and returns its token.
+func readAuthMessage(conn *websocket.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "", errAuthTimeout
+		}
+		return "", err
+	}
+
+	var msg proto.ClientToServerMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "auth" || msg.Token == "" {
+		return "", errors.New("first message must be an auth message with a token")
+	}
+	return msg.Token, nil
+}
+
+// closeWithCode sends a close frame with the given code and closes the connection.
+func closeWithCode(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+}
+
+// parseGameConfig reads the optional "variant", "size", "win" and "tc" query parameters.
+// The board defaults to the one the variant is usually played on, and the win length
+// to the usual one for the requested board size. The time control is left zero
+// when "tc" is missing, so the hub can pick one for the kind of game.
+func parseGameConfig(c *gin.Context) (game.Config, error) {
+	var size, winLength int
+	if raw := c.Query("size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n == 0 {
+			return game.Config{}, fmt.Errorf("invalid board size %q", raw)
+		}
+		size = n
+	}
+
+	if raw := c.Query("win"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n == 0 {
+			return game.Config{}, fmt.Errorf("invalid win length %q", raw)
+		}
+		winLength = n
+	}
+
+	cfg, err := game.ResolveConfig(c.Query("variant"), size, winLength)
+	if err != nil {
+		return game.Config{}, err
+	}
+	if raw := c.Query("tc"); raw != "" {
+		tc, err := game.ParseTimeControl(raw)
+		if err != nil {
+			return game.Config{}, fmt.Errorf("invalid time control %q: %w", raw, err)
+		}
+		cfg.TimeControl = tc
+	}
+	return cfg, nil
+}
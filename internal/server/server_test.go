@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"ctchen222/Tic-Tac-Toe/internal/api/models"
+	"ctchen222/Tic-Tac-Toe/internal/api/service"
+	"ctchen222/Tic-Tac-Toe/internal/player"
+	"ctchen222/Tic-Tac-Toe/pkg/proto"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// fakeAuthenticator accepts only the token "valid", issued to player "alice".
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) PlayerIDFromToken(ctx context.Context, token string) (string, error) {
+	if token != "valid" {
+		return "", errors.New("invalid token")
+	}
+	return "alice", nil
+}
+
+// fakeReplays has a single game, "game-1", with three positions.
+type fakeReplays struct{}
+
+func (fakeReplays) GetReplay(ctx context.Context, gameID string) (*models.Replay, error) {
+	if gameID != "game-1" {
+		return nil, service.ErrGameNotFound
+	}
+	frames := make([]proto.ServerToClientMessage, 3)
+	for i := range frames {
+		frames[i] = proto.ServerToClientMessage{Type: "update", Replay: &proto.ReplayState{GameID: gameID, Ply: i, Plies: 2}}
+	}
+	return &models.Replay{GameID: gameID, Frames: frames}, nil
+}
+
+// newTestServer starts a server without a hub and returns its WebSocket URL.
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	replayCtx, stopReplays := context.WithCancel(context.Background())
+	s := &Server{
+		engine:      gin.New(),
+		auth:        fakeAuthenticator{},
+		replays:     fakeReplays{},
+		upgrader:    websocket.Upgrader{Subprotocols: []string{Subprotocol}},
+		replayCtx:   replayCtx,
+		stopReplays: stopReplays,
+	}
+	s.engine.GET("/api/ws", s.handleWebSocket)
+	ts := httptest.NewServer(s.engine)
+	t.Cleanup(ts.Close)
+	t.Cleanup(stopReplays)
+	return s, "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/ws"
+}
+
+// dialTestServer connects to a server without a hub.
+func dialTestServer(t *testing.T, query string, header http.Header, protocols []string) *websocket.Conn {
+	t.Helper()
+	_, url := newTestServer(t)
+	return dial(t, url+query, header, protocols)
+}
+
+func dial(t *testing.T, url string, header http.Header, protocols []string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	conn, _, err := dialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Dial() returned error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// dialRejected connects to a server without a hub and returns the close code it
+// rejects the connection with.
+func dialRejected(t *testing.T, query string, header http.Header, protocols []string, first *proto.ClientToServerMessage) int {
+	t.Helper()
+	conn := dialTestServer(t, query, header, protocols)
+	if first != nil {
+		if err := conn.WriteJSON(first); err != nil {
+			t.Fatalf("WriteJSON() returned error: %v", err)
+		}
+	}
+
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("ReadMessage() returned %v, want a close error", err)
+	}
+	return closeErr.Code
+}
+
+func TestHandleWebSocketRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		header    http.Header
+		protocols []string
+		first     *proto.ClientToServerMessage
+		want      int
+	}{
+		{
+			name:   "invalid header token",
+			header: http.Header{"Authorization": {"Bearer forged"}},
+			want:   proto.CloseUnauthorized,
+		},
+		{
+			name:      "invalid subprotocol token",
+			protocols: []string{Subprotocol, bearerSubprotocolPrefix + "forged"},
+			want:      proto.CloseUnauthorized,
+		},
+		{
+			name:  "invalid auth message",
+			first: &proto.ClientToServerMessage{Type: "auth", Token: "forged"},
+			want:  proto.CloseUnauthorized,
+		},
+		{
+			name:  "move instead of auth message",
+			first: &proto.ClientToServerMessage{Type: "move", Position: []int{0, 0}},
+			want:  proto.CloseUnauthorized,
+		},
+		{
+			name:   "token of another player",
+			query:  "?playerId=mallory",
+			header: http.Header{"Authorization": {"Bearer valid"}},
+			want:   proto.CloseForbidden,
+		},
+		{
+			name:   "replay of an unknown game",
+			query:  "?replay=missing",
+			header: http.Header{"Authorization": {"Bearer valid"}},
+			want:   proto.CloseGameNotFound,
+		},
+		{
+			name:  "replay without a token",
+			query: "?replay=game-1",
+			first: &proto.ClientToServerMessage{Type: "auth", Token: "forged"},
+			want:  proto.CloseUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dialRejected(t, tt.query, tt.header, tt.protocols, tt.first); got != tt.want {
+				t.Errorf("close code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleWebSocketReplaysGames(t *testing.T) {
+	conn := dialTestServer(t, "?replay=game-1&speed=8", http.Header{"Authorization": {"Bearer valid"}}, nil)
+
+	read := func() proto.ServerToClientMessage {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg proto.ServerToClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("ReadJSON() returned error: %v", err)
+		}
+		return msg
+	}
+
+	// Playback starts at the empty board and plays through on its own.
+	for want := 0; want <= 2; want++ {
+		msg := read()
+		if msg.Type != "update" || msg.Replay == nil || msg.Replay.Ply != want || msg.Replay.Speed != 8 {
+			t.Fatalf("frame %d = %+v, want ply %d at speed 8", want, msg.Replay, want)
+		}
+	}
+
+	if err := conn.WriteJSON(proto.ClientToServerMessage{Type: "step", Steps: -1}); err != nil {
+		t.Fatalf("WriteJSON() returned error: %v", err)
+	}
+	if msg := read(); msg.Replay == nil || msg.Replay.Ply != 1 || msg.Replay.Playing {
+		t.Errorf("after stepping back got %+v, want ply 1 paused", msg.Replay)
+	}
+
+	if err := conn.WriteJSON(proto.ClientToServerMessage{Type: "seek"}); err != nil {
+		t.Fatalf("WriteJSON() returned error: %v", err)
+	}
+	if msg := read(); msg.Type != "error" || msg.Reason == "" {
+		t.Errorf("invalid seek got %+v, want an error", msg)
+	}
+}
+
+func TestReplayDropsClientsThatStopAnsweringPings(t *testing.T) {
+	defer func(interval time.Duration, missed int) {
+		player.HeartbeatInterval, player.MissedHeartbeats = interval, missed
+	}(player.HeartbeatInterval, player.MissedHeartbeats)
+	player.HeartbeatInterval, player.MissedHeartbeats = 20*time.Millisecond, 2
+
+	conn := dialTestServer(t, "?replay=game-1", http.Header{"Authorization": {"Bearer valid"}}, nil)
+	// The client has silently gone: it still reads, but never answers a ping.
+	conn.SetPingHandler(func(string) error { return nil })
+	if err := conn.WriteJSON(proto.ClientToServerMessage{Type: "pause"}); err != nil {
+		t.Fatalf("WriteJSON() returned error: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("paused replay kept the connection of a client that stopped answering pings")
+		}
+		return
+	}
+}
+
+func TestCloseReplaysTellsClientsToReconnect(t *testing.T) {
+	s, url := newTestServer(t)
+	header := http.Header{"Authorization": {"Bearer valid"}}
+	conn := dial(t, url+"?replay=game-1", header, nil)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("ReadMessage() returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	s.CloseReplays(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("CloseReplays() gave up with the replay still open")
+	}
+
+	for _, c := range []*websocket.Conn{conn, dial(t, url+"?replay=game-1", header, nil)} {
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var err error
+		for err == nil {
+			_, _, err = c.ReadMessage()
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseServiceRestart {
+			t.Errorf("ReadMessage() returned %v, want close code %d", err, websocket.CloseServiceRestart)
+		}
+	}
+}
@@ -1,20 +1,149 @@
 package proto
 
-import "ctchen222/Tic-Tac-Toe/internal/game"
+import (
+	"ctchen222/Tic-Tac-Toe/internal/game"
+	"time"
+)
+
+// WebSocket close codes sent when a connection is rejected.
+const (
+	// CloseUnauthorized means the token was missing, invalid or expired.
+	CloseUnauthorized = 4401
+	// CloseForbidden means the token doesn't belong to the requested player.
+	CloseForbidden = 4403
+	// CloseAuthTimeout means no auth message arrived in time.
+	CloseAuthTimeout = 4408
+	// CloseRoomNotFound means the room to spectate doesn't exist.
+	CloseRoomNotFound = 4404
+	// CloseRoomFull means the room to spectate has no room for more spectators.
+	CloseRoomFull = 4429
+	// CloseGameNotFound means the game to replay isn't in the archive.
+	CloseGameNotFound = 4404
+)
 
 // ClientToServerMessage represents a message from the client to the server.
 type ClientToServerMessage struct {
-	Type     string `json:"type" validate:"required"`
-	Position []int  `json:"position,omitempty"`
+	Type     string          `json:"type" validate:"required"`
+	Position []int           `json:"position,omitempty"`
+	Piece    game.PlayerMark `json:"piece,omitempty"`
+	// Token authenticates the connection in an "auth" message.
+	Token string `json:"token,omitempty"`
+	// Text is the text of a "chat" message.
+	Text string `json:"text,omitempty"`
+	// Emote is the name of the emote of an "emote" message.
+	Emote string `json:"emote,omitempty"`
+	// Mute mutes the opponent's chat in a "mute" message, or unmutes it when false.
+	Mute bool `json:"mute,omitempty"`
+	// Accept answers the opponent's request in a "takeback_response" message.
+	Accept bool `json:"accept,omitempty"`
+	// Ply is the position a replay jumps to in a "seek" message, 0 being the empty board.
+	Ply *int `json:"ply,omitempty"`
+	// Steps is how many moves a "step" message moves a replay, backwards when
+	// negative; zero steps forward by one.
+	Steps int `json:"steps,omitempty"`
+	// Speed is the playback speed set by a "speed" message, 1 being one move per second.
+	Speed float64 `json:"speed,omitempty"`
 }
 
 // ServerToClientMessage represents a message from the server to the client.
 type ServerToClientMessage struct {
-	Type   string              `json:"type" validate:"required"`
-	Reason string              `json:"reason,omitempty"`
-	Board  [][]game.PlayerMark `json:"board,omitempty"`
-	Next   game.PlayerMark     `json:"next,omitempty"`
-	Winner game.PlayerMark     `json:"winner,omitempty"`
+	Type      string              `json:"type" validate:"required"`
+	Reason    string              `json:"reason,omitempty"`
+	Variant   string              `json:"variant,omitempty"`
+	Board     [][]game.PlayerMark `json:"board,omitempty"`
+	Size      int                 `json:"size,omitempty"`
+	WinLength int                 `json:"winLength,omitempty"`
+	Next      game.PlayerMark     `json:"next,omitempty"`
+	Winner    game.PlayerMark     `json:"winner,omitempty"`
+	LastMove  *game.Move          `json:"lastMove,omitempty"`
+	// Termination is how the game ended, sent once it is over.
+	Termination game.Termination `json:"termination,omitempty"`
+	// Spectators is the number of spectators watching the game.
+	Spectators int `json:"spectators,omitempty"`
+	// TimeControl is the game's time control, e.g. "60+2", and Clocks the
+	// milliseconds each mark has left when the update was sent. Both are absent
+	// for untimed games.
+	TimeControl string                    `json:"timeControl,omitempty"`
+	Clocks      map[game.PlayerMark]int64 `json:"clocks,omitempty"`
+
+	// MacroBoard and ForcedBoard are only sent for ultimate games. A missing
+	// ForcedBoard means the next move may go to any open small board.
+	MacroBoard  [][]game.PlayerMark `json:"macroBoard,omitempty"`
+	ForcedBoard []int               `json:"forcedBoard,omitempty"`
+
+	// From is the player who asked to take back a move in the "takeback_request",
+	// "takeback_accepted" and "takeback_declined" messages, and who offered a
+	// draw in the "draw_offer" and "draw_declined" messages.
+	From string `json:"from,omitempty"`
+
+	// RTT is the round-trip time of the player's last answered ping in
+	// milliseconds, sent in "latency" messages.
+	RTT int64 `json:"rttMs,omitempty"`
+
+	// ReconnectAfter is how many milliseconds a client told the server is
+	// draining should wait after its connection closes before reconnecting,
+	// sent in "server_draining" messages. The game resumes on another server.
+	ReconnectAfter int64 `json:"reconnectAfterMs,omitempty"`
+
+	// Messages is the chat history replayed in a "chat_history" message.
+	Messages []ChatEntry `json:"messages,omitempty"`
+
+	// Replay is set on the "update" messages of a replay.
+	Replay *ReplayState `json:"replay,omitempty"`
+}
+
+// ReplayState is the position of an "update" message within a replay.
+type ReplayState struct {
+	GameID string `json:"gameId"`
+	// Ply is the number of moves played on the board, out of Plies.
+	Ply   int `json:"ply"`
+	Plies int `json:"plies"`
+	// PlayedAt is when the last move was played, in Unix milliseconds.
+	PlayedAt int64 `json:"playedAt,omitempty"`
+	// Proxy is set when the last move was played by the server for a player who timed out.
+	Proxy bool `json:"proxy,omitempty"`
+	// Playing and Speed are only sent over WebSocket replays.
+	Playing bool    `json:"playing,omitempty"`
+	Speed   float64 `json:"speed,omitempty"`
+}
+
+// NewUpdateMessage builds the "update" message sent to clients for a game state.
+func NewUpdateMessage(state *game.GameStateDTO) *ServerToClientMessage {
+	msg := &ServerToClientMessage{
+		Type:       "update",
+		Variant:    state.Variant,
+		Board:      game.BoardArrayToSlice(state.Board),
+		Size:       state.Board.Size(),
+		WinLength:  state.Board.WinLength,
+		Next:       state.CurrentTurn,
+		Winner:     state.Winner,
+		LastMove:   state.LastMove,
+		Spectators: state.Spectators,
+
+		Termination: state.Termination,
+
+		MacroBoard:  state.MacroBoard,
+		ForcedBoard: state.ForcedBoard,
+	}
+	if !state.TimeControl.IsZero() {
+		now := time.Now()
+		msg.TimeControl = state.TimeControl.String()
+		msg.Clocks = map[game.PlayerMark]int64{
+			game.PlayerX: state.TimeLeft(game.PlayerX, now).Milliseconds(),
+			game.PlayerO: state.TimeLeft(game.PlayerO, now).Milliseconds(),
+		}
+	}
+	return msg
+}
+
+// ChatEntry is a "chat" or "emote" message sent by a player to their room.
+type ChatEntry struct {
+	Type  string `json:"type"`
+	From  string `json:"from"`
+	Text  string `json:"text,omitempty"`
+	Emote string `json:"emote,omitempty"`
+	// SentAt is the time the message was sent, in Unix milliseconds.
+	SentAt int64 `json:"sentAt"`
 }
 
 // PlayerAssignmentMessage informs a player of their assigned mark.